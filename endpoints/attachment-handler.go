@@ -0,0 +1,411 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/blob"
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/thumbnails"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// uploadTimeout replaces the usual request timeout, as uploading a large file takes a while.
+	uploadTimeout  = 5 * time.Minute
+	uploadField    = "file"
+	maxFilenameLen = 255
+	// multipartOverhead is what the request may carry on top of the file: part headers and other form fields.
+	multipartOverhead = 1 << 20
+)
+
+// inlineTypes are the content types browsers may display instead of downloading. Anything else, SVG images included,
+// could run script in the context of the service and is always served as a download.
+var inlineTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// cleanFilename keeps the base name of an uploaded file, without control characters, so that it is safe to echo back
+// in a Content-Disposition header.
+func cleanFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > maxFilenameLen {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		name = strings.ToValidUTF8(name[:maxFilenameLen-len(ext)], "") + ext
+	}
+	return name
+}
+
+// sniffContentType works out the content type from the first bytes of a file rather than trusting the client, and
+// rewinds the file.
+func sniffContentType(file io.ReadSeeker) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// receiveFile spools the "file" field of a multipart form to a temporary file, rewound to its start, so that its size
+// can be enforced before it goes anywhere else. It writes an error response and returns false if the file is missing,
+// empty or larger than limit, calling tooLarge to respond to the latter. The caller removes the file.
+func (s Server) receiveFile(c *gin.Context, limit int64, tooLarge func()) (*os.File, string, int64, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a multipart/form-data body is required"})
+		return nil, "", 0, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				tooLarge()
+				return nil, "", 0, false
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the file must be sent in the \"file\" field"})
+			return nil, "", 0, false
+		}
+		if part.FormName() != uploadField {
+			part.Close()
+			continue
+		}
+
+		tmp, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			s.logger.Error("unable to create temporary file", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process upload"})
+			return nil, "", 0, false
+		}
+		discard := func() {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+
+		size, err := io.Copy(tmp, io.LimitReader(part, limit+1))
+		if err != nil {
+			discard()
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				tooLarge()
+				return nil, "", 0, false
+			}
+			s.logger.Warn("unable to read upload", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return nil, "", 0, false
+		}
+		if size > limit {
+			discard()
+			tooLarge()
+			return nil, "", 0, false
+		}
+		if size == 0 {
+			discard()
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "the file is empty"})
+			return nil, "", 0, false
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			discard()
+			s.logger.Error("unable to rewind upload", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process upload"})
+			return nil, "", 0, false
+		}
+		return tmp, part.FileName(), size, true
+	}
+}
+
+// attachmentFailed maps an attachment datastore error onto the matching HTTP response.
+func (s Server) attachmentFailed(c *gin.Context, userID, noteID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNoteNoteFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+	case errors.Is(err, datastore.ErrAttachmentNotFound), errors.Is(err, blob.ErrNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "attachment not found"})
+	case errors.Is(err, datastore.ErrQuotaExceeded):
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "storage quota exceeded"})
+	default:
+		s.logger.Error("attachment request failed", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process attachment"})
+	}
+}
+
+// attachmentRequest reads the caller and the note an attachment request is about and checks the caller holds the
+// needed permission on the note, writing an error response and returning false otherwise.
+func (s Server) attachmentRequest(ctx context.Context, c *gin.Context, need string) (userID, noteID string, ok bool) {
+	userID = userId(c)
+	if userID == "" {
+		s.logger.Warn("missing user ID in context")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", false
+	}
+
+	noteID = c.Param("noteId")
+	if noteID == "" {
+		s.logger.Warn("missing note ID in request URL")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+		return "", "", false
+	}
+
+	if _, ok := s.authorizeNote(ctx, c, userID, noteID, need); !ok {
+		return "", "", false
+	}
+
+	return userID, noteID, true
+}
+
+// UploadAttachment attaches the file sent as the "file" field of a multipart form to a note. The file is spooled to
+// a temporary file to enforce the size limit, sniff its content type and remove the location from JPEG photos before
+// it is stored.
+func (s Server) UploadAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), uploadTimeout)
+		defer cancel()
+
+		userID, noteID, ok := s.attachmentRequest(ctx, c, types.PermissionEditor)
+		if !ok {
+			return
+		}
+
+		used, err := s.Attachments.GetStorageUsage(ctx, userID)
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+		if used >= s.Cfg.StorageQuota {
+			metrics.CountAttachmentUploadsTotal.WithLabelValues("quota_exceeded").Inc()
+			s.attachmentFailed(c, userID, noteID, datastore.ErrQuotaExceeded)
+			return
+		}
+
+		tmp, filename, size, ok := s.receiveFile(c, s.Cfg.MaxAttachmentSize, func() {
+			metrics.CountAttachmentUploadsTotal.WithLabelValues("too_large").Inc()
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("attachments cannot exceed %d bytes", s.Cfg.MaxAttachmentSize)})
+		})
+		if !ok {
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		contentType, err := sniffContentType(tmp)
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		// The location is removed before the photo is stored, so that it is never served with it.
+		if s.Cfg.StripImageLocation && contentType == "image/jpeg" {
+			if _, err := thumbnails.StripJPEGFileLocation(tmp); err != nil {
+				metrics.CountAttachmentUploadsTotal.WithLabelValues("error").Inc()
+				s.attachmentFailed(c, userID, noteID, fmt.Errorf("unable to remove location from image: %w", err))
+				return
+			}
+		}
+
+		attachment := types.Attachment{
+			Filename:    cleanFilename(filename),
+			ContentType: contentType,
+			Size:        size,
+			StorageKey:  "attachments/" + uuid.NewString(),
+		}
+		if err := s.Blobs.Put(ctx, attachment.StorageKey, tmp, size, contentType); err != nil {
+			metrics.CountAttachmentUploadsTotal.WithLabelValues("error").Inc()
+			s.attachmentFailed(c, userID, noteID, fmt.Errorf("unable to store attachment: %w", err))
+			return
+		}
+
+		created, err := s.Attachments.AddAttachment(ctx, userID, noteID, attachment, s.Cfg.StorageQuota)
+		if err != nil {
+			if err := s.Blobs.Delete(context.WithoutCancel(ctx), attachment.StorageKey); err != nil {
+				s.logger.Warn("unable to remove unused blob", zap.String("key", attachment.StorageKey), zap.Error(err))
+			}
+			outcome := "error"
+			if errors.Is(err, datastore.ErrQuotaExceeded) {
+				outcome = "quota_exceeded"
+			}
+			metrics.CountAttachmentUploadsTotal.WithLabelValues(outcome).Inc()
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		metrics.CountAttachmentUploadsTotal.WithLabelValues("stored").Inc()
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) GetAttachments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.attachmentRequest(ctx, c, types.PermissionViewer)
+		if !ok {
+			return
+		}
+
+		attachments, err := s.Attachments.GetAttachments(ctx, userID, noteID)
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, attachments)
+	}
+}
+
+// DownloadAttachment streams the contents of an attachment, honouring Range requests. Only images are shown inline;
+// everything else is sent as a download.
+func (s Server) DownloadAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.attachmentRequest(ctx, c, types.PermissionViewer)
+		if !ok {
+			return
+		}
+
+		attachment, err := s.Attachments.GetAttachment(ctx, userID, noteID, c.Param("attachmentId"))
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		// The contents are streamed for as long as the client keeps reading, so only the lookups are timed out.
+		content, err := s.Blobs.Open(c.Request.Context(), attachment.StorageKey)
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+		defer content.Close()
+
+		disposition := "attachment"
+		if inlineTypes[attachment.ContentType] {
+			disposition = "inline"
+		}
+
+		c.Header("Content-Type", attachment.ContentType)
+		c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+		c.Header("Cache-Control", "private, no-cache")
+		http.ServeContent(c.Writer, c.Request, attachment.Filename, attachment.CreatedAt, content)
+	}
+}
+
+// GetThumbnail serves the thumbnail of an image attachment once it has been made.
+func (s Server) GetThumbnail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.attachmentRequest(ctx, c, types.PermissionViewer)
+		if !ok {
+			return
+		}
+
+		attachment, err := s.Attachments.GetAttachment(ctx, userID, noteID, c.Param("attachmentId"))
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		if attachment.ThumbnailStatus == nil || *attachment.ThumbnailStatus != types.ThumbnailReady || attachment.ThumbnailKey == nil || attachment.ThumbnailContentType == nil {
+			status := "not available"
+			if attachment.ThumbnailStatus != nil && *attachment.ThumbnailStatus == types.ThumbnailPending {
+				status = "not ready yet"
+			}
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "thumbnail " + status})
+			return
+		}
+
+		content, err := s.Blobs.Open(c.Request.Context(), *attachment.ThumbnailKey)
+		if err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+		defer content.Close()
+
+		c.Header("Content-Type", *attachment.ThumbnailContentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+		c.Header("Cache-Control", "private, max-age=86400")
+		http.ServeContent(c.Writer, c.Request, "", attachment.CreatedAt, content)
+	}
+}
+
+func (s Server) DeleteAttachment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.attachmentRequest(ctx, c, types.PermissionEditor)
+		if !ok {
+			return
+		}
+
+		if err := s.Attachments.DeleteAttachment(ctx, userID, noteID, c.Param("attachmentId")); err != nil {
+			s.attachmentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetStorageUsage reports how much of their storage quota the caller has used.
+func (s Server) GetStorageUsage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		used, err := s.Attachments.GetStorageUsage(ctx, userID)
+		if err != nil {
+			s.attachmentFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.StorageUsage{Used: used, Quota: s.Cfg.StorageQuota})
+	}
+}
@@ -0,0 +1,256 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxItemTextLen = 1000
+
+// checklistRequest reads the caller and the note (and item, if the route has one) a checklist request is about,
+// writing an error response and returning false if any of them is missing or the caller may not edit the note.
+func (s Server) checklistRequest(ctx context.Context, c *gin.Context) (userID, noteID, itemID string, ok bool) {
+	userID = userId(c)
+	if userID == "" {
+		s.logger.Warn("missing user ID in context")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", "", false
+	}
+
+	noteID = c.Param("noteId")
+	if noteID == "" {
+		s.logger.Warn("missing note ID in request URL")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+		return "", "", "", false
+	}
+
+	if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionEditor); !ok {
+		return "", "", "", false
+	}
+
+	return userID, noteID, c.Param("itemId"), true
+}
+
+// checklistFailed maps a checklist datastore error onto the matching HTTP response.
+func (s Server) checklistFailed(c *gin.Context, userID, noteID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNoteNoteFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+	case errors.Is(err, datastore.ErrPermissionDenied):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to edit this note"})
+	case errors.Is(err, datastore.ErrItemNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "checklist item not found"})
+	case errors.Is(err, datastore.ErrNotChecklist):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "note is not a checklist"})
+	case errors.Is(err, datastore.ErrInvalidItemOrder):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "itemIds must list every item of the checklist exactly once"})
+	case errors.Is(err, datastore.ErrContentTooLong):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "the checklist is too long to convert to text, remove some items first"})
+	case errors.Is(err, datastore.ErrUnsupportedNoteKind):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "kind must be text or checklist"})
+	default:
+		s.logger.Error("checklist request failed", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update checklist"})
+	}
+}
+
+// validateItem trims and sanitizes the text of an item, writing an error response and returning false if it is invalid.
+func validateItem(c *gin.Context, item *types.ChecklistItemDto) bool {
+	if item.Text != nil {
+		text := strings.TrimSpace(*item.Text)
+		if text == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "text cannot be empty"})
+			return false
+		}
+		if len(text) > maxItemTextLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("text length cannot exceed %d characters", maxItemTextLen)})
+			return false
+		}
+		text = sanitizeInput(text)
+		item.Text = &text
+	}
+
+	if item.Position != nil && *item.Position < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "position must be non-negative"})
+		return false
+	}
+
+	return true
+}
+
+func (s Server) AddChecklistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, _, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var item types.ChecklistItemDto
+		if err := c.BindJSON(&item); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if item.Text == nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "text is required"})
+			return
+		}
+		if !validateItem(c, &item) {
+			return
+		}
+
+		created, err := s.Checklists.AddChecklistItem(ctx, userID, noteID, item)
+		if err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) UpdateChecklistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, itemID, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var item types.ChecklistItemDto
+		if err := c.BindJSON(&item); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if !validateItem(c, &item) {
+			return
+		}
+
+		updated, err := s.Checklists.UpdateChecklistItem(ctx, userID, noteID, itemID, item)
+		if err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (s Server) ToggleChecklistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, itemID, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		item, err := s.Checklists.ToggleChecklistItem(ctx, userID, noteID, itemID)
+		if err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+func (s Server) ReorderChecklistItems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, _, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var order types.ChecklistOrderDto
+		if err := c.ShouldBindJSON(&order); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		items, err := s.Checklists.ReorderChecklistItems(ctx, userID, noteID, order.ItemIds)
+		if err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+func (s Server) RemoveChecklistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, itemID, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		if err := s.Checklists.RemoveChecklistItem(ctx, userID, noteID, itemID); err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ConvertNote turns a text note into a checklist (one item per line) or a checklist back into text.
+func (s Server) ConvertNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, _, ok := s.checklistRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var convert types.ConvertNoteDto
+		if err := c.ShouldBindJSON(&convert); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		note, err := s.Checklists.ConvertNote(ctx, userID, noteID, convert.Kind)
+		if err != nil {
+			s.checklistFailed(c, userID, noteID, err)
+			return
+		}
+
+		if note.Kind == types.NoteKindChecklist {
+			note.Items, err = s.Checklists.GetChecklistItems(ctx, userID, noteID)
+			if err != nil {
+				s.checklistFailed(c, userID, noteID, err)
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/collab"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// maxRevisions is how many of the latest revisions of a note are listed.
+const maxRevisions = 50
+
+// upgrader only accepts handshakes from pages served at the public base URL of the service, or from clients that
+// are not browsers.
+func (s Server) upgrader() websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     collab.CheckOrigin(s.Cfg.PublicBaseURL),
+	}
+}
+
+// EditNote upgrades the request to a WebSocket through which the content of a note is edited together with everyone
+// else editing it. Viewers see the changes and cursors of the others, but cannot make changes themselves.
+func (s Server) EditNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The connection stays open for as long as the client wants, so only the authorization is given a timeout.
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		note, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionViewer)
+		if !ok {
+			return
+		}
+		if note.Kind == types.NoteKindChecklist {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "checklist notes are edited through their items"})
+			return
+		}
+
+		upgrader := s.upgrader()
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has already replied to the client.
+			s.logger.Warn("failed to upgrade connection", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			return
+		}
+
+		s.Collab.Serve(conn, noteID, userID, types.PermissionAllows(note.Permission, types.PermissionEditor))
+	}
+}
+
+// GetNoteRevisions lists the latest revisions saved by collaborative editing of a note, newest first.
+func (s Server) GetNoteRevisions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionViewer); !ok {
+			return
+		}
+
+		revisions, err := s.Revisions.GetNoteRevisions(ctx, userID, noteID, maxRevisions)
+		if err != nil {
+			s.logger.Error("failed to get note revisions", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve revisions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, revisions)
+	}
+}
@@ -0,0 +1,321 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxCommentLen = 5000
+	// maxMentions bounds the user lookups a single comment can cause.
+	maxMentions = 20
+)
+
+// mentionPattern matches @username when it starts a word, so that email addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]+)`)
+
+// parseMentions returns the distinct usernames mentioned in a comment, in the order they first appear.
+func parseMentions(body string) []string {
+	var usernames []string
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		username := strings.TrimRight(match[1], ".-")
+		if username == "" || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// resolveMentions looks up the users mentioned in a comment. Unknown usernames and the author are ignored.
+func (s Server) resolveMentions(ctx context.Context, userID, body string) ([]types.MentionedUser, error) {
+	var mentions []types.MentionedUser
+	for _, username := range parseMentions(body) {
+		if len(mentions) == maxMentions {
+			break
+		}
+
+		user, err := s.Users.GetUserByUsername(ctx, username)
+		if err != nil {
+			return nil, fmt.Errorf("unable to look up mentioned user %q: %w", username, err)
+		}
+		if user == nil || user.UserId == userID {
+			continue
+		}
+		mentions = append(mentions, types.MentionedUser{UserId: user.UserId, Username: user.Username})
+	}
+	return mentions, nil
+}
+
+// validateComment trims and sanitizes the body of a comment, writing an error response and returning false if it is
+// invalid.
+func validateComment(c *gin.Context, body *string) bool {
+	text := strings.TrimSpace(*body)
+	if text == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "body cannot be empty"})
+		return false
+	}
+	if len(text) > maxCommentLen {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("body length cannot exceed %d characters", maxCommentLen)})
+		return false
+	}
+	*body = sanitizeInput(text)
+	return true
+}
+
+// commentFailed maps a comment datastore error onto the matching HTTP response.
+func (s Server) commentFailed(c *gin.Context, userID, noteID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNoteNoteFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+	case errors.Is(err, datastore.ErrCommentNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "comment not found"})
+	case errors.Is(err, datastore.ErrMentionNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "mention not found"})
+	case errors.Is(err, datastore.ErrPermissionDenied):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to change this comment"})
+	case errors.Is(err, datastore.ErrNotThread):
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "only top-level comments can be resolved"})
+	default:
+		s.logger.Error("comment request failed", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process comment"})
+	}
+}
+
+// commentRequest reads the caller and the note a comment request is about and checks the caller can see the note,
+// writing an error response and returning false otherwise.
+func (s Server) commentRequest(ctx context.Context, c *gin.Context) (userID, noteID string, ok bool) {
+	userID = userId(c)
+	if userID == "" {
+		s.logger.Warn("missing user ID in context")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", false
+	}
+
+	noteID = c.Param("noteId")
+	if noteID == "" {
+		s.logger.Warn("missing note ID in request URL")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+		return "", "", false
+	}
+
+	if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionViewer); !ok {
+		return "", "", false
+	}
+
+	return userID, noteID, true
+}
+
+func (s Server) GetComments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.commentRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		comments, err := s.Comments.GetComments(ctx, userID, noteID)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, comments)
+	}
+}
+
+// AddComment comments on a note, or replies to a comment when parentId is given. Users mentioned with @username are
+// told about it through their mentions inbox.
+func (s Server) AddComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.commentRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var comment types.CommentDto
+		if err := c.ShouldBindJSON(&comment); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !validateComment(c, &comment.Body) {
+			return
+		}
+
+		mentions, err := s.resolveMentions(ctx, userID, comment.Body)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		created, err := s.Comments.AddComment(ctx, userID, noteID, comment, mentions)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) UpdateComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.commentRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var comment types.CommentDto
+		if err := c.ShouldBindJSON(&comment); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if comment.ParentId != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a comment cannot be moved to another thread"})
+			return
+		}
+		if !validateComment(c, &comment.Body) {
+			return
+		}
+
+		mentions, err := s.resolveMentions(ctx, userID, comment.Body)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		updated, err := s.Comments.UpdateComment(ctx, userID, noteID, c.Param("commentId"), comment.Body, mentions)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (s Server) DeleteComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.commentRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		if err := s.Comments.DeleteComment(ctx, userID, noteID, c.Param("commentId")); err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ResolveComment resolves a comment thread with {"resolved": true}, or reopens it with {"resolved": false}.
+func (s Server) ResolveComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, noteID, ok := s.commentRequest(ctx, c)
+		if !ok {
+			return
+		}
+
+		var resolve types.ResolveCommentDto
+		if err := c.ShouldBindJSON(&resolve); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		comment, err := s.Comments.ResolveComment(ctx, userID, noteID, c.Param("commentId"), *resolve.Resolved)
+		if err != nil {
+			s.commentFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, comment)
+	}
+}
+
+// GetMentions is the mentions inbox of the caller, newest first. Pass unread=true to only list unread mentions.
+func (s Server) GetMentions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		limit, offset, err := parsePagination(c)
+		if err != nil {
+			s.logger.Warn("invalid pagination params", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid pagination parameters"})
+			return
+		}
+
+		mentions, totalCount, err := s.Comments.GetMentions(ctx, userID, c.DefaultQuery("unread", "false") == "true", limit, offset)
+		if err != nil {
+			s.commentFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.MentionsResponse{
+			Mentions:      mentions,
+			Offset:        offset,
+			Limit:         limit,
+			TotalMentions: totalCount,
+			HasMore:       offset+len(mentions) < totalCount,
+		})
+	}
+}
+
+func (s Server) MarkMentionRead() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if err := s.Comments.MarkMentionRead(ctx, userID, c.Param("commentId")); err != nil {
+			s.commentFailed(c, userID, "", err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
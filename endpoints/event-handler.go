@@ -0,0 +1,132 @@
+package endpoints
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventBatchSize is how many events are read from the log at a time.
+	eventBatchSize = 100
+	// eventKeepAlive is how often an idle stream sends a comment, so that proxies do not time it out.
+	eventKeepAlive = 15 * time.Second
+	// eventRetry is how long clients are told to wait before reconnecting, in milliseconds.
+	eventRetry = 3000
+)
+
+// StreamEvents streams the changes to the notes the caller can read as Server-Sent Events, as they happen. Each event
+// is named after what happened (note.created, note.updated, note.archived or note.deleted) and carries the note. A
+// client that reconnects with the Last-Event-ID header, or ?lastEventId=, is sent the events it missed; when they are
+// no longer in the log it is sent a reset event instead, after which it should fetch its notes again.
+func (s Server) StreamEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The stream stays open for as long as the client wants, so only the database calls are given a timeout.
+		ctx := c.Request.Context()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		lastEventID := c.GetHeader("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = c.Query("lastEventId")
+		}
+
+		// Subscribing before reading the log means that no event committed in between is missed.
+		wake, unsubscribe := s.Events.Subscribe(userID)
+		defer unsubscribe()
+
+		var after int64
+		if lastEventID != "" {
+			id, err := strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil || id < 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid last event ID"})
+				return
+			}
+			after = id
+		} else {
+			latestCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			latest, err := s.NoteEvents.GetLatestNoteEventID(latestCtx)
+			cancel()
+			if err != nil {
+				s.logger.Error("unable to start event stream", zap.String("userID", userID), zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to start event stream"})
+				return
+			}
+			after = latest
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Render(-1, sse.Event{Retry: eventRetry})
+		c.Writer.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		c.Stream(func(w io.Writer) bool {
+			readCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			events, complete, err := s.NoteEvents.GetNoteEvents(readCtx, userID, after, eventBatchSize)
+			cancel()
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("unable to read events", zap.String("userID", userID), zap.Error(err))
+				}
+				return false
+			}
+
+			if !complete {
+				// The client fetches its notes afresh, so the stream carries on from the latest event.
+				latestCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				latest, err := s.NoteEvents.GetLatestNoteEventID(latestCtx)
+				cancel()
+				if err != nil {
+					if ctx.Err() == nil {
+						s.logger.Error("unable to reset event stream", zap.String("userID", userID), zap.Error(err))
+					}
+					return false
+				}
+				after = latest
+				c.Render(-1, sse.Event{Id: strconv.FormatInt(after, 10), Event: "reset", Data: gin.H{"reason": "missed events are no longer available"}})
+				return true
+			}
+
+			for _, event := range events {
+				c.Render(-1, sse.Event{Id: event.ID, Event: event.Event, Data: event})
+				after, _ = strconv.ParseInt(event.ID, 10, 64)
+			}
+			if len(events) == eventBatchSize {
+				// More are waiting in the log.
+				return true
+			}
+			if len(events) > 0 {
+				c.Writer.Flush()
+			}
+
+			select {
+			case <-ctx.Done():
+				return false
+			case <-wake:
+			case <-keepAlive.C:
+				// Events held back by older transactions when the stream was woken are read on the way round.
+				if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+					return false
+				}
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/export"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// exportTimeout bounds a whole export. It is much longer than for other requests, as the notes are streamed to the
+// client while they are read, which holds a database connection for as long as the export runs.
+const exportTimeout = 5 * time.Minute
+
+// exportWriteTimeout bounds the time taken to send each note, so that a client that stops reading does not hold the
+// database connection until exportTimeout.
+const exportWriteTimeout = 30 * time.Second
+
+// ExportNotes downloads the notes of the caller, or of the selected workspace, in the format given by ?format=: jsonl
+// (the default), markdown for a ZIP archive of Markdown files, or html for a single page. It takes the same filters as
+// GetNotes, without pagination.
+func (s Server) ExportNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), exportTimeout)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		workspaceID, ok := s.selectedWorkspace(ctx, c, userID)
+		if !ok {
+			return
+		}
+
+		filter, ok := s.noteFilter(c, userID, workspaceID)
+		if !ok {
+			return
+		}
+
+		writer, contentType, extension, err := export.New(c.DefaultQuery("format", types.ExportJSONLines), c.Writer)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be jsonl, markdown or html"})
+			return
+		}
+
+		filename := fmt.Sprintf("notes-%s.%s", time.Now().UTC().Format("20060102"), extension)
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Status(http.StatusOK)
+
+		rc := http.NewResponseController(c.Writer)
+		write := func(note types.ExportedNote) error {
+			if err := rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+				return err
+			}
+			return writer.Write(note)
+		}
+
+		if err := s.Exports.ExportNotes(ctx, userID, filter, write); err != nil {
+			s.logger.Error("export failed", zap.String("userID", userID), zap.Error(err))
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to export notes"})
+				return
+			}
+			// Once the export has started streaming the status can no longer change, so the connection is closed
+			// before the response ends for the client to see the download fail rather than end silently incomplete.
+			// gin recovers from every panic, http.ErrAbortHandler included, so the connection is closed directly.
+			c.Abort()
+			if conn, _, err := rc.Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+
+		if err := writer.Close(); err != nil {
+			s.logger.Error("unable to finish export", zap.String("userID", userID), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/imports"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// importFailed maps an import datastore error onto the matching HTTP response.
+func (s Server) importFailed(c *gin.Context, userID, importID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrImportNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "import not found"})
+	case errors.Is(err, datastore.ErrPermissionDenied):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to create notes in this workspace"})
+	default:
+		s.logger.Error("import request failed", zap.String("userID", userID), zap.String("importID", importID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process import"})
+	}
+}
+
+// ImportNotes queues the file sent as the "file" field of a multipart form for import into the personal notes of the
+// caller, or into the selected workspace. The kind of file is given by ?source= (markdown, keep or enex) or else
+// worked out from the file. The import runs in the background; its progress is read from GetImport.
+func (s Server) ImportNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), uploadTimeout)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		workspaceID, ok := s.selectedWorkspace(ctx, c, userID)
+		if !ok {
+			return
+		}
+
+		source := c.Query("source")
+		switch source {
+		case "", types.ImportMarkdown, types.ImportKeep, types.ImportEvernote:
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "source must be markdown, keep or enex"})
+			return
+		}
+
+		tmp, filename, size, ok := s.receiveFile(c, s.Cfg.MaxImportSize, func() {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("imports cannot exceed %d bytes", s.Cfg.MaxImportSize)})
+		})
+		if !ok {
+			return
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if source == "" {
+			detected, err := imports.Detect(filename, tmp, size)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unable to tell what the file was exported from, set source to markdown, keep or enex"})
+				return
+			}
+			source = detected
+		}
+
+		// Reading the file once upfront rejects broken files straight away rather than in the background.
+		if _, err := imports.NewReader(source, tmp, size); err != nil {
+			s.logger.Warn("unreadable import", zap.String("userID", userID), zap.String("source", source), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the file is not a valid %s export", source)})
+			return
+		}
+
+		imp := types.Import{
+			Source:     source,
+			Filename:   cleanFilename(filename),
+			Size:       size,
+			StorageKey: "imports/" + uuid.NewString(),
+		}
+		if workspaceID != "" {
+			imp.WorkspaceId = &workspaceID
+		}
+
+		if err := s.Blobs.Put(ctx, imp.StorageKey, tmp, size, "application/octet-stream"); err != nil {
+			s.importFailed(c, userID, "", fmt.Errorf("unable to store import: %w", err))
+			return
+		}
+
+		created, err := s.Imports.CreateImport(ctx, userID, imp)
+		if err != nil {
+			if err := s.Blobs.Delete(context.WithoutCancel(ctx), imp.StorageKey); err != nil {
+				s.logger.Warn("unable to remove unused blob", zap.String("key", imp.StorageKey), zap.Error(err))
+			}
+			s.importFailed(c, userID, "", err)
+			return
+		}
+
+		c.Header("Location", "/imports/"+created.ID)
+		c.JSON(http.StatusAccepted, created)
+	}
+}
+
+// GetImport reports on an import: its status, how many of its items have been dealt with so far, and the items that
+// were skipped or could not be imported.
+func (s Server) GetImport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		importID := c.Param("importId")
+		imp, err := s.Imports.GetImport(ctx, userID, importID)
+		if err != nil {
+			s.importFailed(c, userID, importID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, imp)
+	}
+}
@@ -0,0 +1,78 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// jobFailed maps a job datastore error onto the matching HTTP response.
+func (s Server) jobFailed(c *gin.Context, userID, jobID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrJobNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "job not found"})
+	case errors.Is(err, datastore.ErrJobFinished):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "job has already finished"})
+	default:
+		s.logger.Error("job request failed", zap.String("userID", userID), zap.String("jobID", jobID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process job"})
+	}
+}
+
+// GetJob reports on a background job the caller started: its status, progress and, once it has failed, why.
+func (s Server) GetJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		jobID := c.Param("jobId")
+		job, err := s.Jobs.GetJob(ctx, userID, jobID)
+		if err != nil {
+			s.jobFailed(c, userID, jobID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelJob cancels a background job the caller started. A queued job is cancelled straight away; a running job is
+// stopped by its worker shortly after, until which the job keeps its status with cancelRequested set.
+func (s Server) CancelJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		jobID := c.Param("jobId")
+		job, err := s.Jobs.CancelJob(ctx, userID, jobID)
+		if err != nil {
+			s.jobFailed(c, userID, jobID, err)
+			return
+		}
+
+		status := http.StatusOK
+		if !job.IsFinished() {
+			status = http.StatusAccepted
+		}
+		c.JSON(status, job)
+	}
+}
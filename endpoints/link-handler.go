@@ -0,0 +1,420 @@
+package endpoints
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/ratelimit"
+	"github.com/RogueAlmond70/code-review-challenge/internal/render"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	linkTokenBytes      = 32
+	maxLinkViews        = 1000000
+	maxLinkPasswordLen  = 72 // bcrypt ignores anything longer
+	linkPasswordHeader  = "X-Link-Password"
+	maxLinkPasswordBody = 4 << 10
+	// Password attempts are limited per client address and per link, as each one is checked with bcrypt, and as a
+	// link is guessed at from many addresses.
+	linkAttemptsPerIP   = 10
+	linkAttemptsPerLink = 30
+	linkAttemptWindow   = time.Minute
+)
+
+// linkAttempts counts the password attempts at protected links.
+type linkAttempts struct {
+	perIP   *ratelimit.Limiter
+	perLink *ratelimit.Limiter
+}
+
+func newLinkAttempts() *linkAttempts {
+	return &linkAttempts{
+		perIP:   ratelimit.New(linkAttemptsPerIP, linkAttemptWindow),
+		perLink: ratelimit.New(linkAttemptsPerLink, linkAttemptWindow),
+	}
+}
+
+// allow records a password attempt at a link from a client address, returning how long the client has to wait when it
+// has made too many.
+func (a *linkAttempts) allow(ip, linkId string) (bool, time.Duration) {
+	if ok, wait := a.perIP.Allow(ip); !ok {
+		return false, wait
+	}
+	return a.perLink.Allow(linkId)
+}
+
+var sharedNotePage = template.Must(template.New("note").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Title}}</title>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Items}}<ul>
+{{range .Items}}<li><input type="checkbox" disabled{{if .Checked}} checked{{end}}> {{.Text}}</li>
+{{end}}</ul>
+{{else}}{{.Body}}
+{{end}}</body>
+</html>
+`))
+
+// linkPasswordPage asks a browser for the password of a protected link, posting it back to the same URL so that it
+// never ends up in the address bar or in logs.
+var linkPasswordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<form method="post" action="?format=html">
+{{if .}}<p>The password is not correct.</p>
+{{end}}<label>Password <input type="password" name="password" autofocus></label>
+<button type="submit">View note</button>
+</form>
+</body>
+</html>
+`))
+
+// sharedNoteView is what the HTML page of a shared note is rendered from.
+type sharedNoteView struct {
+	types.SharedNote
+	Body template.HTML
+}
+
+// newLinkToken returns a random, URL-safe token for a share link along with the hash it is stored under.
+func newLinkToken() (token, hash string, err error) {
+	b := make([]byte, linkTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashLinkToken(token), nil
+}
+
+func hashLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateShareLink mints a public, read-only link to a note. The link can expire, be limited to a number of views and
+// be protected by a password.
+func (s Server) CreateShareLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		var dto types.ShareLinkDto
+		if err := c.BindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		var link types.ShareLink
+		switch {
+		case dto.ExpiresAt != nil && dto.ExpiresIn != "":
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "only one of expiresIn and expiresAt can be given"})
+			return
+		case dto.ExpiresAt != nil:
+			link.ExpiresAt = dto.ExpiresAt
+		case dto.ExpiresIn != "":
+			duration, err := time.ParseDuration(dto.ExpiresIn)
+			if err != nil || duration <= 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "expiresIn must look like 30m or 72h"})
+				return
+			}
+			expiresAt := time.Now().Add(duration)
+			link.ExpiresAt = &expiresAt
+		}
+		if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a link must expire in the future"})
+			return
+		}
+
+		if dto.MaxViews != nil && (*dto.MaxViews < 1 || *dto.MaxViews > maxLinkViews) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "maxViews must be between 1 and 1000000"})
+			return
+		}
+		link.MaxViews = dto.MaxViews
+
+		if dto.Password != "" {
+			if len(dto.Password) > maxLinkPasswordLen {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "password cannot exceed 72 bytes"})
+				return
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(dto.Password), bcrypt.DefaultCost)
+			if err != nil {
+				s.logger.Error("failed to hash link password", zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
+				return
+			}
+			link.PasswordHash = string(hash)
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
+		token, tokenHash, err := newLinkToken()
+		if err != nil {
+			s.logger.Error("failed to generate link token", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
+			return
+		}
+
+		created, err := s.Links.CreateShareLink(ctx, userID, noteID, tokenHash, link)
+		if err != nil {
+			if errors.Is(err, datastore.ErrNoteNoteFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+				return
+			}
+
+			s.logger.Error("failed to create share link", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create link"})
+			return
+		}
+
+		// The token is not stored, so this is the only time the full URL can be handed out.
+		created.URL = s.Cfg.PublicBaseURL + "/s/" + token
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) ListShareLinks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
+		links, err := s.Links.ListShareLinks(ctx, userID, noteID)
+		if err != nil {
+			s.logger.Error("failed to list share links", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve links"})
+			return
+		}
+
+		c.JSON(http.StatusOK, links)
+	}
+}
+
+func (s Server) RevokeShareLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
+		if err := s.Links.RevokeShareLink(ctx, userID, noteID, c.Param("linkId")); err != nil {
+			if errors.Is(err, datastore.ErrLinkNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "link not found"})
+				return
+			}
+
+			s.logger.Error("failed to revoke share link", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke link"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// ViewSharedNote serves the note behind a public link, without authentication. The note is rendered as HTML for
+// browsers (or with ?format=html) and as JSON otherwise. Password protected links take the password in the
+// X-Link-Password header or in the body of a POST, as a form field or JSON, but never in the URL. Clients that try too
+// many passwords, or too many at the same link, are turned away with 429 for a while.
+func (s Server) ViewSharedNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		// Shared notes must not end up in shared caches or leak their token through the Referer header.
+		c.Header("Cache-Control", "no-store")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("X-Robots-Tag", "noindex")
+
+		link, err := s.Links.GetShareLink(ctx, hashLinkToken(c.Param("token")))
+		if err != nil {
+			s.linkFailed(c, err)
+			return
+		}
+		if !link.Usable(time.Now()) {
+			s.linkFailed(c, datastore.ErrLinkExpired)
+			return
+		}
+
+		asHTML := c.Query("format") == "html" || c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML
+
+		if link.HasPassword {
+			password := c.GetHeader(linkPasswordHeader)
+			if password == "" && c.Request.Method == http.MethodPost {
+				password = linkPasswordFromBody(c)
+			}
+			if password != "" {
+				if ok, wait := s.linkAttempts.allow(c.ClientIP(), link.ID); !ok {
+					metrics.CountShareLinkViewsTotal.WithLabelValues("throttled").Inc()
+					c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many password attempts, try again later"})
+					return
+				}
+			}
+			if password == "" || bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+				metrics.CountShareLinkViewsTotal.WithLabelValues("unauthorized").Inc()
+				if asHTML {
+					c.Status(http.StatusUnauthorized)
+					c.Header("Content-Type", "text/html; charset=utf-8")
+					c.Header("Content-Security-Policy", "default-src 'none'; form-action 'self'")
+					if err := linkPasswordPage.Execute(c.Writer, password != ""); err != nil {
+						s.logger.Error("failed to render password page", zap.Error(err))
+					}
+					c.Abort()
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "a valid password is required to view this note"})
+				return
+			}
+		}
+
+		note, err := s.Links.ViewShareLink(ctx, link.ID, time.Now())
+		if err != nil {
+			s.linkFailed(c, err)
+			return
+		}
+
+		if note.Kind == types.NoteKindChecklist && s.Checklists != nil {
+			note.Items, err = s.Checklists.GetChecklistItems(ctx, link.UserId, note.ID)
+			if err != nil {
+				s.linkFailed(c, err)
+				return
+			}
+		}
+		metrics.CountShareLinkViewsTotal.WithLabelValues("viewed").Inc()
+
+		shared := types.SharedNote{
+			ID:      note.ID,
+			Title:   note.Title,
+			Content: note.Content,
+			Format:  note.Format,
+			Kind:    note.Kind,
+			Items:   note.Items,
+		}
+
+		if asHTML {
+			// The content is rendered and sanitised the same way as for GetSingleNote and HTML exports.
+			body, err := render.HTML(note.Content, note.Format)
+			if err != nil {
+				s.logger.Error("failed to render shared note", zap.String("noteID", note.ID), zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to render note"})
+				return
+			}
+
+			c.Status(http.StatusOK)
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+			if err := sharedNotePage.Execute(c.Writer, sharedNoteView{SharedNote: shared, Body: template.HTML(body)}); err != nil {
+				s.logger.Error("failed to render shared note", zap.String("noteID", note.ID), zap.Error(err))
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, shared)
+	}
+}
+
+// linkPasswordFromBody reads the password of a protected link from a JSON body or a form, such as the one of
+// linkPasswordPage.
+func linkPasswordFromBody(c *gin.Context) string {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxLinkPasswordBody)
+	if c.ContentType() == gin.MIMEJSON {
+		var body struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			return ""
+		}
+		return body.Password
+	}
+	return c.PostForm("password")
+}
+
+func (s Server) linkFailed(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrLinkNotFound):
+		metrics.CountShareLinkViewsTotal.WithLabelValues("not_found").Inc()
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "link not found"})
+	case errors.Is(err, datastore.ErrLinkExpired):
+		metrics.CountShareLinkViewsTotal.WithLabelValues("expired").Inc()
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "link has expired"})
+	default:
+		metrics.CountShareLinkViewsTotal.WithLabelValues("error").Inc()
+		s.logger.Error("failed to view shared note", zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve note"})
+	}
+}
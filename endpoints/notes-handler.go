@@ -11,6 +11,7 @@ import (
 
 	"github.com/RogueAlmond70/code-review-challenge/internal/config"
 	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/render"
 	"github.com/RogueAlmond70/code-review-challenge/services"
 	"github.com/RogueAlmond70/code-review-challenge/types"
 	"github.com/gin-gonic/gin"
@@ -18,10 +19,49 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	maxTitleLen   = 255
+	maxContentLen = types.MaxNoteContentLen
+	// MaxRequestBody bounds the JSON body of a request to change a note or anything else, which the longest note fits
+	// in even with every character escaped.
+	MaxRequestBody = 1 << 20
+)
+
 type Server struct {
-	DB     services.DBClient
-	Cfg    *config.Config
-	logger *zap.Logger
+	DB          services.DBClient
+	Checklists  services.ChecklistStore
+	Reminders   services.ReminderStore
+	Shares      services.ShareStore
+	Links       services.LinkStore
+	Workspaces  services.WorkspaceStore
+	Comments    services.CommentStore
+	References  services.ReferenceStore
+	Templates   services.TemplateStore
+	Exports     services.ExportStore
+	Imports     services.ImportStore
+	Attachments services.AttachmentStore
+	Jobs        services.JobStore
+	Webhooks    services.WebhookStore
+	NoteEvents  services.NoteEventStore
+	Events      services.EventBroker
+	Sync        services.SyncStore
+	Revisions   services.RevisionStore
+	Collab      services.Collaboration
+	Blobs       services.BlobStore
+	Users       services.UserDirectory
+	Cfg         *config.Config
+	logger      *zap.Logger
+
+	linkAttempts *linkAttempts
+}
+
+func NewServer(db services.DBClient, cfg *config.Config, logger *zap.Logger) Server {
+	return Server{
+		DB:           db,
+		Cfg:          cfg,
+		logger:       logger,
+		linkAttempts: newLinkAttempts(),
+	}
 }
 
 func (s Server) GetSingleNote() gin.HandlerFunc {
@@ -55,6 +95,35 @@ func (s Server) GetSingleNote() gin.HandlerFunc {
 			return
 		}
 
+		if !inSelectedWorkspace(c, note) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+			return
+		}
+
+		if note.Kind == types.NoteKindChecklist && s.Checklists != nil {
+			note.Items, err = s.Checklists.GetChecklistItems(ctx, userID, noteID)
+			if err != nil {
+				s.logger.Error("failed to get checklist items", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve note"})
+				return
+			}
+		}
+
+		// Content is stored as written, so it is only made safe to display here, when it is rendered.
+		switch c.Query("render") {
+		case "":
+		case "html":
+			note.HTML, err = render.HTML(note.Content, note.Format)
+			if err != nil {
+				s.logger.Error("failed to render note", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to render note"})
+				return
+			}
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "render must be html"})
+			return
+		}
+
 		c.JSON(http.StatusOK, note)
 	}
 }
@@ -71,13 +140,13 @@ func (s Server) GetNotes() gin.HandlerFunc {
 			return
 		}
 
-		includeArchived := c.DefaultQuery("includeArchived", "false") == "true"
-		includeActive := c.DefaultQuery("includeActive", "true") == "true"
+		workspaceID, ok := s.selectedWorkspace(ctx, c, userID)
+		if !ok {
+			return
+		}
 
-		// Validate filters
-		if !includeArchived && !includeActive {
-			s.logger.Warn("no notes included", zap.String("userID", userID))
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "must include at least one of active or archived notes"})
+		filter, ok := s.noteFilter(c, userID, workspaceID)
+		if !ok {
 			return
 		}
 
@@ -89,17 +158,7 @@ func (s Server) GetNotes() gin.HandlerFunc {
 			return
 		}
 
-		var archiveFilter *bool
-		switch {
-		case includeArchived && includeActive:
-			archiveFilter = nil
-		case includeArchived:
-			archiveFilter = ptr(true)
-		case includeActive:
-			archiveFilter = ptr(false)
-		}
-
-		notes, totalCount, err := s.DB.GetNotes(ctx, userID, archiveFilter, limit, offset)
+		notes, totalCount, err := s.DB.GetNotes(ctx, userID, filter, limit, offset)
 		if err != nil {
 			s.logger.Error("failed to get notes", zap.String("userID", userID), zap.Error(err))
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve notes"})
@@ -118,6 +177,47 @@ func (s Server) GetNotes() gin.HandlerFunc {
 	}
 }
 
+// noteFilter reads the filters for listing notes from the query string, writing an error response and returning false
+// if they are invalid.
+func (s Server) noteFilter(c *gin.Context, userID, workspaceID string) (types.NoteFilter, bool) {
+	includeArchived := c.DefaultQuery("includeArchived", "false") == "true"
+	includeActive := c.DefaultQuery("includeActive", "true") == "true"
+
+	// Validate filters
+	if !includeArchived && !includeActive {
+		s.logger.Warn("no notes included", zap.String("userID", userID))
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "must include at least one of active or archived notes"})
+		return types.NoteFilter{}, false
+	}
+
+	filter := types.NoteFilter{
+		PinnedFirst: c.DefaultQuery("pinnedFirst", "true") == "true",
+		WorkspaceId: workspaceID,
+	}
+	switch {
+	case includeArchived && includeActive:
+		filter.Archived = nil
+	case includeArchived:
+		filter.Archived = ptr(true)
+	case includeActive:
+		filter.Archived = ptr(false)
+	}
+
+	if pinned, ok := c.GetQuery("pinned"); ok {
+		switch pinned {
+		case "true":
+			filter.Pinned = ptr(true)
+		case "false":
+			filter.Pinned = ptr(false)
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "pinned must be true or false"})
+			return types.NoteFilter{}, false
+		}
+	}
+
+	return filter, true
+}
+
 // Helper to return a pointer to a bool
 func ptr(b bool) *bool {
 	return &b
@@ -147,19 +247,17 @@ func parsePagination(c *gin.Context) (limit int, offset int, err error) {
 }
 
 func (s Server) CreateNote() gin.HandlerFunc {
-	const maxTitleLen = 255
-	const maxContentLen = 10000 // arbitrary sane max for content
-
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		var newNote types.NoteDto
-		if err := c.BindJSON(&newNote); err != nil {
+		var body types.TemplateNoteDto
+		if err := c.BindJSON(&body); err != nil {
 			s.logger.Warn("invalid JSON body", zap.Error(err))
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
 			return
 		}
+		newNote := body.NoteDto
 
 		userID := userId(c)
 		if userID == "" {
@@ -168,52 +266,43 @@ func (s Server) CreateNote() gin.HandlerFunc {
 			return
 		}
 
-		// Validate and sanitize title
-		title := ""
-		if newNote.Title != nil {
-			title = strings.TrimSpace(*newNote.Title)
-			if title == "" {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+		// With ?template=<id> the note starts out from one of the templates of the user.
+		if templateID := c.Query("template"); templateID != "" {
+			if !s.applyTemplate(ctx, c, userID, templateID, &newNote, body.Variables) {
 				return
 			}
-			if len(title) > maxTitleLen {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("title length cannot exceed %d characters", maxTitleLen)})
-				return
-			}
-			title = sanitizeInput(title)
-		} else {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		} else if body.Variables != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "variables can only be given with a template"})
 			return
 		}
 
-		// Validate and sanitize content
-		content := ""
-		if newNote.Content != nil {
-			content = strings.TrimSpace(*newNote.Content)
-			if len(content) > maxContentLen {
-				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("content length cannot exceed %d characters", maxContentLen)})
-				return
-			}
-			content = sanitizeInput(content)
+		// Content is stored as written and sanitised when rendered, as sanitising it here would mangle Markdown such
+		// as <https://example.com> autolinks.
+		if err := normalizeNote(&newNote, true); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		// Check for duplicate title for this user
-		existingNotes, _, err := s.DB.GetNotes(ctx, userID, nil, 1, 0) // get first note, no filter
-		if err != nil {
-			s.logger.Error("failed to check for duplicate note", zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		workspaceID, ok := s.selectedWorkspace(ctx, c, userID)
+		if !ok {
 			return
 		}
-		for _, note := range existingNotes {
-			if note.Title == title {
+		if workspaceID != "" {
+			newNote.WorkspaceId = &workspaceID
+		}
+
+		// Create note in DB. Duplicate titles are rejected by the database according to the configured title policy.
+		createdNote, err := s.DB.CreateNote(ctx, userID, &newNote)
+		if err != nil {
+			if errors.Is(err, datastore.ErrDuplicateTitle) {
 				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "note with this title already exists"})
 				return
 			}
-		}
+			if errors.Is(err, datastore.ErrPermissionDenied) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to create notes in this workspace"})
+				return
+			}
 
-		// Create note in DB
-		createdNote, err := s.DB.CreateNote(ctx, userID, title, content)
-		if err != nil {
 			s.logger.Error("failed to create note", zap.Error(err))
 			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to create note"})
 			return
@@ -224,6 +313,142 @@ func (s Server) CreateNote() gin.HandlerFunc {
 	}
 }
 
+func (s Server) UpdateNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionEditor); !ok {
+			return
+		}
+
+		var update types.NoteDto
+		if err := c.BindJSON(&update); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if err := normalizeNote(&update, false); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		note, err := s.DB.UpdateNote(ctx, userID, noteID, &update)
+		if err != nil {
+			if errors.Is(err, datastore.ErrNoteNoteFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+				return
+			}
+			if errors.Is(err, datastore.ErrPermissionDenied) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to edit this note"})
+				return
+			}
+			if errors.Is(err, datastore.ErrDuplicateTitle) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "note with this title already exists"})
+				return
+			}
+			if errors.Is(err, datastore.ErrVersionConflict) {
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "note has changed since the given version"})
+				return
+			}
+
+			s.logger.Error("failed to update note", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update note"})
+			return
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+// normalizeNote checks the fields of a note that are set, trimming and sanitising them in place. The error says what
+// is wrong, for the client. A new note needs a title, and only a new note may set its kind: existing notes change it
+// through their convert endpoint.
+func normalizeNote(note *types.NoteDto, create bool) error {
+	if note.Title != nil {
+		title := strings.TrimSpace(*note.Title)
+		if title == "" {
+			return errors.New("title cannot be empty")
+		}
+		if len(title) > maxTitleLen {
+			return fmt.Errorf("title length cannot exceed %d characters", maxTitleLen)
+		}
+		title = sanitizeInput(title)
+		note.Title = &title
+	} else if create {
+		return errors.New("title is required")
+	}
+
+	if note.Content != nil {
+		content := strings.TrimSpace(*note.Content)
+		if len(content) > maxContentLen {
+			return fmt.Errorf("content length cannot exceed %d characters", maxContentLen)
+		}
+		note.Content = &content
+	} else if create {
+		content := ""
+		note.Content = &content
+	}
+
+	if err := checkFormat(note.Format); err != nil {
+		return err
+	}
+
+	if note.Color != nil && !types.IsValidNoteColor(*note.Color) {
+		return fmt.Errorf("color must be one of %s", strings.Join(types.NoteColors, ", "))
+	}
+
+	if note.Kind != nil {
+		if !create {
+			return errors.New("the kind of a note is changed through its convert endpoint")
+		}
+		if *note.Kind != types.NoteKindText && *note.Kind != types.NoteKindChecklist {
+			return errors.New("kind must be text or checklist")
+		}
+	}
+
+	if err := normalizeSchedule(note); err != nil {
+		return err
+	}
+	if create && note.Recurrence.Value != nil && note.RemindAt.Value == nil {
+		return errors.New("a recurring note needs a remindAt time")
+	}
+
+	return nil
+}
+
+// checkFormat checks the format of a note is one that can be rendered.
+func checkFormat(format *string) error {
+	if format != nil && *format != types.NoteFormatPlain && *format != types.NoteFormatMarkdown {
+		return errors.New("format must be plain or markdown")
+	}
+	return nil
+}
+
+// validateFormat is checkFormat for handlers, writing an error response and returning false if the format is invalid.
+func validateFormat(c *gin.Context, format *string) bool {
+	if err := checkFormat(format); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
 // sanitizeInput uses a strict HTML sanitizer to remove potentially dangerous input.
 // It prevents XSS by stripping out scripts, unsafe tags, and attributes.
 func sanitizeInput(input string) string {
@@ -251,6 +476,10 @@ func (s Server) DeleteNote() gin.HandlerFunc {
 			return
 		}
 
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
 		err := s.DB.DeleteNote(ctx, userID, noteID)
 		if err != nil {
 			if errors.Is(err, datastore.ErrNoteNoteFound) {
@@ -0,0 +1,86 @@
+package endpoints
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// noteLinks serves one direction of the wiki links of a note the caller can see.
+func (s Server) noteLinks(get func(ctx context.Context, userId, noteId string) ([]types.NoteReference, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionViewer); !ok {
+			return
+		}
+
+		refs, err := get(ctx, userID, noteID)
+		if err != nil {
+			s.logger.Error("failed to get note links", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve links"})
+			return
+		}
+
+		c.JSON(http.StatusOK, refs)
+	}
+}
+
+// GetBacklinks lists the notes linking to a note with [[Title]] or [[id]].
+func (s Server) GetBacklinks() gin.HandlerFunc {
+	return s.noteLinks(s.References.GetBacklinks)
+}
+
+// GetOutlinks lists the links in a note, with the notes they lead to. Broken links have no target.
+func (s Server) GetOutlinks() gin.HandlerFunc {
+	return s.noteLinks(s.References.GetOutlinks)
+}
+
+// GetBrokenLinks lists the links that do not lead to any note, in the personal notes of the caller or in the
+// workspace chosen with the workspace selector.
+func (s Server) GetBrokenLinks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		workspaceID, ok := s.selectedWorkspace(ctx, c, userID)
+		if !ok {
+			return
+		}
+
+		refs, err := s.References.GetBrokenLinks(ctx, userID, workspaceID)
+		if err != nil {
+			s.logger.Error("failed to get broken links", zap.String("userID", userID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve links"})
+			return
+		}
+
+		c.JSON(http.StatusOK, refs)
+	}
+}
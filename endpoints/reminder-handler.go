@@ -0,0 +1,145 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/reminders"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxSnooze = 30 * 24 * time.Hour
+
+// normalizeSchedule checks the reminder fields of a note, normalising the recurrence rule. The error says what is
+// wrong, for the client.
+func normalizeSchedule(note *types.NoteDto) error {
+	if note.Recurrence.Value != nil {
+		recurrence := strings.TrimSpace(*note.Recurrence.Value)
+		if recurrence == "" {
+			note.Recurrence.Value = nil
+		} else {
+			if _, err := reminders.ParseRule(recurrence); err != nil {
+				return err
+			}
+			recurrence = strings.ToUpper(strings.TrimPrefix(recurrence, "RRULE:"))
+			note.Recurrence.Value = &recurrence
+		}
+	}
+
+	return nil
+}
+
+func (s Server) SnoozeReminder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionEditor); !ok {
+			return
+		}
+
+		var snooze types.SnoozeDto
+		if err := c.BindJSON(&snooze); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		var until time.Time
+		switch {
+		case snooze.Until != nil && snooze.Duration != "":
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "only one of duration and until can be given"})
+			return
+		case snooze.Until != nil:
+			until = *snooze.Until
+		case snooze.Duration != "":
+			duration, err := time.ParseDuration(snooze.Duration)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "duration must look like 10m or 2h"})
+				return
+			}
+			until = time.Now().Add(duration)
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "one of duration and until is required"})
+			return
+		}
+
+		if !until.After(time.Now()) || until.After(time.Now().Add(maxSnooze)) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a reminder can be snoozed for up to 30 days"})
+			return
+		}
+
+		note, err := s.Reminders.SnoozeReminder(ctx, userID, noteID, until)
+		if err != nil {
+			s.reminderFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+func (s Server) DismissReminder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionEditor); !ok {
+			return
+		}
+
+		note, err := s.Reminders.DismissReminder(ctx, userID, noteID)
+		if err != nil {
+			s.reminderFailed(c, userID, noteID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, note)
+	}
+}
+
+func (s Server) reminderFailed(c *gin.Context, userID, noteID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrNoteNoteFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+	case errors.Is(err, datastore.ErrNoReminder):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "note has no reminder"})
+	default:
+		s.logger.Error("failed to update reminder", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to update reminder"})
+	}
+}
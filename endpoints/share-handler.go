@@ -0,0 +1,247 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// authorizeNote fetches the note and checks the caller holds at least the needed permission on it, writing an error
+// response and returning false otherwise. Notes the caller cannot see at all, or that are outside the selected
+// workspace, are reported as not found.
+func (s Server) authorizeNote(ctx context.Context, c *gin.Context, userID, noteID, need string) (types.Note, bool) {
+	note, err := s.DB.GetSingleNote(ctx, userID, noteID)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNoteNoteFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+			return types.Note{}, false
+		}
+
+		s.logger.Error("failed to get single note", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve note"})
+		return types.Note{}, false
+	}
+
+	if !inSelectedWorkspace(c, note) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+		return types.Note{}, false
+	}
+
+	if !types.PermissionAllows(note.Permission, need) {
+		s.logger.Warn("permission denied",
+			zap.String("userID", userID),
+			zap.String("noteID", noteID),
+			zap.String("permission", note.Permission),
+			zap.String("need", need))
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "you do not have permission to " + permissionAction(need) + " this note"})
+		return types.Note{}, false
+	}
+
+	return note, true
+}
+
+func permissionAction(need string) string {
+	switch need {
+	case types.PermissionOwner:
+		return "manage"
+	case types.PermissionEditor:
+		return "edit"
+	}
+	return "view"
+}
+
+// ShareNote shares a note with another registered user as a viewer or an editor. Sharing it again with the same user
+// changes their permission.
+func (s Server) ShareNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		var share types.ShareDto
+		if err := c.ShouldBindJSON(&share); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		if share.Permission != types.PermissionViewer && share.Permission != types.PermissionEditor {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "permission must be viewer or editor"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
+		user, err := s.Users.GetUserByUsername(ctx, strings.TrimSpace(share.Username))
+		if err != nil {
+			s.logger.Error("failed to look up user", zap.String("username", share.Username), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to share note"})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		if user.UserId == userID {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "a note cannot be shared with its owner"})
+			return
+		}
+
+		created, err := s.Shares.ShareNote(ctx, userID, noteID, types.NoteShare{
+			UserId:     user.UserId,
+			Username:   user.Username,
+			Permission: share.Permission,
+		})
+		if err != nil {
+			if errors.Is(err, datastore.ErrNoteNoteFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "note not found"})
+				return
+			}
+
+			s.logger.Error("failed to share note", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to share note"})
+			return
+		}
+
+		c.JSON(http.StatusOK, created)
+	}
+}
+
+// ListShares lists who a note has been shared with. Only the owner of the note can see its shares.
+func (s Server) ListShares() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, types.PermissionOwner); !ok {
+			return
+		}
+
+		shares, err := s.Shares.ListNoteShares(ctx, userID, noteID)
+		if err != nil {
+			s.logger.Error("failed to list note shares", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve shares"})
+			return
+		}
+
+		c.JSON(http.StatusOK, shares)
+	}
+}
+
+// RevokeShare takes away the access a user has to a note. The owner can revoke any share, and a user a note was
+// shared with can remove themselves from it.
+func (s Server) RevokeShare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		noteID := c.Param("noteId")
+		if noteID == "" {
+			s.logger.Warn("missing note ID in request URL")
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "note ID must be provided"})
+			return
+		}
+
+		need := types.PermissionOwner
+		granteeID := c.Param("userId")
+		if granteeID == userID {
+			need = types.PermissionViewer
+		}
+		if _, ok := s.authorizeNote(ctx, c, userID, noteID, need); !ok {
+			return
+		}
+
+		if err := s.Shares.RevokeNoteShare(ctx, userID, noteID, granteeID); err != nil {
+			if errors.Is(err, datastore.ErrShareNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "share not found"})
+				return
+			}
+
+			s.logger.Error("failed to revoke note share", zap.String("userID", userID), zap.String("noteID", noteID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke share"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// SharedWithMe lists the notes other users have shared with the caller, paginated like GET /notes.
+func (s Server) SharedWithMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		limit, offset, err := parsePagination(c)
+		if err != nil {
+			s.logger.Warn("invalid pagination params", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid pagination parameters"})
+			return
+		}
+
+		notes, totalCount, err := s.Shares.GetSharedNotes(ctx, userID, limit, offset)
+		if err != nil {
+			s.logger.Error("failed to get shared notes", zap.String("userID", userID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve notes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.NotesResponse{
+			Notes:      notes,
+			Offset:     offset,
+			Limit:      limit,
+			TotalNotes: totalCount,
+			HasMore:    offset+len(notes) < totalCount,
+		})
+	}
+}
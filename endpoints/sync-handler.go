@@ -0,0 +1,272 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSyncLimit = 200
+	maxSyncLimit     = 1000
+	// maxPushedChanges bounds how many changes a client pushes at once.
+	maxPushedChanges = 100
+	// MaxSyncPushBody bounds the body of a push, which maxPushedChanges of the longest notes fit in.
+	MaxSyncPushBody = 8 << 20
+)
+
+var errInvalidSyncToken = errors.New("invalid sync token")
+
+// syncToken encodes a sync cursor for the client. Between rounds it is just where the next round starts.
+func syncToken(cursor types.SyncCursor) string {
+	if cursor.Until == 0 {
+		return strconv.FormatInt(cursor.Since, 10)
+	}
+	return fmt.Sprintf("%d.%d.%d", cursor.Since, cursor.Until, cursor.AfterId)
+}
+
+// parseSyncToken decodes a token made by syncToken. An empty token starts from the beginning.
+func parseSyncToken(token string) (types.SyncCursor, error) {
+	if token == "" {
+		return types.SyncCursor{}, nil
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 1 && len(parts) != 3 {
+		return types.SyncCursor{}, errInvalidSyncToken
+	}
+	values := make([]int64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || value < 0 {
+			return types.SyncCursor{}, errInvalidSyncToken
+		}
+		values[i] = value
+	}
+
+	if len(values) == 1 {
+		return types.SyncCursor{Since: values[0]}, nil
+	}
+	if values[1] == 0 {
+		return types.SyncCursor{}, errInvalidSyncToken
+	}
+	return types.SyncCursor{Since: values[0], Until: values[1], AfterId: values[2]}, nil
+}
+
+// GetSyncChanges returns the notes the caller can read that changed since the token they last synced with, and those
+// that were deleted or that they can no longer read. Without a token every note is sent. Changes come in pages: the
+// client asks again with the returned token while more is true, and keeps the last token for its next sync.
+func (s Server) GetSyncChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		cursor, err := parseSyncToken(c.Query("since"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSyncLimit)))
+		if err != nil || limit <= 0 || limit > maxSyncLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSyncLimit)})
+			return
+		}
+
+		changes, err := s.Sync.GetNoteChanges(ctx, userID, cursor, limit)
+		if err != nil {
+			s.logger.Error("failed to get note changes", zap.String("userID", userID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve changes"})
+			return
+		}
+		changes.Token = syncToken(changes.Next)
+
+		c.JSON(http.StatusOK, changes)
+	}
+}
+
+// PushSyncChanges applies the changes a client made while offline, in order, and reports on each. An update or delete
+// is only applied if the note is still at the version the client changed; otherwise it is a conflict, returned with
+// the note as it is now for the client to reconcile. Once a change fails on our side the rest are not tried, so that
+// they are pushed again in order, and the results are sent with a 500 so that the failure is not stored against an
+// Idempotency-Key.
+func (s Server) PushSyncChanges() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var push types.SyncPushDto
+		if err := c.ShouldBindJSON(&push); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if len(push.Changes) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "changes are required"})
+			return
+		}
+		if len(push.Changes) > maxPushedChanges {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d changes can be pushed at once", maxPushedChanges)})
+			return
+		}
+
+		results := make([]types.NoteChangeResult, len(push.Changes))
+		failed := false
+		for i, change := range push.Changes {
+			if failed {
+				results[i] = types.NoteChangeResult{ClientId: change.ClientId, ID: change.ID, Status: types.SyncFailed,
+					Error: "not applied after an earlier change failed"}
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+			result, err := s.pushChange(ctx, userID, change)
+			cancel()
+			if err != nil {
+				s.logger.Error("failed to apply pushed change", zap.String("userID", userID), zap.String("noteID", change.ID), zap.Error(err))
+				result.Status = types.SyncFailed
+				result.Error = "failed to apply change, push it again"
+				failed = true
+			}
+			results[i] = result
+		}
+
+		status := http.StatusOK
+		if failed {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, types.SyncPushResult{Results: results})
+	}
+}
+
+// pushChange applies one change pushed by a client. The error is only set when the change could not be applied
+// because of an error on our side.
+func (s Server) pushChange(ctx context.Context, userID string, change types.NoteChangeDto) (types.NoteChangeResult, error) {
+	result := types.NoteChangeResult{ClientId: change.ClientId, ID: change.ID}
+	rejected := func(reason string) (types.NoteChangeResult, error) {
+		result.Status = types.SyncRejected
+		result.Error = reason
+		return result, nil
+	}
+
+	switch {
+	case change.Deleted:
+		if change.ID == "" || change.Version == nil {
+			return rejected("id and version are required to delete a note")
+		}
+
+		err := s.Sync.DeleteNoteVersion(ctx, userID, change.ID, *change.Version)
+		switch {
+		case err == nil:
+		case errors.Is(err, datastore.ErrVersionConflict):
+			return s.syncConflict(ctx, userID, result)
+		case errors.Is(err, datastore.ErrNoteNoteFound):
+			// Either the note is already gone, which is what the client wanted, or it is not theirs to delete.
+			note, err := s.DB.GetSingleNote(ctx, userID, change.ID)
+			if err == nil {
+				result.Note = &note
+				return rejected("you do not have permission to delete this note")
+			}
+			if !errors.Is(err, datastore.ErrNoteNoteFound) {
+				return result, err
+			}
+		default:
+			return result, err
+		}
+
+		result.Status = types.SyncApplied
+		result.Deleted = true
+		return result, nil
+
+	case change.Note == nil:
+		return rejected("note is required")
+
+	case change.ID == "":
+		if err := normalizeNote(change.Note, true); err != nil {
+			return rejected(err.Error())
+		}
+		if change.WorkspaceId != nil {
+			if _, err := strconv.Atoi(*change.WorkspaceId); err != nil {
+				return rejected("invalid workspaceId")
+			}
+		}
+		change.Note.WorkspaceId = change.WorkspaceId
+		change.Note.Version = nil
+
+		created, err := s.DB.CreateNote(ctx, userID, change.Note)
+		switch {
+		case errors.Is(err, datastore.ErrDuplicateTitle):
+			return rejected("note with this title already exists")
+		case errors.Is(err, datastore.ErrPermissionDenied):
+			return rejected("you do not have permission to create notes in this workspace")
+		case err != nil:
+			return result, err
+		}
+
+		result.Status = types.SyncApplied
+		result.ID = created.ID
+		result.Note = &created
+		return result, nil
+
+	default:
+		if change.Version == nil {
+			return rejected("version is required to update a note")
+		}
+		if err := normalizeNote(change.Note, false); err != nil {
+			return rejected(err.Error())
+		}
+		change.Note.Version = change.Version
+
+		updated, err := s.DB.UpdateNote(ctx, userID, change.ID, change.Note)
+		switch {
+		case errors.Is(err, datastore.ErrVersionConflict), errors.Is(err, datastore.ErrNoteNoteFound):
+			return s.syncConflict(ctx, userID, result)
+		case errors.Is(err, datastore.ErrPermissionDenied):
+			return rejected("you do not have permission to edit this note")
+		case errors.Is(err, datastore.ErrDuplicateTitle):
+			return rejected("note with this title already exists")
+		case err != nil:
+			return result, err
+		}
+
+		result.Status = types.SyncApplied
+		result.Note = &updated
+		return result, nil
+	}
+}
+
+// syncConflict reports a change that was made to a version of the note that is no longer the latest, along with the
+// note as it is now, or as deleted when the caller can no longer read it.
+func (s Server) syncConflict(ctx context.Context, userID string, result types.NoteChangeResult) (types.NoteChangeResult, error) {
+	result.Status = types.SyncConflict
+	note, err := s.DB.GetSingleNote(ctx, userID, result.ID)
+	switch {
+	case errors.Is(err, datastore.ErrNoteNoteFound):
+		result.Deleted = true
+	case err != nil:
+		return result, err
+	default:
+		result.Note = &note
+	}
+	return result, nil
+}
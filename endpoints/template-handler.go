@@ -0,0 +1,260 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/templates"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const maxTemplateNameLen = 255
+
+// username is the name the caller signed in with, which is what the {{user}} placeholder of templates expands to.
+func username(c *gin.Context) string {
+	if name, _, ok := c.Request.BasicAuth(); ok {
+		return name
+	}
+	return userId(c)
+}
+
+// validateTemplate trims and checks the fields of a template that are set, writing an error response and returning
+// false if any is invalid. A new template needs a name and a title.
+func validateTemplate(c *gin.Context, template *types.TemplateDto, create bool) bool {
+	if create && (template.Name == nil || template.Title == nil) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name and title are required"})
+		return false
+	}
+
+	if template.Name != nil {
+		name := strings.TrimSpace(*template.Name)
+		if name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return false
+		}
+		if len(name) > maxTemplateNameLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name length cannot exceed %d characters", maxTemplateNameLen)})
+			return false
+		}
+		name = sanitizeInput(name)
+		template.Name = &name
+	}
+
+	if template.Title != nil {
+		title := strings.TrimSpace(*template.Title)
+		if title == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "title cannot be empty"})
+			return false
+		}
+		if len(title) > maxTitleLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("title length cannot exceed %d characters", maxTitleLen)})
+			return false
+		}
+		template.Title = &title
+	}
+
+	if template.Content != nil {
+		content := strings.TrimSpace(*template.Content)
+		if len(content) > maxContentLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("content length cannot exceed %d characters", maxContentLen)})
+			return false
+		}
+		template.Content = &content
+	}
+
+	return validateFormat(c, template.Format)
+}
+
+// templateFailed maps a template datastore error onto the matching HTTP response.
+func (s Server) templateFailed(c *gin.Context, userID, templateID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrTemplateNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "template not found"})
+	case errors.Is(err, datastore.ErrDuplicateTemplate):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "template with this name already exists"})
+	default:
+		s.logger.Error("template request failed", zap.String("userID", userID), zap.String("templateID", templateID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process template"})
+	}
+}
+
+// applyTemplate fills in the note from a template, expanding its placeholders with the built-in variables and the
+// supplied values. Fields already set on the note are kept, but placeholders in them are expanded too. It writes an
+// error response and returns false if the template does not exist or variables are left without a value.
+func (s Server) applyTemplate(ctx context.Context, c *gin.Context, userID, templateID string, note *types.NoteDto, variables map[string]string) bool {
+	if s.Templates == nil {
+		s.templateFailed(c, userID, templateID, datastore.ErrTemplateNotFound)
+		return false
+	}
+	template, err := s.Templates.GetTemplate(ctx, userID, templateID)
+	if err != nil {
+		s.templateFailed(c, userID, templateID, err)
+		return false
+	}
+
+	values := templates.Builtins(username(c), time.Now().UTC())
+	for name, value := range variables {
+		values[name] = value
+	}
+
+	title, content := template.Title, template.Content
+	if note.Title != nil {
+		title = *note.Title
+	}
+	if note.Content != nil {
+		content = *note.Content
+	}
+
+	if missing := templates.Missing(values, title, content); len(missing) > 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "missing values for template variables", "missing": missing})
+		return false
+	}
+
+	title = templates.Expand(title, values)
+	content = templates.Expand(content, values)
+	note.Title = &title
+	note.Content = &content
+	if note.Format == nil {
+		note.Format = &template.Format
+	}
+	return true
+}
+
+func (s Server) CreateTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var template types.TemplateDto
+		if err := c.ShouldBindJSON(&template); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !validateTemplate(c, &template, true) {
+			return
+		}
+
+		created, err := s.Templates.CreateTemplate(ctx, userID, template)
+		if err != nil {
+			s.templateFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) GetTemplates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		list, err := s.Templates.GetTemplates(ctx, userID)
+		if err != nil {
+			s.templateFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func (s Server) GetTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		templateID := c.Param("templateId")
+		template, err := s.Templates.GetTemplate(ctx, userID, templateID)
+		if err != nil {
+			s.templateFailed(c, userID, templateID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+func (s Server) UpdateTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var template types.TemplateDto
+		if err := c.ShouldBindJSON(&template); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !validateTemplate(c, &template, false) {
+			return
+		}
+
+		templateID := c.Param("templateId")
+		updated, err := s.Templates.UpdateTemplate(ctx, userID, templateID, template)
+		if err != nil {
+			s.templateFailed(c, userID, templateID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (s Server) DeleteTemplate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		templateID := c.Param("templateId")
+		if err := s.Templates.DeleteTemplate(ctx, userID, templateID); err != nil {
+			s.templateFailed(c, userID, templateID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,285 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/webhooks"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxWebhookURLLen         = 2048
+	maxWebhookDescriptionLen = 255
+	// webhookDeliveriesShown is how many of the latest deliveries the delivery log returns.
+	webhookDeliveriesShown = 100
+)
+
+// validateWebhook trims and checks the fields of a webhook that are set, writing an error response and returning false
+// if any is invalid. A new webhook needs a URL and at least one event.
+func validateWebhook(c *gin.Context, webhook *types.WebhookDto, create bool) bool {
+	if create && (webhook.URL == nil || len(webhook.Events) == 0) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "url and events are required"})
+		return false
+	}
+
+	if webhook.URL != nil {
+		url := strings.TrimSpace(*webhook.URL)
+		if len(url) > maxWebhookURLLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("url length cannot exceed %d characters", maxWebhookURLLen)})
+			return false
+		}
+		if err := webhooks.ValidateURL(url); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		webhook.URL = &url
+	}
+
+	if webhook.Events != nil {
+		if len(webhook.Events) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "events cannot be empty"})
+			return false
+		}
+		for _, event := range webhook.Events {
+			if !types.IsWebhookEvent(event) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("events must be among %s", strings.Join(types.WebhookEvents, ", "))})
+				return false
+			}
+		}
+		slices.Sort(webhook.Events)
+		webhook.Events = slices.Compact(webhook.Events)
+	}
+
+	if webhook.Description != nil {
+		description := sanitizeInput(strings.TrimSpace(*webhook.Description))
+		if len(description) > maxWebhookDescriptionLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("description length cannot exceed %d characters", maxWebhookDescriptionLen)})
+			return false
+		}
+		webhook.Description = &description
+	}
+
+	return true
+}
+
+// webhookFailed maps a webhook datastore error onto the matching HTTP response.
+func (s Server) webhookFailed(c *gin.Context, userID, webhookID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrWebhookNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+	case errors.Is(err, datastore.ErrDeliveryNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+	case errors.Is(err, datastore.ErrWebhookLimit):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "you have too many webhooks, delete one first"})
+	case errors.Is(err, datastore.ErrWebhookDisabled):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "webhook is disabled, enable it first"})
+	default:
+		s.logger.Error("webhook request failed", zap.String("userID", userID), zap.String("webhookID", webhookID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process webhook"})
+	}
+}
+
+// CreateWebhook registers a webhook. The response is the only one to include its secret, which the receiver needs to
+// check the signatures of deliveries.
+func (s Server) CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var dto types.WebhookDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !validateWebhook(c, &dto, true) {
+			return
+		}
+
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			s.webhookFailed(c, userID, "", err)
+			return
+		}
+
+		webhook := types.Webhook{URL: *dto.URL, Secret: secret, Events: dto.Events}
+		if dto.Description != nil {
+			webhook.Description = *dto.Description
+		}
+
+		created, err := s.Webhooks.CreateWebhook(ctx, userID, webhook)
+		if err != nil {
+			s.webhookFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func (s Server) GetWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		list, err := s.Webhooks.GetWebhooks(ctx, userID)
+		if err != nil {
+			s.webhookFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func (s Server) GetWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		webhookID := c.Param("webhookId")
+		webhook, err := s.Webhooks.GetWebhook(ctx, userID, webhookID)
+		if err != nil {
+			s.webhookFailed(c, userID, webhookID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// UpdateWebhook changes the URL, events, description or active state of a webhook. Sending "active": true enables a
+// webhook that was disabled after repeated failures.
+func (s Server) UpdateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var dto types.WebhookDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !validateWebhook(c, &dto, false) {
+			return
+		}
+
+		webhookID := c.Param("webhookId")
+		updated, err := s.Webhooks.UpdateWebhook(ctx, userID, webhookID, dto)
+		if err != nil {
+			s.webhookFailed(c, userID, webhookID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func (s Server) DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		webhookID := c.Param("webhookId")
+		if err := s.Webhooks.DeleteWebhook(ctx, userID, webhookID); err != nil {
+			s.webhookFailed(c, userID, webhookID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook: its latest deliveries, newest first, each with the
+// outcome of its latest attempt.
+func (s Server) GetWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		webhookID := c.Param("webhookId")
+		deliveries, err := s.Webhooks.GetWebhookDeliveries(ctx, userID, webhookID, webhookDeliveriesShown)
+		if err != nil {
+			s.webhookFailed(c, userID, webhookID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverWebhook sends an earlier delivery again, as a new delivery whose redeliveryOf points at it.
+func (s Server) RedeliverWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		webhookID := c.Param("webhookId")
+		delivery, err := s.Webhooks.RedeliverWebhook(ctx, userID, webhookID, c.Param("deliveryId"))
+		if err != nil {
+			s.webhookFailed(c, userID, webhookID, err)
+			return
+		}
+
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
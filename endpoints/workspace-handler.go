@@ -0,0 +1,414 @@
+package endpoints
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// workspaceQuery selects the workspace a note endpoint works in. Without it they work on personal notes.
+	workspaceQuery  = "workspaceId"
+	maxWorkspaceLen = 255
+)
+
+// selectedWorkspace returns the workspace chosen with the workspace selector, or "" for the personal space of the
+// user. It writes an error response and returns false if the user is not a member of the chosen workspace.
+func (s Server) selectedWorkspace(ctx context.Context, c *gin.Context, userID string) (string, bool) {
+	workspaceID := c.Query(workspaceQuery)
+	if workspaceID == "" {
+		return "", true
+	}
+
+	// Without a workspace store, as with storage drivers other than postgres, there are no workspaces to select.
+	if s.Workspaces == nil {
+		s.workspaceFailed(c, userID, workspaceID, datastore.ErrWorkspaceNotFound)
+		return "", false
+	}
+	if _, err := s.Workspaces.GetWorkspace(ctx, userID, workspaceID); err != nil {
+		s.workspaceFailed(c, userID, workspaceID, err)
+		return "", false
+	}
+	return workspaceID, true
+}
+
+// inSelectedWorkspace reports whether a note belongs to the workspace chosen with the workspace selector. Requests
+// without a selector can reach any note the user has access to.
+func inSelectedWorkspace(c *gin.Context, note types.Note) bool {
+	workspaceID := c.Query(workspaceQuery)
+	return workspaceID == "" || (note.WorkspaceId != nil && *note.WorkspaceId == workspaceID)
+}
+
+// workspaceRequest reads the caller and the workspace a request is about, writing an error response and returning
+// false if either is missing.
+func (s Server) workspaceRequest(c *gin.Context) (userID, workspaceID string, ok bool) {
+	userID = userId(c)
+	if userID == "" {
+		s.logger.Warn("missing user ID in context")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return "", "", false
+	}
+
+	workspaceID = c.Param("workspaceId")
+	if workspaceID == "" {
+		s.logger.Warn("missing workspace ID in request URL")
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "workspace ID must be provided"})
+		return "", "", false
+	}
+
+	return userID, workspaceID, true
+}
+
+// authorizeWorkspace checks the caller holds at least the needed role in the workspace, writing an error response and
+// returning false otherwise.
+func (s Server) authorizeWorkspace(ctx context.Context, c *gin.Context, userID, workspaceID, need string) bool {
+	workspace, err := s.Workspaces.GetWorkspace(ctx, userID, workspaceID)
+	if err != nil {
+		s.workspaceFailed(c, userID, workspaceID, err)
+		return false
+	}
+
+	if !types.PermissionAllows(workspace.Role, need) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only workspace owners can do this"})
+		return false
+	}
+	return true
+}
+
+// workspaceFailed maps a workspace datastore error onto the matching HTTP response.
+func (s Server) workspaceFailed(c *gin.Context, userID, workspaceID string, err error) {
+	switch {
+	case errors.Is(err, datastore.ErrWorkspaceNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "workspace not found"})
+	case errors.Is(err, datastore.ErrMemberNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "member not found"})
+	case errors.Is(err, datastore.ErrInvitationNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+	case errors.Is(err, datastore.ErrAlreadyMember):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "user is already a member of the workspace"})
+	case errors.Is(err, datastore.ErrLastOwner):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a workspace must keep at least one owner"})
+	default:
+		s.logger.Error("workspace request failed", zap.String("userID", userID), zap.String("workspaceID", workspaceID), zap.Error(err))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to process workspace request"})
+	}
+}
+
+func (s Server) CreateWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var dto types.WorkspaceDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		name := strings.TrimSpace(dto.Name)
+		if name == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+			return
+		}
+		if len(name) > maxWorkspaceLen {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name length cannot exceed %d characters", maxWorkspaceLen)})
+			return
+		}
+
+		workspace, err := s.Workspaces.CreateWorkspace(ctx, userID, sanitizeInput(name))
+		if err != nil {
+			s.workspaceFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, workspace)
+	}
+}
+
+func (s Server) GetWorkspaces() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		workspaces, err := s.Workspaces.GetWorkspaces(ctx, userID)
+		if err != nil {
+			s.workspaceFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, workspaces)
+	}
+}
+
+func (s Server) GetWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		workspace, err := s.Workspaces.GetWorkspace(ctx, userID, workspaceID)
+		if err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, workspace)
+	}
+}
+
+// DeleteWorkspace deletes a workspace and every note in it. Only owners can delete a workspace.
+func (s Server) DeleteWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		if !s.authorizeWorkspace(ctx, c, userID, workspaceID, types.PermissionOwner) {
+			return
+		}
+
+		if err := s.Workspaces.DeleteWorkspace(ctx, userID, workspaceID); err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func (s Server) GetWorkspaceMembers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		if !s.authorizeWorkspace(ctx, c, userID, workspaceID, types.PermissionViewer) {
+			return
+		}
+
+		members, err := s.Workspaces.GetWorkspaceMembers(ctx, userID, workspaceID)
+		if err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, members)
+	}
+}
+
+func (s Server) UpdateMemberRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		var dto types.MemberRoleDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !types.IsValidRole(dto.Role) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor or viewer"})
+			return
+		}
+
+		if !s.authorizeWorkspace(ctx, c, userID, workspaceID, types.PermissionOwner) {
+			return
+		}
+
+		member, err := s.Workspaces.UpdateMemberRole(ctx, userID, workspaceID, c.Param("userId"), dto.Role)
+		if err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, member)
+	}
+}
+
+// RemoveMember removes a member from a workspace. Owners can remove anyone, and members can remove themselves to leave
+// the workspace.
+func (s Server) RemoveMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		memberID := c.Param("userId")
+		need := types.PermissionOwner
+		if memberID == userID {
+			need = types.PermissionViewer
+		}
+		if !s.authorizeWorkspace(ctx, c, userID, workspaceID, need) {
+			return
+		}
+
+		if err := s.Workspaces.RemoveMember(ctx, userID, workspaceID, memberID); err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// InviteToWorkspace invites a registered user, by username, to join a workspace with a given role.
+func (s Server) InviteToWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID, workspaceID, ok := s.workspaceRequest(c)
+		if !ok {
+			return
+		}
+
+		var dto types.InvitationDto
+		if err := c.ShouldBindJSON(&dto); err != nil {
+			s.logger.Warn("invalid JSON body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		if !types.IsValidRole(dto.Role) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "role must be owner, editor or viewer"})
+			return
+		}
+
+		if !s.authorizeWorkspace(ctx, c, userID, workspaceID, types.PermissionOwner) {
+			return
+		}
+
+		user, err := s.Users.GetUserByUsername(ctx, strings.TrimSpace(dto.Username))
+		if err != nil {
+			s.logger.Error("failed to look up user", zap.String("username", dto.Username), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to invite user"})
+			return
+		}
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		invitation, err := s.Workspaces.InviteToWorkspace(ctx, userID, workspaceID, types.WorkspaceInvitation{
+			UserId:   user.UserId,
+			Username: user.Username,
+			Role:     dto.Role,
+		})
+		if err != nil {
+			s.workspaceFailed(c, userID, workspaceID, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+// GetInvitations lists the workspace invitations waiting for the caller to accept or decline them.
+func (s Server) GetInvitations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		invitations, err := s.Workspaces.GetInvitations(ctx, userID)
+		if err != nil {
+			s.workspaceFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+func (s Server) AcceptInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		member, err := s.Workspaces.AcceptInvitation(ctx, userID, c.Param("invitationId"))
+		if err != nil {
+			s.workspaceFailed(c, userID, "", err)
+			return
+		}
+
+		c.JSON(http.StatusOK, member)
+	}
+}
+
+func (s Server) DeclineInvitation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		userID := userId(c)
+		if userID == "" {
+			s.logger.Warn("missing user ID in context")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if err := s.Workspaces.DeclineInvitation(ctx, userID, c.Param("invitationId")); err != nil {
+			s.workspaceFailed(c, userID, "", err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
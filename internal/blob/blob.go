@@ -0,0 +1,29 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// New returns the blob store selected by cfg.BlobStore.
+func New(cfg config.Config) (services.BlobStore, error) {
+	switch cfg.BlobStore {
+	case "local":
+		return NewLocalStore(cfg.BlobLocalDir)
+	case "s3":
+		if cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			return nil, fmt.Errorf("S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 blob store")
+		}
+		return NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKeyID, cfg.S3SecretAccessKey,
+			&http.Client{Timeout: 5 * time.Minute})
+	default:
+		return nil, fmt.Errorf("unsupported blob store %q", cfg.BlobStore)
+	}
+}
@@ -0,0 +1,35 @@
+package blob
+
+import (
+	"context"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/internal/jobs"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// DeletionHandler removes the blobs that are no longer used, such as the contents of deleted attachments and the files
+// of finished imports. It runs the jobs of kind types.JobBlobDeletion.
+type DeletionHandler struct {
+	blobs services.BlobStore
+}
+
+func NewDeletionHandler(blobs services.BlobStore) *DeletionHandler {
+	return &DeletionHandler{blobs: blobs}
+}
+
+func (h *DeletionHandler) Run(ctx context.Context, job types.Job, _ jobs.Progress) error {
+	var payload struct {
+		Key string `json:"key"`
+	}
+	if err := jobs.DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	if err := h.blobs.Delete(ctx, payload.Key); err != nil {
+		metrics.CountBlobDeletionErrorsTotal.Inc()
+		return err
+	}
+	return nil
+}
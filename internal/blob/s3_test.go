@@ -0,0 +1,210 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testRegion    = "us-east-1"
+	testBucket    = "attachments"
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// s3Stub is an in-process stand-in for an S3 bucket. It checks the signature of every request the way S3 does and
+// keeps objects in memory under their escaped path.
+type s3Stub struct {
+	mu      sync.Mutex
+	objects map[string]stubObject
+	// fail, when set, answers every request with its status instead.
+	fail int
+}
+
+type stubObject struct {
+	body        []byte
+	contentType string
+}
+
+func newS3Stub(t *testing.T) (*s3Stub, *S3Store) {
+	t.Helper()
+	stub := &s3Stub{objects: make(map[string]stubObject)}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(server.URL, testRegion, testBucket, testAccessKey, testSecretKey, server.Client())
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return stub, store
+}
+
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.validSignature(r) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	if s.fail != 0 {
+		http.Error(w, "InternalError", s.fail)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		s.objects[path] = stubObject{body: body, contentType: r.Header.Get("Content-Type")}
+	case http.MethodHead, http.MethodGet:
+		object, ok := s.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(object.body))
+	case http.MethodDelete:
+		if _, ok := s.objects[path]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(s.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// validSignature recomputes the Signature Version 4 of a request from what arrived on the wire.
+func (s *s3Stub) validSignature(r *http.Request) bool {
+	amzDate := r.Header.Get("X-Amz-Date")
+	date, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || r.Header.Get("X-Amz-Content-Sha256") != unsignedPayload {
+		return false
+	}
+	day := date.Format("20060102")
+	scope := day + "/" + testRegion + "/s3/aws4_request"
+
+	canonicalRequest := r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.Query().Encode() + "\n" +
+		"host:" + r.Host + "\nx-amz-content-sha256:" + unsignedPayload + "\nx-amz-date:" + amzDate + "\n\n" +
+		"host;x-amz-content-sha256;x-amz-date\n" + unsignedPayload
+	hash := sha256.Sum256([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+testSecretKey), day)
+	key = hmacSHA256(key, testRegion)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hex.EncodeToString(hash[:])))
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKey + "/" + scope +
+		", SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=" + signature
+	return r.Header.Get("Authorization") == want
+}
+
+func (s *s3Stub) object(path string) (stubObject, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[path]
+	return object, ok
+}
+
+func TestS3StorePutOpenDelete(t *testing.T) {
+	stub, store := newS3Stub(t)
+	ctx := context.Background()
+
+	key := "notes/42/meeting notes+v2.txt"
+	content := "The quarterly plan, as agreed on Monday."
+	if err := store.Put(ctx, key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	object, ok := stub.object("/attachments/notes/42/meeting%20notes%2Bv2.txt")
+	if !ok {
+		t.Fatal("object not stored under its escaped path")
+	}
+	if string(object.body) != content || object.contentType != "text/plain" {
+		t.Errorf("stored %q as %q, want %q as text/plain", object.body, object.contentType, content)
+	}
+
+	r, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil || string(got) != content {
+		t.Fatalf("ReadAll = %q, %v, want %q", got, err, content)
+	}
+
+	// Seeking starts a ranged GET from the new offset.
+	if _, err := r.Seek(-7, io.SeekEnd); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	got, err = io.ReadAll(r)
+	if err != nil || string(got) != "Monday." {
+		t.Errorf("ReadAll after Seek = %q, %v, want %q", got, err, "Monday.")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := stub.object("/attachments/notes/42/meeting%20notes%2Bv2.txt"); ok {
+		t.Error("object still stored after Delete")
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3StoreNotFound(t *testing.T) {
+	_, store := newS3Stub(t)
+	ctx := context.Background()
+
+	if _, err := store.Open(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open: %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing"); err != nil {
+		t.Errorf("Delete: %v, want nil for a missing object", err)
+	}
+}
+
+func TestS3StoreErrorResponse(t *testing.T) {
+	stub, store := newS3Stub(t)
+	stub.fail = http.StatusServiceUnavailable
+
+	err := store.Put(context.Background(), "a", strings.NewReader("a"), 1, "text/plain")
+	if err == nil || errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Put: %v, want an error reporting the 503", err)
+	}
+}
+
+func TestS3StoreWrongCredentials(t *testing.T) {
+	stub, _ := newS3Stub(t)
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	store, err := NewS3Store(server.URL, testRegion, testBucket, testAccessKey, "not-the-secret", server.Client())
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	if err := store.Put(context.Background(), "a", strings.NewReader("a"), 1, "text/plain"); err == nil {
+		t.Error("Put signed with the wrong secret succeeded")
+	}
+}
@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+)
+
+// ErrMiss is returned by Get when a key is not in the cache, or has expired.
+var ErrMiss = errors.New("cache miss")
+
+// New returns the cache selected by cfg.CacheBackend.
+func New(cfg config.Config) (services.Cache, error) {
+	switch cfg.CacheBackend {
+	case "memory":
+		return NewMemoryCache(cfg.CacheMaxEntries, cfg.CacheMaxBytes)
+	case "redis":
+		return NewRedisCache(cfg.RedisURL)
+	default:
+		return nil, fmt.Errorf("unsupported cache backend %q", cfg.CacheBackend)
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+)
+
+var _ services.Cache = &MemoryCache{}
+
+// MemoryCache keeps values in the memory of this replica, evicting the least recently used ones once it holds more
+// than maxEntries values or maxBytes of keys and values. Expired values are dropped when they are next looked up, or
+// evicted like any other.
+type MemoryCache struct {
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+func NewMemoryCache(maxEntries int, maxBytes int64) (*MemoryCache, error) {
+	if maxEntries <= 0 || maxBytes <= 0 {
+		return nil, errors.New("the in-memory cache needs a positive number of entries and bytes")
+	}
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}, nil
+}
+
+func (m *MemoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		metrics.CountCacheMissesTotal.WithLabelValues("memory").Inc()
+		return nil, ErrMiss
+	}
+	entry := el.Value.(*memoryEntry)
+	if entry.expired(time.Now()) {
+		m.remove(el)
+		metrics.CountCacheEvictionsTotal.WithLabelValues("memory", "expired").Inc()
+		metrics.CountCacheMissesTotal.WithLabelValues("memory").Inc()
+		return nil, ErrMiss
+	}
+
+	m.order.MoveToFront(el)
+	metrics.CountCacheHitsTotal.WithLabelValues("memory").Inc()
+	return append([]byte(nil), entry.value...), nil
+}
+
+// Set stores a value for ttl, or until it is evicted when ttl is not positive. A value too large to ever fit is not
+// stored, and the one it replaces is dropped.
+func (m *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	entry := &memoryEntry{key: key, value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	if entry.size() > m.maxBytes {
+		return nil
+	}
+
+	m.items[key] = m.order.PushFront(entry)
+	m.size += entry.size()
+
+	now := time.Now()
+	for len(m.items) > m.maxEntries || m.size > m.maxBytes {
+		oldest := m.order.Back()
+		reason := "capacity"
+		if oldest.Value.(*memoryEntry).expired(now) {
+			reason = "expired"
+		}
+		m.remove(oldest)
+		metrics.CountCacheEvictionsTotal.WithLabelValues("memory", reason).Inc()
+	}
+	return nil
+}
+
+func (m *MemoryCache) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	return nil
+}
+
+func (m *MemoryCache) remove(el *list.Element) {
+	entry := m.order.Remove(el).(*memoryEntry)
+	delete(m.items, entry.key)
+	m.size -= entry.size()
+}
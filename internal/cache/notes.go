@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// loadTimeout bounds a database call made for several callers at once, which is not cut short when the one that
+// started it gives up.
+const loadTimeout = 5 * time.Second
+
+var (
+	_ services.DBClient        = &NoteCache{}
+	_ services.NoteInvalidator = &NoteCache{}
+)
+
+// NoteCache is a DBClient that serves single notes and first pages of notes from a cache, and the rest from the
+// DBClient it wraps. Concurrent misses for the same value make a single database call.
+//
+// Cached values are keyed by generations: one per user for everything they read, one per note and one per workspace.
+// A change replaces the generations it affects, so later reads use new keys and the stale values are left to expire.
+// Changes made through NoteCache replace those of the user making them, of the owner of the note, of the note and of
+// its workspace. Changes made elsewhere are brought in with InvalidateNotes, or otherwise seen once the values expire
+// after ttl.
+type NoteCache struct {
+	db     services.DBClient
+	cache  services.Cache
+	ttl    time.Duration
+	logger *zap.Logger
+	group  singleflight.Group
+}
+
+// cachedNote keeps the owner of a note, which it does not marshal itself.
+type cachedNote struct {
+	types.Note
+	UserId string `json:"userId"`
+}
+
+type cachedPage struct {
+	Notes []cachedNote `json:"notes"`
+	Total int          `json:"total"`
+}
+
+func NewNoteCache(db services.DBClient, cache services.Cache, ttl time.Duration, logger *zap.Logger) *NoteCache {
+	return &NoteCache{
+		db:     db,
+		cache:  cache,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+func (n *NoteCache) GetSingleNote(ctx context.Context, userId string, noteId string) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		return n.db.GetSingleNote(ctx, userId, noteId)
+	}
+
+	key := "notes:user:" + userId + ":" + n.generation(ctx, "user", userId) +
+		":note:" + noteId + ":" + n.generation(ctx, "note", noteId)
+
+	var cached cachedNote
+	err := n.load(ctx, key, &cached, func(ctx context.Context) (any, error) {
+		note, err := n.db.GetSingleNote(ctx, userId, noteId)
+		return cachedNote{Note: note, UserId: note.UserId}, err
+	})
+	if err != nil {
+		return types.Note{}, err
+	}
+	cached.Note.UserId = cached.UserId
+	return cached.Note, nil
+}
+
+// GetNotes caches the first page of each listing. Later pages are rarely asked for, and would all have to go when
+// anything changes.
+func (n *NoteCache) GetNotes(ctx context.Context, userId string, filter types.NoteFilter, limit, offset int) ([]types.Note, int, error) {
+	if userId == "" || offset != 0 {
+		return n.db.GetNotes(ctx, userId, filter, limit, offset)
+	}
+
+	key := "notes:user:" + userId + ":" + n.generation(ctx, "user", userId) + ":list:" + listKey(filter, limit)
+	if filter.WorkspaceId != "" {
+		key += ":" + n.generation(ctx, "workspace", filter.WorkspaceId)
+	}
+
+	var cached cachedPage
+	err := n.load(ctx, key, &cached, func(ctx context.Context) (any, error) {
+		notes, total, err := n.db.GetNotes(ctx, userId, filter, limit, offset)
+		page := cachedPage{Notes: make([]cachedNote, len(notes)), Total: total}
+		for i, note := range notes {
+			page.Notes[i] = cachedNote{Note: note, UserId: note.UserId}
+		}
+		return page, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	notes := make([]types.Note, len(cached.Notes))
+	for i, note := range cached.Notes {
+		notes[i] = note.Note
+		notes[i].UserId = note.UserId
+	}
+	return notes, cached.Total, nil
+}
+
+func (n *NoteCache) CreateNote(ctx context.Context, userId string, note *types.NoteDto) (types.Note, error) {
+	created, err := n.db.CreateNote(ctx, userId, note)
+	if err != nil {
+		return created, err
+	}
+	n.invalidate(ctx, userId, created)
+	return created, nil
+}
+
+func (n *NoteCache) UpdateNote(ctx context.Context, userId, noteId string, note *types.NoteDto) (types.Note, error) {
+	updated, err := n.db.UpdateNote(ctx, userId, noteId, note)
+	if err != nil {
+		return updated, err
+	}
+	n.invalidate(ctx, userId, updated)
+	return updated, nil
+}
+
+// DeleteNote looks the note up first, so that the lists of its owner and workspace can be refreshed too.
+func (n *NoteCache) DeleteNote(ctx context.Context, userId, noteId string) error {
+	note, err := n.db.GetSingleNote(ctx, userId, noteId)
+	if err != nil {
+		note = types.Note{ID: noteId}
+	}
+
+	if err := n.db.DeleteNote(ctx, userId, noteId); err != nil {
+		return err
+	}
+	n.invalidate(ctx, userId, note)
+	return nil
+}
+
+// InvalidateNotes drops what is cached for users, and for a note and a workspace when their IDs are set, after they
+// were changed without going through NoteCache.
+func (n *NoteCache) InvalidateNotes(ctx context.Context, userIds []string, noteId, workspaceId string) {
+	for _, userId := range userIds {
+		n.bump(ctx, "user", userId)
+	}
+	if noteId != "" {
+		n.bump(ctx, "note", noteId)
+	}
+	if workspaceId != "" {
+		n.bump(ctx, "workspace", workspaceId)
+	}
+}
+
+func (n *NoteCache) invalidate(ctx context.Context, userId string, note types.Note) {
+	n.bump(ctx, "user", userId)
+	if note.UserId != "" && note.UserId != userId {
+		n.bump(ctx, "user", note.UserId)
+	}
+	if note.ID != "" {
+		n.bump(ctx, "note", note.ID)
+	}
+	if note.WorkspaceId != nil {
+		n.bump(ctx, "workspace", *note.WorkspaceId)
+	}
+}
+
+// load reads a value from the cache into dest, or from fetch when it is not there, storing it for next time.
+func (n *NoteCache) load(ctx context.Context, key string, dest any, fetch func(ctx context.Context) (any, error)) error {
+	if data, err := n.cache.Get(ctx, key); err == nil {
+		if err := json.Unmarshal(data, dest); err == nil {
+			return nil
+		}
+		n.logger.Warn("unable to decode cached value", zap.String("operation_name", "load"), zap.String("key", key))
+	} else if !errors.Is(err, ErrMiss) {
+		n.logger.Warn("unable to read from cache", zap.String("operation_name", "load"), zap.String("key", key), zap.Error(err))
+	}
+
+	data, err, _ := n.group.Do(key, func() (any, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		value, err := fetch(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode value for the cache: %w", err)
+		}
+		if err := n.cache.Set(loadCtx, key, data, n.ttl); err != nil {
+			n.logger.Warn("unable to write to cache", zap.String("operation_name", "load"), zap.String("key", key), zap.Error(err))
+		}
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data.([]byte), dest)
+}
+
+// generation returns the current generation of a user, note or workspace, starting a new one when there is none. A
+// generation that cannot be read is replaced by one nothing was cached under, so the database is used instead.
+func (n *NoteCache) generation(ctx context.Context, kind, id string) string {
+	key := "notes:gen:" + kind + ":" + id
+	data, err := n.cache.Get(ctx, key)
+	if err == nil {
+		return string(data)
+	}
+	if !errors.Is(err, ErrMiss) {
+		n.logger.Warn("unable to read cache generation", zap.String("operation_name", "generation"), zap.String("key", key), zap.Error(err))
+		return uuid.NewString()
+	}
+	return n.bump(ctx, kind, id)
+}
+
+// bump starts a new generation of a user, note or workspace. Generations are random, so that one that was replaced or
+// evicted never comes back while values cached under it are still there.
+func (n *NoteCache) bump(ctx context.Context, kind, id string) string {
+	key := "notes:gen:" + kind + ":" + id
+	generation := uuid.NewString()
+	if err := n.cache.Set(ctx, key, []byte(generation), 0); err != nil {
+		n.logger.Error("unable to replace cache generation", zap.String("operation_name", "bump"), zap.String("key", key), zap.Error(err))
+	}
+	return generation
+}
+
+func listKey(filter types.NoteFilter, limit int) string {
+	flag := func(b *bool) string {
+		if b == nil {
+			return "-"
+		}
+		return strconv.FormatBool(*b)
+	}
+	return fmt.Sprintf("%s:%s:%t:%s:%d", flag(filter.Archived), flag(filter.Pinned), filter.PinnedFirst, filter.WorkspaceId, limit)
+}
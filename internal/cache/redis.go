@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+)
+
+const (
+	// redisTimeout bounds a command when the context has no deadline of its own.
+	redisTimeout = 5 * time.Second
+	// redisIdleConns is how many connections are kept open for later commands.
+	redisIdleConns = 16
+	// maxRedisBulkLen bounds the values read back, well above anything the service stores.
+	maxRedisBulkLen = 64 << 20
+)
+
+var _ services.Cache = &RedisCache{}
+
+// RedisCache keeps values in Redis, or any server speaking its protocol (RESP), so that replicas share them. It
+// talks to the server itself over a small pool of connections, using GET, SET with PX, and DEL.
+type RedisCache struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	dialer   net.Dialer
+
+	idle chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+// redisError is an error reply from the server, after which the connection can still be used.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisCache connects lazily to the server at rawURL, given as redis://[user:password@]host:port/db, or rediss://
+// for TLS.
+func NewRedisCache(rawURL string) (*RedisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q", rawURL)
+	}
+
+	r := &RedisCache{
+		addr:   u.Host,
+		dialer: net.Dialer{Timeout: redisTimeout, KeepAlive: time.Minute},
+		idle:   make(chan *redisConn, redisIdleConns),
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil || r.db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		r.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+	return r, nil
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		metrics.CountCacheMissesTotal.WithLabelValues("redis").Inc()
+		return nil, ErrMiss
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T to GET", reply)
+	}
+	metrics.CountCacheHitsTotal.WithLabelValues("redis").Inc()
+	return value, nil
+}
+
+// Set stores a value for ttl, or until Redis evicts it when ttl is not positive. Redis keeps expiry in milliseconds,
+// so shorter ones are rounded up.
+func (r *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := [][]byte{[]byte(key), value}
+	if ttl > 0 {
+		ms := (ttl + time.Millisecond - 1) / time.Millisecond
+		args = append(args, []byte("PX"), []byte(strconv.FormatInt(int64(ms), 10)))
+	}
+	_, err := r.do(ctx, "SET", args...)
+	return err
+}
+
+func (r *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := r.do(ctx, "DEL", []byte(key))
+	return err
+}
+
+// Close closes the idle connections. Commands still running close theirs when they are done.
+func (r *RedisCache) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do sends a command and reads its reply. A connection is only reused after a complete exchange, so that a reply
+// never goes to the wrong command.
+func (r *RedisCache) do(ctx context.Context, cmd string, args ...[]byte) (any, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.do(ctx, cmd, args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		return nil, fmt.Errorf("redis %s: %w", cmd, err)
+	}
+	r.put(c)
+	return reply, err
+}
+
+func (r *RedisCache) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+
+	conn, err := r.dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+	if r.tls != nil {
+		conn = tls.Client(conn, r.tls)
+	}
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+
+	if r.password != "" {
+		args := [][]byte{[]byte(r.password)}
+		if r.username != "" {
+			args = [][]byte{[]byte(r.username), []byte(r.password)}
+		}
+		if _, err := c.do(ctx, "AUTH", args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to authenticate with redis: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do(ctx, "SELECT", []byte(strconv.Itoa(r.db))); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to select redis database %d: %w", r.db, err)
+		}
+	}
+	return c, nil
+}
+
+func (r *RedisCache) put(c *redisConn) {
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+func (c *redisConn) do(ctx context.Context, cmd string, args ...[]byte) (any, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as an array of bulk strings.
+	fmt.Fprintf(c.w, "*%d\r\n$%d\r\n%s\r\n", len(args)+1, len(cmd), cmd)
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n", len(arg))
+		c.w.Write(arg)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// readReply reads a RESP2 reply: a simple string, error, integer, bulk string (nil when null) or array of those.
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n > maxRedisBulkLen {
+			return nil, fmt.Errorf("malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, 0, min(n, 1024))
+		for range n {
+			item, err := c.readReply()
+			var replyErr redisError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = replyErr
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
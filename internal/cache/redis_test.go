@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T, m *miniredis.Miniredis, userinfo, db string) *RedisCache {
+	t.Helper()
+	r, err := NewRedisCache("redis://" + userinfo + m.Addr() + db)
+	if err != nil {
+		t.Fatalf("NewRedisCache: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRedisCacheGetSetDelete(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := newTestRedis(t, m, "", "")
+	ctx := context.Background()
+
+	if _, err := r.Get(ctx, "note:1"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get of a missing key: %v, want ErrMiss", err)
+	}
+
+	// Values are bulk strings, so line breaks and arbitrary bytes come back as they were.
+	value := []byte("{\"title\":\"a\"}\r\n$3\r\n\x00\xff")
+	if err := r.Set(ctx, "note:1", value, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	got, err := r.Get(ctx, "note:1")
+	if err != nil || string(got) != string(value) {
+		t.Fatalf("Get = %q, %v, want %q", got, err, value)
+	}
+	if ttl := m.TTL("note:1"); ttl != 0 {
+		t.Errorf("TTL without expiry = %v, want none", ttl)
+	}
+
+	if err := r.Set(ctx, "empty", []byte{}, 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := r.Get(ctx, "empty"); err != nil || len(got) != 0 {
+		t.Errorf("Get of an empty value = %q, %v, want an empty hit", got, err)
+	}
+
+	if err := r.Delete(ctx, "note:1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := r.Get(ctx, "note:1"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get after Delete: %v, want ErrMiss", err)
+	}
+	if err := r.Delete(ctx, "note:1"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+}
+
+func TestRedisCacheExpiry(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := newTestRedis(t, m, "", "")
+	ctx := context.Background()
+
+	if err := r.Set(ctx, "note:1", []byte("a"), 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := m.TTL("note:1"); ttl != 1500*time.Millisecond {
+		t.Errorf("TTL = %v, want 1.5s", ttl)
+	}
+
+	// Redis keeps expiry in whole milliseconds, so shorter ones are rounded up rather than dropped.
+	if err := r.Set(ctx, "note:2", []byte("b"), time.Microsecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := m.TTL("note:2"); ttl != time.Millisecond {
+		t.Errorf("TTL = %v, want 1ms", ttl)
+	}
+
+	m.FastForward(2 * time.Second)
+	if _, err := r.Get(ctx, "note:1"); !errors.Is(err, ErrMiss) {
+		t.Errorf("Get after expiry: %v, want ErrMiss", err)
+	}
+}
+
+func TestRedisCacheAuthAndSelect(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("user and password", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		m.RequireUserAuth("notes", "s3cret")
+		r := newTestRedis(t, m, "notes:s3cret@", "/3")
+
+		if err := r.Set(ctx, "note:1", []byte("a"), 0); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+		if got, err := m.DB(3).Get("note:1"); err != nil || got != "a" {
+			t.Errorf("database 3 holds %q, %v, want the value", got, err)
+		}
+		if m.Exists("note:1") {
+			t.Error("value was stored in database 0")
+		}
+	})
+
+	t.Run("password only", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		m.RequireAuth("s3cret")
+		r := newTestRedis(t, m, ":s3cret@", "")
+
+		if err := r.Set(ctx, "note:1", []byte("a"), 0); err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		m := miniredis.RunT(t)
+		m.RequireUserAuth("notes", "s3cret")
+		r := newTestRedis(t, m, "notes:guess@", "")
+
+		err := r.Set(ctx, "note:1", []byte("a"), 0)
+		if err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+			t.Fatalf("Set: %v, want an authentication error", err)
+		}
+		if len(r.idle) != 0 {
+			t.Error("connection that failed to authenticate was kept")
+		}
+	})
+}
+
+func TestRedisCacheKeepsConnectionAfterErrorReply(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := newTestRedis(t, m, "", "")
+	ctx := context.Background()
+
+	if _, err := m.Lpush("list", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := r.Get(ctx, "list")
+	var replyErr redisError
+	if !errors.As(err, &replyErr) || !strings.Contains(err.Error(), "WRONGTYPE") {
+		t.Fatalf("GET of a list: %v, want the WRONGTYPE error reply", err)
+	}
+	if len(r.idle) != 1 {
+		t.Fatalf("%d idle connections after an error reply, want 1", len(r.idle))
+	}
+
+	if err := r.Set(ctx, "note:1", []byte("a"), 0); err != nil {
+		t.Fatalf("Set after an error reply: %v", err)
+	}
+	if got, err := r.Get(ctx, "note:1"); err != nil || string(got) != "a" {
+		t.Fatalf("Get after an error reply = %q, %v", got, err)
+	}
+	if n := m.TotalConnectionCount(); n != 1 {
+		t.Errorf("%d connections were opened, want the one to be reused", n)
+	}
+}
+
+func TestRedisCacheDropsBrokenConnection(t *testing.T) {
+	m := miniredis.RunT(t)
+	r := newTestRedis(t, m, "", "")
+	ctx := context.Background()
+
+	if err := r.Set(ctx, "note:1", []byte("a"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	// Restarting closes the idle connection on the server side, keeping the data.
+	m.Close()
+	if err := m.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Get(ctx, "note:1"); err == nil {
+		t.Fatal("Get over a closed connection succeeded")
+	}
+	if len(r.idle) != 0 {
+		t.Fatal("broken connection was put back in the pool")
+	}
+	if got, err := r.Get(ctx, "note:1"); err != nil || string(got) != "a" {
+		t.Errorf("Get on a new connection = %q, %v", got, err)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  any
+	}{
+		{"simple string", "+OK\r\n", "OK"},
+		{"integer", ":42\r\n", int64(42)},
+		{"negative integer", ":-1\r\n", int64(-1)},
+		{"bulk string", "$5\r\nhello\r\n", []byte("hello")},
+		{"bulk string with a line break", "$4\r\na\r\nb\r\n", []byte("a\r\nb")},
+		{"empty bulk string", "$0\r\n\r\n", []byte{}},
+		{"null bulk string", "$-1\r\n", nil},
+		{"array", "*3\r\n$1\r\na\r\n:7\r\n$-1\r\n", []any{[]byte("a"), int64(7), nil}},
+		{"empty array", "*0\r\n", []any{}},
+		{"null array", "*-1\r\n", nil},
+		{"nested array", "*2\r\n*1\r\n+x\r\n$1\r\ny\r\n", []any{[]any{"x"}, []byte("y")}},
+		{"error inside an array", "*2\r\n-ERR bad\r\n:1\r\n", []any{redisError("ERR bad"), int64(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &redisConn{r: bufio.NewReader(strings.NewReader(tt.reply))}
+			got, err := c.readReply()
+			if err != nil {
+				t.Fatalf("readReply: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readReply = %#v, want %#v", got, tt.want)
+			}
+			if rest, _ := c.r.Peek(1); len(rest) != 0 {
+				t.Errorf("%q left unread", rest)
+			}
+		})
+	}
+
+	c := &redisConn{r: bufio.NewReader(strings.NewReader("-WRONGTYPE Operation against a key\r\n"))}
+	if _, err := c.readReply(); err != redisError("WRONGTYPE Operation against a key") {
+		t.Errorf("error reply: %v", err)
+	}
+
+	for _, malformed := range []string{
+		"",
+		"+OK\n",
+		"!\r\n",
+		":x\r\n",
+		"$x\r\n",
+		"$5\r\nhi\r\n",
+		"$99999999999\r\n",
+		"*x\r\n",
+		"*2\r\n:1\r\n",
+	} {
+		c := &redisConn{r: bufio.NewReader(strings.NewReader(malformed))}
+		_, err := c.readReply()
+		var replyErr redisError
+		if err == nil || errors.As(err, &replyErr) {
+			t.Errorf("readReply(%q): %v, want a protocol error", malformed, err)
+		}
+	}
+}
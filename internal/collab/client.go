@@ -0,0 +1,141 @@
+package collab
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = time.Minute
+	pingPeriod = pongWait * 9 / 10
+	// maxMessageSize bounds the messages clients send, which is plenty for an operation on the longest content.
+	maxMessageSize = 64 << 10
+	// sendBuffer is how many messages a client can fall behind by before it is disconnected.
+	sendBuffer = 256
+)
+
+// client is a connection taking part in an editing session.
+type client struct {
+	id      string
+	userId  string
+	canEdit bool
+	conn    *websocket.Conn
+
+	// cursor is guarded by the mutex of the session.
+	cursor *Cursor
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *client) participant() Participant {
+	return Participant{ClientId: c.id, UserId: c.userId, CanEdit: c.canEdit, Cursor: c.cursor}
+}
+
+// queue sends a message to the client without waiting, disconnecting a client that has fallen too far behind.
+func (c *client) queue(msg serverMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		c.close()
+	}
+}
+
+// fail sends the client an error and disconnects it.
+func (c *client) fail(reason string) {
+	c.queue(serverMessage{Type: MessageError, Error: reason})
+	c.close()
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// writePump writes the messages queued for the client and keeps the connection alive, until the client is closed.
+// It then writes what is left in the queue, so that a closing error gets through.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			for {
+				select {
+				case data := <-c.send:
+					if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+						return
+					}
+				default:
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					return
+				}
+			}
+		}
+	}
+}
+
+// readPump hands the messages of the client to its session until the connection closes or the client is
+// disconnected.
+func (c *client) readPump(s *session) {
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.fail("invalid message: " + err.Error())
+			return
+		}
+
+		switch msg.Type {
+		case MessageOp:
+			if msg.Op == nil {
+				c.fail("op is required")
+				return
+			}
+			if err := s.receive(c, msg.Revision, *msg.Op, msg.Cursor); err != nil {
+				c.fail(err.Error())
+				return
+			}
+		case MessageCursor:
+			if msg.Cursor != nil {
+				s.moveCursor(c, *msg.Cursor)
+			}
+		default:
+			c.fail("type must be op or cursor")
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package collab
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+var _ services.Collaboration = &Hub{}
+
+// Hub keeps the editing sessions of the notes being edited on this replica, starting one when the first client joins
+// and ending it when the last one leaves.
+type Hub struct {
+	db           services.DBClient
+	revisions    services.RevisionStore
+	saveInterval time.Duration
+	logger       *zap.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+func NewHub(db services.DBClient, revisions services.RevisionStore, saveInterval time.Duration, logger *zap.Logger) *Hub {
+	return &Hub{
+		db:           db,
+		revisions:    revisions,
+		saveInterval: saveInterval,
+		logger:       logger,
+		sessions:     make(map[string]*session),
+	}
+}
+
+// Serve has a client take part in editing a note until its connection closes. The caller has checked that the user
+// can read the note, and whether they can edit it.
+func (h *Hub) Serve(conn *websocket.Conn, noteId, userId string, canEdit bool) {
+	c := &client{
+		id:      uuid.NewString(),
+		userId:  userId,
+		canEdit: canEdit,
+		conn:    conn,
+		send:    make(chan []byte, sendBuffer),
+		done:    make(chan struct{}),
+	}
+
+	s, err := h.join(c, noteId)
+	if err != nil {
+		c.fail(err.Error())
+		c.writePump()
+		return
+	}
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.writePump()
+	}()
+
+	c.readPump(s)
+	s.leave(c)
+	c.close()
+	<-written
+}
+
+// join adds a client to the session of a note, starting the session if there is none.
+func (h *Hub) join(c *client, noteId string) (*session, error) {
+	for {
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			return nil, errShuttingDown
+		}
+		s, ok := h.sessions[noteId]
+		if !ok {
+			s = newSession(h, noteId)
+			h.sessions[noteId] = s
+			h.wg.Add(1)
+			h.mu.Unlock()
+
+			s.loadErr = s.load(c.userId)
+			close(s.ready)
+			if s.loadErr != nil {
+				h.remove(s)
+				h.wg.Done()
+				return nil, s.loadErr
+			}
+			go func() {
+				defer h.wg.Done()
+				s.run()
+			}()
+		} else {
+			h.mu.Unlock()
+			<-s.ready
+			if s.loadErr != nil {
+				return nil, s.loadErr
+			}
+		}
+
+		if s.add(c) {
+			return s, nil
+		}
+		if h.isClosed() {
+			s.endIfIdle()
+			return nil, errShuttingDown
+		}
+		// The session is ending, so wait for it to save and join the next one.
+		<-s.finished
+	}
+}
+
+func (h *Hub) isClosed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.closed
+}
+
+func (h *Hub) remove(s *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.sessions[s.noteId] == s {
+		delete(h.sessions, s.noteId)
+	}
+}
+
+// Run waits for ctx to be done, then disconnects every client and waits for the sessions to save.
+func (h *Hub) Run(ctx context.Context) {
+	<-ctx.Done()
+
+	h.mu.Lock()
+	h.closed = true
+	sessions := make([]*session, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mu.Unlock()
+
+	for _, s := range sessions {
+		s.shutdown(errShuttingDown.Error())
+	}
+	h.wg.Wait()
+}
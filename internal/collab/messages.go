@@ -0,0 +1,51 @@
+package collab
+
+// The messages clients send: an operation made to a revision of the content, or where their cursor is now.
+const (
+	MessageOp     = "op"
+	MessageCursor = "cursor"
+)
+
+// The messages clients are sent. init comes first, with the content at the latest revision and who else is editing.
+// ack confirms an operation of the client, which is sent to the others as op. presence and leave tell of other
+// clients joining, moving their cursor and leaving. error comes just before the connection is closed.
+const (
+	MessageInit     = "init"
+	MessageAck      = "ack"
+	MessagePresence = "presence"
+	MessageLeave    = "leave"
+	MessageError    = "error"
+)
+
+// Cursor is where a client's cursor is in the content, and where its selection ends, counted in code points.
+type Cursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selectionEnd"`
+}
+
+// Participant is a client in an editing session. A user may take part from several clients.
+type Participant struct {
+	ClientId string  `json:"clientId"`
+	UserId   string  `json:"userId"`
+	CanEdit  bool    `json:"canEdit"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+type clientMessage struct {
+	Type     string     `json:"type"`
+	Revision int        `json:"revision"`
+	Op       *Operation `json:"op"`
+	Cursor   *Cursor    `json:"cursor"`
+}
+
+type serverMessage struct {
+	Type         string        `json:"type"`
+	ClientId     string        `json:"clientId,omitempty"`
+	UserId       string        `json:"userId,omitempty"`
+	Revision     int           `json:"revision"`
+	Content      *string       `json:"content,omitempty"`
+	Op           *Operation    `json:"op,omitempty"`
+	Cursor       *Cursor       `json:"cursor,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
@@ -0,0 +1,44 @@
+package collab
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CheckOrigin returns the origin check for WebSocket handshakes. Browsers send the basic auth credentials they have
+// cached along with cross-site handshakes too, so only pages served from publicBaseURL may open a connection. Clients
+// that are not browsers send no Origin header and are let through.
+func CheckOrigin(publicBaseURL string) func(r *http.Request) bool {
+	allowed, ok := origin(publicBaseURL)
+	return func(r *http.Request) bool {
+		header := r.Header.Get("Origin")
+		if header == "" {
+			return true
+		}
+		got, valid := origin(header)
+		return ok && valid && got == allowed
+	}
+}
+
+// origin reduces a URL to its scheme, host and port, spelling out the default port of the scheme.
+func origin(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		switch scheme {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		default:
+			return "", false
+		}
+	}
+	return scheme + "://" + strings.ToLower(u.Hostname()) + ":" + port, true
+}
@@ -0,0 +1,38 @@
+package collab
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		origin  string
+		allowed bool
+	}{
+		{"no origin", "https://notes.example.com", "", true},
+		{"same origin", "https://notes.example.com", "https://notes.example.com", true},
+		{"case and default port", "https://notes.example.com", "HTTPS://Notes.Example.com:443", true},
+		{"base URL with a path", "https://example.com/notes", "https://example.com", true},
+		{"local development", "http://localhost:8080", "http://localhost:8080", true},
+		{"other site", "https://notes.example.com", "https://evil.example", false},
+		{"subdomain", "https://example.com", "https://notes.example.com", false},
+		{"other scheme", "https://notes.example.com", "http://notes.example.com", false},
+		{"other port", "http://localhost:8080", "http://localhost:3000", false},
+		{"opaque origin", "https://notes.example.com", "null", false},
+		{"invalid base URL", "notes.example.com", "https://notes.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/note/1/edit", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := CheckOrigin(tt.baseURL)(r); got != tt.allowed {
+				t.Errorf("CheckOrigin(%q) with Origin %q = %v, want %v", tt.baseURL, tt.origin, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package collab
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// component is one step of an operation: retaining n characters when n > 0, deleting -n characters when n < 0, or
+// inserting s.
+type component struct {
+	n int
+	s string
+}
+
+// Operation is a change to the content of a note, in the format of ot.js text operations: it walks the whole document,
+// retaining, deleting and inserting characters along the way. Lengths are in Unicode code points. In JSON an operation
+// is an array in which a positive number retains that many characters, a negative number deletes them and a string is
+// inserted.
+type Operation struct {
+	components []component
+	// baseLen is the length of the documents the operation applies to, and targetLen the length of the result.
+	baseLen   int
+	targetLen int
+}
+
+func (o *Operation) retain(n int) {
+	if n == 0 {
+		return
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if last := len(o.components) - 1; last >= 0 && o.components[last].s == "" && o.components[last].n > 0 {
+		o.components[last].n += n
+		return
+	}
+	o.components = append(o.components, component{n: n})
+}
+
+// insert keeps inserts ahead of deletes they are next to, so that equal operations have the same components.
+func (o *Operation) insert(s string) {
+	if s == "" {
+		return
+	}
+	o.targetLen += utf8.RuneCountInString(s)
+	last := len(o.components) - 1
+	if last >= 0 && o.components[last].s != "" {
+		o.components[last].s += s
+		return
+	}
+	if last >= 0 && o.components[last].n < 0 {
+		if last > 0 && o.components[last-1].s != "" {
+			o.components[last-1].s += s
+			return
+		}
+		o.components = append(o.components, o.components[last])
+		o.components[last] = component{s: s}
+		return
+	}
+	o.components = append(o.components, component{s: s})
+}
+
+func (o *Operation) delete(n int) {
+	if n == 0 {
+		return
+	}
+	o.baseLen += n
+	if last := len(o.components) - 1; last >= 0 && o.components[last].s == "" && o.components[last].n < 0 {
+		o.components[last].n -= n
+		return
+	}
+	o.components = append(o.components, component{n: -n})
+}
+
+// BaseLen is the length of the documents the operation applies to.
+func (o Operation) BaseLen() int {
+	return o.baseLen
+}
+
+// IsNoop reports whether the operation leaves documents as they are.
+func (o Operation) IsNoop() bool {
+	return len(o.components) == 0 || (len(o.components) == 1 && o.components[0].s == "" && o.components[0].n > 0)
+}
+
+func (o Operation) MarshalJSON() ([]byte, error) {
+	steps := make([]any, len(o.components))
+	for i, c := range o.components {
+		if c.s != "" {
+			steps[i] = c.s
+		} else {
+			steps[i] = c.n
+		}
+	}
+	return json.Marshal(steps)
+}
+
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var steps []json.RawMessage
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidOperation, err)
+	}
+
+	*o = Operation{}
+	for _, step := range steps {
+		if bytes.HasPrefix(bytes.TrimSpace(step), []byte(`"`)) {
+			var s string
+			if err := json.Unmarshal(step, &s); err != nil || s == "" {
+				return fmt.Errorf("%w: inserts must be non-empty strings", ErrInvalidOperation)
+			}
+			o.insert(s)
+			continue
+		}
+
+		var n int
+		if err := json.Unmarshal(step, &n); err != nil || n == 0 {
+			return fmt.Errorf("%w: steps must be strings or non-zero integers", ErrInvalidOperation)
+		}
+		if n > 0 {
+			o.retain(n)
+		} else {
+			o.delete(-n)
+		}
+	}
+	return nil
+}
+
+// Apply applies the operation to a document.
+func (o Operation) Apply(doc []rune) ([]rune, error) {
+	if len(doc) != o.baseLen {
+		return nil, fmt.Errorf("%w: it applies to documents of %d characters, not %d", ErrInvalidOperation, o.baseLen, len(doc))
+	}
+
+	result := make([]rune, 0, o.targetLen)
+	index := 0
+	for _, c := range o.components {
+		switch {
+		case c.s != "":
+			result = append(result, []rune(c.s)...)
+		case c.n > 0:
+			result = append(result, doc[index:index+c.n]...)
+			index += c.n
+		default:
+			index -= c.n
+		}
+	}
+	return result, nil
+}
+
+// Transform takes two operations made concurrently to the same document and returns a' and b' such that applying a and
+// then b' gives the same document as applying b and then a'. When both insert at the same place, the insert of a comes
+// first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.baseLen != b.baseLen {
+		return Operation{}, Operation{}, fmt.Errorf("%w: concurrent operations apply to documents of different lengths", ErrInvalidOperation)
+	}
+
+	var aPrime, bPrime Operation
+	as, bs := a.components, b.components
+	var c1, c2 *component
+	next := func(cs *[]component) *component {
+		if len(*cs) == 0 {
+			return nil
+		}
+		c := (*cs)[0]
+		*cs = (*cs)[1:]
+		return &c
+	}
+	c1, c2 = next(&as), next(&bs)
+
+	for c1 != nil || c2 != nil {
+		if c1 != nil && c1.s != "" {
+			aPrime.insert(c1.s)
+			bPrime.retain(utf8.RuneCountInString(c1.s))
+			c1 = next(&as)
+			continue
+		}
+		if c2 != nil && c2.s != "" {
+			aPrime.retain(utf8.RuneCountInString(c2.s))
+			bPrime.insert(c2.s)
+			c2 = next(&bs)
+			continue
+		}
+		if c1 == nil || c2 == nil {
+			return Operation{}, Operation{}, fmt.Errorf("%w: concurrent operations do not cover the same document", ErrInvalidOperation)
+		}
+
+		n1, n2 := abs(c1.n), abs(c2.n)
+		m := min(n1, n2)
+		switch {
+		case c1.n > 0 && c2.n > 0:
+			aPrime.retain(m)
+			bPrime.retain(m)
+		case c1.n < 0 && c2.n < 0:
+			// Both deleted the same characters.
+		case c1.n < 0:
+			aPrime.delete(m)
+		default:
+			bPrime.delete(m)
+		}
+
+		c1 = shorten(c1, m, next, &as)
+		c2 = shorten(c2, m, next, &bs)
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// shorten takes m characters off a retain or delete, moving on to the next component once it is used up.
+func shorten(c *component, m int, next func(*[]component) *component, rest *[]component) *component {
+	if abs(c.n) == m {
+		return next(rest)
+	}
+	if c.n > 0 {
+		c.n -= m
+	} else {
+		c.n += m
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// TransformIndex moves a position in a document, such as a cursor, to where it is after the operation. Text inserted at
+// the position pushes it along.
+func TransformIndex(pos int, o Operation) int {
+	moved, index := pos, 0
+	for _, c := range o.components {
+		if index > pos {
+			break
+		}
+		switch {
+		case c.s != "":
+			moved += utf8.RuneCountInString(c.s)
+		case c.n > 0:
+			index += c.n
+		default:
+			moved -= min(-c.n, max(pos-index, 0))
+			index -= c.n
+		}
+	}
+	return moved
+}
+
+// Diff returns an operation that turns one document into another, replacing whatever lies between their common prefix
+// and suffix.
+func Diff(from, to []rune) Operation {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	var o Operation
+	o.retain(prefix)
+	o.insert(string(to[prefix : len(to)-suffix]))
+	o.delete(len(from) - prefix - suffix)
+	o.retain(suffix)
+	return o
+}
@@ -0,0 +1,291 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// parseOp reads an operation in its JSON form.
+func parseOp(t *testing.T, s string) Operation {
+	t.Helper()
+	var o Operation
+	if err := json.Unmarshal([]byte(s), &o); err != nil {
+		t.Fatalf("unmarshal %s: %v", s, err)
+	}
+	return o
+}
+
+func opJSON(t *testing.T, o Operation) string {
+	t.Helper()
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(b)
+}
+
+func TestOperationJSON(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`[]`, `[]`},
+		{`[3]`, `[3]`},
+		{`[1, 2, "a", "b", -1, -2]`, `[3,"ab",-3]`},
+		// Inserts are kept ahead of deletes they are next to.
+		{`[-2, "x", 1]`, `["x",-2,1]`},
+		{`[-1, "x", -1, "y"]`, `["xy",-2]`},
+	}
+	for _, tt := range tests {
+		if got := opJSON(t, parseOp(t, tt.in)); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{`{}`, `[0]`, `[""]`, `[1.5]`, `[true]`, `[null]`} {
+		var o Operation
+		if err := json.Unmarshal([]byte(invalid), &o); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("%s: %v, want ErrInvalidOperation", invalid, err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		doc, op, want string
+	}{
+		{"", `[]`, ""},
+		{"", `["hello"]`, "hello"},
+		{"hello", `[5, " world"]`, "hello world"},
+		{"hello world", `[-6, 5]`, "world"},
+		{"hello world", `[6, "there", -5]`, "hello there"},
+		{"héllo wörld", `[1, -1, "e", 5, -1, "o", 3]`, "hello world"},
+		{"🙂🙃", `[1, "!", 1]`, "🙂!🙃"},
+	}
+	for _, tt := range tests {
+		got, err := parseOp(t, tt.op).Apply([]rune(tt.doc))
+		if err != nil {
+			t.Errorf("%s to %q: %v", tt.op, tt.doc, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s to %q = %q, want %q", tt.op, tt.doc, string(got), tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ doc, op string }{
+		{"abc", `[2]`},
+		{"abc", `[4]`},
+		{"abc", `[1, -3]`},
+		{"", `[-1]`},
+	} {
+		if _, err := parseOp(t, tt.op).Apply([]rune(tt.doc)); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("%s to %q: %v, want ErrInvalidOperation", tt.op, tt.doc, err)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name           string
+		doc, a, b      string
+		aPrime, bPrime string
+		want           string
+	}{
+		{
+			name: "inserts at different places",
+			doc:  "abc", a: `["x", 3]`, b: `[3, "y"]`,
+			aPrime: `["x",4]`, bPrime: `[4,"y"]`,
+			want: "xabcy",
+		},
+		{
+			name: "inserts at the same place put a first",
+			doc:  "abc", a: `[1, "x", 2]`, b: `[1, "y", 2]`,
+			aPrime: `[1,"x",3]`, bPrime: `[2,"y",2]`,
+			want: "axybc",
+		},
+		{
+			name: "the same delete is only made once",
+			doc:  "abcdef", a: `[1, -2, 3]`, b: `[1, -2, 3]`,
+			aPrime: `[4]`, bPrime: `[4]`,
+			want: "adef",
+		},
+		{
+			name: "overlapping deletes",
+			doc:  "abcdef", a: `[1, -3, 2]`, b: `[2, -3, 1]`,
+			aPrime: `[1,-1,1]`, bPrime: `[1,-1,1]`,
+			want: "af",
+		},
+		{
+			name: "insert inside a deleted range survives",
+			doc:  "abcdef", a: `[2, "x", 4]`, b: `[1, -4, 1]`,
+			aPrime: `[1,"x",1]`, bPrime: `[1,-1,1,-3,1]`,
+			want: "axf",
+		},
+		{
+			name: "noop against an edit",
+			doc:  "abc", a: `[3]`, b: `[-1, "z", 2]`,
+			aPrime: `[3]`, bPrime: `["z",-1,2]`,
+			want: "zbc",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parseOp(t, tt.a), parseOp(t, tt.b)
+			aPrime, bPrime, err := Transform(a, b)
+			if err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+			if got := opJSON(t, aPrime); got != tt.aPrime {
+				t.Errorf("a' = %s, want %s", got, tt.aPrime)
+			}
+			if got := opJSON(t, bPrime); got != tt.bPrime {
+				t.Errorf("b' = %s, want %s", got, tt.bPrime)
+			}
+			if got := applyBoth(t, []rune(tt.doc), a, bPrime); got != tt.want {
+				t.Errorf("a then b' = %q, want %q", got, tt.want)
+			}
+			if got := applyBoth(t, []rune(tt.doc), b, aPrime); got != tt.want {
+				t.Errorf("b then a' = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Transform(parseOp(t, `[3]`), parseOp(t, `[2]`)); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("operations on documents of different lengths: %v, want ErrInvalidOperation", err)
+	}
+}
+
+func applyBoth(t *testing.T, doc []rune, first, second Operation) string {
+	t.Helper()
+	doc, err := first.Apply(doc)
+	if err != nil {
+		t.Fatalf("apply %s: %v", opJSON(t, first), err)
+	}
+	doc, err = second.Apply(doc)
+	if err != nil {
+		t.Fatalf("apply %s: %v", opJSON(t, second), err)
+	}
+	return string(doc)
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  int
+		op   string
+		want int
+	}{
+		{"insert before", 3, `["ab", 5]`, 5},
+		{"insert at the position pushes it", 3, `[3, "ab", 2]`, 5},
+		{"insert after", 3, `[4, "ab", 1]`, 3},
+		{"delete before", 3, `[-2, 3]`, 1},
+		{"delete across", 3, `[1, -4]`, 1},
+		{"delete after", 3, `[3, -2]`, 3},
+		{"replace before", 4, `[1, "xyz", -2, 2]`, 5},
+		{"start of the document", 0, `["ab", 5]`, 2},
+		{"end of the document", 5, `[5, "ab"]`, 7},
+	}
+	for _, tt := range tests {
+		if got := TransformIndex(tt.pos, parseOp(t, tt.op)); got != tt.want {
+			t.Errorf("%s: TransformIndex(%d, %s) = %d, want %d", tt.name, tt.pos, tt.op, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		from, to, want string
+	}{
+		{"", "", `[]`},
+		{"same", "same", `[4]`},
+		{"", "new", `["new"]`},
+		{"old", "", `[-3]`},
+		{"hello world", "hello there world", `[6,"there ",5]`},
+		{"hello there world", "hello world", `[6,-6,5]`},
+		{"abcdef", "abXYef", `[2,"XY",-2,2]`},
+		{"aaa", "aaaa", `[3,"a"]`},
+		{"wörld", "world", `[1,"o",-1,3]`},
+	}
+	for _, tt := range tests {
+		o := Diff([]rune(tt.from), []rune(tt.to))
+		if got := opJSON(t, o); got != tt.want {
+			t.Errorf("Diff(%q, %q) = %s, want %s", tt.from, tt.to, got, tt.want)
+		}
+		got, err := o.Apply([]rune(tt.from))
+		if err != nil || string(got) != tt.to {
+			t.Errorf("Diff(%q, %q) applied = %q, %v", tt.from, tt.to, string(got), err)
+		}
+	}
+}
+
+// alphabet has multi-byte characters so that lengths in code points and bytes differ.
+var alphabet = []rune("abcdé🙂\n ")
+
+func randomText(r *rand.Rand, max int) string {
+	text := make([]rune, r.Intn(max+1))
+	for i := range text {
+		text[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(text)
+}
+
+// randomOp makes an operation that applies to doc out of a random mix of retains, deletes and inserts.
+func randomOp(r *rand.Rand, doc []rune) Operation {
+	var o Operation
+	for left := len(doc); left > 0; {
+		n := 1 + r.Intn(left)
+		switch r.Intn(3) {
+		case 0:
+			o.retain(n)
+			left -= n
+		case 1:
+			o.delete(n)
+			left -= n
+		default:
+			o.insert(randomText(r, 4))
+		}
+	}
+	if r.Intn(2) == 0 {
+		o.insert(randomText(r, 4))
+	}
+	return o
+}
+
+func TestTransformConvergence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		doc := []rune(randomText(r, 20))
+		a, b := randomOp(r, doc), randomOp(r, doc)
+
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Transform(%s, %s) on %q: %v", opJSON(t, a), opJSON(t, b), string(doc), err)
+		}
+		viaA := applyBoth(t, doc, a, bPrime)
+		viaB := applyBoth(t, doc, b, aPrime)
+		if viaA != viaB {
+			t.Fatalf("on %q, a=%s b=%s: a then b' = %q but b then a' = %q",
+				string(doc), opJSON(t, a), opJSON(t, b), viaA, viaB)
+		}
+
+		// A cursor moved through either order ends up in the same document at a valid position.
+		pos := r.Intn(len(doc) + 1)
+		for _, moved := range []int{
+			TransformIndex(TransformIndex(pos, a), bPrime),
+			TransformIndex(TransformIndex(pos, b), aPrime),
+		} {
+			if moved < 0 || moved > len([]rune(viaA)) {
+				t.Fatalf("on %q, a=%s b=%s: cursor %d moved to %d, outside %q",
+					string(doc), opJSON(t, a), opJSON(t, b), pos, moved, viaA)
+			}
+		}
+
+		// The diff from the original document takes it to the merged one.
+		diff := Diff(doc, []rune(viaA))
+		if got, err := diff.Apply(doc); err != nil || string(got) != viaA {
+			t.Fatalf("Diff(%q, %q) applied = %q, %v", string(doc), viaA, string(got), err)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// maxSaveAttempts bounds how often a save is tried again when the note was saved by someone else in between.
+const maxSaveAttempts = 5
+
+// maxHistory bounds the operations a session keeps to transform the operations of clients that are behind. A client
+// further behind than that is disconnected, and starts again from the latest revision when it rejoins.
+const maxHistory = 1000
+
+var (
+	errReadOnly       = errors.New("you do not have permission to edit this note")
+	errStaleRevision  = errors.New("revision is too old or unknown, rejoin to catch up")
+	errContentTooLong = fmt.Errorf("content length cannot exceed %d characters", types.MaxNoteContentLen)
+	errShuttingDown   = errors.New("the server is shutting down, reconnect to carry on editing")
+)
+
+// session is the editing session of a note, shared by every client editing it on this replica. Operations are
+// transformed against those applied since the revision they were made to, then applied and sent to the other clients.
+// The session saves the content every so often through the DBClient, merging in whatever was saved to the note by
+// others in the meantime, be it through the API or by the session of another replica.
+type session struct {
+	hub    *Hub
+	noteId string
+
+	// ready is closed once the note has been loaded, or failed to load with loadErr.
+	ready   chan struct{}
+	loadErr error
+	// stop is closed when the last client leaves, after which the session saves the content one last time and closes
+	// finished.
+	stop     chan struct{}
+	stopOnce sync.Once
+	finished chan struct{}
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	ended   bool
+	doc     []rune
+	// revision counts the operations applied since the session started, the latest of which are in history.
+	revision int
+	history  []Operation
+	// saved is the content of the note at version, as last loaded or saved. unsaved are the operations applied to it
+	// since, and editors who made them.
+	saved   []rune
+	version int
+	unsaved []Operation
+	editors []string
+	// saver is who the note is read and saved as: the last user to edit it, or the one who started the session.
+	saver string
+}
+
+func newSession(hub *Hub, noteId string) *session {
+	return &session{
+		hub:      hub,
+		noteId:   noteId,
+		ready:    make(chan struct{}),
+		stop:     make(chan struct{}),
+		finished: make(chan struct{}),
+		clients:  make(map[*client]struct{}),
+	}
+}
+
+func (s *session) load(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	note, err := s.hub.db.GetSingleNote(ctx, userId, s.noteId)
+	if err != nil {
+		return err
+	}
+
+	s.doc = []rune(note.Content)
+	s.saved = s.doc
+	s.version = note.Version
+	s.saver = userId
+	return nil
+}
+
+// add joins a client to the session, sending it the content and telling the others. It fails once the session has
+// ended, in which case the client has to wait for the next one, or once the hub is shutting down.
+func (s *session) add(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended || s.hub.isClosed() {
+		return false
+	}
+
+	participants := make([]Participant, 0, len(s.clients)+1)
+	for other := range s.clients {
+		participants = append(participants, other.participant())
+		other.queue(serverMessage{Type: MessagePresence, ClientId: c.id, UserId: c.userId, Revision: s.revision})
+	}
+	s.clients[c] = struct{}{}
+	participants = append(participants, c.participant())
+
+	content := string(s.doc)
+	c.queue(serverMessage{Type: MessageInit, ClientId: c.id, UserId: c.userId, Revision: s.revision, Content: &content, Participants: participants})
+	return true
+}
+
+// leave removes a client from the session, ending the session when it was the last one.
+func (s *session) leave(c *client) {
+	s.mu.Lock()
+	if _, ok := s.clients[c]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.clients, c)
+	for other := range s.clients {
+		other.queue(serverMessage{Type: MessageLeave, ClientId: c.id, UserId: c.userId, Revision: s.revision})
+	}
+	last := len(s.clients) == 0
+	if last {
+		s.ended = true
+	}
+	s.mu.Unlock()
+
+	if last {
+		s.end()
+	}
+}
+
+// endIfIdle ends the session if no client has joined it.
+func (s *session) endIfIdle() {
+	s.mu.Lock()
+	idle := len(s.clients) == 0
+	if idle {
+		s.ended = true
+	}
+	s.mu.Unlock()
+
+	if idle {
+		s.end()
+	}
+}
+
+func (s *session) end() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// shutdown disconnects every client, which ends the session.
+func (s *session) shutdown(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.clients {
+		c.fail(reason)
+	}
+}
+
+// receive applies an operation a client made to the given revision, with where its cursor is after it.
+func (s *session) receive(c *client, revision int, op Operation, cursor *Cursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !c.canEdit {
+		return errReadOnly
+	}
+
+	first := s.revision - len(s.history)
+	if revision < first || revision > s.revision {
+		return errStaleRevision
+	}
+	for _, concurrent := range s.history[revision-first:] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return err
+		}
+	}
+
+	doc, err := op.Apply(s.doc)
+	if err != nil {
+		return err
+	}
+	if len(string(doc)) > types.MaxNoteContentLen {
+		return errContentTooLong
+	}
+
+	s.unsaved = append(s.unsaved, op)
+	s.editors = append(s.editors, c.userId)
+	s.saver = c.userId
+	s.apply(c, doc, op, cursor)
+	return nil
+}
+
+// apply makes doc, the result of op, the latest revision and sends op to the clients. from is the client that made
+// the operation, which is only sent an acknowledgement, or nil for changes merged in from the note.
+func (s *session) apply(from *client, doc []rune, op Operation, cursor *Cursor) {
+	s.doc = doc
+	s.revision++
+	s.history = append(s.history, op)
+	if len(s.history) > maxHistory {
+		s.history = slices.Clone(s.history[len(s.history)-maxHistory:])
+	}
+
+	for c := range s.clients {
+		if c == from {
+			continue
+		}
+		if c.cursor != nil {
+			c.cursor = &Cursor{Position: TransformIndex(c.cursor.Position, op), SelectionEnd: TransformIndex(c.cursor.SelectionEnd, op)}
+		}
+	}
+
+	msg := serverMessage{Type: MessageOp, Revision: s.revision, Op: &op}
+	if from != nil {
+		if cursor != nil && s.validCursor(*cursor) {
+			from.cursor = cursor
+		} else if from.cursor != nil {
+			from.cursor = &Cursor{Position: TransformIndex(from.cursor.Position, op), SelectionEnd: TransformIndex(from.cursor.SelectionEnd, op)}
+		}
+		msg.ClientId, msg.UserId, msg.Cursor = from.id, from.userId, from.cursor
+		from.queue(serverMessage{Type: MessageAck, Revision: s.revision})
+	}
+
+	for c := range s.clients {
+		if c != from {
+			c.queue(msg)
+		}
+	}
+}
+
+func (s *session) validCursor(cursor Cursor) bool {
+	return cursor.Position >= 0 && cursor.Position <= len(s.doc) && cursor.SelectionEnd >= 0 && cursor.SelectionEnd <= len(s.doc)
+}
+
+// moveCursor records where the cursor of a client is and tells the others. Cursors outside the content are ignored.
+func (s *session) moveCursor(c *client, cursor Cursor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.validCursor(cursor) {
+		return
+	}
+	c.cursor = &cursor
+	for other := range s.clients {
+		if other != c {
+			other.queue(serverMessage{Type: MessagePresence, ClientId: c.id, UserId: c.userId, Revision: s.revision, Cursor: c.cursor})
+		}
+	}
+}
+
+// run saves the content every save interval until the session ends, and then one last time.
+func (s *session) run() {
+	defer close(s.finished)
+
+	logger := s.hub.logger.With(zap.String("noteId", s.noteId))
+	ticker := time.NewTicker(s.hub.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			if err := s.save(); err != nil {
+				logger.Error("unable to save note at the end of an editing session", zap.Error(err))
+			}
+			s.hub.remove(s)
+			return
+		case <-ticker.C:
+			err := s.save()
+			switch {
+			case errors.Is(err, datastore.ErrNoteNoteFound), errors.Is(err, datastore.ErrPermissionDenied):
+				logger.Info("note can no longer be edited, ending its editing session", zap.Error(err))
+				s.shutdown("the note has been deleted or can no longer be edited")
+			case err != nil:
+				logger.Warn("unable to save note, it will be tried again", zap.Error(err))
+			}
+		}
+	}
+}
+
+// save merges in the changes saved to the note by others since the session last loaded or saved it, then saves the
+// content if the session has changed it, along with a revision. A note saved by someone else in between is read and
+// merged again, up to maxSaveAttempts times.
+func (s *session) save() error {
+	var err error
+	for attempt := 1; attempt <= maxSaveAttempts; attempt++ {
+		if err = s.trySave(); !errors.Is(err, datastore.ErrVersionConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("note kept being saved by others after %d attempts: %w", maxSaveAttempts, err)
+}
+
+// trySave is a single attempt of save, which fails with datastore.ErrVersionConflict when the note was saved by
+// someone else since it was read.
+func (s *session) trySave() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.mu.Lock()
+	saver := s.saver
+	s.mu.Unlock()
+
+	note, err := s.hub.db.GetSingleNote(ctx, saver, s.noteId)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if note.Version != s.version {
+		if err := s.merge(note); err != nil {
+			s.mu.Unlock()
+			return err
+		}
+	}
+	if len(s.unsaved) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	content, version, saved := string(s.doc), s.version, len(s.unsaved)
+	saver = s.saver
+	editors := slices.Compact(slices.Sorted(slices.Values(s.editors[:saved])))
+	s.mu.Unlock()
+
+	updated, err := s.hub.db.UpdateNote(ctx, saver, s.noteId, &types.NoteDto{Content: &content, Version: &version})
+	if err != nil {
+		return err
+	}
+
+	// Operations applied while saving stay unsaved, on top of what was saved.
+	s.mu.Lock()
+	s.saved = []rune(content)
+	s.version = updated.Version
+	s.unsaved = s.unsaved[saved:]
+	s.editors = s.editors[saved:]
+	s.mu.Unlock()
+
+	revision := types.NoteRevision{NoteId: s.noteId, Version: updated.Version, Content: content, Editors: editors}
+	if err := s.hub.revisions.AddNoteRevision(ctx, revision); err != nil {
+		s.hub.logger.Warn("unable to record revision", zap.String("noteId", s.noteId), zap.Error(err))
+	}
+	return nil
+}
+
+// merge brings in the content of the note as saved by someone else. What changed since the session last loaded or
+// saved it is applied as an operation, after the unsaved operations of the session, which are rebased onto the note.
+func (s *session) merge(note types.Note) error {
+	current := []rune(note.Content)
+	external := Diff(s.saved, current)
+	for i, op := range s.unsaved {
+		var err error
+		if external, s.unsaved[i], err = Transform(external, op); err != nil {
+			return err
+		}
+	}
+
+	s.saved = current
+	s.version = note.Version
+	if external.IsNoop() {
+		return nil
+	}
+
+	doc, err := external.Apply(s.doc)
+	if err != nil {
+		return err
+	}
+	s.apply(nil, doc, external, nil)
+	return nil
+}
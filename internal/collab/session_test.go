@@ -0,0 +1,112 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// racingDB saves an edit of its own to the note right before each of the first races updates made through it, as
+// another replica or an API client would.
+type racingDB struct {
+	services.DBClient
+	races int
+	edit  func(content string) string
+}
+
+func (r *racingDB) UpdateNote(ctx context.Context, userId, noteId string, note *types.NoteDto) (types.Note, error) {
+	if r.races > 0 {
+		r.races--
+		current, err := r.DBClient.GetSingleNote(ctx, userId, noteId)
+		if err != nil {
+			return types.Note{}, err
+		}
+		content := r.edit(current.Content)
+		if _, err := r.DBClient.UpdateNote(ctx, userId, noteId, &types.NoteDto{Content: &content}); err != nil {
+			return types.Note{}, err
+		}
+	}
+	return r.DBClient.UpdateNote(ctx, userId, noteId, note)
+}
+
+type noRevisions struct{}
+
+func (noRevisions) AddNoteRevision(context.Context, types.NoteRevision) error { return nil }
+
+func (noRevisions) GetNoteRevisions(context.Context, string, string, int) ([]types.NoteRevision, error) {
+	return nil, nil
+}
+
+// editedSession starts a session of a new note with content, and applies op to it as an edit of the owner.
+func editedSession(t *testing.T, db *racingDB, content string, op Operation) *session {
+	t.Helper()
+	ctx := context.Background()
+
+	db.DBClient = datastore.NewMemory(config.Config{})
+	title := "Shared"
+	note, err := db.CreateNote(ctx, "owner", &types.NoteDto{Title: &title, Content: &content})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+
+	s := newSession(NewHub(db, noRevisions{}, time.Minute, zap.NewNop()), note.ID)
+	if err := s.load("owner"); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	c := &client{userId: "owner", canEdit: true, send: make(chan []byte, 16), done: make(chan struct{})}
+	if err := s.receive(c, 0, op, nil); err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	return s
+}
+
+func TestSaveMergesConflictingSaves(t *testing.T) {
+	db := &racingDB{races: 2, edit: func(content string) string { return content + "!" }}
+	s := editedSession(t, db, "hello", parseOp(t, `["> ", 5]`))
+
+	if err := s.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	note, err := db.GetSingleNote(context.Background(), "owner", s.noteId)
+	if err != nil {
+		t.Fatalf("GetSingleNote: %v", err)
+	}
+	if want := "> hello!!"; note.Content != want || string(s.doc) != want {
+		t.Errorf("saved %q with the session at %q, want %q", note.Content, string(s.doc), want)
+	}
+	if len(s.unsaved) != 0 || s.version != note.Version {
+		t.Errorf("session has %d unsaved operations at version %d, want none at %d", len(s.unsaved), s.version, note.Version)
+	}
+}
+
+func TestSaveGivesUpOnConflicts(t *testing.T) {
+	db := &racingDB{races: maxSaveAttempts, edit: func(content string) string { return content + "!" }}
+	s := editedSession(t, db, "hello", parseOp(t, `["> ", 5]`))
+
+	if err := s.save(); !errors.Is(err, datastore.ErrVersionConflict) {
+		t.Fatalf("save: %v, want ErrVersionConflict", err)
+	}
+	if len(s.unsaved) != 1 {
+		t.Errorf("session has %d unsaved operations, want the edit kept", len(s.unsaved))
+	}
+
+	// The edit is saved once the others stop.
+	if err := s.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	note, err := db.GetSingleNote(context.Background(), "owner", s.noteId)
+	if err != nil {
+		t.Fatalf("GetSingleNote: %v", err)
+	}
+	if want := "> hello!!!!!"; note.Content != want {
+		t.Errorf("saved %q, want %q", note.Content, want)
+	}
+}
@@ -4,9 +4,19 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// TitleUniqueness controls how strictly note titles must be unique for a single user.
+type TitleUniqueness string
+
+const (
+	TitleUniquenessOff             TitleUniqueness = "off"
+	TitleUniquenessExact           TitleUniqueness = "exact"
+	TitleUniquenessCaseInsensitive TitleUniqueness = "case-insensitive"
+)
+
 type Config struct {
 	JWTToken         string
 	PostgresHost     string
@@ -18,6 +28,68 @@ type Config struct {
 	PostgresDelay    time.Duration
 	PrometheusPort   string
 	PageSize         int
+	IdempotencyTTL   time.Duration
+	TitleUniqueness  TitleUniqueness
+	// When set, only active (unarchived) notes take part in the title uniqueness check.
+	TitleUniqueActiveOnly bool
+	// Reminders are delivered through ReminderNotifier, one of "log", "webhook" or "smtp".
+	ReminderNotifier     string
+	ReminderPollInterval time.Duration
+	ReminderWebhookURL   string
+	ReminderSMTPAddr     string
+	ReminderSMTPFrom     string
+	ReminderEmailDomain  string
+	// PublicBaseURL is the address the service is reachable on from outside, used to build public share links.
+	PublicBaseURL string
+	// Attachments are kept in BlobStore, either "local" (under BlobLocalDir) or "s3" (any S3-compatible service).
+	BlobStore         string
+	BlobLocalDir      string
+	S3Endpoint        string
+	S3Region          string
+	S3Bucket          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
+	// MaxAttachmentSize bounds a single upload and StorageQuota the attachments of a user altogether, both in bytes.
+	MaxAttachmentSize int64
+	StorageQuota      int64
+	// Thumbnails of images fit within ThumbnailSize pixels square. StripImageLocation removes GPS data from uploaded
+	// photos.
+	ThumbnailSize      int
+	StripImageLocation bool
+	// MaxImportSize bounds the files notes are imported from, in bytes.
+	MaxImportSize int64
+	// Background jobs run on JobWorkers workers, which look for due jobs every JobPollInterval. A job whose replica
+	// has not extended its JobLease for that long is run again elsewhere. Finished jobs are kept for JobRetention.
+	JobWorkers      int
+	JobPollInterval time.Duration
+	JobLease        time.Duration
+	JobRetention    time.Duration
+	// Webhooks are called with WebhookTimeout and disabled after WebhookDisableAfter failed attempts in a row. Unless
+	// WebhookAllowPrivate is set, they cannot call loopback or private network addresses.
+	WebhookTimeout      time.Duration
+	WebhookDisableAfter int
+	WebhookAllowPrivate bool
+	// EventLogRetention is how long changes to notes are kept for event streams to resume from.
+	EventLogRetention time.Duration
+	// CollabSaveInterval is how often the content of notes being edited together is saved.
+	CollabSaveInterval time.Duration
+	// CacheBackend is where cached values are kept: "memory" (in each replica, bounded by CacheMaxEntries values and
+	// CacheMaxBytes) or "redis" (shared, at RedisURL).
+	CacheBackend    string
+	CacheMaxEntries int
+	CacheMaxBytes   int64
+	RedisURL        string
+	// NoteCache serves single notes and first pages of notes from the cache, for up to NoteCacheTTL after they were
+	// read from the database. It is off by default, and needs the redis backend when notes are kept in postgres.
+	NoteCache    bool
+	NoteCacheTTL time.Duration
+	// StorageDriver is where notes and users are kept: "postgres", "sqlite" (in the file at SQLitePath) or "memory"
+	// (until the service stops). Everything beyond notes themselves needs postgres.
+	StorageDriver string
+	SQLitePath    string
+	// TrustedProxies are the addresses of the proxies whose X-Forwarded-For header is believed for the address of a
+	// client. With none, the address is the one the request came from.
+	TrustedProxies []string
 }
 
 func LoadConfig() (*Config, error) {
@@ -33,18 +105,161 @@ func LoadConfig() (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error parsing PAGE_SIZE: %w", err)
 	}
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration for IDEMPOTENCY_TTL: %w", err)
+	}
+	titleUniqueness := TitleUniqueness(getEnv("TITLE_UNIQUENESS", string(TitleUniquenessExact)))
+	switch titleUniqueness {
+	case TitleUniquenessOff, TitleUniquenessExact, TitleUniquenessCaseInsensitive:
+	default:
+		return nil, fmt.Errorf("error parsing TITLE_UNIQUENESS: unsupported value %q", titleUniqueness)
+	}
+	titleUniqueActiveOnly, err := strconv.ParseBool(getEnv("TITLE_UNIQUE_ACTIVE_ONLY", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing TITLE_UNIQUE_ACTIVE_ONLY: %w", err)
+	}
+	reminderPollInterval, err := time.ParseDuration(getEnv("REMINDER_POLL_INTERVAL", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration for REMINDER_POLL_INTERVAL: %w", err)
+	}
+	maxAttachmentSize, err := strconv.ParseInt(getEnv("MAX_ATTACHMENT_SIZE", "26214400"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing MAX_ATTACHMENT_SIZE: %w", err)
+	}
+	storageQuota, err := strconv.ParseInt(getEnv("STORAGE_QUOTA", "524288000"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing STORAGE_QUOTA: %w", err)
+	}
+	thumbnailSize, err := strconv.Atoi(getEnv("THUMBNAIL_SIZE", "256"))
+	if err != nil || thumbnailSize <= 0 {
+		return nil, fmt.Errorf("error parsing THUMBNAIL_SIZE: must be a positive number of pixels")
+	}
+	stripImageLocation, err := strconv.ParseBool(getEnv("STRIP_IMAGE_LOCATION", "true"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing STRIP_IMAGE_LOCATION: %w", err)
+	}
+	maxImportSize, err := strconv.ParseInt(getEnv("MAX_IMPORT_SIZE", "104857600"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing MAX_IMPORT_SIZE: %w", err)
+	}
+	jobWorkers, err := strconv.Atoi(getEnv("JOB_WORKERS", "4"))
+	if err != nil || jobWorkers <= 0 {
+		return nil, fmt.Errorf("error parsing JOB_WORKERS: must be a positive number of workers")
+	}
+	jobPollInterval, err := time.ParseDuration(getEnv("JOB_POLL_INTERVAL", "2s"))
+	if err != nil || jobPollInterval <= 0 {
+		return nil, fmt.Errorf("error parsing duration for JOB_POLL_INTERVAL: must be a positive duration")
+	}
+	jobLease, err := time.ParseDuration(getEnv("JOB_LEASE", "1m"))
+	if err != nil || jobLease < 3*time.Second {
+		return nil, fmt.Errorf("error parsing duration for JOB_LEASE: must be at least 3s")
+	}
+	jobRetention, err := time.ParseDuration(getEnv("JOB_RETENTION", "168h"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration for JOB_RETENTION: %w", err)
+	}
+	webhookTimeout, err := time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration for WEBHOOK_TIMEOUT: %w", err)
+	}
+	webhookDisableAfter, err := strconv.Atoi(getEnv("WEBHOOK_DISABLE_AFTER", "15"))
+	if err != nil || webhookDisableAfter <= 0 {
+		return nil, fmt.Errorf("error parsing WEBHOOK_DISABLE_AFTER: must be a positive number of attempts")
+	}
+	webhookAllowPrivate, err := strconv.ParseBool(getEnv("WEBHOOK_ALLOW_PRIVATE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing WEBHOOK_ALLOW_PRIVATE: %w", err)
+	}
+	eventLogRetention, err := time.ParseDuration(getEnv("EVENT_LOG_RETENTION", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing duration for EVENT_LOG_RETENTION: %w", err)
+	}
+	collabSaveInterval, err := time.ParseDuration(getEnv("COLLAB_SAVE_INTERVAL", "5s"))
+	if err != nil || collabSaveInterval <= 0 {
+		return nil, fmt.Errorf("error parsing COLLAB_SAVE_INTERVAL: must be a positive duration")
+	}
+	cacheMaxEntries, err := strconv.Atoi(getEnv("CACHE_MAX_ENTRIES", "10000"))
+	if err != nil || cacheMaxEntries <= 0 {
+		return nil, fmt.Errorf("error parsing CACHE_MAX_ENTRIES: must be a positive number of entries")
+	}
+	cacheMaxBytes, err := strconv.ParseInt(getEnv("CACHE_MAX_BYTES", "67108864"), 10, 64)
+	if err != nil || cacheMaxBytes <= 0 {
+		return nil, fmt.Errorf("error parsing CACHE_MAX_BYTES: must be a positive number of bytes")
+	}
+	noteCache, err := strconv.ParseBool(getEnv("NOTE_CACHE", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing NOTE_CACHE: %w", err)
+	}
+	// Postgres can be shared by several replicas, each of which would keep serving notes from its own memory cache
+	// after another one changed them.
+	cacheBackend, storageDriver := getEnv("CACHE_BACKEND", "memory"), getEnv("STORAGE_DRIVER", "postgres")
+	if noteCache && cacheBackend == "memory" && storageDriver == "postgres" {
+		return nil, fmt.Errorf("error parsing NOTE_CACHE: notes stored in postgres need CACHE_BACKEND=redis")
+	}
+	noteCacheTTL, err := time.ParseDuration(getEnv("NOTE_CACHE_TTL", "30s"))
+	if err != nil || noteCacheTTL <= 0 {
+		return nil, fmt.Errorf("error parsing NOTE_CACHE_TTL: must be a positive duration")
+	}
+
+	var trustedProxies []string
+	for _, proxy := range strings.Split(getEnv("TRUSTED_PROXIES", ""), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
 
 	return &Config{
-		JWTToken:         getEnv("JWT_TOKEN", "A5S8D45W8DA4"),
-		PostgresHost:     getEnv("POSTGRES_HOST", "localhost"),
-		PostgresPort:     getEnv("POSTGRES_PORT", "5432"),
-		PostgresUser:     getEnv("POSTGRES_USER", "postgres"),
-		PostgresPassword: getEnv("POSTGRES_PASSWORD", "password"),
-		PostgresDB:       getEnv("POSTGRES_DB", "myappdb"),
-		PostgresRetry:    postgresRetry,
-		PostgresDelay:    postgresDelay,
-		PrometheusPort:   getEnv("PROMETHEUS_PORT", "2112"),
-		PageSize:         pageSize,
+		JWTToken:              getEnv("JWT_TOKEN", "A5S8D45W8DA4"),
+		PostgresHost:          getEnv("POSTGRES_HOST", "localhost"),
+		PostgresPort:          getEnv("POSTGRES_PORT", "5432"),
+		PostgresUser:          getEnv("POSTGRES_USER", "postgres"),
+		PostgresPassword:      getEnv("POSTGRES_PASSWORD", "password"),
+		PostgresDB:            getEnv("POSTGRES_DB", "myappdb"),
+		PostgresRetry:         postgresRetry,
+		PostgresDelay:         postgresDelay,
+		PrometheusPort:        getEnv("PROMETHEUS_PORT", "2112"),
+		PageSize:              pageSize,
+		IdempotencyTTL:        idempotencyTTL,
+		TitleUniqueness:       titleUniqueness,
+		TitleUniqueActiveOnly: titleUniqueActiveOnly,
+		ReminderNotifier:      getEnv("REMINDER_NOTIFIER", "log"),
+		ReminderPollInterval:  reminderPollInterval,
+		ReminderWebhookURL:    getEnv("REMINDER_WEBHOOK_URL", ""),
+		ReminderSMTPAddr:      getEnv("REMINDER_SMTP_ADDR", "localhost:1025"),
+		ReminderSMTPFrom:      getEnv("REMINDER_SMTP_FROM", "reminders@notes.local"),
+		ReminderEmailDomain:   getEnv("REMINDER_EMAIL_DOMAIN", "notes.local"),
+		PublicBaseURL:         strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", "http://localhost:8080"), "/"),
+		BlobStore:             getEnv("BLOB_STORE", "local"),
+		BlobLocalDir:          getEnv("BLOB_LOCAL_DIR", "data/attachments"),
+		S3Endpoint:            getEnv("S3_ENDPOINT", "http://localhost:9000"),
+		S3Region:              getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:              getEnv("S3_BUCKET", "notes-attachments"),
+		S3AccessKeyID:         getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:     getEnv("S3_SECRET_ACCESS_KEY", ""),
+		MaxAttachmentSize:     maxAttachmentSize,
+		StorageQuota:          storageQuota,
+		ThumbnailSize:         thumbnailSize,
+		StripImageLocation:    stripImageLocation,
+		MaxImportSize:         maxImportSize,
+		JobWorkers:            jobWorkers,
+		JobPollInterval:       jobPollInterval,
+		JobLease:              jobLease,
+		JobRetention:          jobRetention,
+		WebhookTimeout:        webhookTimeout,
+		WebhookDisableAfter:   webhookDisableAfter,
+		WebhookAllowPrivate:   webhookAllowPrivate,
+		EventLogRetention:     eventLogRetention,
+		CollabSaveInterval:    collabSaveInterval,
+		CacheBackend:          cacheBackend,
+		CacheMaxEntries:       cacheMaxEntries,
+		CacheMaxBytes:         cacheMaxBytes,
+		RedisURL:              getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		NoteCache:             noteCache,
+		NoteCacheTTL:          noteCacheTTL,
+		StorageDriver:         storageDriver,
+		SQLitePath:            getEnv("SQLITE_PATH", "data/notes.db"),
+		TrustedProxies:        trustedProxies,
 	}, nil
 }
 
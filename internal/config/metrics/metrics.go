@@ -179,4 +179,124 @@ var (
 			Buckets:   prometheus.DefBuckets,
 		},
 	)
+	CountIdempotentRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_idempotent_requests_total",
+			Help:      "Counter of requests to notes-service carrying an Idempotency-Key, by outcome",
+		},
+		[]string{"outcome"},
+	)
+	CountChecklistRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_checklist_requests_total",
+			Help:      "Counter of checklist item requests to notes-service, by operation",
+		},
+		[]string{"operation"},
+	)
+	CountChecklistRequestErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_checklist_request_errors_total",
+			Help:      "Counter of errored checklist item requests to notes-service, by operation",
+		},
+		[]string{"operation"},
+	)
+	CountRemindersFiredTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_reminders_fired_total",
+			Help:      "Counter of note reminders delivered by notes-service",
+		},
+	)
+	CountReminderErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_reminder_errors_total",
+			Help:      "Counter of failures while firing note reminders",
+		},
+		[]string{"stage"},
+	)
+	CountShareLinkViewsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_share_link_views_total",
+			Help:      "Counter of requests to public share links, by outcome",
+		},
+		[]string{"outcome"},
+	)
+	CountAttachmentUploadsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_attachment_uploads_total",
+			Help:      "Counter of attachment uploads, by outcome",
+		},
+		[]string{"outcome"},
+	)
+	CountBlobDeletionErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_blob_deletion_errors_total",
+			Help:      "Counter of failures to remove the contents of deleted attachments from the blob store",
+		},
+	)
+	JobQueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_queue_depth",
+			Help:      "Number of queued and running background jobs across all replicas, by kind and status",
+		},
+		[]string{"kind", "status"},
+	)
+	JobWaitDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_wait_duration_seconds",
+			Help:      "Latency histogram for the time background jobs wait for a worker once they are due, by kind",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 4, 8),
+		},
+		[]string{"kind"},
+	)
+	JobRunDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "job_run_duration_seconds",
+			Help:      "Latency histogram for attempts at running background jobs, by kind and outcome",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 4, 9),
+		},
+		[]string{"kind", "outcome"},
+	)
+	CountWebhookDeliveriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "count_webhook_deliveries_total",
+			Help:      "Counter of attempts at delivering note events to webhooks, by outcome",
+		},
+		[]string{"outcome"},
+	)
+	CountCacheHitsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_hits_total",
+			Help:      "Counter of cache lookups that found a value, by backend",
+		},
+		[]string{"backend"},
+	)
+	CountCacheMissesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_misses_total",
+			Help:      "Counter of cache lookups that found no value, by backend",
+		},
+		[]string{"backend"},
+	)
+	CountCacheEvictionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_evictions_total",
+			Help:      "Counter of values dropped from the cache before being deleted, by backend and reason (capacity or expired)",
+		},
+		[]string{"backend", "reason"},
+	)
 )
@@ -0,0 +1,215 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrAttachmentNotFound = errors.New("could not find attachment")
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+var _ services.AttachmentStore = &Postgres{}
+
+const attachmentColumns = `a.id, a.note_id, a.user_id, a.filename, a.content_type, a.size, a.storage_key, a.created_at,
+	a.width, a.height, a.thumbnail_status, a.thumbnail_key, a.thumbnail_content_type`
+
+// scanAttachment reads the attachmentColumns of a row into attachment, followed by any extra columns the query selected.
+func scanAttachment(row rowScanner, attachment *types.Attachment, extra ...any) error {
+	var width, height sql.NullInt32
+	var status, thumbnailKey, thumbnailType sql.NullString
+	dest := []any{&attachment.ID, &attachment.NoteId, &attachment.UserId, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.StorageKey, &attachment.CreatedAt, &width, &height, &status, &thumbnailKey, &thumbnailType}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	if width.Valid && height.Valid {
+		w, h := int(width.Int32), int(height.Int32)
+		attachment.Width, attachment.Height = &w, &h
+	}
+	attachment.ThumbnailStatus = stringPtr(status)
+	attachment.ThumbnailKey = stringPtr(thumbnailKey)
+	attachment.ThumbnailContentType = stringPtr(thumbnailType)
+	return nil
+}
+
+func stringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func (p *Postgres) attachmentFailed(operation, userId, noteId, msg string, err error) error {
+	if errors.Is(err, ErrAttachmentNotFound) || errors.Is(err, ErrNoteNoteFound) || errors.Is(err, ErrQuotaExceeded) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// AddAttachment records an attachment whose contents have been stored, as long as the user can edit the note and the
+// attachment fits in their quota. Uploads of the same user are serialised so that they cannot overrun it together.
+func (p *Postgres) AddAttachment(ctx context.Context, userId, noteId string, attachment types.Attachment, quota int64) (types.Attachment, error) {
+	if userId == "" || noteId == "" || attachment.StorageKey == "" {
+		p.logger.Error("userId, noteId and storage key must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId))
+
+		return types.Attachment{}, fmt.Errorf("userId, noteId and storage key must be provided: %w", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('attachments:' || $1))`, userId); err != nil {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to lock storage usage", err)
+	}
+
+	var used int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM note_attachments WHERE user_id = $1`, userId).Scan(&used); err != nil {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to read storage usage", err)
+	}
+	if used+attachment.Size > quota {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to add attachment", ErrQuotaExceeded)
+	}
+
+	// Images are queued for a thumbnail in the same transaction, so that none is missed.
+	insert := `
+        INSERT INTO note_attachments AS a (note_id, user_id, filename, content_type, size, storage_key, thumbnail_status)
+        SELECT notes.id, $2, $3, $4, $5::bigint, $6, CASE WHEN $4 = ANY($7::text[]) THEN 'pending' END
+        FROM notes WHERE notes.id = $1 AND ` + canEdit("notes", "$2") + `
+        RETURNING ` + attachmentColumns
+
+	var created types.Attachment
+	err = scanAttachment(tx.QueryRowContext(ctx, insert, noteId, userId, attachment.Filename, attachment.ContentType, attachment.Size,
+		attachment.StorageKey, pq.StringArray(types.ThumbnailTypes)), &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoteNoteFound
+	}
+	if err != nil {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to add attachment", err)
+	}
+
+	if created.ThumbnailStatus != nil {
+		thumbnail := types.JobDto{Kind: types.JobThumbnail, Payload: map[string]string{"attachmentId": created.ID}}
+		if _, err := enqueueJob(ctx, tx, thumbnail); err != nil {
+			return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to queue thumbnail", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Attachment{}, p.attachmentFailed("AddAttachment", userId, noteId, "unable to add attachment", err)
+	}
+
+	p.logger.Info("attachment added",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("attachmentId", created.ID),
+		zap.Int64("size", created.Size))
+
+	return created, nil
+}
+
+// GetAttachments lists the attachments of a note the user can see, oldest first.
+func (p *Postgres) GetAttachments(ctx context.Context, userId, noteId string) ([]types.Attachment, error) {
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM note_attachments a
+        JOIN notes ON notes.id = a.note_id
+        WHERE a.note_id = $1 AND ` + canRead("notes", "$2") + `
+        ORDER BY a.created_at, a.id`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, userId)
+	if err != nil {
+		return nil, p.attachmentFailed("GetAttachments", userId, noteId, "unable to query attachments", err)
+	}
+	defer rows.Close()
+
+	attachments := []types.Attachment{}
+	for rows.Next() {
+		var attachment types.Attachment
+		if err := scanAttachment(rows, &attachment); err != nil {
+			return nil, p.attachmentFailed("GetAttachments", userId, noteId, "unable to scan row", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.attachmentFailed("GetAttachments", userId, noteId, "row iteration error", err)
+	}
+
+	return attachments, nil
+}
+
+func (p *Postgres) GetAttachment(ctx context.Context, userId, noteId, attachmentId string) (types.Attachment, error) {
+	query := `
+        SELECT ` + attachmentColumns + `
+        FROM note_attachments a
+        JOIN notes ON notes.id = a.note_id
+        WHERE a.id = $1 AND a.note_id = $2 AND ` + canRead("notes", "$3")
+
+	var attachment types.Attachment
+	err := scanAttachment(p.db.QueryRowContext(ctx, query, attachmentId, noteId, userId), &attachment)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrAttachmentNotFound
+	}
+	if err != nil {
+		return types.Attachment{}, p.attachmentFailed("GetAttachment", userId, noteId, "unable to get attachment", err)
+	}
+
+	return attachment, nil
+}
+
+// DeleteAttachment deletes an attachment from a note the user can edit. Its contents are queued for removal from the
+// blob store by a trigger.
+func (p *Postgres) DeleteAttachment(ctx context.Context, userId, noteId, attachmentId string) error {
+	query := `
+        DELETE FROM note_attachments a
+        USING notes
+        WHERE notes.id = a.note_id AND a.id = $1 AND a.note_id = $2 AND ` + canEdit("notes", "$3")
+
+	result, err := p.db.ExecContext(ctx, query, attachmentId, noteId, userId)
+	if err != nil {
+		return p.attachmentFailed("DeleteAttachment", userId, noteId, "unable to delete attachment", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return p.attachmentFailed("DeleteAttachment", userId, noteId, "unable to delete attachment", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("unable to delete attachment: %w", ErrAttachmentNotFound)
+	}
+
+	p.logger.Info("attachment deleted",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("attachmentId", attachmentId))
+
+	return nil
+}
+
+// GetStorageUsage returns the total size of the attachments uploaded by a user.
+func (p *Postgres) GetStorageUsage(ctx context.Context, userId string) (int64, error) {
+	var used int64
+	err := p.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(size), 0) FROM note_attachments WHERE user_id = $1`, userId).Scan(&used)
+	if err != nil {
+		return 0, p.attachmentFailed("GetStorageUsage", userId, "", "unable to read storage usage", err)
+	}
+	return used, nil
+}
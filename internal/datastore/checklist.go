@@ -0,0 +1,542 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var ErrItemNotFound = errors.New("could not find checklist item")
+var ErrNotChecklist = errors.New("note is not a checklist")
+var ErrInvalidItemOrder = errors.New("item order must list every item of the checklist exactly once")
+var ErrUnsupportedNoteKind = errors.New("unsupported note kind")
+var ErrContentTooLong = fmt.Errorf("content length cannot exceed %d characters", types.MaxNoteContentLen)
+var _ services.ChecklistStore = &Postgres{}
+
+const checklistItemColumns = "ci.id, ci.text, ci.checked, ci.position"
+
+func scanChecklistItem(row rowScanner, item *types.ChecklistItem) error {
+	return row.Scan(&item.ID, &item.Text, &item.Checked, &item.Position)
+}
+
+// checklistFailed records a failed checklist operation and wraps err for the caller.
+func (p *Postgres) checklistFailed(operation, userId, noteId, msg string, err error) error {
+	metrics.CountChecklistRequestErrorsTotal.WithLabelValues(operation).Inc()
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// lockChecklistNote locks the note for the rest of tx after checking the user may edit it and it is a checklist. Every
+// change to the items of a note goes through this lock so that item positions stay contiguous.
+func lockChecklistNote(ctx context.Context, tx *sql.Tx, userId, noteId string) error {
+	var kind string
+	err := tx.QueryRowContext(ctx, `SELECT kind FROM notes WHERE notes.id = $1 AND `+canEdit("notes", "$2")+` FOR UPDATE`, noteId, userId).Scan(&kind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoteNoteFound
+	}
+	if err != nil {
+		return err
+	}
+	if kind != types.NoteKindChecklist {
+		return ErrNotChecklist
+	}
+	return nil
+}
+
+// touchChecklistNote records a change to the items of a note on the note itself, with a new version, so that the change
+// reaches syncing clients and edits made to the previous version are refused, and queues a note.updated event carrying
+// the items.
+func touchChecklistNote(ctx context.Context, tx *sql.Tx, noteId string) error {
+	query := `UPDATE notes SET version = notes.version + 1, updated_at = NOW() WHERE notes.id = $1 RETURNING ` + noteColumns
+
+	var note types.Note
+	if err := scanNote(tx.QueryRowContext(ctx, query, noteId), &note); err != nil {
+		return err
+	}
+	items, err := queryChecklistItems(ctx, tx, noteId)
+	if err != nil {
+		return err
+	}
+	note.Items = items
+	return queueNoteEvent(ctx, tx, types.EventNoteUpdated, note)
+}
+
+func queryChecklistItems(ctx context.Context, tx *sql.Tx, noteId string) ([]types.ChecklistItem, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT `+checklistItemColumns+`
+		FROM checklist_items ci
+		WHERE ci.note_id = $1
+		ORDER BY ci.position, ci.id`, noteId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []types.ChecklistItem{}
+	for rows.Next() {
+		var item types.ChecklistItem
+		if err := scanChecklistItem(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (p *Postgres) GetChecklistItems(ctx context.Context, userId, noteId string) ([]types.ChecklistItem, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("get_items").Inc()
+
+	if userId == "" || noteId == "" {
+		return nil, p.checklistFailed("get_items", userId, noteId, "userId and noteId must be provided", ErrParameterNotProvided)
+	}
+
+	query := `
+        SELECT ` + checklistItemColumns + `
+        FROM checklist_items ci
+        JOIN notes n ON n.id = ci.note_id
+        WHERE n.id = $1 AND ` + canRead("n", "$2") + `
+        ORDER BY ci.position, ci.id`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, userId)
+	if err != nil {
+		return nil, p.checklistFailed("get_items", userId, noteId, "unable to query checklist items", err)
+	}
+	defer rows.Close()
+
+	items := []types.ChecklistItem{}
+	for rows.Next() {
+		var item types.ChecklistItem
+		if err := scanChecklistItem(rows, &item); err != nil {
+			return nil, p.checklistFailed("get_items", userId, noteId, "unable to scan checklist item", err)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.checklistFailed("get_items", userId, noteId, "row iteration error", err)
+	}
+
+	return items, nil
+}
+
+// AddChecklistItem appends an item to a checklist, or inserts it at item.Position when one is given.
+func (p *Postgres) AddChecklistItem(ctx context.Context, userId, noteId string, item types.ChecklistItemDto) (types.ChecklistItem, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("add_item").Inc()
+
+	if userId == "" || noteId == "" || item.Text == nil || *item.Text == "" {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "userId, noteId and text must be provided", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockChecklistNote(ctx, tx, userId, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to add checklist item", err)
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM checklist_items WHERE note_id = $1`, noteId).Scan(&count); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to count checklist items", err)
+	}
+
+	position := count
+	if item.Position != nil {
+		position = clamp(*item.Position, 0, count)
+		shift := `UPDATE checklist_items SET position = position + 1 WHERE note_id = $1 AND position >= $2`
+		if _, err := tx.ExecContext(ctx, shift, noteId, position); err != nil {
+			return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to make room for checklist item", err)
+		}
+	}
+
+	checked := item.Checked != nil && *item.Checked
+
+	query := `
+        INSERT INTO checklist_items AS ci (note_id, text, checked, position)
+        VALUES ($1, $2, $3, $4)
+        RETURNING ` + checklistItemColumns
+
+	var newItem types.ChecklistItem
+	if err := scanChecklistItem(tx.QueryRowContext(ctx, query, noteId, *item.Text, checked, position), &newItem); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to add checklist item", err)
+	}
+
+	if err := touchChecklistNote(ctx, tx, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to record checklist change", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("add_item", userId, noteId, "unable to add checklist item", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	return newItem, nil
+}
+
+// UpdateChecklistItem changes the text or checked state of an item, and moves it when a new position is given.
+func (p *Postgres) UpdateChecklistItem(ctx context.Context, userId, noteId, itemId string, item types.ChecklistItemDto) (types.ChecklistItem, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("update_item").Inc()
+
+	if userId == "" || noteId == "" || itemId == "" {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "userId, noteId and itemId must be provided", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockChecklistNote(ctx, tx, userId, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to update checklist item", err)
+	}
+
+	var current, count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT position, (SELECT COUNT(*) FROM checklist_items WHERE note_id = $2)
+		FROM checklist_items
+		WHERE id = $1 AND note_id = $2`, itemId, noteId).Scan(&current, &count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to update checklist item", ErrItemNotFound)
+	}
+	if err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to load checklist item", err)
+	}
+
+	position := current
+	if item.Position != nil {
+		position = clamp(*item.Position, 0, count-1)
+		var shift string
+		switch {
+		case position < current:
+			shift = `UPDATE checklist_items SET position = position + 1 WHERE note_id = $1 AND position >= $2 AND position < $3`
+		case position > current:
+			shift = `UPDATE checklist_items SET position = position - 1 WHERE note_id = $1 AND position <= $2 AND position > $3`
+		}
+		if shift != "" {
+			if _, err := tx.ExecContext(ctx, shift, noteId, position, current); err != nil {
+				return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to move checklist item", err)
+			}
+		}
+	}
+
+	query := `
+        UPDATE checklist_items ci
+        SET text = COALESCE($1, ci.text), checked = COALESCE($2, ci.checked), position = $3
+        WHERE ci.id = $4 AND ci.note_id = $5
+        RETURNING ` + checklistItemColumns
+
+	var updated types.ChecklistItem
+	if err := scanChecklistItem(tx.QueryRowContext(ctx, query, item.Text, item.Checked, position, itemId, noteId), &updated); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to update checklist item", err)
+	}
+
+	if err := touchChecklistNote(ctx, tx, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to record checklist change", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("update_item", userId, noteId, "unable to update checklist item", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	return updated, nil
+}
+
+func (p *Postgres) ToggleChecklistItem(ctx context.Context, userId, noteId, itemId string) (types.ChecklistItem, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("toggle_item").Inc()
+
+	if userId == "" || noteId == "" || itemId == "" {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "userId, noteId and itemId must be provided", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockChecklistNote(ctx, tx, userId, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to toggle checklist item", err)
+	}
+
+	query := `
+        UPDATE checklist_items ci
+        SET checked = NOT ci.checked
+        WHERE ci.id = $1 AND ci.note_id = $2
+        RETURNING ` + checklistItemColumns
+
+	var item types.ChecklistItem
+	err = scanChecklistItem(tx.QueryRowContext(ctx, query, itemId, noteId), &item)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to toggle checklist item", ErrItemNotFound)
+	}
+	if err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to toggle checklist item", err)
+	}
+
+	if err := touchChecklistNote(ctx, tx, noteId); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to record checklist change", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.ChecklistItem{}, p.checklistFailed("toggle_item", userId, noteId, "unable to toggle checklist item", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	return item, nil
+}
+
+// ReorderChecklistItems puts the items of a checklist in the order given by itemIds, which must name every item once.
+func (p *Postgres) ReorderChecklistItems(ctx context.Context, userId, noteId string, itemIds []string) ([]types.ChecklistItem, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("reorder_items").Inc()
+
+	if userId == "" || noteId == "" {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "userId and noteId must be provided", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockChecklistNote(ctx, tx, userId, noteId); err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to reorder checklist items", err)
+	}
+
+	items, err := queryChecklistItems(ctx, tx, noteId)
+	if err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to query checklist items", err)
+	}
+
+	if !sameItems(items, itemIds) {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to reorder checklist items", ErrInvalidItemOrder)
+	}
+
+	for position, id := range itemIds {
+		if _, err := tx.ExecContext(ctx, `UPDATE checklist_items SET position = $1 WHERE id = $2 AND note_id = $3`, position, id, noteId); err != nil {
+			return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to reorder checklist items", err)
+		}
+	}
+
+	items, err = queryChecklistItems(ctx, tx, noteId)
+	if err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to query checklist items", err)
+	}
+
+	if err := touchChecklistNote(ctx, tx, noteId); err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to record checklist change", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, p.checklistFailed("reorder_items", userId, noteId, "unable to reorder checklist items", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	return items, nil
+}
+
+func (p *Postgres) RemoveChecklistItem(ctx context.Context, userId, noteId, itemId string) error {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("remove_item").Inc()
+
+	if userId == "" || noteId == "" || itemId == "" {
+		return p.checklistFailed("remove_item", userId, noteId, "userId, noteId and itemId must be provided", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockChecklistNote(ctx, tx, userId, noteId); err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to remove checklist item", err)
+	}
+
+	var position int
+	err = tx.QueryRowContext(ctx, `DELETE FROM checklist_items WHERE id = $1 AND note_id = $2 RETURNING position`, itemId, noteId).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to remove checklist item", ErrItemNotFound)
+	}
+	if err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to remove checklist item", err)
+	}
+
+	// Close the gap left by the removed item.
+	if _, err := tx.ExecContext(ctx, `UPDATE checklist_items SET position = position - 1 WHERE note_id = $1 AND position > $2`, noteId, position); err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to remove checklist item", err)
+	}
+
+	if err := touchChecklistNote(ctx, tx, noteId); err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to record checklist change", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return p.checklistFailed("remove_item", userId, noteId, "unable to remove checklist item", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	return nil
+}
+
+// ConvertNote switches a note between text and checklist. Each non-blank line of a text note becomes an item, and
+// the items of a checklist are written back as a Markdown task list.
+func (p *Postgres) ConvertNote(ctx context.Context, userId, noteId, kind string) (types.Note, error) {
+	metrics.CountChecklistRequestsTotal.WithLabelValues("convert").Inc()
+
+	if userId == "" || noteId == "" {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "userId and noteId must be provided", ErrParameterNotProvided)
+	}
+	if kind != types.NoteKindText && kind != types.NoteKindChecklist {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", ErrUnsupportedNoteKind)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	var currentKind, content string
+	err = tx.QueryRowContext(ctx, `SELECT kind, content FROM notes WHERE notes.id = $1 AND `+canEdit("notes", "$2")+` FOR UPDATE`, noteId, userId).Scan(&currentKind, &content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", ErrNoteNoteFound)
+	}
+	if err != nil {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", err)
+	}
+
+	if currentKind != kind {
+		switch kind {
+		case types.NoteKindChecklist:
+			for position, item := range checklistFromText(content) {
+				insert := `INSERT INTO checklist_items (note_id, text, checked, position) VALUES ($1, $2, $3, $4)`
+				if _, err := tx.ExecContext(ctx, insert, noteId, item.Text, item.Checked, position); err != nil {
+					return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to create checklist item", err)
+				}
+			}
+			content = ""
+		case types.NoteKindText:
+			items, err := queryChecklistItems(ctx, tx, noteId)
+			if err != nil {
+				return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to query checklist items", err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM checklist_items WHERE note_id = $1`, noteId); err != nil {
+				return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to remove checklist items", err)
+			}
+			content = strings.TrimSpace(content + "\n" + checklistToText(items))
+			if len(content) > types.MaxNoteContentLen {
+				return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", ErrContentTooLong)
+			}
+		}
+
+		query := `UPDATE notes SET kind = $1, content = $2, updated_at = NOW() WHERE notes.id = $3 RETURNING ` + noteColumns
+
+		var converted types.Note
+		if err := scanNote(tx.QueryRowContext(ctx, query, kind, content, noteId), &converted); err != nil {
+			return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", err)
+		}
+		if kind == types.NoteKindChecklist {
+			if converted.Items, err = queryChecklistItems(ctx, tx, noteId); err != nil {
+				return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to query checklist items", err)
+			}
+		}
+		if err := queueNoteEvent(ctx, tx, types.EventNoteUpdated, converted); err != nil {
+			return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to record conversion", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Note{}, p.checklistFailed("convert", userId, noteId, "unable to convert note", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	p.logger.Info("note converted",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("kind", kind))
+
+	return p.GetSingleNote(ctx, userId, noteId)
+}
+
+// checklistFromText turns each non-blank line of content into a checklist item. Markdown list and task markers such
+// as "- [x] done" are understood and removed from the item text.
+func checklistFromText(content string) []types.ChecklistItem {
+	var items []types.ChecklistItem
+	for _, line := range strings.Split(content, "\n") {
+		text := strings.TrimSpace(line)
+		for _, bullet := range []string{"- ", "* ", "+ "} {
+			if strings.HasPrefix(text, bullet) {
+				text = strings.TrimSpace(strings.TrimPrefix(text, bullet))
+				break
+			}
+		}
+
+		checked := false
+		switch {
+		case strings.HasPrefix(text, "[ ]"):
+			text = strings.TrimSpace(text[3:])
+		case strings.HasPrefix(text, "[x]"), strings.HasPrefix(text, "[X]"):
+			text = strings.TrimSpace(text[3:])
+			checked = true
+		}
+
+		if text == "" {
+			continue
+		}
+		items = append(items, types.ChecklistItem{Text: text, Checked: checked})
+	}
+	return items
+}
+
+// checklistToText renders items as a Markdown task list.
+func checklistToText(items []types.ChecklistItem) string {
+	var b strings.Builder
+	for _, item := range items {
+		if item.Checked {
+			b.WriteString("- [x] ")
+		} else {
+			b.WriteString("- [ ] ")
+		}
+		b.WriteString(item.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// sameItems reports whether ids names every item exactly once.
+func sameItems(items []types.ChecklistItem, ids []string) bool {
+	if len(items) != len(ids) {
+		return false
+	}
+
+	remaining := make(map[string]bool, len(items))
+	for _, item := range items {
+		remaining[item.ID] = true
+	}
+	for _, id := range ids {
+		if !remaining[id] {
+			return false
+		}
+		delete(remaining, id)
+	}
+	return true
+}
+
+func clamp(value, low, high int) int {
+	return max(low, min(value, high))
+}
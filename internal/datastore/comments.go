@@ -0,0 +1,403 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrCommentNotFound = errors.New("could not find comment")
+var ErrNotThread = errors.New("only top-level comments can be resolved")
+var ErrMentionNotFound = errors.New("could not find mention")
+var _ services.CommentStore = &Postgres{}
+
+const commentColumns = `c.id, c.note_id, c.parent_id, c.user_id, c.body, c.resolved, c.resolved_by, c.resolved_at,
+	c.created_at, c.updated_at,
+	ARRAY(SELECT cm.username FROM comment_mentions cm WHERE cm.comment_id = c.id ORDER BY cm.username)`
+
+func scanComment(row rowScanner, comment *types.Comment) error {
+	var parentId, resolvedBy sql.NullString
+	var resolvedAt, updatedAt sql.NullTime
+	var mentions pq.StringArray
+	err := row.Scan(&comment.ID, &comment.NoteId, &parentId, &comment.UserId, &comment.Body, &comment.Resolved, &resolvedBy,
+		&resolvedAt, &comment.CreatedAt, &updatedAt, &mentions)
+	if err != nil {
+		return err
+	}
+
+	if parentId.Valid {
+		comment.ParentId = &parentId.String
+	}
+	if resolvedBy.Valid {
+		comment.ResolvedBy = &resolvedBy.String
+	}
+	comment.ResolvedAt = timePtr(resolvedAt)
+	comment.UpdatedAt = timePtr(updatedAt)
+	comment.Mentions = []string(mentions)
+	if comment.Mentions == nil {
+		comment.Mentions = []string{}
+	}
+	return nil
+}
+
+// commentRef is what is needed to decide whether a user may change a comment.
+type commentRef struct {
+	authorId   string
+	parentId   sql.NullString
+	permission string
+}
+
+// lockComment locks a comment on a note the user can see for the rest of tx, returning its author, its parent and
+// the permission the user has on the note.
+func lockComment(ctx context.Context, tx *sql.Tx, userId, noteId, commentId string) (commentRef, error) {
+	query := `
+        SELECT c.user_id, c.parent_id, ` + permissionColumn("notes", "$3") + `
+        FROM note_comments c
+        JOIN notes ON notes.id = c.note_id
+        WHERE c.id = $1 AND c.note_id = $2 AND ` + canRead("notes", "$3") + `
+        FOR UPDATE OF c`
+
+	var ref commentRef
+	err := tx.QueryRowContext(ctx, query, commentId, noteId, userId).Scan(&ref.authorId, &ref.parentId, &ref.permission)
+	if errors.Is(err, sql.ErrNoRows) {
+		return commentRef{}, ErrCommentNotFound
+	}
+	return ref, err
+}
+
+func getComment(ctx context.Context, tx *sql.Tx, commentId string) (types.Comment, error) {
+	var comment types.Comment
+	err := scanComment(tx.QueryRowContext(ctx, `SELECT `+commentColumns+` FROM note_comments c WHERE c.id = $1`, commentId), &comment)
+	return comment, err
+}
+
+// addMentions records that the comment mentions the given users. Users who cannot see the note are left out, so that
+// mentions never reveal a note to someone without access to it.
+func addMentions(ctx context.Context, tx *sql.Tx, noteId, commentId string, mentions []types.MentionedUser) error {
+	query := `
+        INSERT INTO comment_mentions (comment_id, user_id, username)
+        SELECT $1::int, $2, $3 FROM notes WHERE notes.id = $4 AND ` + canRead("notes", "$2") + `
+        ON CONFLICT (comment_id, user_id) DO NOTHING`
+
+	for _, mention := range mentions {
+		if _, err := tx.ExecContext(ctx, query, commentId, mention.UserId, mention.Username, noteId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) commentFailed(operation, userId, noteId, msg string, err error) error {
+	if errors.Is(err, ErrCommentNotFound) || errors.Is(err, ErrNoteNoteFound) || errors.Is(err, ErrPermissionDenied) || errors.Is(err, ErrNotThread) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// GetComments returns the comment threads of a note, oldest first, with the replies of each thread nested in it.
+func (p *Postgres) GetComments(ctx context.Context, userId, noteId string) ([]types.Comment, error) {
+	query := `
+        SELECT ` + commentColumns + `
+        FROM note_comments c
+        JOIN notes ON notes.id = c.note_id
+        WHERE c.note_id = $1 AND ` + canRead("notes", "$2") + `
+        ORDER BY c.created_at, c.id`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, userId)
+	if err != nil {
+		return nil, p.commentFailed("GetComments", userId, noteId, "unable to query comments", err)
+	}
+	defer rows.Close()
+
+	threads := []types.Comment{}
+	index := map[string]int{}
+	var replies []types.Comment
+	for rows.Next() {
+		var comment types.Comment
+		if err := scanComment(rows, &comment); err != nil {
+			return nil, p.commentFailed("GetComments", userId, noteId, "unable to scan row", err)
+		}
+		if comment.ParentId != nil {
+			replies = append(replies, comment)
+			continue
+		}
+		index[comment.ID] = len(threads)
+		threads = append(threads, comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.commentFailed("GetComments", userId, noteId, "row iteration error", err)
+	}
+
+	for _, reply := range replies {
+		if i, ok := index[*reply.ParentId]; ok {
+			threads[i].Replies = append(threads[i].Replies, reply)
+		}
+	}
+
+	return threads, nil
+}
+
+// AddComment adds a comment to a note the user can see. A reply to a reply joins the thread of the comment it answers.
+func (p *Postgres) AddComment(ctx context.Context, userId, noteId string, comment types.CommentDto, mentions []types.MentionedUser) (types.Comment, error) {
+	if userId == "" || noteId == "" || comment.Body == "" {
+		p.logger.Error("userId, noteId and body must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId))
+
+		return types.Comment{}, fmt.Errorf("userId, noteId and body must be provided: %w", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	var parentId *string
+	if comment.ParentId != nil {
+		var root string
+		err := tx.QueryRowContext(ctx, `SELECT COALESCE(parent_id, id) FROM note_comments WHERE id = $1 AND note_id = $2`,
+			*comment.ParentId, noteId).Scan(&root)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrCommentNotFound
+		}
+		if err != nil {
+			return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to find parent comment", err)
+		}
+		parentId = &root
+	}
+
+	insert := `
+        INSERT INTO note_comments (note_id, parent_id, user_id, body)
+        SELECT notes.id, $2::int, $3, $4 FROM notes WHERE notes.id = $1 AND ` + canRead("notes", "$3") + `
+        RETURNING id`
+
+	var commentId string
+	err = tx.QueryRowContext(ctx, insert, noteId, parentId, userId, comment.Body).Scan(&commentId)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrNoteNoteFound
+	}
+	if err != nil {
+		return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to add comment", err)
+	}
+
+	if err := addMentions(ctx, tx, noteId, commentId, mentions); err != nil {
+		return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to record mentions", err)
+	}
+
+	created, err := getComment(ctx, tx, commentId)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to read comment", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Comment{}, p.commentFailed("AddComment", userId, noteId, "unable to add comment", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	p.logger.Info("comment added",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("commentId", commentId),
+		zap.Int("mentions", len(created.Mentions)))
+
+	return created, nil
+}
+
+// UpdateComment changes the body of a comment. Only its author can edit a comment. Users no longer mentioned lose
+// their mention, while those still mentioned keep whether they have read it.
+func (p *Postgres) UpdateComment(ctx context.Context, userId, noteId, commentId, body string, mentions []types.MentionedUser) (types.Comment, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	ref, err := lockComment(ctx, tx, userId, noteId, commentId)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update comment", err)
+	}
+	if ref.authorId != userId {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update comment", ErrPermissionDenied)
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE note_comments SET body = $1, updated_at = NOW() WHERE id = $2`, body, commentId); err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update comment", err)
+	}
+
+	mentioned := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		mentioned = append(mentioned, mention.UserId)
+	}
+	drop := `DELETE FROM comment_mentions WHERE comment_id = $1 AND NOT (user_id = ANY($2))`
+	if _, err := tx.ExecContext(ctx, drop, commentId, pq.StringArray(mentioned)); err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update mentions", err)
+	}
+	if err := addMentions(ctx, tx, noteId, commentId, mentions); err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update mentions", err)
+	}
+
+	updated, err := getComment(ctx, tx, commentId)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to read comment", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Comment{}, p.commentFailed("UpdateComment", userId, noteId, "unable to update comment", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteComment deletes a comment along with its replies. Authors can delete their own comments, and whoever manages
+// the note can delete any comment on it.
+func (p *Postgres) DeleteComment(ctx context.Context, userId, noteId, commentId string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p.commentFailed("DeleteComment", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	ref, err := lockComment(ctx, tx, userId, noteId, commentId)
+	if err != nil {
+		return p.commentFailed("DeleteComment", userId, noteId, "unable to delete comment", err)
+	}
+	if ref.authorId != userId && !types.PermissionAllows(ref.permission, types.PermissionOwner) {
+		return p.commentFailed("DeleteComment", userId, noteId, "unable to delete comment", ErrPermissionDenied)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM note_comments WHERE id = $1`, commentId); err != nil {
+		return p.commentFailed("DeleteComment", userId, noteId, "unable to delete comment", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return p.commentFailed("DeleteComment", userId, noteId, "unable to delete comment", err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	p.logger.Info("comment deleted",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("commentId", commentId))
+
+	return nil
+}
+
+// ResolveComment marks a thread as resolved, or reopens it. The author of the thread and the editors of the note can
+// resolve it.
+func (p *Postgres) ResolveComment(ctx context.Context, userId, noteId, commentId string, resolved bool) (types.Comment, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	ref, err := lockComment(ctx, tx, userId, noteId, commentId)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to resolve comment", err)
+	}
+	if ref.parentId.Valid {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to resolve comment", ErrNotThread)
+	}
+	if ref.authorId != userId && !types.PermissionAllows(ref.permission, types.PermissionEditor) {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to resolve comment", ErrPermissionDenied)
+	}
+
+	update := `
+        UPDATE note_comments
+        SET resolved = $1,
+            resolved_by = CASE WHEN $1 THEN $2 END,
+            resolved_at = CASE WHEN $1 THEN NOW() END
+        WHERE id = $3`
+
+	if _, err := tx.ExecContext(ctx, update, resolved, userId, commentId); err != nil {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to resolve comment", err)
+	}
+
+	updated, err := getComment(ctx, tx, commentId)
+	if err != nil {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to read comment", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Comment{}, p.commentFailed("ResolveComment", userId, noteId, "unable to resolve comment", err)
+	}
+
+	return updated, nil
+}
+
+// GetMentions returns the mentions of userId, newest first, along with their total number. Mentions on notes the user
+// can no longer see are left out.
+func (p *Postgres) GetMentions(ctx context.Context, userId string, unreadOnly bool, limit, offset int) ([]types.Mention, int, error) {
+	from := `
+        FROM comment_mentions cm
+        JOIN note_comments c ON c.id = cm.comment_id
+        JOIN notes ON notes.id = c.note_id
+        WHERE cm.user_id = $1 AND (NOT $2 OR cm.read_at IS NULL) AND ` + canRead("notes", "$1")
+
+	var totalCount int
+	if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) `+from, userId, unreadOnly).Scan(&totalCount); err != nil {
+		return nil, 0, p.commentFailed("GetMentions", userId, "", "failed to get total count", err)
+	}
+
+	query := `
+        SELECT c.id, c.note_id, notes.title, c.user_id, c.body, cm.created_at, cm.read_at ` + from + `
+        ORDER BY cm.created_at DESC, c.id DESC
+        LIMIT $3 OFFSET $4`
+
+	rows, err := p.db.QueryContext(ctx, query, userId, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, 0, p.commentFailed("GetMentions", userId, "", "unable to query mentions", err)
+	}
+	defer rows.Close()
+
+	mentions := []types.Mention{}
+	for rows.Next() {
+		var mention types.Mention
+		var readAt sql.NullTime
+		if err := rows.Scan(&mention.CommentId, &mention.NoteId, &mention.NoteTitle, &mention.AuthorId, &mention.Body,
+			&mention.CreatedAt, &readAt); err != nil {
+			return nil, 0, p.commentFailed("GetMentions", userId, "", "unable to scan row", err)
+		}
+		mention.ReadAt = timePtr(readAt)
+		mentions = append(mentions, mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, p.commentFailed("GetMentions", userId, "", "row iteration error", err)
+	}
+
+	return mentions, totalCount, nil
+}
+
+// MarkMentionRead marks the mention of userId in a comment as read.
+func (p *Postgres) MarkMentionRead(ctx context.Context, userId, commentId string) error {
+	res, err := p.db.ExecContext(ctx, `UPDATE comment_mentions SET read_at = COALESCE(read_at, NOW()) WHERE comment_id = $1 AND user_id = $2`,
+		commentId, userId)
+	if err != nil {
+		return p.commentFailed("MarkMentionRead", userId, "", "unable to mark mention as read", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected after marking mention as read: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unable to mark mention as read: %w", ErrMentionNotFound)
+	}
+
+	return nil
+}
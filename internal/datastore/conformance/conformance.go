@@ -0,0 +1,428 @@
+// Package conformance checks that implementations of services.DBClient and services.UserStore behave like the
+// Postgres ones the service was written against, so that the handlers can rely on the same results and errors from
+// any of them. Each backend runs the same suite from a test of its own:
+//
+//	func TestMemory(t *testing.T) {
+//		conformance.TestDBClient(t, func(t *testing.T) services.DBClient {
+//			return datastore.NewMemory(config.Config{TitleUniqueness: config.TitleUniquenessExact})
+//		})
+//	}
+//
+// The suite writes the notes of new users only, so it can run against a database shared with other data. It expects
+// the default title policy: exact titles, unique among all the notes of a user.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/models"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/google/uuid"
+)
+
+// missingId is a note or workspace ID that is never used.
+const missingId = "2147483647"
+
+// TestDBClient runs the suite against the clients made by newClient, one per subtest.
+func TestDBClient(t *testing.T, newClient func(t *testing.T) services.DBClient) {
+	t.Run("MissingParameters", func(t *testing.T) { testMissingParameters(t, newClient(t)) })
+	t.Run("Create", func(t *testing.T) { testCreate(t, newClient(t)) })
+	t.Run("Read", func(t *testing.T) { testRead(t, newClient(t)) })
+	t.Run("Update", func(t *testing.T) { testUpdate(t, newClient(t)) })
+	t.Run("Version", func(t *testing.T) { testVersion(t, newClient(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newClient(t)) })
+	t.Run("Pagination", func(t *testing.T) { testPagination(t, newClient(t)) })
+	t.Run("Filters", func(t *testing.T) { testFilters(t, newClient(t)) })
+	t.Run("Titles", func(t *testing.T) { testTitles(t, newClient(t)) })
+}
+
+// TestUserStore runs the suite against the stores made by newStore, one per subtest.
+func TestUserStore(t *testing.T, newStore func(t *testing.T) services.UserStore) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		store, ctx := newStore(t), context.Background()
+
+		user := &models.User{Username: "user-" + uuid.NewString(), PasswordHash: "hash", CreatedAt: time.Now().UTC().Truncate(time.Second)}
+		if err := store.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if user.UserId == "" {
+			t.Fatal("CreateUser did not set the ID of the user")
+		}
+
+		got, err := store.GetUserByUsername(ctx, user.Username)
+		if err != nil || got == nil {
+			t.Fatalf("GetUserByUsername = %v, %v, want the user", got, err)
+		}
+		if got.UserId != user.UserId || got.Username != user.Username || got.PasswordHash != user.PasswordHash {
+			t.Errorf("GetUserByUsername = %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		got, err := newStore(t).GetUserByUsername(context.Background(), "user-"+uuid.NewString())
+		if got != nil || err != nil {
+			t.Errorf("GetUserByUsername = %v, %v, want nil, nil", got, err)
+		}
+	})
+
+	t.Run("DuplicateUsername", func(t *testing.T) {
+		store, ctx := newStore(t), context.Background()
+
+		username := "user-" + uuid.NewString()
+		if err := store.CreateUser(ctx, &models.User{Username: username, PasswordHash: "hash", CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := store.CreateUser(ctx, &models.User{Username: username, PasswordHash: "other", CreatedAt: time.Now()}); err == nil {
+			t.Error("CreateUser with a username in use succeeded, want an error")
+		}
+	})
+}
+
+func testMissingParameters(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	note := create(t, db, user, &types.NoteDto{Title: ptr("Note")})
+
+	checks := []struct {
+		name string
+		err  error
+	}{
+		{"GetSingleNote without user", second(db.GetSingleNote(ctx, "", note.ID))},
+		{"GetSingleNote without note", second(db.GetSingleNote(ctx, user, ""))},
+		{"GetNotes without user", third(db.GetNotes(ctx, "", types.NoteFilter{}, 10, 0))},
+		{"CreateNote without user", second(db.CreateNote(ctx, "", &types.NoteDto{Title: ptr("Note")}))},
+		{"CreateNote without title", second(db.CreateNote(ctx, user, &types.NoteDto{Content: ptr("Content")}))},
+		{"CreateNote with an empty title", second(db.CreateNote(ctx, user, &types.NoteDto{Title: ptr("")}))},
+		{"UpdateNote without user", second(db.UpdateNote(ctx, "", note.ID, &types.NoteDto{Title: ptr("New")}))},
+		{"UpdateNote without note", second(db.UpdateNote(ctx, user, "", &types.NoteDto{Title: ptr("New")}))},
+		{"DeleteNote without user", db.DeleteNote(ctx, "", note.ID)},
+		{"DeleteNote without note", db.DeleteNote(ctx, user, "")},
+	}
+	for _, check := range checks {
+		if !errors.Is(check.err, datastore.ErrParameterNotProvided) {
+			t.Errorf("%s: got %v, want ErrParameterNotProvided", check.name, check.err)
+		}
+	}
+
+	if _, err := db.CreateNote(ctx, user, nil); !errors.Is(err, datastore.ErrNilNote) {
+		t.Errorf("CreateNote with a nil note: got %v, want ErrNilNote", err)
+	}
+	if _, err := db.UpdateNote(ctx, user, note.ID, nil); !errors.Is(err, datastore.ErrNilNote) {
+		t.Errorf("UpdateNote with a nil note: got %v, want ErrNilNote", err)
+	}
+}
+
+func testCreate(t *testing.T, db services.DBClient) {
+	user := newUser()
+
+	note := create(t, db, user, &types.NoteDto{Title: ptr("Groceries")})
+	if note.ID == "" {
+		t.Error("created note has no ID")
+	}
+	want := types.Note{
+		ID:         note.ID,
+		Title:      "Groceries",
+		Color:      types.DefaultNoteColor,
+		Kind:       types.NoteKindText,
+		Format:     types.NoteFormatPlain,
+		Version:    1,
+		Permission: types.PermissionOwner,
+	}
+	compare(t, "created note", note, want)
+
+	remindAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	note = create(t, db, user, &types.NoteDto{
+		Title:      ptr("Call the bank"),
+		Content:    ptr("About the *card*"),
+		Archived:   ptr(true),
+		Pinned:     ptr(true),
+		Color:      ptr("red"),
+		Format:     ptr(types.NoteFormatMarkdown),
+		RemindAt:   types.Nullable[time.Time]{Set: true, Value: &remindAt},
+		Recurrence: types.Nullable[string]{Set: true, Value: ptr("FREQ=WEEKLY")},
+	})
+	want = types.Note{
+		ID:         note.ID,
+		Title:      "Call the bank",
+		Content:    "About the *card*",
+		Archived:   true,
+		Pinned:     true,
+		Color:      "red",
+		Kind:       types.NoteKindText,
+		Format:     types.NoteFormatMarkdown,
+		Version:    1,
+		RemindAt:   &remindAt,
+		Recurrence: "FREQ=WEEKLY",
+		Permission: types.PermissionOwner,
+	}
+	compare(t, "created note", note, want)
+
+	if _, err := db.CreateNote(context.Background(), user, &types.NoteDto{Title: ptr("In a workspace"), WorkspaceId: ptr(missingId)}); !errors.Is(err, datastore.ErrPermissionDenied) {
+		t.Errorf("CreateNote in a workspace the user is not in: got %v, want ErrPermissionDenied", err)
+	}
+}
+
+func testRead(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	note := create(t, db, user, &types.NoteDto{Title: ptr("Mine"), Content: ptr("Secret")})
+
+	got, err := db.GetSingleNote(ctx, user, note.ID)
+	if err != nil {
+		t.Fatalf("GetSingleNote: %v", err)
+	}
+	compare(t, "read note", got, note)
+
+	if _, err := db.GetSingleNote(ctx, newUser(), note.ID); !errors.Is(err, datastore.ErrNoteNoteFound) {
+		t.Errorf("GetSingleNote of someone else's note: got %v, want ErrNoteNoteFound", err)
+	}
+	if _, err := db.GetSingleNote(ctx, user, missingId); !errors.Is(err, datastore.ErrNoteNoteFound) {
+		t.Errorf("GetSingleNote of a missing note: got %v, want ErrNoteNoteFound", err)
+	}
+}
+
+func testUpdate(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	dueAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	note := create(t, db, user, &types.NoteDto{
+		Title:   ptr("Draft"),
+		Content: ptr("First version"),
+		DueAt:   types.Nullable[time.Time]{Set: true, Value: &dueAt},
+	})
+
+	updated, err := db.UpdateNote(ctx, user, note.ID, &types.NoteDto{Content: ptr("Second version"), Pinned: ptr(true)})
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	want := note
+	want.Content, want.Pinned, want.Version = "Second version", true, note.Version+1
+	compare(t, "updated note", updated, want)
+
+	// Fields sent as null are cleared, and those left out are kept.
+	updated, err = db.UpdateNote(ctx, user, note.ID, &types.NoteDto{DueAt: types.Nullable[time.Time]{Set: true}})
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	want.DueAt, want.Version = nil, want.Version+1
+	compare(t, "updated note", updated, want)
+
+	got, err := db.GetSingleNote(ctx, user, note.ID)
+	if err != nil {
+		t.Fatalf("GetSingleNote: %v", err)
+	}
+	compare(t, "read updated note", got, want)
+
+	if _, err := db.UpdateNote(ctx, newUser(), note.ID, &types.NoteDto{Title: ptr("Mine now")}); !errors.Is(err, datastore.ErrNoteNoteFound) {
+		t.Errorf("UpdateNote of someone else's note: got %v, want ErrNoteNoteFound", err)
+	}
+	if _, err := db.UpdateNote(ctx, user, missingId, &types.NoteDto{Title: ptr("Nothing")}); !errors.Is(err, datastore.ErrNoteNoteFound) {
+		t.Errorf("UpdateNote of a missing note: got %v, want ErrNoteNoteFound", err)
+	}
+}
+
+func testVersion(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	note := create(t, db, user, &types.NoteDto{Title: ptr("Versioned")})
+
+	unchanged, err := db.UpdateNote(ctx, user, note.ID, &types.NoteDto{Title: ptr("Versioned")})
+	if err != nil {
+		t.Fatalf("UpdateNote: %v", err)
+	}
+	if unchanged.Version != note.Version {
+		t.Errorf("version after an update changing nothing = %d, want %d", unchanged.Version, note.Version)
+	}
+
+	updated, err := db.UpdateNote(ctx, user, note.ID, &types.NoteDto{Content: ptr("Changed"), Version: ptr(note.Version)})
+	if err != nil {
+		t.Fatalf("UpdateNote at the current version: %v", err)
+	}
+	if updated.Version != note.Version+1 {
+		t.Errorf("version after an update = %d, want %d", updated.Version, note.Version+1)
+	}
+
+	if _, err := db.UpdateNote(ctx, user, note.ID, &types.NoteDto{Content: ptr("Stale"), Version: ptr(note.Version)}); !errors.Is(err, datastore.ErrVersionConflict) {
+		t.Errorf("UpdateNote at an old version: got %v, want ErrVersionConflict", err)
+	}
+	got, err := db.GetSingleNote(ctx, user, note.ID)
+	if err != nil {
+		t.Fatalf("GetSingleNote: %v", err)
+	}
+	if got.Content != "Changed" {
+		t.Errorf("content after a conflicting update = %q, want it unchanged", got.Content)
+	}
+}
+
+func testDelete(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	note := create(t, db, user, &types.NoteDto{Title: ptr("Short-lived")})
+
+	// Deleting someone else's note, or one that is missing, does nothing.
+	if err := db.DeleteNote(ctx, newUser(), note.ID); err != nil {
+		t.Errorf("DeleteNote of someone else's note: %v", err)
+	}
+	if _, err := db.GetSingleNote(ctx, user, note.ID); err != nil {
+		t.Errorf("note deleted by someone else: GetSingleNote = %v", err)
+	}
+	if err := db.DeleteNote(ctx, user, missingId); err != nil {
+		t.Errorf("DeleteNote of a missing note: %v", err)
+	}
+
+	if err := db.DeleteNote(ctx, user, note.ID); err != nil {
+		t.Fatalf("DeleteNote: %v", err)
+	}
+	if _, err := db.GetSingleNote(ctx, user, note.ID); !errors.Is(err, datastore.ErrNoteNoteFound) {
+		t.Errorf("GetSingleNote of a deleted note: got %v, want ErrNoteNoteFound", err)
+	}
+	if err := db.DeleteNote(ctx, user, note.ID); err != nil {
+		t.Errorf("DeleteNote of a deleted note: %v", err)
+	}
+}
+
+func testPagination(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	var ids []string
+	for i := range 5 {
+		ids = append(ids, create(t, db, user, &types.NoteDto{Title: ptr(fmt.Sprintf("Note %d", i))}).ID)
+	}
+	create(t, db, newUser(), &types.NoteDto{Title: ptr("Someone else's")})
+
+	for _, page := range []struct {
+		limit, offset int
+		want          []string
+	}{
+		{2, 0, ids[0:2]},
+		{2, 2, ids[2:4]},
+		{2, 4, ids[4:5]},
+		{2, 6, nil},
+		{10, 0, ids},
+	} {
+		notes, total, err := db.GetNotes(ctx, user, types.NoteFilter{}, page.limit, page.offset)
+		if err != nil {
+			t.Fatalf("GetNotes(limit %d, offset %d): %v", page.limit, page.offset, err)
+		}
+		if total != len(ids) {
+			t.Errorf("GetNotes(limit %d, offset %d) total = %d, want %d", page.limit, page.offset, total, len(ids))
+		}
+		if got := noteIds(notes); !slices.Equal(got, page.want) {
+			t.Errorf("GetNotes(limit %d, offset %d) = %v, want %v", page.limit, page.offset, got, page.want)
+		}
+	}
+
+	notes, total, err := db.GetNotes(ctx, user, types.NoteFilter{WorkspaceId: missingId}, 10, 0)
+	if err != nil || total != 0 || len(notes) != 0 {
+		t.Errorf("GetNotes of a workspace the user is not in = %v, %d, %v, want nothing", noteIds(notes), total, err)
+	}
+}
+
+func testFilters(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	plain := create(t, db, user, &types.NoteDto{Title: ptr("Plain")}).ID
+	archived := create(t, db, user, &types.NoteDto{Title: ptr("Archived"), Archived: ptr(true)}).ID
+	pinned := create(t, db, user, &types.NoteDto{Title: ptr("Pinned"), Pinned: ptr(true)}).ID
+	both := create(t, db, user, &types.NoteDto{Title: ptr("Pinned and archived"), Pinned: ptr(true), Archived: ptr(true)}).ID
+
+	for _, filter := range []struct {
+		name   string
+		filter types.NoteFilter
+		want   []string
+	}{
+		{"all", types.NoteFilter{}, []string{plain, archived, pinned, both}},
+		{"archived", types.NoteFilter{Archived: ptr(true)}, []string{archived, both}},
+		{"active", types.NoteFilter{Archived: ptr(false)}, []string{plain, pinned}},
+		{"pinned", types.NoteFilter{Pinned: ptr(true)}, []string{pinned, both}},
+		{"unpinned active", types.NoteFilter{Pinned: ptr(false), Archived: ptr(false)}, []string{plain}},
+		{"pinned first", types.NoteFilter{PinnedFirst: true}, []string{pinned, both, plain, archived}},
+	} {
+		notes, total, err := db.GetNotes(ctx, user, filter.filter, 10, 0)
+		if err != nil {
+			t.Fatalf("GetNotes(%s): %v", filter.name, err)
+		}
+		if got := noteIds(notes); !slices.Equal(got, filter.want) || total != len(filter.want) {
+			t.Errorf("GetNotes(%s) = %v (total %d), want %v", filter.name, got, total, filter.want)
+		}
+	}
+}
+
+func testTitles(t *testing.T, db services.DBClient) {
+	ctx, user := context.Background(), newUser()
+	create(t, db, user, &types.NoteDto{Title: ptr("Taken")})
+	other := create(t, db, user, &types.NoteDto{Title: ptr("Other")})
+
+	if _, err := db.CreateNote(ctx, user, &types.NoteDto{Title: ptr("Taken")}); !errors.Is(err, datastore.ErrDuplicateTitle) {
+		t.Errorf("CreateNote with a title in use: got %v, want ErrDuplicateTitle", err)
+	}
+	if _, err := db.UpdateNote(ctx, user, other.ID, &types.NoteDto{Title: ptr("Taken")}); !errors.Is(err, datastore.ErrDuplicateTitle) {
+		t.Errorf("UpdateNote to a title in use: got %v, want ErrDuplicateTitle", err)
+	}
+
+	// Titles only have to be unique among the notes of a user.
+	create(t, db, newUser(), &types.NoteDto{Title: ptr("Taken")})
+}
+
+func create(t *testing.T, db services.DBClient, userId string, note *types.NoteDto) types.Note {
+	t.Helper()
+	created, err := db.CreateNote(context.Background(), userId, note)
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	return created
+}
+
+// compare reports the fields of got that differ from want. Times are compared as instants.
+func compare(t *testing.T, what string, got, want types.Note) {
+	t.Helper()
+	field := func(name string, got, want any) {
+		if got != want {
+			t.Errorf("%s: %s = %v, want %v", what, name, got, want)
+		}
+	}
+	timeField := func(name string, got, want *time.Time) {
+		if (got == nil) != (want == nil) || (got != nil && !got.Equal(*want)) {
+			t.Errorf("%s: %s = %v, want %v", what, name, got, want)
+		}
+	}
+
+	field("ID", got.ID, want.ID)
+	field("Title", got.Title, want.Title)
+	field("Content", got.Content, want.Content)
+	field("Archived", got.Archived, want.Archived)
+	field("Pinned", got.Pinned, want.Pinned)
+	field("Color", got.Color, want.Color)
+	field("Kind", got.Kind, want.Kind)
+	field("Format", got.Format, want.Format)
+	field("Version", got.Version, want.Version)
+	field("Recurrence", got.Recurrence, want.Recurrence)
+	field("Permission", got.Permission, want.Permission)
+	timeField("RemindAt", got.RemindAt, want.RemindAt)
+	timeField("SnoozedUntil", got.SnoozedUntil, want.SnoozedUntil)
+	timeField("DueAt", got.DueAt, want.DueAt)
+}
+
+func newUser() string {
+	return uuid.NewString()
+}
+
+func noteIds(notes []types.Note) []string {
+	var ids []string
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+	return ids
+}
+
+func second[T any](_ T, err error) error {
+	return err
+}
+
+func third[T, U any](_ T, _ U, err error) error {
+	return err
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,5 @@
+ALTER TABLE notes
+    ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN color VARCHAR(20) NOT NULL DEFAULT 'default';
+
+CREATE INDEX notes_user_pinned_idx ON notes (user_id, pinned DESC, id);
@@ -0,0 +1,12 @@
+ALTER TABLE notes
+    ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'text';
+
+CREATE TABLE checklist_items (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    text VARCHAR NOT NULL,
+    checked BOOLEAN NOT NULL DEFAULT false,
+    position INT NOT NULL
+);
+
+CREATE INDEX checklist_items_note_position_idx ON checklist_items (note_id, position);
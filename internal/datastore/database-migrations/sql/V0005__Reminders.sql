@@ -0,0 +1,9 @@
+ALTER TABLE notes
+    ADD COLUMN remind_at TIMESTAMPTZ,
+    ADD COLUMN snoozed_until TIMESTAMPTZ,
+    ADD COLUMN reminder_fired_at TIMESTAMPTZ,
+    ADD COLUMN due_at TIMESTAMPTZ,
+    ADD COLUMN recurrence VARCHAR(255);
+
+CREATE INDEX notes_pending_reminders_idx ON notes (COALESCE(snoozed_until, remind_at))
+    WHERE remind_at IS NOT NULL AND archived = false;
@@ -0,0 +1,13 @@
+-- User ids are the string ids handed out by the user store, so notes need to hold them as text to be shared.
+ALTER TABLE notes ALTER COLUMN user_id TYPE VARCHAR USING user_id::text;
+
+CREATE TABLE note_shares (
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    permission VARCHAR(10) NOT NULL CHECK (permission IN ('viewer', 'editor')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (note_id, user_id)
+);
+
+CREATE INDEX note_shares_user_idx ON note_shares (user_id);
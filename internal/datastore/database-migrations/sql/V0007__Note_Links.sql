@@ -0,0 +1,16 @@
+-- Public read-only links to a note. Only a hash of the token is stored, so the links cannot be recovered from the
+-- database.
+CREATE TABLE note_links (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(255),
+    expires_at TIMESTAMPTZ,
+    max_views INT CHECK (max_views > 0),
+    view_count INT NOT NULL DEFAULT 0,
+    last_viewed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_links_note_idx ON note_links (note_id);
@@ -0,0 +1,35 @@
+CREATE TABLE workspaces (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_by VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE workspace_members (
+    workspace_id INT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, user_id)
+);
+
+CREATE INDEX workspace_members_user_idx ON workspace_members (user_id);
+
+-- Invitations wait for the invited user to accept or decline them before they become memberships.
+CREATE TABLE workspace_invitations (
+    id SERIAL PRIMARY KEY,
+    workspace_id INT NOT NULL REFERENCES workspaces (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    role VARCHAR(10) NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    invited_by VARCHAR NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, user_id)
+);
+
+-- A note belongs to a workspace when workspace_id is set, and to user_id otherwise. For workspace notes user_id
+-- records who created the note.
+ALTER TABLE notes ADD COLUMN workspace_id INT REFERENCES workspaces (id) ON DELETE CASCADE;
+
+CREATE INDEX notes_workspace_idx ON notes (workspace_id) WHERE workspace_id IS NOT NULL;
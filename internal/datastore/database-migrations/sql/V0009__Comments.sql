@@ -0,0 +1,26 @@
+-- Comments form threads of one level: a reply points at the top-level comment that started the thread.
+CREATE TABLE note_comments (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    parent_id INT REFERENCES note_comments (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    body TEXT NOT NULL,
+    resolved BOOLEAN NOT NULL DEFAULT false,
+    resolved_by VARCHAR,
+    resolved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX note_comments_note_idx ON note_comments (note_id, created_at);
+
+CREATE TABLE comment_mentions (
+    comment_id INT NOT NULL REFERENCES note_comments (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    read_at TIMESTAMPTZ,
+    PRIMARY KEY (comment_id, user_id)
+);
+
+CREATE INDEX comment_mentions_user_idx ON comment_mentions (user_id, created_at DESC);
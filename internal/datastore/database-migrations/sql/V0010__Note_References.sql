@@ -0,0 +1,12 @@
+-- The wiki links ([[Title]] or [[id]]) found in the content of notes. target_id is NULL while a link does not
+-- resolve to a note, which is how broken links are found.
+CREATE TABLE note_references (
+    source_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    target_text VARCHAR(255) NOT NULL,
+    target_id INT REFERENCES notes (id) ON DELETE SET NULL,
+    PRIMARY KEY (source_id, position)
+);
+
+CREATE INDEX note_references_target_idx ON note_references (target_id);
+CREATE INDEX note_references_unresolved_idx ON note_references (LOWER(target_text)) WHERE target_id IS NULL;
@@ -0,0 +1,2 @@
+-- Content is stored as written from now on. The format says how it is rendered.
+ALTER TABLE notes ADD COLUMN format VARCHAR(16) NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown'));
@@ -0,0 +1,13 @@
+-- Templates are personal. Their title and content may contain {{placeholders}} filled in when a note is created.
+CREATE TABLE note_templates (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    format VARCHAR(16) NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX note_templates_user_name_unique ON note_templates (user_id, LOWER(name));
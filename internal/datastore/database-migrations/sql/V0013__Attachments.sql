@@ -0,0 +1,33 @@
+-- Attachments count towards the storage quota of the user who uploaded them.
+CREATE TABLE note_attachments (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    user_id VARCHAR NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_attachments_note_idx ON note_attachments (note_id);
+CREATE INDEX note_attachments_user_idx ON note_attachments (user_id);
+
+-- The contents of deleted attachments are removed from the blob store in the background. Queueing them from a trigger
+-- catches every way an attachment goes away, including the cascades from deleted notes and workspaces.
+CREATE TABLE blob_deletions (
+    storage_key VARCHAR(255) PRIMARY KEY,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE FUNCTION queue_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_attachments_blob_deletion
+    AFTER DELETE ON note_attachments
+    FOR EACH ROW EXECUTE FUNCTION queue_blob_deletion();
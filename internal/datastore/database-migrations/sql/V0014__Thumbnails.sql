@@ -0,0 +1,29 @@
+-- Images get a thumbnail and their dimensions recorded in the background. thumbnail_status is NULL for attachments
+-- that are not images, and otherwise one of pending, ready or failed.
+ALTER TABLE note_attachments
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN thumbnail_status VARCHAR(16),
+    ADD COLUMN thumbnail_key VARCHAR(255),
+    ADD COLUMN thumbnail_content_type VARCHAR(255);
+
+-- Jobs stay queued until they succeed or run out of attempts, so that thumbnails are made even across restarts.
+CREATE TABLE thumbnail_jobs (
+    attachment_id INT PRIMARY KEY REFERENCES note_attachments (id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    run_after TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX thumbnail_jobs_run_after_idx ON thumbnail_jobs (run_after);
+
+CREATE OR REPLACE FUNCTION queue_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO blob_deletions (storage_key) VALUES (OLD.thumbnail_key) ON CONFLICT DO NOTHING;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
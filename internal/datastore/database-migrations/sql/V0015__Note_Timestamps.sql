@@ -0,0 +1,5 @@
+-- When notes were created and last edited. Nothing better is known for the notes from before these columns existed, so
+-- they are taken to have been created and edited when the columns were added.
+ALTER TABLE notes
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
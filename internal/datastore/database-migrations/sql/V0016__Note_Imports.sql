@@ -0,0 +1,39 @@
+-- Imports run in the background from an uploaded file kept in the blob store. status is one of pending, running, done
+-- or failed; heartbeat_at is touched as a running import makes progress, so that imports abandoned by a crashed
+-- replica are picked up again. report lists the items that were skipped or could not be imported.
+CREATE TABLE note_imports (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR NOT NULL,
+    workspace_id INT REFERENCES workspaces (id) ON DELETE CASCADE,
+    source VARCHAR(16) NOT NULL CHECK (source IN ('markdown', 'keep', 'enex')),
+    filename VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done', 'failed')),
+    total INT NOT NULL DEFAULT 0,
+    processed INT NOT NULL DEFAULT 0,
+    imported INT NOT NULL DEFAULT 0,
+    skipped INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    report JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    heartbeat_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX note_imports_user_idx ON note_imports (user_id);
+CREATE INDEX note_imports_unfinished_idx ON note_imports (created_at) WHERE status IN ('pending', 'running');
+
+-- The uploaded file is removed once the import finishes, or when the import goes away before that.
+CREATE FUNCTION queue_import_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_imports_blob_deletion
+    AFTER DELETE ON note_imports
+    FOR EACH ROW EXECUTE FUNCTION queue_import_blob_deletion();
@@ -0,0 +1,92 @@
+-- Work done in the background goes through a single queue. Replicas claim due jobs with FOR UPDATE SKIP LOCKED and
+-- hold them for a lease they keep extending while the job runs; a job whose lease runs out is claimed again. Failed
+-- jobs are retried with a growing delay until they run out of attempts. user_id is set for jobs a user started, who
+-- can follow and cancel them.
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    user_id VARCHAR,
+    payload JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    progress_done INT,
+    progress_total INT,
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    run_after TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    cancel_requested BOOLEAN NOT NULL DEFAULT false,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX jobs_queued_idx ON jobs (run_after) WHERE status = 'queued';
+CREATE INDEX jobs_running_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX jobs_user_idx ON jobs (user_id) WHERE user_id IS NOT NULL;
+
+-- Thumbnails are made by jobs instead of through their own table.
+INSERT INTO jobs (kind, payload, attempts, run_after, last_error, created_at)
+SELECT 'thumbnail', jsonb_build_object('attachmentId', attachment_id::text), attempts, run_after, last_error, created_at
+FROM thumbnail_jobs;
+
+DROP TABLE thumbnail_jobs;
+
+-- So are the deletions of blobs, which are still queued by triggers.
+INSERT INTO jobs (kind, payload, attempts, created_at)
+SELECT 'blob_deletion', jsonb_build_object('key', storage_key), attempts, created_at
+FROM blob_deletions;
+
+DROP TABLE blob_deletions;
+
+CREATE OR REPLACE FUNCTION queue_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO jobs (kind, payload) VALUES ('blob_deletion', jsonb_build_object('key', OLD.storage_key));
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO jobs (kind, payload) VALUES ('blob_deletion', jsonb_build_object('key', OLD.thumbnail_key));
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION queue_import_blob_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO jobs (kind, payload) VALUES ('blob_deletion', jsonb_build_object('key', OLD.storage_key));
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Imports run as jobs, which now hold their status. The progress and report of an import stay with it.
+ALTER TABLE note_imports ADD COLUMN job_id BIGINT REFERENCES jobs (id) ON DELETE SET NULL;
+
+WITH queued AS (
+    INSERT INTO jobs (kind, user_id, payload, status, attempts, last_error, created_at, finished_at)
+    SELECT 'import', user_id, jsonb_build_object('importId', id::text),
+        CASE status WHEN 'done' THEN 'succeeded' WHEN 'failed' THEN 'failed' ELSE 'queued' END,
+        attempts, error, created_at, finished_at
+    FROM note_imports
+    RETURNING id, (payload->>'importId')::int AS import_id)
+UPDATE note_imports SET job_id = queued.id FROM queued WHERE note_imports.id = queued.import_id;
+
+DROP INDEX note_imports_unfinished_idx;
+ALTER TABLE note_imports
+    DROP COLUMN status,
+    DROP COLUMN error,
+    DROP COLUMN attempts,
+    DROP COLUMN heartbeat_at,
+    DROP COLUMN finished_at;
+
+-- The uploaded file of an import is removed once its job is over, however it ended.
+CREATE FUNCTION queue_import_upload_deletion() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO jobs (kind, payload)
+    SELECT 'blob_deletion', jsonb_build_object('key', storage_key) FROM note_imports WHERE job_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER jobs_import_finished
+    AFTER UPDATE OF status ON jobs
+    FOR EACH ROW
+    WHEN (NEW.kind = 'import' AND NEW.status IN ('succeeded', 'failed', 'cancelled') AND OLD.status <> NEW.status)
+    EXECUTE FUNCTION queue_import_upload_deletion();
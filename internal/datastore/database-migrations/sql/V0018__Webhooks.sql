@@ -0,0 +1,37 @@
+-- Webhooks are called with the events of the notes their user can read, signed with the secret of the webhook.
+-- consecutive_failures counts the delivery attempts that failed in a row; the webhook is disabled once it gets too high.
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    events TEXT[] NOT NULL,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT true,
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    disabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX webhooks_user_idx ON webhooks (user_id) WHERE active;
+
+-- Each event is delivered to each webhook subscribed to it by a job of its own. The delivery keeps the outcome of the
+-- latest attempt for the delivery log; a redelivery is a new delivery of the same payload.
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    redelivery_of BIGINT,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    response_status INT,
+    response_body TEXT,
+    error TEXT,
+    duration_ms INT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    attempted_at TIMESTAMPTZ
+);
+
+CREATE INDEX webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id DESC);
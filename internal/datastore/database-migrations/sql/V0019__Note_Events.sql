@@ -0,0 +1,25 @@
+-- A short log of the changes to notes, with one row for each user who can read the note, that feeds the live event
+-- streams of clients. Each row is announced on the note_events channel as it is committed, so that every replica can
+-- wake the streams of the user; the event itself is read from the log, which is also what clients resume from.
+CREATE TABLE note_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id VARCHAR NOT NULL,
+    note_id INT NOT NULL,
+    event VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_events_user_idx ON note_events (user_id, id);
+CREATE INDEX note_events_created_idx ON note_events (created_at);
+
+CREATE FUNCTION notify_note_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('note_events', NEW.user_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_events_notify
+    AFTER INSERT ON note_events
+    FOR EACH ROW EXECUTE FUNCTION notify_note_event();
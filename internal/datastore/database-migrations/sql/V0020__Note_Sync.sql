@@ -0,0 +1,120 @@
+-- Offline clients sync by asking for the changes since their last sync. Every write to a note records the transaction
+-- that made it in change_xid, and sync tokens hold the oldest transaction that was still running when the changes
+-- were read: anything written by a transaction at or after it is sent again on the next sync, so that changes
+-- committed out of order are never skipped. version goes up whenever what clients see of a note changes, and is what
+-- clients send back to detect conflicting edits.
+ALTER TABLE notes
+    ADD COLUMN version INT NOT NULL DEFAULT 1,
+    ADD COLUMN change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX notes_change_xid_idx ON notes (change_xid);
+
+CREATE FUNCTION track_note_change() RETURNS trigger AS $$
+BEGIN
+    NEW.change_xid := pg_current_xact_id();
+    IF to_jsonb(NEW) - '{change_xid,version,updated_at,reminder_fired_at}'::text[]
+            IS DISTINCT FROM to_jsonb(OLD) - '{change_xid,version,updated_at,reminder_fired_at}'::text[] THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_track_change
+    BEFORE UPDATE ON notes
+    FOR EACH ROW EXECUTE FUNCTION track_note_change();
+
+-- A tombstone tells a user that a note they could read is gone, because it was deleted or they lost access to it.
+-- Gaining access again removes the tombstone and touches the note, so that it is sent as changed.
+CREATE TABLE note_tombstones (
+    user_id VARCHAR NOT NULL,
+    note_id INT NOT NULL,
+    change_xid xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    deleted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, note_id)
+);
+
+CREATE INDEX note_tombstones_change_idx ON note_tombstones (user_id, change_xid);
+
+CREATE FUNCTION bury_note(bury_user_id VARCHAR, bury_note_id INT) RETURNS void AS $$
+    INSERT INTO note_tombstones (user_id, note_id) VALUES (bury_user_id, bury_note_id)
+    ON CONFLICT (user_id, note_id) DO UPDATE SET change_xid = EXCLUDED.change_xid, deleted_at = EXCLUDED.deleted_at;
+$$ LANGUAGE sql;
+
+CREATE FUNCTION bury_deleted_note() RETURNS trigger AS $$
+BEGIN
+    PERFORM bury_note(readers.user_id, OLD.id)
+    FROM (
+        SELECT OLD.user_id WHERE OLD.workspace_id IS NULL
+        UNION
+        SELECT user_id FROM note_shares WHERE note_id = OLD.id
+        UNION
+        SELECT user_id FROM workspace_members WHERE workspace_id = OLD.workspace_id
+    ) readers (user_id);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER notes_bury
+    BEFORE DELETE ON notes
+    FOR EACH ROW EXECUTE FUNCTION bury_deleted_note();
+
+-- A revoked share buries the note unless the user can still read it through its workspace. When the note itself is
+-- being deleted it is already gone here, and burying it again does no harm.
+CREATE FUNCTION bury_unshared_note() RETURNS trigger AS $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM notes
+        WHERE notes.id = OLD.note_id
+            AND ((notes.workspace_id IS NULL AND notes.user_id = OLD.user_id)
+                OR EXISTS (SELECT 1 FROM workspace_members wm
+                           WHERE wm.workspace_id = notes.workspace_id AND wm.user_id = OLD.user_id))) THEN
+        PERFORM bury_note(OLD.user_id, OLD.note_id);
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_shares_bury
+    AFTER DELETE ON note_shares
+    FOR EACH ROW EXECUTE FUNCTION bury_unshared_note();
+
+CREATE FUNCTION unbury_shared_note() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM note_tombstones WHERE user_id = NEW.user_id AND note_id = NEW.note_id;
+    UPDATE notes SET change_xid = pg_current_xact_id() WHERE id = NEW.note_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER note_shares_unbury
+    AFTER INSERT OR UPDATE ON note_shares
+    FOR EACH ROW EXECUTE FUNCTION unbury_shared_note();
+
+CREATE FUNCTION bury_workspace_notes() RETURNS trigger AS $$
+BEGIN
+    PERFORM bury_note(OLD.user_id, notes.id)
+    FROM notes
+    WHERE notes.workspace_id = OLD.workspace_id
+        AND NOT EXISTS (SELECT 1 FROM note_shares ns WHERE ns.note_id = notes.id AND ns.user_id = OLD.user_id);
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workspace_members_bury
+    AFTER DELETE ON workspace_members
+    FOR EACH ROW EXECUTE FUNCTION bury_workspace_notes();
+
+CREATE FUNCTION unbury_workspace_notes() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM note_tombstones nt
+    USING notes
+    WHERE nt.user_id = NEW.user_id AND nt.note_id = notes.id AND notes.workspace_id = NEW.workspace_id;
+    UPDATE notes SET change_xid = pg_current_xact_id() WHERE workspace_id = NEW.workspace_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER workspace_members_unbury
+    AFTER INSERT OR UPDATE ON workspace_members
+    FOR EACH ROW EXECUTE FUNCTION unbury_workspace_notes();
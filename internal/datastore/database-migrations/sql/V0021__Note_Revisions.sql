@@ -0,0 +1,12 @@
+-- Revisions record the content of a note each time a collaborative editing session saves it, and who edited it since
+-- the revision before.
+CREATE TABLE note_revisions (
+    id SERIAL PRIMARY KEY,
+    note_id INT NOT NULL REFERENCES notes (id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    content VARCHAR NOT NULL,
+    editors VARCHAR[] NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX note_revisions_note_idx ON note_revisions (note_id, id DESC);
@@ -0,0 +1,54 @@
+-- Titles are unique within the personal notes of a user or within a workspace. Notes that already share a title with an
+-- older note are renamed first by appending their id, so the index can be created over the existing notes. The title is
+-- shortened to keep it within the 255 bytes the API accepts, and a counter is added when another note already has the
+-- new title.
+DO $$
+DECLARE
+    duplicate record;
+    suffix    text;
+    renamed   text;
+    attempt   int;
+BEGIN
+    FOR duplicate IN
+        SELECT id, user_id, workspace_id, title
+        FROM (
+            SELECT id, user_id, workspace_id, title, ROW_NUMBER() OVER (
+                PARTITION BY COALESCE('workspace:' || workspace_id::text, user_id), title
+                ORDER BY id
+            ) AS position
+            FROM notes
+            WHERE title IS NOT NULL
+        ) titles
+        WHERE position > 1
+        ORDER BY id
+    LOOP
+        attempt := 1;
+        LOOP
+            suffix := ' (' || duplicate.id || CASE WHEN attempt > 1 THEN '-' || attempt ELSE '' END || ')';
+            renamed := LEFT(duplicate.title, 255 - octet_length(suffix));
+            WHILE octet_length(renamed) > 255 - octet_length(suffix) LOOP
+                renamed := LEFT(renamed, -1);
+            END LOOP;
+            renamed := renamed || suffix;
+
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM notes
+                WHERE COALESCE('workspace:' || workspace_id::text, user_id)
+                          = COALESCE('workspace:' || duplicate.workspace_id::text, duplicate.user_id)
+                  AND title = renamed
+            );
+            attempt := attempt + 1;
+        END LOOP;
+
+        UPDATE notes SET title = renamed WHERE id = duplicate.id;
+    END LOOP;
+END;
+$$;
+
+-- The index used to be built by the service at startup, so it may already exist.
+DROP INDEX IF EXISTS notes_user_title_unique;
+
+CREATE UNIQUE INDEX notes_user_title_unique ON notes (COALESCE('workspace:' || workspace_id::text, user_id), title);
+
+-- The policy the index enforces. The service rebuilds the index at startup when TITLE_UNIQUENESS asks for another one.
+COMMENT ON INDEX notes_user_title_unique IS 'exact,per-workspace';
@@ -0,0 +1,11 @@
+-- Reminders are claimed before they are delivered by pushing reminder_retry_at past the time the delivery can take,
+-- and a failed delivery pushes it back further each time it fails, so that failing reminders wait their turn instead
+-- of being retried ahead of every other due reminder.
+ALTER TABLE notes
+    ADD COLUMN reminder_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN reminder_retry_at TIMESTAMPTZ;
+
+DROP INDEX notes_pending_reminders_idx;
+
+CREATE INDEX notes_pending_reminders_idx ON notes (COALESCE(reminder_retry_at, snoozed_until, remind_at))
+    WHERE remind_at IS NOT NULL AND archived = false;
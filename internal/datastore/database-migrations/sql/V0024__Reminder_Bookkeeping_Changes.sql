@@ -0,0 +1,18 @@
+-- Claiming, retrying and firing a reminder write columns clients never see. Writes that only change those leave the
+-- version and change_xid of a note alone, so that they neither fail edits made against the version a client holds nor
+-- send the note to every syncing client again. Setting change_xid explicitly still touches the note, as granting
+-- access to it does.
+CREATE OR REPLACE FUNCTION track_note_change() RETURNS trigger AS $$
+DECLARE
+    bookkeeping CONSTANT text[] := '{reminder_fired_at,reminder_attempts,reminder_retry_at}';
+BEGIN
+    IF to_jsonb(NEW) - bookkeeping - '{change_xid,version,updated_at}'::text[]
+            IS DISTINCT FROM to_jsonb(OLD) - bookkeeping - '{change_xid,version,updated_at}'::text[] THEN
+        NEW.version := OLD.version + 1;
+    ELSIF to_jsonb(NEW) - bookkeeping IS NOT DISTINCT FROM to_jsonb(OLD) - bookkeeping THEN
+        RETURN NEW;
+    END IF;
+    NEW.change_xid := pg_current_xact_id();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
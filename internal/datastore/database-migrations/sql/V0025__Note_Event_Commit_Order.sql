@@ -0,0 +1,8 @@
+-- Event ids are handed out as events are inserted, not as they are committed, so a client that had read up to an event
+-- would skip one with a lower id committed after it. Each event records the transaction that logged it, and events are
+-- read in order of transaction, once every transaction that could still log an event before them has finished.
+ALTER TABLE note_events ADD COLUMN change_xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+DROP INDEX note_events_user_idx;
+CREATE INDEX note_events_user_idx ON note_events (user_id, change_xid, id);
+CREATE INDEX note_events_position_idx ON note_events (change_xid, id);
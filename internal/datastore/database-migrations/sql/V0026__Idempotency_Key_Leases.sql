@@ -0,0 +1,5 @@
+-- A key is only held for a request while the process running it renews its lease, so that a retry can take over the
+-- key of a request whose process went away instead of being refused until the key expires. Reservations made before
+-- leases existed are given a minute to finish.
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMPTZ NOT NULL DEFAULT (NOW() + INTERVAL '1 minute');
+ALTER TABLE idempotency_keys ALTER COLUMN locked_until DROP DEFAULT;
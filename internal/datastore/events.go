@@ -0,0 +1,160 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var _ services.NoteEventStore = &Postgres{}
+
+// noteEventsChannel is the channel each row of note_events is announced on, with the user it is for as payload.
+const noteEventsChannel = "note_events"
+
+// logNoteEvent adds an event of a note to the log of every user who can read it.
+func logNoteEvent(ctx context.Context, tx *sql.Tx, event, noteId string, payload []byte) error {
+	query := `
+        INSERT INTO note_events (user_id, note_id, event, payload)
+        SELECT readers.user_id, $1, $2, $3
+        FROM (
+            SELECT user_id FROM notes WHERE id = $1 AND workspace_id IS NULL
+            UNION
+            SELECT user_id FROM note_shares WHERE note_id = $1
+            UNION
+            SELECT wm.user_id FROM workspace_members wm JOIN notes ON notes.workspace_id = wm.workspace_id WHERE notes.id = $1
+        ) readers`
+
+	if _, err := tx.ExecContext(ctx, query, noteId, event, string(payload)); err != nil {
+		return fmt.Errorf("unable to log %s event: %w", event, err)
+	}
+	return nil
+}
+
+// GetNoteEvents returns up to limit events of the user that come after afterId, oldest first. complete is false when
+// events after afterId may already have been pruned from the log, in which case the caller has missed some.
+//
+// Events come in the order of the transactions that logged them rather than of their ids, which are taken before the
+// transactions commit, and only once every older transaction has finished. An event can therefore be held back for as
+// long as an older transaction runs, but none is skipped by a caller that has read past it.
+func (p *Postgres) GetNoteEvents(ctx context.Context, userId string, afterId int64, limit int) ([]types.NoteEvent, bool, error) {
+	var complete bool
+	check := `
+        SELECT EXISTS (SELECT 1 FROM note_events WHERE id = $1)
+            OR $1 >= COALESCE((SELECT MIN(id) FROM note_events), 0)`
+
+	if err := p.db.QueryRowContext(ctx, check, afterId).Scan(&complete); err != nil {
+		p.logger.Error("unable to check event log", zap.String("operation_name", "GetNoteEvents"), zap.String("userId", userId), zap.Error(err))
+		return nil, false, fmt.Errorf("unable to check event log: %w", err)
+	}
+
+	// An afterId that is no longer in the log, or never was, falls back to the order of ids.
+	query := `
+        WITH position AS (SELECT change_xid FROM note_events WHERE id = $2)
+        SELECT id, event, note_id, payload, created_at
+        FROM note_events
+        WHERE user_id = $1
+            AND change_xid < pg_snapshot_xmin(pg_current_snapshot())
+            AND CASE
+                WHEN EXISTS (SELECT 1 FROM position) THEN (change_xid, id) > ((SELECT change_xid FROM position), $2)
+                ELSE id > $2
+            END
+        ORDER BY change_xid, id
+        LIMIT $3`
+
+	rows, err := p.db.QueryContext(ctx, query, userId, afterId, limit)
+	if err != nil {
+		p.logger.Error("unable to query events", zap.String("operation_name", "GetNoteEvents"), zap.String("userId", userId), zap.Error(err))
+		return nil, false, fmt.Errorf("unable to query events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []types.NoteEvent
+	for rows.Next() {
+		var event types.NoteEvent
+		if err := rows.Scan(&event.ID, &event.Event, &event.NoteId, &event.Note, &event.CreatedAt); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "GetNoteEvents"), zap.Error(err))
+			return nil, false, fmt.Errorf("unable to scan row: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.String("operation_name", "GetNoteEvents"), zap.Error(err))
+		return nil, false, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return events, complete, nil
+}
+
+// GetLatestNoteEventID returns the id of the latest event logged for anyone that GetNoteEvents would return, from which
+// a stream that only wants new events starts.
+func (p *Postgres) GetLatestNoteEventID(ctx context.Context) (int64, error) {
+	query := `
+        SELECT COALESCE((
+            SELECT id
+            FROM note_events
+            WHERE change_xid < pg_snapshot_xmin(pg_current_snapshot())
+            ORDER BY change_xid DESC, id DESC
+            LIMIT 1), 0)`
+
+	var id int64
+	if err := p.db.QueryRowContext(ctx, query).Scan(&id); err != nil {
+		p.logger.Error("unable to get latest event", zap.String("operation_name", "GetLatestNoteEventID"), zap.Error(err))
+		return 0, fmt.Errorf("unable to get latest event: %w", err)
+	}
+	return id, nil
+}
+
+// PruneNoteEvents deletes the events logged before createdBefore.
+func (p *Postgres) PruneNoteEvents(ctx context.Context, createdBefore time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM note_events WHERE created_at < $1`, createdBefore)
+	if err != nil {
+		p.logger.Error("unable to prune events", zap.String("operation_name", "PruneNoteEvents"), zap.Error(err))
+		return 0, fmt.Errorf("unable to prune events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// ListenNoteEvents calls notify with the user of each event logged, by any replica, until ctx is cancelled. It runs on
+// a connection of its own. Notifications sent while the connection was down are lost, so notify is called with an
+// empty user once it is back, meaning that any user may have new events.
+func (p *Postgres) ListenNoteEvents(ctx context.Context, notify func(userId string)) error {
+	listener := pq.NewListener(getPostgresConnStr(&p.cfg), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			p.logger.Warn("lost connection listening for note events", zap.Error(err))
+		case pq.ListenerEventReconnected:
+			p.logger.Info("listening for note events again")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(noteEventsChannel); err != nil {
+		p.logger.Error("unable to listen for note events", zap.String("operation_name", "ListenNoteEvents"), zap.Error(err))
+		return fmt.Errorf("unable to listen for note events: %w", err)
+	}
+
+	// Pinging now and then notices a connection that went away without being told.
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				notify("")
+				continue
+			}
+			notify(n.Extra)
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var _ services.ExportStore = &Postgres{}
+
+// ExportNotes streams the notes matched by filter to fn as they are read, so that the export of a large account is
+// never held in memory at once. The items of checklist notes come along as a JSON array.
+func (p *Postgres) ExportNotes(ctx context.Context, userId string, filter types.NoteFilter, fn func(types.ExportedNote) error) error {
+	where, args := noteFilterWhere(userId, filter)
+
+	query := fmt.Sprintf(`
+		SELECT %s, notes.created_at, notes.updated_at,
+			(SELECT COALESCE(json_agg(json_build_object('id', ci.id, 'text', ci.text, 'checked', ci.checked, 'position', ci.position)
+				ORDER BY ci.position), '[]') FROM checklist_items ci WHERE ci.note_id = notes.id)
+		FROM notes
+		WHERE %s
+		ORDER BY %s`, noteColumns, where, noteOrder(filter))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return p.exportFailed(userId, "unable to query notes", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var note types.ExportedNote
+		var items []byte
+		if err := scanNote(rows, &note.Note, &note.CreatedAt, &note.UpdatedAt, &items); err != nil {
+			return p.exportFailed(userId, "unable to scan row", err)
+		}
+		if note.Kind == types.NoteKindChecklist {
+			if err := json.Unmarshal(items, &note.Items); err != nil {
+				return p.exportFailed(userId, "unable to read checklist items", err)
+			}
+		}
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return p.exportFailed(userId, "row iteration error", err)
+	}
+	return nil
+}
+
+func (p *Postgres) exportFailed(userId, msg string, err error) error {
+	p.logger.Error(msg,
+		zap.String("operation_name", "ExportNotes"),
+		zap.Error(err),
+		zap.String("userId", userId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
@@ -0,0 +1,156 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var _ services.IdempotencyStore = &Postgres{}
+
+// ReserveIdempotencyKey claims an idempotency key for the user until record.LockedUntil. If the key was free (or its
+// previous use has expired) the record is stored and returned with reserved set to true, as it is when the same request
+// was reserved before but its lease ran out without it finishing. Otherwise the existing record is returned so the
+// caller can decide whether to replay it or reject the request.
+func (p *Postgres) ReserveIdempotencyKey(ctx context.Context, record types.IdempotencyRecord) (types.IdempotencyRecord, bool, error) {
+	if record.UserId == "" || record.Key == "" || record.Fingerprint == "" {
+		p.logger.Error("userId, key and fingerprint must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", record.UserId),
+			zap.String("key", record.Key))
+
+		return types.IdempotencyRecord{}, false, fmt.Errorf("userId, key and fingerprint must be provided: %w", ErrParameterNotProvided)
+	}
+
+	// Expired keys are cleared first so that a key can be reused once its window has passed.
+	deleteQuery := `
+        DELETE FROM idempotency_keys
+        WHERE user_id = $1 AND idempotency_key = $2 AND expires_at <= NOW()`
+
+	if _, err := p.db.ExecContext(ctx, deleteQuery, record.UserId, record.Key); err != nil {
+		p.logger.Error("failed to clear expired idempotency key",
+			zap.String("operation_name", "ReserveIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", record.UserId),
+		)
+		return types.IdempotencyRecord{}, false, fmt.Errorf("failed to clear expired idempotency key: %w", err)
+	}
+
+	insertQuery := `
+        INSERT INTO idempotency_keys (user_id, idempotency_key, fingerprint, expires_at, locked_until)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id, idempotency_key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+        WHERE idempotency_keys.fingerprint = EXCLUDED.fingerprint
+            AND idempotency_keys.status_code IS NULL
+            AND idempotency_keys.locked_until <= NOW()`
+
+	res, err := p.db.ExecContext(ctx, insertQuery, record.UserId, record.Key, record.Fingerprint, record.ExpiresAt, record.LockedUntil)
+	if err != nil {
+		p.logger.Error("failed to reserve idempotency key",
+			zap.String("operation_name", "ReserveIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", record.UserId),
+		)
+		return types.IdempotencyRecord{}, false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return types.IdempotencyRecord{}, false, fmt.Errorf("could not check rows affected after reserving idempotency key: %w", err)
+	}
+	if rowsAffected == 1 {
+		return record, true, nil
+	}
+
+	selectQuery := `
+        SELECT fingerprint, status_code, response_body, content_type, created_at, expires_at, locked_until
+        FROM idempotency_keys
+        WHERE user_id = $1 AND idempotency_key = $2`
+
+	existing := types.IdempotencyRecord{UserId: record.UserId, Key: record.Key}
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+
+	err = p.db.QueryRowContext(ctx, selectQuery, record.UserId, record.Key).Scan(
+		&existing.Fingerprint,
+		&statusCode,
+		&existing.Body,
+		&contentType,
+		&existing.CreatedAt,
+		&existing.ExpiresAt,
+		&existing.LockedUntil,
+	)
+	if err != nil {
+		p.logger.Error("failed to load idempotency key",
+			zap.String("operation_name", "ReserveIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", record.UserId),
+		)
+		return types.IdempotencyRecord{}, false, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+
+	existing.StatusCode = int(statusCode.Int64)
+	existing.ContentType = contentType.String
+
+	return existing, false, nil
+}
+
+// RenewIdempotencyKey holds a reserved key for the request running under it until lockedUntil.
+func (p *Postgres) RenewIdempotencyKey(ctx context.Context, userId, key string, lockedUntil time.Time) error {
+	query := `
+        UPDATE idempotency_keys
+        SET locked_until = $1
+        WHERE user_id = $2 AND idempotency_key = $3 AND status_code IS NULL`
+
+	if _, err := p.db.ExecContext(ctx, query, lockedUntil, userId, key); err != nil {
+		p.logger.Error("failed to renew idempotency key",
+			zap.String("operation_name", "RenewIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return fmt.Errorf("failed to renew idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// CompleteIdempotencyKey stores the response produced for a reserved key so it can be replayed.
+func (p *Postgres) CompleteIdempotencyKey(ctx context.Context, userId, key string, statusCode int, contentType string, body []byte) error {
+	query := `
+        UPDATE idempotency_keys
+        SET status_code = $1, content_type = $2, response_body = $3
+        WHERE user_id = $4 AND idempotency_key = $5`
+
+	if _, err := p.db.ExecContext(ctx, query, statusCode, contentType, body, userId, key); err != nil {
+		p.logger.Error("failed to store idempotent response",
+			zap.String("operation_name", "CompleteIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a reserved key, allowing the client to retry a request that failed on our side.
+func (p *Postgres) ReleaseIdempotencyKey(ctx context.Context, userId, key string) error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE user_id = $1 AND idempotency_key = $2`
+
+	if _, err := p.db.ExecContext(ctx, query, userId, key); err != nil {
+		p.logger.Error("failed to release idempotency key",
+			zap.String("operation_name", "ReleaseIdempotencyKey"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var ErrImportNotFound = errors.New("could not find import")
+var _ services.ImportStore = &Postgres{}
+
+// maxImportReport bounds the items reported on for a single import, as a file full of broken items could otherwise
+// grow the report without limit. The counts keep adding up past it.
+const maxImportReport = 1000
+
+// importColumns selects an import i along with the status of its job j.
+const importColumns = `i.id, COALESCE(i.job_id::text, ''), i.user_id, i.workspace_id, i.source, i.filename, i.size, i.storage_key,
+	CASE COALESCE(j.status, 'succeeded') WHEN 'queued' THEN 'pending' WHEN 'succeeded' THEN 'done' ELSE j.status END,
+	i.total, i.processed, i.imported, i.skipped, i.failed, i.report, COALESCE(j.last_error, ''), i.created_at, j.finished_at`
+
+func scanImport(row rowScanner, imp *types.Import) error {
+	var workspaceId sql.NullString
+	var report []byte
+	var finishedAt sql.NullTime
+	err := row.Scan(&imp.ID, &imp.JobId, &imp.UserId, &workspaceId, &imp.Source, &imp.Filename, &imp.Size, &imp.StorageKey,
+		&imp.Status, &imp.Total, &imp.Processed, &imp.Imported, &imp.Skipped, &imp.Failed, &report, &imp.Error, &imp.CreatedAt,
+		&finishedAt)
+	if err != nil {
+		return err
+	}
+
+	imp.WorkspaceId = stringPtr(workspaceId)
+	imp.FinishedAt = timePtr(finishedAt)
+	return json.Unmarshal(report, &imp.Report)
+}
+
+func (p *Postgres) importFailed(operation, userId, importId, msg string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", msg, ErrImportNotFound)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("importId", importId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// CreateImport records an uploaded file for import and queues the job importing it. Notes can only be imported into a
+// workspace by its owners and editors.
+func (p *Postgres) CreateImport(ctx context.Context, userId string, imp types.Import) (types.Import, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, "", "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	insert := `
+        INSERT INTO note_imports (user_id, workspace_id, source, filename, size, storage_key)
+        SELECT $1, $2::int, $3, $4, $5, $6
+        WHERE $2::int IS NULL OR EXISTS (
+            SELECT 1 FROM workspace_members wm
+            WHERE wm.workspace_id = $2::int AND wm.user_id = $1 AND wm.role IN ('owner', 'editor'))
+        RETURNING id`
+
+	var importId string
+	err = tx.QueryRowContext(ctx, insert, userId, imp.WorkspaceId, imp.Source, imp.Filename, imp.Size, imp.StorageKey).Scan(&importId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.Import{}, fmt.Errorf("unable to create import: %w", ErrPermissionDenied)
+	}
+	if err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, "", "unable to create import", err)
+	}
+
+	job, err := enqueueJob(ctx, tx, types.JobDto{Kind: types.JobImport, UserId: userId, Payload: map[string]string{"importId": importId}})
+	if err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, importId, "unable to queue import", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE note_imports SET job_id = $2 WHERE id = $1`, importId, job.ID); err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, importId, "unable to queue import", err)
+	}
+
+	var created types.Import
+	query := `SELECT ` + importColumns + ` FROM note_imports i LEFT JOIN jobs j ON j.id = i.job_id WHERE i.id = $1`
+	if err := scanImport(tx.QueryRowContext(ctx, query, importId), &created); err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, importId, "unable to create import", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Import{}, p.importFailed("CreateImport", userId, importId, "unable to create import", err)
+	}
+
+	p.logger.Info("import queued", zap.String("userId", userId), zap.String("importId", created.ID), zap.String("jobId", job.ID))
+	return created, nil
+}
+
+// GetImport returns an import of the user, with its progress so far.
+func (p *Postgres) GetImport(ctx context.Context, userId, importId string) (types.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM note_imports i LEFT JOIN jobs j ON j.id = i.job_id WHERE i.id = $1 AND i.user_id = $2`
+
+	var imp types.Import
+	if err := scanImport(p.db.QueryRowContext(ctx, query, importId, userId), &imp); err != nil {
+		return types.Import{}, p.importFailed("GetImport", userId, importId, "unable to get import", err)
+	}
+	return imp, nil
+}
+
+// GetImportByID returns an import for the job running it.
+func (p *Postgres) GetImportByID(ctx context.Context, importId string) (types.Import, error) {
+	query := `SELECT ` + importColumns + ` FROM note_imports i LEFT JOIN jobs j ON j.id = i.job_id WHERE i.id = $1`
+
+	var imp types.Import
+	if err := scanImport(p.db.QueryRowContext(ctx, query, importId), &imp); err != nil {
+		return types.Import{}, p.importFailed("GetImportByID", "", importId, "unable to get import", err)
+	}
+	return imp, nil
+}
+
+// SetImportTotal records how many items the file of an import holds.
+func (p *Postgres) SetImportTotal(ctx context.Context, importId string, total int) error {
+	_, err := p.db.ExecContext(ctx, `UPDATE note_imports SET total = $2 WHERE id = $1`, importId, total)
+	if err != nil {
+		return p.importFailed("SetImportTotal", "", importId, "unable to record import total", err)
+	}
+	return nil
+}
+
+// ImportNote creates a note read from an import and counts it as imported. A note whose title is already used in the
+// personal notes of the user, or in the workspace imported into, is skipped instead.
+func (p *Postgres) ImportNote(ctx context.Context, imp types.Import, name string, note types.ImportedNote) error {
+	skip := func(outcome, reason string) error {
+		return p.SkipImportItem(ctx, imp.ID, types.ImportItem{Name: name, Title: note.Title, Outcome: outcome, Reason: reason})
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM notes
+            WHERE LOWER(title) = LOWER($1)
+                AND (($3::int IS NULL AND user_id = $2 AND workspace_id IS NULL) OR workspace_id = $3::int))`
+
+	if err := tx.QueryRowContext(ctx, query, note.Title, imp.UserId, imp.WorkspaceId).Scan(&exists); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to check title", err)
+	}
+	if exists {
+		tx.Rollback()
+		return skip(types.ImportItemSkipped, "a note with this title already exists")
+	}
+
+	insert := `
+        INSERT INTO notes (user_id, title, content, archived, pinned, color, kind, format, workspace_id, created_at, updated_at)
+        SELECT $1, $2, $3, $4::boolean, $5::boolean, $6, $7, $8, $9::int,
+            COALESCE($10::timestamp, NOW()), COALESCE($11::timestamp, $10::timestamp, NOW())
+        WHERE $9::int IS NULL OR EXISTS (
+            SELECT 1 FROM workspace_members wm
+            WHERE wm.workspace_id = $9::int AND wm.user_id = $1 AND wm.role IN ('owner', 'editor'))
+        RETURNING id`
+
+	created := types.Note{Title: note.Title, Content: note.Content}
+	err = tx.QueryRowContext(ctx, insert, imp.UserId, note.Title, note.Content, note.Archived, note.Pinned, note.Color, note.Kind,
+		note.Format, imp.WorkspaceId, utcPtr(note.CreatedAt), utcPtr(note.UpdatedAt)).Scan(&created.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		tx.Rollback()
+		return skip(types.ImportItemFailed, "you may no longer create notes in this workspace")
+	case isDuplicateTitle(err):
+		tx.Rollback()
+		return skip(types.ImportItemSkipped, "a note with this title already exists")
+	case err != nil:
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to create note", err)
+	}
+
+	for position, item := range note.Items {
+		_, err := tx.ExecContext(ctx, `INSERT INTO checklist_items (note_id, text, checked, position) VALUES ($1, $2, $3, $4)`,
+			created.ID, item.Text, item.Checked, position)
+		if err != nil {
+			return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to add checklist item", err)
+		}
+	}
+
+	if _, err := syncNoteReferences(ctx, tx, created, "", true); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to link note", err)
+	}
+
+	if err := scanNote(tx.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE notes.id = $1`, created.ID), &created); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to read note", err)
+	}
+	if err := queueNoteEvent(ctx, tx, types.EventNoteCreated, created); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to queue note event", err)
+	}
+
+	progress := `UPDATE note_imports SET processed = processed + 1, imported = imported + 1 WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, progress, imp.ID); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to record import progress", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return p.importFailed("ImportNote", imp.UserId, imp.ID, "unable to import note", err)
+	}
+	p.noteChanged(ctx, created.ID)
+	return nil
+}
+
+// SkipImportItem counts an item of an import as skipped or failed and adds it to the report.
+func (p *Postgres) SkipImportItem(ctx context.Context, importId string, item types.ImportItem) error {
+	entry, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("unable to encode import item: %w", err)
+	}
+
+	query := `
+        UPDATE note_imports SET
+            processed = processed + 1,
+            skipped = skipped + CASE WHEN $2 = 'skipped' THEN 1 ELSE 0 END,
+            failed = failed + CASE WHEN $2 = 'failed' THEN 1 ELSE 0 END,
+            report = CASE WHEN jsonb_array_length(report) < $4 THEN report || jsonb_build_array($3::jsonb) ELSE report END
+        WHERE id = $1`
+
+	if _, err := p.db.ExecContext(ctx, query, importId, item.Outcome, string(entry), maxImportReport); err != nil {
+		return p.importFailed("SkipImportItem", "", importId, "unable to record import item", err)
+	}
+	return nil
+}
+
+func utcPtr(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
@@ -0,0 +1,268 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrJobNotFound = errors.New("could not find job")
+var ErrJobFinished = errors.New("job has already finished")
+var _ services.JobStore = &Postgres{}
+
+// defaultJobAttempts is how often a job is started before it is given up on, unless it was queued with its own limit.
+const defaultJobAttempts = 5
+
+const jobColumns = `jobs.id, jobs.kind, jobs.user_id, jobs.payload, jobs.status, jobs.progress_done, jobs.progress_total,
+	jobs.attempts, jobs.max_attempts, jobs.run_after, jobs.cancel_requested, COALESCE(jobs.last_error, ''), jobs.created_at,
+	jobs.started_at, jobs.finished_at`
+
+func scanJob(row rowScanner, job *types.Job) error {
+	var userId sql.NullString
+	var done, total sql.NullInt32
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Kind, &userId, &job.Payload, &job.Status, &done, &total, &job.Attempts, &job.MaxAttempts,
+		&job.RunAfter, &job.CancelRequested, &job.Error, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return err
+	}
+
+	job.UserId = stringPtr(userId)
+	if done.Valid && total.Valid {
+		job.Progress = &types.JobProgress{Done: int(done.Int32), Total: int(total.Int32)}
+	}
+	job.StartedAt = timePtr(startedAt)
+	job.FinishedAt = timePtr(finishedAt)
+	return nil
+}
+
+func (p *Postgres) jobFailed(operation, jobId, msg string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", msg, ErrJobNotFound)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("jobId", jobId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx, so that jobs can be queued along with other changes.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func enqueueJob(ctx context.Context, q rowQuerier, job types.JobDto) (types.Job, error) {
+	payload, err := json.Marshal(job.Payload)
+	if err != nil {
+		return types.Job{}, fmt.Errorf("unable to encode job payload: %w", err)
+	}
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultJobAttempts
+	}
+
+	query := `
+        INSERT INTO jobs (kind, user_id, payload, max_attempts)
+        VALUES ($1, NULLIF($2, ''), $3, $4)
+        RETURNING ` + jobColumns
+
+	var created types.Job
+	if err := scanJob(q.QueryRowContext(ctx, query, job.Kind, job.UserId, string(payload), maxAttempts), &created); err != nil {
+		return types.Job{}, err
+	}
+	return created, nil
+}
+
+// EnqueueJob queues a job to run as soon as a worker is free.
+func (p *Postgres) EnqueueJob(ctx context.Context, job types.JobDto) (types.Job, error) {
+	created, err := enqueueJob(ctx, p.db, job)
+	if err != nil {
+		return types.Job{}, p.jobFailed("EnqueueJob", "", "unable to queue job", err)
+	}
+	return created, nil
+}
+
+// GetJob returns a job the user started.
+func (p *Postgres) GetJob(ctx context.Context, userId, jobId string) (types.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE jobs.id = $1 AND jobs.user_id = $2`
+
+	var job types.Job
+	if err := scanJob(p.db.QueryRowContext(ctx, query, jobId, userId), &job); err != nil {
+		return types.Job{}, p.jobFailed("GetJob", jobId, "unable to get job", err)
+	}
+	return job, nil
+}
+
+// CancelJob cancels a job the user started. A queued job is cancelled straight away, whereas a running job is asked to
+// stop and is cancelled once it has.
+func (p *Postgres) CancelJob(ctx context.Context, userId, jobId string) (types.Job, error) {
+	query := `
+        UPDATE jobs SET
+            status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+            finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+            cancel_requested = true
+        WHERE jobs.id = $1 AND jobs.user_id = $2 AND status IN ('queued', 'running')
+        RETURNING ` + jobColumns
+
+	var job types.Job
+	err := scanJob(p.db.QueryRowContext(ctx, query, jobId, userId), &job)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := p.GetJob(ctx, userId, jobId); err != nil {
+			return types.Job{}, err
+		}
+		return types.Job{}, fmt.Errorf("unable to cancel job: %w", ErrJobFinished)
+	}
+	if err != nil {
+		return types.Job{}, p.jobFailed("CancelJob", jobId, "unable to cancel job", err)
+	}
+
+	p.logger.Info("job cancelled", zap.String("userId", userId), zap.String("jobId", jobId), zap.String("status", job.Status))
+	return job, nil
+}
+
+// ClaimJobs marks up to limit due jobs of the given kinds as running for the length of lease and returns them, oldest
+// first. Running jobs whose lease has run out are claimed again. Several replicas can claim at once, as each gets
+// different jobs.
+func (p *Postgres) ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]types.Job, error) {
+	query := `
+        WITH due AS (
+            SELECT id FROM jobs
+            WHERE kind = ANY($1)
+                AND ((status = 'queued' AND run_after <= NOW()) OR (status = 'running' AND locked_until < NOW()))
+            ORDER BY run_after, id
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED)
+        UPDATE jobs SET
+            status = 'running',
+            attempts = attempts + 1,
+            locked_until = NOW() + make_interval(secs => $3),
+            started_at = COALESCE(started_at, NOW())
+        FROM due
+        WHERE jobs.id = due.id
+        RETURNING ` + jobColumns
+
+	rows, err := p.db.QueryContext(ctx, query, pq.StringArray(kinds), limit, lease.Seconds())
+	if err != nil {
+		return nil, p.jobFailed("ClaimJobs", "", "unable to claim jobs", err)
+	}
+	defer rows.Close()
+
+	var jobs []types.Job
+	for rows.Next() {
+		var job types.Job
+		if err := scanJob(rows, &job); err != nil {
+			return nil, p.jobFailed("ClaimJobs", "", "unable to scan row", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, p.jobFailed("ClaimJobs", "", "row iteration error", err)
+	}
+	return jobs, nil
+}
+
+// HeartbeatJob extends the lease of a running job and records its progress, if given. It reports whether the job has
+// been asked to stop. ErrJobNotFound means the job is no longer held by this attempt.
+func (p *Postgres) HeartbeatJob(ctx context.Context, job types.Job, lease time.Duration, progress *types.JobProgress) (bool, error) {
+	var done, total *int
+	if progress != nil {
+		done, total = &progress.Done, &progress.Total
+	}
+
+	query := `
+        UPDATE jobs SET
+            locked_until = NOW() + make_interval(secs => $3),
+            progress_done = COALESCE($4, progress_done),
+            progress_total = COALESCE($5, progress_total)
+        WHERE id = $1 AND attempts = $2 AND status = 'running'
+        RETURNING cancel_requested`
+
+	var cancelRequested bool
+	if err := p.db.QueryRowContext(ctx, query, job.ID, job.Attempts, lease.Seconds(), done, total).Scan(&cancelRequested); err != nil {
+		return false, p.jobFailed("HeartbeatJob", job.ID, "unable to extend job lease", err)
+	}
+	return cancelRequested, nil
+}
+
+// finishJob applies update to the attempt of job, if it still holds the job.
+func (p *Postgres) finishJob(ctx context.Context, operation string, job types.Job, update string, args ...interface{}) error {
+	query := update + ` WHERE id = $1 AND attempts = $2 AND status = 'running'`
+	res, err := p.db.ExecContext(ctx, query, append([]interface{}{job.ID, job.Attempts}, args...)...)
+	if err != nil {
+		return p.jobFailed(operation, job.ID, "unable to record job outcome", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		p.logger.Warn("job no longer held by this attempt", zap.String("operation_name", operation), zap.String("jobId", job.ID))
+	}
+	return nil
+}
+
+// CompleteJob records that a job succeeded.
+func (p *Postgres) CompleteJob(ctx context.Context, job types.Job) error {
+	return p.finishJob(ctx, "CompleteJob", job,
+		`UPDATE jobs SET status = 'succeeded', locked_until = NULL, last_error = NULL, finished_at = NOW()`)
+}
+
+// RetryJob puts a failed job back in the queue until runAfter.
+func (p *Postgres) RetryJob(ctx context.Context, job types.Job, cause string, runAfter time.Time) error {
+	return p.finishJob(ctx, "RetryJob", job,
+		`UPDATE jobs SET status = 'queued', locked_until = NULL, last_error = $3, run_after = $4`, cause, runAfter)
+}
+
+// FailJob records that a job stopped for good, either failed or cancelled.
+func (p *Postgres) FailJob(ctx context.Context, job types.Job, status, cause string) error {
+	return p.finishJob(ctx, "FailJob", job,
+		`UPDATE jobs SET status = $3, locked_until = NULL, last_error = NULLIF($4, ''), finished_at = NOW()`, status, cause)
+}
+
+// CountJobs counts the queued and running jobs of each kind.
+func (p *Postgres) CountJobs(ctx context.Context) ([]types.JobCount, error) {
+	query := `
+        SELECT kind, status, COUNT(*) FROM jobs
+        WHERE status IN ('queued', 'running')
+        GROUP BY kind, status`
+
+	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, p.jobFailed("CountJobs", "", "unable to count jobs", err)
+	}
+	defer rows.Close()
+
+	var counts []types.JobCount
+	for rows.Next() {
+		var count types.JobCount
+		if err := rows.Scan(&count.Kind, &count.Status, &count.Count); err != nil {
+			return nil, p.jobFailed("CountJobs", "", "unable to scan row", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, p.jobFailed("CountJobs", "", "row iteration error", err)
+	}
+	return counts, nil
+}
+
+// PruneJobs deletes the jobs that finished before finishedBefore. The jobs of imports are kept, as the imports get
+// their status from them.
+func (p *Postgres) PruneJobs(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	query := `
+        DELETE FROM jobs
+        WHERE status IN ('succeeded', 'failed', 'cancelled') AND finished_at < $1
+            AND NOT EXISTS (SELECT 1 FROM note_imports ni WHERE ni.job_id = jobs.id)`
+
+	res, err := p.db.ExecContext(ctx, query, finishedBefore)
+	if err != nil {
+		return 0, p.jobFailed("PruneJobs", "", "unable to prune jobs", err)
+	}
+	return res.RowsAffected()
+}
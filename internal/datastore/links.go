@@ -0,0 +1,198 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var ErrLinkNotFound = errors.New("could not find share link")
+var ErrLinkExpired = errors.New("share link has expired")
+var _ services.LinkStore = &Postgres{}
+
+const linkColumns = `id, note_id, user_id, COALESCE(password_hash, ''), expires_at, max_views, view_count, last_viewed_at, created_at`
+
+func scanLink(row rowScanner, link *types.ShareLink) error {
+	var expiresAt, lastViewedAt sql.NullTime
+	var maxViews sql.NullInt64
+	err := row.Scan(&link.ID, &link.NoteId, &link.UserId, &link.PasswordHash, &expiresAt, &maxViews, &link.ViewCount, &lastViewedAt, &link.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	link.HasPassword = link.PasswordHash != ""
+	link.ExpiresAt = timePtr(expiresAt)
+	link.LastViewedAt = timePtr(lastViewedAt)
+	if maxViews.Valid {
+		views := int(maxViews.Int64)
+		link.MaxViews = &views
+	}
+	return nil
+}
+
+// CreateShareLink creates a public link to a note managed by ownerId. The link records ownerId as its creator.
+func (p *Postgres) CreateShareLink(ctx context.Context, ownerId, noteId, tokenHash string, link types.ShareLink) (types.ShareLink, error) {
+	if ownerId == "" || noteId == "" || tokenHash == "" {
+		p.logger.Error("ownerId, noteId and tokenHash must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", ownerId),
+			zap.String("noteId", noteId))
+
+		return types.ShareLink{}, fmt.Errorf("ownerId, noteId and tokenHash must be provided: %w", ErrParameterNotProvided)
+	}
+
+	query := `
+        INSERT INTO note_links (note_id, user_id, token_hash, password_hash, expires_at, max_views)
+        SELECT notes.id, $2, $3, NULLIF($4, ''), $5::timestamptz, $6::int FROM notes WHERE notes.id = $1 AND ` + canManage("notes", "$2") + `
+        RETURNING ` + linkColumns
+
+	var created types.ShareLink
+	err := scanLink(p.db.QueryRowContext(ctx, query, noteId, ownerId, tokenHash, link.PasswordHash, link.ExpiresAt, link.MaxViews), &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.ShareLink{}, fmt.Errorf("unable to create share link: %w", ErrNoteNoteFound)
+		}
+		p.logger.Error("failed to create share link",
+			zap.String("operation_name", "CreateShareLink"),
+			zap.Error(err),
+			zap.String("userId", ownerId),
+			zap.String("noteId", noteId),
+		)
+		return types.ShareLink{}, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	p.logger.Info("share link created",
+		zap.String("userId", ownerId),
+		zap.String("noteId", noteId),
+		zap.String("linkId", created.ID))
+
+	return created, nil
+}
+
+// ListShareLinks returns the public links to a note managed by ownerId, newest first.
+func (p *Postgres) ListShareLinks(ctx context.Context, ownerId, noteId string) ([]types.ShareLink, error) {
+	query := `
+        SELECT ` + linkColumns + `
+        FROM note_links
+        WHERE note_id = $1 AND EXISTS (SELECT 1 FROM notes WHERE notes.id = note_links.note_id AND ` + canManage("notes", "$2") + `)
+        ORDER BY created_at DESC, id DESC`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, ownerId)
+	if err != nil {
+		p.logger.Error("unable to query share links", zap.String("noteId", noteId), zap.Error(err))
+		return nil, fmt.Errorf("unable to query share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []types.ShareLink{}
+	for rows.Next() {
+		var link types.ShareLink
+		if err := scanLink(rows, &link); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "ListShareLinks"), zap.Error(err))
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.Error(err))
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return links, nil
+}
+
+// RevokeShareLink deletes a public link, after which its token no longer resolves.
+func (p *Postgres) RevokeShareLink(ctx context.Context, ownerId, noteId, linkId string) error {
+	query := `
+        DELETE FROM note_links
+        WHERE id = $1 AND note_id = $2
+            AND EXISTS (SELECT 1 FROM notes WHERE notes.id = note_links.note_id AND ` + canManage("notes", "$3") + `)`
+
+	res, err := p.db.ExecContext(ctx, query, linkId, noteId, ownerId)
+	if err != nil {
+		p.logger.Error("failed to revoke share link",
+			zap.String("operation_name", "RevokeShareLink"),
+			zap.Error(err),
+			zap.String("userId", ownerId),
+			zap.String("noteId", noteId),
+		)
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected after revoking share link: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unable to revoke share link: %w", ErrLinkNotFound)
+	}
+
+	p.logger.Info("share link revoked",
+		zap.String("userId", ownerId),
+		zap.String("noteId", noteId),
+		zap.String("linkId", linkId))
+
+	return nil
+}
+
+// linkCreatorManages holds when the user who created a link in note_links can still manage its note. A link stops
+// working, without being deleted, once its creator has left the workspace of the note or lost their role in it.
+var linkCreatorManages = `EXISTS (SELECT 1 FROM notes WHERE notes.id = note_links.note_id AND ` + canManage("notes", "note_links.user_id") + `)`
+
+// GetShareLink looks a link up by the hash of its token, whether or not it can still be viewed. A link whose creator
+// can no longer manage the note is not found.
+func (p *Postgres) GetShareLink(ctx context.Context, tokenHash string) (types.ShareLink, error) {
+	query := `SELECT ` + linkColumns + ` FROM note_links WHERE token_hash = $1 AND ` + linkCreatorManages
+
+	var link types.ShareLink
+	err := scanLink(p.db.QueryRowContext(ctx, query, tokenHash), &link)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.ShareLink{}, fmt.Errorf("unable to get share link: %w", ErrLinkNotFound)
+		}
+		p.logger.Error("failed to get share link", zap.String("operation_name", "GetShareLink"), zap.Error(err))
+		return types.ShareLink{}, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	return link, nil
+}
+
+// ViewShareLink counts a view of a link and returns the note it points to. Counting and checking the expiry, the view
+// limit and that the creator of the link can still manage the note happen in the same statement, so concurrent views
+// can never go over the limit, nor get through after the creator lost access.
+func (p *Postgres) ViewShareLink(ctx context.Context, linkId string, now time.Time) (types.Note, error) {
+	query := `
+        WITH viewed AS (
+            UPDATE note_links
+            SET view_count = view_count + 1, last_viewed_at = $2
+            WHERE id = $1
+                AND (expires_at IS NULL OR expires_at > $2)
+                AND (max_views IS NULL OR view_count < max_views)
+                AND ` + linkCreatorManages + `
+            RETURNING note_id
+        )
+        SELECT ` + noteColumns + `
+        FROM notes
+        JOIN viewed ON viewed.note_id = notes.id`
+
+	var note types.Note
+	if err := scanNote(p.db.QueryRowContext(ctx, query, linkId, now), &note); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Note{}, fmt.Errorf("unable to view share link: %w", ErrLinkExpired)
+		}
+		p.logger.Error("failed to view share link",
+			zap.String("operation_name", "ViewShareLink"),
+			zap.Error(err),
+			zap.String("linkId", linkId),
+		)
+		return types.Note{}, fmt.Errorf("failed to view share link: %w", err)
+	}
+
+	return note, nil
+}
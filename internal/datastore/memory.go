@@ -0,0 +1,296 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+var _ services.DBClient = &Memory{}
+
+// Memory is a DBClient that keeps notes in memory, for tests and local development. It behaves like Postgres for the
+// personal notes of each user, title policy included, and returns the same errors. There are no shares or workspaces:
+// only its owner can read a note, and workspaces are empty and cannot be written to.
+type Memory struct {
+	cfg config.Config
+
+	mu     sync.RWMutex
+	lastId int
+	notes  map[string]*memoryNote
+}
+
+type memoryNote struct {
+	id     int
+	userId string
+	note   types.Note
+}
+
+func NewMemory(cfg config.Config) *Memory {
+	return &Memory{
+		cfg:   cfg,
+		notes: make(map[string]*memoryNote),
+	}
+}
+
+func (m *Memory) GetSingleNote(_ context.Context, userId string, noteId string) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored, ok := m.notes[noteId]
+	if !ok || stored.userId != userId {
+		return types.Note{}, fmt.Errorf("note not found: %w", ErrNoteNoteFound)
+	}
+	return stored.read(), nil
+}
+
+func (m *Memory) GetNotes(_ context.Context, userId string, filter types.NoteFilter, limit, offset int) ([]types.Note, int, error) {
+	if userId == "" {
+		return nil, 0, fmt.Errorf("userId must be provided: %w", ErrParameterNotProvided)
+	}
+	// The user is not a member of any workspace, so there is nothing to list.
+	if filter.WorkspaceId != "" {
+		return nil, 0, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matched []*memoryNote
+	for _, stored := range m.notes {
+		if stored.userId != userId {
+			continue
+		}
+		if filter.Archived != nil && stored.note.Archived != *filter.Archived {
+			continue
+		}
+		if filter.Pinned != nil && stored.note.Pinned != *filter.Pinned {
+			continue
+		}
+		matched = append(matched, stored)
+	}
+
+	slices.SortFunc(matched, func(a, b *memoryNote) int {
+		if filter.PinnedFirst && a.note.Pinned != b.note.Pinned {
+			if a.note.Pinned {
+				return -1
+			}
+			return 1
+		}
+		return a.id - b.id
+	})
+
+	var notes []types.Note
+	for i := offset; i < len(matched) && i < offset+limit; i++ {
+		notes = append(notes, matched[i].read())
+	}
+	return notes, len(matched), nil
+}
+
+func (m *Memory) CreateNote(_ context.Context, userId string, note *types.NoteDto) (types.Note, error) {
+	if note == nil {
+		return types.Note{}, fmt.Errorf("note must not be nil: %w", ErrNilNote)
+	}
+	if userId == "" || note.Title == nil || *note.Title == "" {
+		return types.Note{}, fmt.Errorf("userId and title must be provided: %w", ErrParameterNotProvided)
+	}
+	if note.WorkspaceId != nil {
+		return types.Note{}, fmt.Errorf("failed to create note: %w", ErrPermissionDenied)
+	}
+
+	newNote := types.Note{
+		Title:   *note.Title,
+		Color:   types.DefaultNoteColor,
+		Kind:    types.NoteKindText,
+		Format:  types.NoteFormatPlain,
+		Version: 1,
+	}
+	if note.Content != nil {
+		newNote.Content = *note.Content
+	}
+	if note.Archived != nil {
+		newNote.Archived = *note.Archived
+	}
+	if note.Pinned != nil {
+		newNote.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		newNote.Color = *note.Color
+	}
+	if note.Kind != nil {
+		newNote.Kind = *note.Kind
+	}
+	if note.Format != nil {
+		newNote.Format = *note.Format
+	}
+	newNote.RemindAt = cloneTime(note.RemindAt.Value)
+	newNote.DueAt = cloneTime(note.DueAt.Value)
+	if note.Recurrence.Value != nil {
+		newNote.Recurrence = *note.Recurrence.Value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.titleTaken(userId, "", newNote) {
+		return types.Note{}, fmt.Errorf("failed to create note: %w", ErrDuplicateTitle)
+	}
+
+	m.lastId++
+	newNote.ID = strconv.Itoa(m.lastId)
+	stored := &memoryNote{id: m.lastId, userId: userId, note: newNote}
+	m.notes[newNote.ID] = stored
+	return stored.read(), nil
+}
+
+func (m *Memory) UpdateNote(_ context.Context, userId, noteId string, note *types.NoteDto) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+	if note == nil {
+		return types.Note{}, fmt.Errorf("note must not be nil: %w", ErrNilNote)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.notes[noteId]
+	if !ok || stored.userId != userId {
+		return types.Note{}, fmt.Errorf("unable to update note: note not found: %w", ErrNoteNoteFound)
+	}
+	if note.Version != nil && *note.Version != stored.note.Version {
+		return types.Note{}, fmt.Errorf("unable to update note: %w", ErrVersionConflict)
+	}
+
+	updated := stored.note
+	if note.Title != nil {
+		updated.Title = *note.Title
+	}
+	if note.Content != nil {
+		updated.Content = *note.Content
+	}
+	if note.Archived != nil {
+		updated.Archived = *note.Archived
+	}
+	if note.Pinned != nil {
+		updated.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		updated.Color = *note.Color
+	}
+	if note.Format != nil {
+		updated.Format = *note.Format
+	}
+	if note.DueAt.Set {
+		updated.DueAt = cloneTime(note.DueAt.Value)
+	}
+	if note.Recurrence.Set {
+		updated.Recurrence = ""
+		if note.Recurrence.Value != nil {
+			updated.Recurrence = *note.Recurrence.Value
+		}
+	}
+	// A new reminder time starts the reminder afresh, dropping any snooze.
+	if note.RemindAt.Set {
+		updated.RemindAt = cloneTime(note.RemindAt.Value)
+		updated.SnoozedUntil = nil
+	}
+
+	if m.titleTaken(userId, noteId, updated) {
+		return types.Note{}, fmt.Errorf("failed to update note: %w", ErrDuplicateTitle)
+	}
+
+	// Like the trigger in Postgres, the version only goes up when something changed.
+	if !sameNote(stored.note, updated) {
+		updated.Version++
+	}
+	stored.note = updated
+	return stored.read(), nil
+}
+
+// DeleteNote deletes a note of the user. A note that is missing or belongs to someone else is left alone without an
+// error.
+func (m *Memory) DeleteNote(_ context.Context, userId, noteId string) error {
+	if userId == "" || noteId == "" {
+		return fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.notes[noteId]; ok && stored.userId == userId {
+		delete(m.notes, noteId)
+	}
+	return nil
+}
+
+// titleTaken reports whether another note of the user has the title of note under the configured title policy.
+func (m *Memory) titleTaken(userId, noteId string, note types.Note) bool {
+	same := func(a, b string) bool { return a == b }
+	switch m.cfg.TitleUniqueness {
+	case config.TitleUniquenessExact:
+	case config.TitleUniquenessCaseInsensitive:
+		same = func(a, b string) bool { return strings.ToLower(a) == strings.ToLower(b) }
+	default:
+		return false
+	}
+	if m.cfg.TitleUniqueActiveOnly && note.Archived {
+		return false
+	}
+
+	for id, other := range m.notes {
+		if id == noteId || other.userId != userId || (m.cfg.TitleUniqueActiveOnly && other.note.Archived) {
+			continue
+		}
+		if same(other.note.Title, note.Title) {
+			return true
+		}
+	}
+	return false
+}
+
+// read returns a copy of the note as its owner sees it.
+func (n *memoryNote) read() types.Note {
+	note := n.note
+	note.UserId = n.userId
+	note.Permission = types.PermissionOwner
+	note.RemindAt = cloneTime(note.RemindAt)
+	note.SnoozedUntil = cloneTime(note.SnoozedUntil)
+	note.DueAt = cloneTime(note.DueAt)
+	if note.Kind == types.NoteKindChecklist {
+		note.Checklist = &types.ChecklistSummary{}
+	}
+	return note
+}
+
+func sameNote(a, b types.Note) bool {
+	return a.Title == b.Title && a.Content == b.Content && a.Archived == b.Archived && a.Pinned == b.Pinned &&
+		a.Color == b.Color && a.Format == b.Format && a.Recurrence == b.Recurrence &&
+		sameTime(a.RemindAt, b.RemindAt) && sameTime(a.SnoozedUntil, b.SnoozedUntil) && sameTime(a.DueAt, b.DueAt)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
@@ -0,0 +1,22 @@
+package datastore_test
+
+import (
+	"testing"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore/conformance"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+)
+
+func TestMemory(t *testing.T) {
+	conformance.TestDBClient(t, func(t *testing.T) services.DBClient {
+		return datastore.NewMemory(config.Config{TitleUniqueness: config.TitleUniquenessExact})
+	})
+}
+
+func TestMemoryUserStore(t *testing.T) {
+	conformance.TestUserStore(t, func(t *testing.T) services.UserStore {
+		return services.NewMemoryUserStore()
+	})
+}
@@ -0,0 +1,72 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// invalidateTimeout bounds the cache calls made after a change, which still have to be made when the caller that
+// made the change has given up.
+const invalidateTimeout = 5 * time.Second
+
+// SetNoteInvalidator has every change to what notes read as, wherever it is made from, drop what notes cached about
+// it once the change is committed. Requests, background workers and the reminder scheduler all go through here.
+func (p *Postgres) SetNoteInvalidator(notes services.NoteInvalidator) {
+	p.notes = notes
+}
+
+// noteReaders returns everyone who can read a note and the workspace it belongs to, if any. A note that cannot be
+// found has no readers.
+func (p *Postgres) noteReaders(ctx context.Context, q rowQuerier, noteId string) ([]string, string) {
+	if p.notes == nil {
+		return nil, ""
+	}
+
+	query := `
+        SELECT COALESCE(notes.workspace_id::text, ''), ARRAY(
+            SELECT notes.user_id::text
+            UNION
+            SELECT user_id FROM note_shares WHERE note_id = notes.id
+            UNION
+            SELECT user_id FROM workspace_members WHERE workspace_id = notes.workspace_id)
+        FROM notes
+        WHERE notes.id = $1`
+
+	var userIds []string
+	var workspaceId string
+	err := q.QueryRowContext(ctx, query, noteId).Scan(&workspaceId, pq.Array(&userIds))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		p.logger.Error("unable to find readers of note", zap.String("operation_name", "noteReaders"), zap.String("noteId", noteId), zap.Error(err))
+	}
+	return userIds, workspaceId
+}
+
+// noteChanged drops what is cached about a note for everyone who can read it, and for the users in also, who could
+// until the change.
+func (p *Postgres) noteChanged(ctx context.Context, noteId string, also ...string) {
+	if p.notes == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), invalidateTimeout)
+	defer cancel()
+
+	userIds, workspaceId := p.noteReaders(ctx, p.db, noteId)
+	p.notes.InvalidateNotes(ctx, append(userIds, also...), noteId, workspaceId)
+}
+
+// notesChanged drops what is cached for users, and about a note and a workspace when their IDs are set.
+func (p *Postgres) notesChanged(ctx context.Context, userIds []string, noteId, workspaceId string) {
+	if p.notes == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), invalidateTimeout)
+	defer cancel()
+
+	p.notes.InvalidateNotes(ctx, userIds, noteId, workspaceId)
+}
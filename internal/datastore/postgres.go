@@ -12,6 +12,7 @@ import (
 	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
 	"github.com/RogueAlmond70/code-review-challenge/services"
 	"github.com/RogueAlmond70/code-review-challenge/types"
+	_ "github.com/lib/pq"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
@@ -19,12 +20,77 @@ import (
 var ErrParameterNotProvided = errors.New("required parameters missing")
 var ErrNilNote = errors.New("note is nil")
 var ErrNoteNoteFound = errors.New("could not find note")
+var ErrVersionConflict = errors.New("note has changed since the given version")
 var _ services.DBClient = &Postgres{}
 
+// noteColumns is the column list scanned by scanNote, shared by every query returning whole notes. It includes the
+// checklist completion counts and the number of comments so that list responses can summarise them.
+const noteColumns = `notes.id, notes.title, notes.content, notes.archived, notes.pinned, notes.color, notes.kind,
+	notes.format, notes.remind_at, notes.snoozed_until, notes.due_at, COALESCE(notes.recurrence, ''), notes.workspace_id,
+	notes.version,
+	(SELECT COUNT(*) FROM checklist_items ci WHERE ci.note_id = notes.id),
+	(SELECT COUNT(*) FROM checklist_items ci WHERE ci.note_id = notes.id AND ci.checked),
+	(SELECT COUNT(*) FROM note_comments nc WHERE nc.note_id = notes.id)`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNote reads the noteColumns of a row into note, followed by any extra columns the query selected.
+func scanNote(row rowScanner, note *types.Note, extra ...any) error {
+	var summary types.ChecklistSummary
+	var remindAt, snoozedUntil, dueAt sql.NullTime
+	var workspaceId sql.NullString
+	dest := []any{
+		&note.ID,
+		&note.Title,
+		&note.Content,
+		&note.Archived,
+		&note.Pinned,
+		&note.Color,
+		&note.Kind,
+		&note.Format,
+		&remindAt,
+		&snoozedUntil,
+		&dueAt,
+		&note.Recurrence,
+		&workspaceId,
+		&note.Version,
+		&summary.Total,
+		&summary.Completed,
+		&note.CommentCount,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	note.RemindAt = timePtr(remindAt)
+	note.SnoozedUntil = timePtr(snoozedUntil)
+	note.DueAt = timePtr(dueAt)
+	if workspaceId.Valid {
+		note.WorkspaceId = &workspaceId.String
+	}
+
+	if note.Kind == types.NoteKindChecklist {
+		note.Checklist = &summary
+	}
+	return nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
 type Postgres struct {
 	logger *zap.Logger
 	db     *sql.DB
 	cfg    config.Config
+	// notes, when set, is told about every committed change to what notes read as.
+	notes services.NoteInvalidator
 }
 
 func NewPostgres(logger *zap.Logger, sqldb *sql.DB, cfg config.Config) *Postgres {
@@ -101,18 +167,14 @@ func (p *Postgres) GetSingleNote(ctx context.Context, userId string, noteId stri
 		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
 	}
 
+	// Notes can be read by their owner and by anyone they have been shared with.
 	query := `
-        SELECT id, title, content, archived
+        SELECT ` + noteColumns + `, ` + permissionColumn("notes", "$1") + `
         FROM notes
-        WHERE user_id = $1 AND id = $2`
+        WHERE notes.id = $2 AND ` + canRead("notes", "$1")
 
 	var note types.Note
-	err := p.db.QueryRowContext(ctx, query, userId, noteId).Scan(
-		&note.ID,
-		&note.Title,
-		&note.Content,
-		&note.Archived,
-	)
+	err := scanNote(p.db.QueryRowContext(ctx, query, userId, noteId), &note, &note.Permission)
 
 	if err != nil {
 		metrics.CountSingleNoteRequestErrorsTotal.WithLabelValues("single_note_request_errors_total").Inc()
@@ -135,7 +197,8 @@ func (p *Postgres) GetSingleNote(ctx context.Context, userId string, noteId stri
 	return note, nil
 }
 
-func (p *Postgres) GetNotes(ctx context.Context, userId string, archivedFilter *bool, limit, offset int) ([]types.Note, int, error) {
+func (p *Postgres) GetNotes(ctx context.Context, userId string, filter types.NoteFilter, limit, offset int) ([]types.Note, int, error) {
+	archivedFilter := filter.Archived
 	timer := timerMetricSelection(archivedFilter)
 	incrementTotalMetric(archivedFilter)
 
@@ -156,18 +219,8 @@ func (p *Postgres) GetNotes(ctx context.Context, userId string, archivedFilter *
 		return nil, 0, fmt.Errorf("userId must be provided: %w", ErrParameterNotProvided)
 	}
 
-	// Build dynamic WHERE clause
-	whereClauses := []string{"user_id = $1"}
-	args := []interface{}{userId}
-	argIndex := 2
-
-	if archivedFilter != nil {
-		whereClauses = append(whereClauses, fmt.Sprintf("archived = $%d", argIndex))
-		args = append(args, *archivedFilter)
-		argIndex++
-	}
-
-	where := strings.Join(whereClauses, " AND ")
+	where, args := noteFilterWhere(userId, filter)
+	argIndex := len(args) + 1
 
 	// ----- Total Count Query -----
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM notes WHERE %s", where)
@@ -178,14 +231,16 @@ func (p *Postgres) GetNotes(ctx context.Context, userId string, archivedFilter *
 		return nil, 0, fmt.Errorf("failed to get total count: %w", err)
 	}
 
+	orderBy := noteOrder(filter)
+
 	// ----- Main Query with Pagination -----
 	args = append(args, limit, offset)
 	baseQuery := fmt.Sprintf(`
-		SELECT id, title, content, archived
+		SELECT %s, %s
 		FROM notes
 		WHERE %s
-		ORDER BY id
-		LIMIT $%d OFFSET $%d`, where, argIndex, argIndex+1)
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, noteColumns, permissionColumn("notes", "$1"), where, orderBy, argIndex, argIndex+1)
 
 	rows, err := p.db.QueryContext(ctx, baseQuery, args...)
 	if err != nil {
@@ -198,7 +253,7 @@ func (p *Postgres) GetNotes(ctx context.Context, userId string, archivedFilter *
 	var notes []types.Note
 	for rows.Next() {
 		var note types.Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.Archived); err != nil {
+		if err := scanNote(rows, &note, &note.Permission); err != nil {
 			incrementErrorMetric(archivedFilter)
 			p.logger.Error("unable to scan row",
 				zap.String("operation_name", "GetNotes"),
@@ -218,7 +273,44 @@ func (p *Postgres) GetNotes(ctx context.Context, userId string, archivedFilter *
 	return notes, totalCount, nil
 }
 
-func (p *Postgres) CreateNote(ctx context.Context, userId, title, body string) (types.Note, error) {
+// noteFilterWhere builds the WHERE clause selecting the notes matched by filter, with the user bound to $1. Without a
+// workspace only the personal notes of the user are matched.
+func noteFilterWhere(userId string, filter types.NoteFilter) (string, []interface{}) {
+	whereClauses := []string{"notes.user_id = $1", "notes.workspace_id IS NULL"}
+	args := []interface{}{userId}
+	argIndex := 2
+
+	if filter.WorkspaceId != "" {
+		whereClauses = []string{
+			fmt.Sprintf("notes.workspace_id = $%d", argIndex),
+			fmt.Sprintf("EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = $%d AND wm.user_id = $1)", argIndex),
+		}
+		args = append(args, filter.WorkspaceId)
+		argIndex++
+	}
+
+	if filter.Archived != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("archived = $%d", argIndex))
+		args = append(args, *filter.Archived)
+		argIndex++
+	}
+
+	if filter.Pinned != nil {
+		whereClauses = append(whereClauses, fmt.Sprintf("pinned = $%d", argIndex))
+		args = append(args, *filter.Pinned)
+	}
+
+	return strings.Join(whereClauses, " AND "), args
+}
+
+func noteOrder(filter types.NoteFilter) string {
+	if filter.PinnedFirst {
+		return "pinned DESC, id"
+	}
+	return "id"
+}
+
+func (p *Postgres) CreateNote(ctx context.Context, userId string, note *types.NoteDto) (types.Note, error) {
 	timer := prometheus.NewTimer(metrics.CreateNoteRequestDurationSeconds)
 	metrics.CountCreateNoteRequestsTotal.WithLabelValues("count_create_note_requests_total").Inc()
 
@@ -233,32 +325,97 @@ func (p *Postgres) CreateNote(ctx context.Context, userId, title, body string) (
 		}
 	}()
 
+	if note == nil {
+		metrics.CountCreateNoteRequestErrorsTotal.WithLabelValues("create_note_request_errors_total").Inc()
+		p.logger.Error("note must not be nil", zap.Error(ErrNilNote))
+		return types.Note{}, fmt.Errorf("note must not be nil: %w", ErrNilNote)
+	}
+
 	// Input validation:
-	if userId == "" || title == "" || body == "" {
+	if userId == "" || note.Title == nil || *note.Title == "" {
 		metrics.CountCreateNoteRequestErrorsTotal.WithLabelValues("create_note_request_errors_total").Inc()
-		p.logger.Error("userId, title and body must be provided", zap.Error(ErrParameterNotProvided),
-			zap.String("userId", userId),
-			zap.String("title", title),
-			zap.String("body", body))
+		p.logger.Error("userId and title must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId))
+
+		return types.Note{}, fmt.Errorf("userId and title must be provided: %w", ErrParameterNotProvided)
+	}
 
-		return types.Note{}, fmt.Errorf("userId, title and body must be provided: %w", ErrParameterNotProvided)
+	newNote := types.Note{
+		Title:  *note.Title,
+		Color:  types.DefaultNoteColor,
+		Kind:   types.NoteKindText,
+		Format: types.NoteFormatPlain,
+	}
+	if note.Content != nil {
+		newNote.Content = *note.Content
+	}
+	if note.Archived != nil {
+		newNote.Archived = *note.Archived
+	}
+	if note.Pinned != nil {
+		newNote.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		newNote.Color = *note.Color
+	}
+	if note.Kind != nil {
+		newNote.Kind = *note.Kind
+	}
+	if note.Format != nil {
+		newNote.Format = *note.Format
+	}
+	newNote.RemindAt = note.RemindAt.Value
+	newNote.DueAt = note.DueAt.Value
+	if note.Recurrence.Value != nil {
+		newNote.Recurrence = *note.Recurrence.Value
 	}
 
+	// Notes can only be created in a workspace by its owners and editors.
 	query := `
-        INSERT INTO notes (user_id, title, content, archived)
-        VALUES ($1,$2,$3,$4) RETURNING id, title, content, archived`
+        INSERT INTO notes (user_id, title, content, archived, pinned, color, kind, remind_at, due_at, recurrence, workspace_id, format)
+        SELECT $1, $2, $3, $4::boolean, $5::boolean, $6, $7, $8::timestamptz, $9::timestamptz, NULLIF($10, ''), $11::int, $12
+        WHERE $11::int IS NULL OR EXISTS (
+            SELECT 1 FROM workspace_members wm
+            WHERE wm.workspace_id = $11::int AND wm.user_id = $1 AND wm.role IN ('owner', 'editor'))
+        RETURNING ` + noteColumns + `, ` + permissionColumn("notes", "$1")
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.CountCreateNoteRequestErrorsTotal.WithLabelValues("create_note_request_errors_total").Inc()
+		p.logger.Error("unable to start transaction", zap.Error(err), zap.String("userId", userId))
+		return types.Note{}, fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	var newNote types.Note
+	err = scanNote(tx.QueryRowContext(ctx, query, userId, newNote.Title, newNote.Content, newNote.Archived, newNote.Pinned, newNote.Color, newNote.Kind,
+		newNote.RemindAt, newNote.DueAt, newNote.Recurrence, note.WorkspaceId, newNote.Format), &newNote, &newNote.Permission)
 
-	err := p.db.QueryRowContext(ctx, query, userId, title, body, false).Scan(
-		&newNote.ID,
-		&newNote.Title,
-		&newNote.Content,
-		&newNote.Archived,
-	)
+	if err == nil {
+		_, err = syncNoteReferences(ctx, tx, newNote, "", true)
+	}
+	if err == nil {
+		err = queueNoteEvent(ctx, tx, types.EventNoteCreated, newNote)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
 	if err != nil {
 		metrics.CountCreateNoteRequestErrorsTotal.WithLabelValues("create_note_request_errors_total").Inc()
+		if errors.Is(err, sql.ErrNoRows) {
+			p.logger.Warn("user may not create notes in workspace",
+				zap.String("operation_name", "CreateNote"),
+				zap.String("userId", userId),
+			)
+			return types.Note{}, fmt.Errorf("failed to create note: %w", ErrPermissionDenied)
+		}
+		if isDuplicateTitle(err) {
+			p.logger.Info("note title already in use",
+				zap.String("operation_name", "CreateNote"),
+				zap.String("userId", userId),
+			)
+			return types.Note{}, fmt.Errorf("failed to create note: %w", ErrDuplicateTitle)
+		}
 		p.logger.Error("failed to create note",
 			zap.String("operation_name", "CreateNote"),
 			zap.Error(err),
@@ -267,6 +424,8 @@ func (p *Postgres) CreateNote(ctx context.Context, userId, title, body string) (
 		return types.Note{}, fmt.Errorf("failed to create note: %w", err)
 	}
 
+	p.noteChanged(ctx, newNote.ID)
+
 	p.logger.Info("note created",
 		zap.String("userId", userId),
 		zap.String("noteId", newNote.ID))
@@ -313,6 +472,25 @@ func (p *Postgres) UpdateNote(ctx context.Context, userId, noteId string, note *
 		return types.Note{}, fmt.Errorf("unable to update note: %w", err)
 	}
 
+	if !types.PermissionAllows(oldNote.Permission, types.PermissionEditor) {
+		metrics.CountUpdateNoteRequestErrorsTotal.WithLabelValues("update_note_request_errors_total").Inc()
+		p.logger.Warn("user may not edit note",
+			zap.String("userId", userId),
+			zap.String("noteId", noteId),
+			zap.String("permission", oldNote.Permission))
+		return types.Note{}, fmt.Errorf("unable to update note: %w", ErrPermissionDenied)
+	}
+
+	if note.Version != nil && *note.Version != oldNote.Version {
+		metrics.CountUpdateNoteRequestErrorsTotal.WithLabelValues("update_note_request_errors_total").Inc()
+		p.logger.Info("note has changed since the given version",
+			zap.String("userId", userId),
+			zap.String("noteId", noteId),
+			zap.Int("version", *note.Version))
+		return types.Note{}, fmt.Errorf("unable to update note: %w", ErrVersionConflict)
+	}
+
+	oldTitle, wasArchived := oldNote.Title, oldNote.Archived
 	if note.Title != nil {
 		oldNote.Title = *note.Title
 	}
@@ -322,23 +500,90 @@ func (p *Postgres) UpdateNote(ctx context.Context, userId, noteId string, note *
 	if note.Archived != nil {
 		oldNote.Archived = *note.Archived
 	}
+	if note.Pinned != nil {
+		oldNote.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		oldNote.Color = *note.Color
+	}
+	if note.Format != nil {
+		oldNote.Format = *note.Format
+	}
+	if note.DueAt.Set {
+		oldNote.DueAt = note.DueAt.Value
+	}
+	if note.Recurrence.Set {
+		oldNote.Recurrence = ""
+		if note.Recurrence.Value != nil {
+			oldNote.Recurrence = *note.Recurrence.Value
+		}
+	}
+	// A new reminder time starts the reminder afresh, dropping its snooze, failed deliveries and the record of it firing.
+	resetReminder := note.RemindAt.Set
+	if resetReminder {
+		oldNote.RemindAt = note.RemindAt.Value
+	}
 
 	query := `UPDATE notes
-		SET title = $1, content = $2, archived = $3
-		WHERE id = $4 AND user_id = $5
-		RETURNING id, title, content, archived`
+		SET title = $1, content = $2, archived = $3, pinned = $4, color = $5,
+			remind_at = $6, due_at = $7, recurrence = NULLIF($8, ''),
+			snoozed_until = CASE WHEN $9::boolean THEN NULL ELSE snoozed_until END,
+			reminder_fired_at = CASE WHEN $9::boolean THEN NULL ELSE reminder_fired_at END,
+			reminder_attempts = CASE WHEN $9::boolean THEN 0 ELSE reminder_attempts END,
+			reminder_retry_at = CASE WHEN $9::boolean THEN NULL ELSE reminder_retry_at END,
+			format = $12, updated_at = NOW()
+		WHERE notes.id = $10 AND ` + canEdit("notes", "$11") + ` AND ($13::int IS NULL OR notes.version = $13)
+		RETURNING ` + noteColumns
 
 	var newNote types.Note
+	var rewritten []string
 
-	err = p.db.QueryRowContext(ctx, query, oldNote.Title, oldNote.Content, oldNote.Archived, noteId, userId).Scan(
-		&newNote.ID,
-		&newNote.Title,
-		&newNote.Content,
-		&newNote.Archived,
-	)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.CountUpdateNoteRequestErrorsTotal.WithLabelValues("update_note_request_errors_total").Inc()
+		p.logger.Error("unable to start transaction", zap.Error(err), zap.String("userId", userId), zap.String("noteId", noteId))
+		return types.Note{}, fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = scanNote(tx.QueryRowContext(ctx, query, oldNote.Title, oldNote.Content, oldNote.Archived, oldNote.Pinned, oldNote.Color,
+		oldNote.RemindAt, oldNote.DueAt, oldNote.Recurrence, resetReminder, noteId, userId, oldNote.Format, note.Version), &newNote)
+
+	// Links in the content are only parsed again when it was written, and the notes linking to this one by title are
+	// pointed at its new title when it changed.
+	if err == nil {
+		rewritten, err = syncNoteReferences(ctx, tx, newNote, oldTitle, note.Content != nil)
+	}
+	if err == nil {
+		event := types.EventNoteUpdated
+		if newNote.Archived && !wasArchived {
+			event = types.EventNoteArchived
+		}
+		err = queueNoteEvent(ctx, tx, event, newNote)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
 	if err != nil {
 		metrics.CountUpdateNoteRequestErrorsTotal.WithLabelValues("update_note_request_errors_total").Inc()
+		if errors.Is(err, sql.ErrNoRows) && note.Version != nil {
+			// Someone else changed the note after it was read above.
+			p.logger.Info("note has changed since the given version",
+				zap.String("operation_name", "UpdateNote"),
+				zap.String("userId", userId),
+				zap.String("noteId", noteId),
+			)
+			return types.Note{}, fmt.Errorf("failed to update note: %w", ErrVersionConflict)
+		}
+		if isDuplicateTitle(err) {
+			p.logger.Info("note title already in use",
+				zap.String("operation_name", "UpdateNote"),
+				zap.String("userId", userId),
+				zap.String("noteId", noteId),
+			)
+			return types.Note{}, fmt.Errorf("failed to update note: %w", ErrDuplicateTitle)
+		}
 		p.logger.Error("failed to update note",
 			zap.String("operation_name", "UpdateNote"),
 			zap.Error(err),
@@ -346,6 +591,12 @@ func (p *Postgres) UpdateNote(ctx context.Context, userId, noteId string, note *
 		)
 		return types.Note{}, fmt.Errorf("failed to update note: %w", err)
 	}
+	newNote.Permission = oldNote.Permission
+
+	p.noteChanged(ctx, noteId)
+	for _, id := range rewritten {
+		p.noteChanged(ctx, id)
+	}
 
 	p.logger.Info("note update",
 		zap.String("userId", userId),
@@ -355,6 +606,13 @@ func (p *Postgres) UpdateNote(ctx context.Context, userId, noteId string, note *
 }
 
 func (p *Postgres) DeleteNote(ctx context.Context, userId, noteId string) error {
+	return p.deleteNote(ctx, userId, noteId, nil)
+}
+
+// deleteNote deletes a note managed by the user. Without a version, a note that is missing or that the user may not
+// delete is left alone without an error. With one, the note is only deleted at that version, and ErrNoteNoteFound or
+// ErrVersionConflict say why it was not.
+func (p *Postgres) deleteNote(ctx context.Context, userId, noteId string, version *int) error {
 	timer := prometheus.NewTimer(metrics.DeleteNoteRequestDurationSeconds)
 	metrics.CountDeleteNoteRequestsTotal.WithLabelValues("count_delete_note_requests_total").Inc()
 
@@ -379,11 +637,51 @@ func (p *Postgres) DeleteNote(ctx context.Context, userId, noteId string) error
 		return fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
 	}
 
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		metrics.CountDeleteNoteRequestErrorsTotal.WithLabelValues("count_delete_note_request_errors_total").Inc()
+		p.logger.Error("unable to start transaction", zap.Error(err), zap.String("userId", userId), zap.String("noteId", noteId))
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The note is read before it goes, so that webhooks are sent what was deleted.
 	query := `
-        DELETE FROM notes 
-        WHERE id = $1 AND user_id = $2`
+        SELECT ` + noteColumns + `
+        FROM notes
+        WHERE notes.id = $1 AND ` + canManage("notes", "$2") + `
+        FOR UPDATE`
 
-	res, err := p.db.ExecContext(ctx, query, noteId, userId)
+	var deleted types.Note
+	err = scanNote(tx.QueryRowContext(ctx, query, noteId, userId), &deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		p.logger.Info("no note deleted (not found or not owned by user)",
+			zap.String("userId", userId),
+			zap.String("noteId", noteId),
+		)
+		if version != nil {
+			return fmt.Errorf("failed to delete note: %w", ErrNoteNoteFound)
+		}
+		return nil
+	}
+	if err == nil && version != nil && *version != deleted.Version {
+		p.logger.Info("note has changed since the given version",
+			zap.String("operation_name", "DeleteNote"),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId),
+			zap.Int("version", *version))
+		return fmt.Errorf("failed to delete note: %w", ErrVersionConflict)
+	}
+	if err == nil {
+		err = queueNoteEvent(ctx, tx, types.EventNoteDeleted, deleted)
+	}
+	readers, workspaceId := p.noteReaders(ctx, tx, noteId)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM notes WHERE id = $1`, noteId)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 
 	if err != nil {
 		metrics.CountDeleteNoteRequestErrorsTotal.WithLabelValues("count_delete_note_request_errors_total").Inc()
@@ -394,19 +692,7 @@ func (p *Postgres) DeleteNote(ctx context.Context, userId, noteId string) error
 		)
 		return fmt.Errorf("failed to delete note: %w", err)
 	}
-
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		p.logger.Warn("could not check rows affected after delete", zap.Error(err))
-	}
-
-	if rowsAffected == 0 {
-		p.logger.Info("no note deleted (not found or not owned by user)",
-			zap.String("userId", userId),
-			zap.String("noteId", noteId),
-		)
-
-	}
+	p.notesChanged(ctx, readers, noteId, workspaceId)
 
 	p.logger.Info("note deleted",
 		zap.String("userId", userId),
@@ -417,10 +703,10 @@ func (p *Postgres) DeleteNote(ctx context.Context, userId, noteId string) error
 
 func timerMetricSelection(archivedFilter *bool) *prometheus.Timer {
 	var timer *prometheus.Timer
-	switch *archivedFilter {
-	case true:
+	switch {
+	case archivedFilter != nil && *archivedFilter:
 		timer = prometheus.NewTimer(metrics.CountArchivedNotesRequestDurationSeconds)
-	case false:
+	case archivedFilter != nil && !*archivedFilter:
 		timer = prometheus.NewTimer(metrics.UnarchivedNotesRequestDurationSeconds)
 	default:
 		timer = prometheus.NewTimer(metrics.AllNotesRequestDurationSeconds)
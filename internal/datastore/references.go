@@ -0,0 +1,290 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var _ services.ReferenceStore = &Postgres{}
+
+const (
+	// maxReferences bounds the links stored for a single note.
+	maxReferences = 100
+	maxTargetLen  = 255
+)
+
+// wikiLinkPattern matches [[Target]] and [[Target|label]], where the target is the title or the id of a note.
+var wikiLinkPattern = regexp.MustCompile(`\[\[([^\[\]|]+)(\|[^\[\]]*)?\]\]`)
+
+// parseWikiLinks returns the distinct targets linked to from content, in the order they first appear. Targets that
+// differ only in case are the same target, as titles are matched case-insensitively.
+func parseWikiLinks(content string) []string {
+	var targets []string
+	seen := map[string]bool{}
+	for _, match := range wikiLinkPattern.FindAllStringSubmatch(content, -1) {
+		target := strings.TrimSpace(match[1])
+		key := strings.ToLower(target)
+		if target == "" || len(target) > maxTargetLen || seen[key] {
+			continue
+		}
+		seen[key] = true
+		targets = append(targets, target)
+		if len(targets) == maxReferences {
+			break
+		}
+	}
+	return targets
+}
+
+// rewriteWikiLinks points the links to oldTitle in content at newTitle, keeping their labels. Links by id are left
+// alone. When newTitle cannot be written inside a link, noteId is linked to instead.
+func rewriteWikiLinks(content, oldTitle, newTitle, noteId string) string {
+	if strings.ContainsAny(newTitle, "[]|") {
+		newTitle = noteId
+	}
+	return wikiLinkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		match := wikiLinkPattern.FindStringSubmatch(link)
+		if !strings.EqualFold(strings.TrimSpace(match[1]), oldTitle) {
+			return link
+		}
+		return "[[" + newTitle + match[2] + "]]"
+	})
+}
+
+// sameScope holds when the notes aliased as target and source are in the same workspace, or are both personal notes
+// of the same user. Links never reach across scopes.
+func sameScope(target, source string) string {
+	return fmt.Sprintf(`(%[1]s.workspace_id = %[2]s.workspace_id
+		OR (%[1]s.workspace_id IS NULL AND %[2]s.workspace_id IS NULL AND %[1]s.user_id = %[2]s.user_id))`, target, source)
+}
+
+// syncReferences replaces the stored links of a note with the ones in its content. A link resolves to the note in the
+// same scope with that id or, failing that, with that title.
+func syncReferences(ctx context.Context, tx *sql.Tx, noteId, content string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM note_references WHERE source_id = $1`, noteId); err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO note_references (source_id, position, target_text, target_id)
+        SELECT s.id, $2::int, $3::text, (
+            SELECT t.id FROM notes t
+            WHERE (t.id::text = $3::text OR LOWER(t.title) = LOWER($3::text)) AND ` + sameScope("t", "s") + `
+            ORDER BY t.id::text = $3::text DESC, t.id
+            LIMIT 1)
+        FROM notes s WHERE s.id = $1`
+
+	for position, target := range parseWikiLinks(content) {
+		if _, err := tx.ExecContext(ctx, query, noteId, position, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveReferences points the broken links in the scope of a note at it, now that a note with their target exists.
+func resolveReferences(ctx context.Context, tx *sql.Tx, noteId string) error {
+	query := `
+        UPDATE note_references r SET target_id = t.id
+        FROM notes t, notes s
+        WHERE t.id = $1 AND s.id = r.source_id AND r.target_id IS NULL
+            AND (LOWER(r.target_text) = LOWER(t.title) OR r.target_text = t.id::text)
+            AND ` + sameScope("t", "s")
+
+	_, err := tx.ExecContext(ctx, query, noteId)
+	return err
+}
+
+// renameReferences rewrites the links to a note by its old title in the other notes linking to it, so that renaming a
+// note does not break links to it, and queues a note.updated event for each note it rewrote. A note that would grow past
+// the longest content allowed is linked to by id instead; when even that does not fit, its links are left as they were
+// and reported as broken. It returns the notes whose content it rewrote.
+func renameReferences(ctx context.Context, tx *sql.Tx, noteId, oldTitle, newTitle string) ([]string, error) {
+	query := `
+        SELECT s.id, s.content FROM notes s
+        WHERE s.id <> $1 AND s.id IN (SELECT r.source_id FROM note_references r WHERE r.target_id = $1)
+        ORDER BY s.id
+        FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]string{}
+	var ids []string
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+		sources[id] = content
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	update := `UPDATE notes SET content = $1, updated_at = NOW() WHERE notes.id = $2 RETURNING ` + noteColumns
+
+	var rewritten []string
+	for _, id := range ids {
+		content := rewriteWikiLinks(sources[id], oldTitle, newTitle, noteId)
+		if content == sources[id] {
+			continue
+		}
+		if len(content) > types.MaxNoteContentLen {
+			content = rewriteWikiLinks(sources[id], oldTitle, noteId, noteId)
+		}
+		if len(content) > types.MaxNoteContentLen {
+			if err := syncReferences(ctx, tx, id, sources[id]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		var source types.Note
+		if err := scanNote(tx.QueryRowContext(ctx, update, content, id), &source); err != nil {
+			return nil, err
+		}
+		if err := syncReferences(ctx, tx, id, content); err != nil {
+			return nil, err
+		}
+		if err := queueNoteEvent(ctx, tx, types.EventNoteUpdated, source); err != nil {
+			return nil, err
+		}
+		rewritten = append(rewritten, id)
+	}
+	return rewritten, nil
+}
+
+// referenceColumns selects a link from source s to target t. The target is left out when t is not joined, whereas
+// whether the link is broken comes from the stored link itself.
+const referenceColumns = `s.id, s.title, r.target_text, t.id, t.title, r.target_id IS NULL`
+
+func scanReference(row rowScanner, ref *types.NoteReference) error {
+	var targetId, targetTitle sql.NullString
+	if err := row.Scan(&ref.SourceId, &ref.SourceTitle, &ref.Target, &targetId, &targetTitle, &ref.Broken); err != nil {
+		return err
+	}
+	if targetId.Valid {
+		ref.TargetId = &targetId.String
+		ref.TargetTitle = &targetTitle.String
+	}
+	return nil
+}
+
+func (p *Postgres) referenceFailed(operation, userId, noteId, msg string, err error) error {
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func (p *Postgres) queryReferences(ctx context.Context, operation, userId, noteId, query string, args ...interface{}) ([]types.NoteReference, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, p.referenceFailed(operation, userId, noteId, "unable to query links", err)
+	}
+	defer rows.Close()
+
+	refs := []types.NoteReference{}
+	for rows.Next() {
+		var ref types.NoteReference
+		if err := scanReference(rows, &ref); err != nil {
+			return nil, p.referenceFailed(operation, userId, noteId, "unable to scan row", err)
+		}
+		refs = append(refs, ref)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.referenceFailed(operation, userId, noteId, "row iteration error", err)
+	}
+	return refs, nil
+}
+
+// GetBacklinks returns the links to a note from the notes the user can see.
+func (p *Postgres) GetBacklinks(ctx context.Context, userId, noteId string) ([]types.NoteReference, error) {
+	query := `
+        SELECT ` + referenceColumns + `
+        FROM note_references r
+        JOIN notes s ON s.id = r.source_id
+        JOIN notes t ON t.id = r.target_id
+        WHERE r.target_id = $1 AND ` + canRead("t", "$2") + ` AND ` + canRead("s", "$2") + `
+        ORDER BY LOWER(s.title), s.id`
+
+	return p.queryReferences(ctx, "GetBacklinks", userId, noteId, query, noteId, userId)
+}
+
+// GetOutlinks returns the links in a note, in the order they appear in it. Links to notes the user cannot see are
+// listed without their target, but are not reported as broken.
+func (p *Postgres) GetOutlinks(ctx context.Context, userId, noteId string) ([]types.NoteReference, error) {
+	query := `
+        SELECT ` + referenceColumns + `
+        FROM note_references r
+        JOIN notes s ON s.id = r.source_id
+        LEFT JOIN notes t ON t.id = r.target_id AND ` + canRead("t", "$2") + `
+        WHERE r.source_id = $1 AND ` + canRead("s", "$2") + `
+        ORDER BY r.position`
+
+	return p.queryReferences(ctx, "GetOutlinks", userId, noteId, query, noteId, userId)
+}
+
+// GetBrokenLinks returns the links that do not lead to any note, in the personal notes of the user or, when
+// workspaceId is set, in the notes of that workspace.
+func (p *Postgres) GetBrokenLinks(ctx context.Context, userId, workspaceId string) ([]types.NoteReference, error) {
+	scope := `s.user_id = $1 AND s.workspace_id IS NULL`
+	args := []interface{}{userId}
+	if workspaceId != "" {
+		scope = `s.workspace_id = $2 AND ` + canRead("s", "$1")
+		args = append(args, workspaceId)
+	}
+
+	query := `
+        SELECT ` + referenceColumns + `
+        FROM note_references r
+        JOIN notes s ON s.id = r.source_id
+        LEFT JOIN notes t ON t.id = r.target_id
+        WHERE r.target_id IS NULL AND ` + scope + `
+        ORDER BY LOWER(s.title), s.id, r.position`
+
+	return p.queryReferences(ctx, "GetBrokenLinks", userId, "", query, args...)
+}
+
+// syncNoteReferences updates the link graph after a note has been written in tx: the links in its content when they
+// may have changed, and the links to it when its title has. It returns the other notes whose content it rewrote.
+func syncNoteReferences(ctx context.Context, tx *sql.Tx, note types.Note, oldTitle string, contentChanged bool) ([]string, error) {
+	if contentChanged {
+		if err := syncReferences(ctx, tx, note.ID, note.Content); err != nil {
+			return nil, fmt.Errorf("unable to store links: %w", err)
+		}
+	}
+	if oldTitle == note.Title {
+		return nil, nil
+	}
+	var rewritten []string
+	if oldTitle != "" {
+		var err error
+		if rewritten, err = renameReferences(ctx, tx, note.ID, oldTitle, note.Title); err != nil {
+			return nil, fmt.Errorf("unable to update links: %w", err)
+		}
+	}
+	if err := resolveReferences(ctx, tx, note.ID); err != nil {
+		return nil, fmt.Errorf("unable to resolve links: %w", err)
+	}
+	return rewritten, nil
+}
@@ -0,0 +1,238 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var ErrNoReminder = errors.New("note has no reminder")
+var _ services.ReminderStore = &Postgres{}
+
+const (
+	// reminderLockKey identifies the session advisory lock held by the replica firing reminders, so that only one
+	// replica fires them at a time. It is released as soon as that replica's connection closes.
+	reminderLockKey = 7301842201
+	// reminderDeliveryTimeout bounds how long a single reminder may take to deliver.
+	reminderDeliveryTimeout = 30 * time.Second
+	// reminderClaimLease is how long a claimed reminder is held off from other runs. It only matters when the replica
+	// delivering it stops before recording the outcome, so it is kept just above a single delivery.
+	reminderClaimLease = reminderDeliveryTimeout + 15*time.Second
+	// reminderRetryBase and reminderRetryMax bound the wait before a failed reminder is tried again, which doubles with
+	// every failed attempt.
+	reminderRetryBase = 30 * time.Second
+	reminderRetryMax  = time.Hour
+)
+
+// ProcessDueReminders fires the reminders that are due at now, at most limit of them. The work is done under a session
+// advisory lock: if another replica is already firing reminders nothing is done and 0 is returned. Reminders are
+// claimed one at a time, each in a transaction of its own committed before it is delivered, so no row lock is held
+// while notifiers run and a replica that stops mid-batch only holds off the reminder it was delivering. A reminder that
+// fails to fire is retried with an exponential backoff, behind the reminders that became due before its next attempt.
+func (p *Postgres) ProcessDueReminders(ctx context.Context, now time.Time, limit int, fire func(context.Context, types.Reminder) (*time.Time, error)) (int, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		p.logger.Error("unable to get connection", zap.String("operation_name", "ProcessDueReminders"), zap.Error(err))
+		return 0, fmt.Errorf("unable to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	var leader bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, reminderLockKey).Scan(&leader); err != nil {
+		p.logger.Error("unable to take reminder lock", zap.String("operation_name", "ProcessDueReminders"), zap.Error(err))
+		return 0, fmt.Errorf("unable to take reminder lock: %w", err)
+	}
+	if !leader {
+		return 0, nil
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reminderDeliveryTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(unlockCtx, `SELECT pg_advisory_unlock($1)`, reminderLockKey); err != nil {
+			// Closing a connection that still holds the lock would hand it back to the pool with it.
+			p.logger.Error("unable to release reminder lock", zap.String("operation_name", "ProcessDueReminders"), zap.Error(err))
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	fired := 0
+	for fired < limit {
+		reminder, ok, err := p.claimDueReminder(ctx, now)
+		if err != nil || !ok {
+			return fired, err
+		}
+
+		fireCtx, cancel := context.WithTimeout(ctx, reminderDeliveryTimeout)
+		next, err := fire(fireCtx, reminder)
+		cancel()
+		if err != nil {
+			p.logger.Warn("unable to fire reminder, it will be retried",
+				zap.String("noteId", reminder.NoteId),
+				zap.String("userId", reminder.UserId),
+				zap.Error(err))
+
+			if err := p.retryReminder(ctx, reminder.NoteId, time.Now()); err != nil {
+				return fired, err
+			}
+			continue
+		}
+
+		// The reminder may have been changed while it was delivered, in which case the new schedule is kept.
+		update := `
+            UPDATE notes
+            SET remind_at = CASE WHEN remind_at = $4 THEN COALESCE($1, remind_at) ELSE remind_at END,
+                snoozed_until = CASE WHEN snoozed_until IS NOT DISTINCT FROM $5 THEN NULL ELSE snoozed_until END,
+                reminder_fired_at = $2, reminder_attempts = 0, reminder_retry_at = NULL
+            WHERE id = $3`
+
+		if _, err := p.db.ExecContext(ctx, update, next, now, reminder.NoteId, reminder.RemindAt, reminder.SnoozedUntil); err != nil {
+			p.logger.Error("unable to record fired reminder", zap.String("noteId", reminder.NoteId), zap.Error(err))
+			return fired, fmt.Errorf("unable to record fired reminder: %w", err)
+		}
+		p.noteChanged(ctx, reminder.NoteId)
+		fired++
+	}
+
+	return fired, nil
+}
+
+// claimDueReminder picks the oldest reminder due at now and holds it off from other runs for reminderClaimLease. ok is
+// false when no reminder is due.
+func (p *Postgres) claimDueReminder(ctx context.Context, now time.Time) (reminder types.Reminder, ok bool, err error) {
+	// A reminder is due once its (possibly snoozed) time has passed and it has not fired since, unless it is waiting
+	// for its next attempt or is claimed by a run that stopped.
+	query := `
+        UPDATE notes
+        SET reminder_retry_at = $2
+        WHERE id = (
+            SELECT id
+            FROM notes
+            WHERE remind_at IS NOT NULL
+                AND archived = false
+                AND COALESCE(reminder_retry_at, snoozed_until, remind_at) <= $1
+                AND COALESCE(snoozed_until, remind_at) <= $1
+                AND (reminder_fired_at IS NULL OR reminder_fired_at < COALESCE(snoozed_until, remind_at))
+            ORDER BY COALESCE(reminder_retry_at, snoozed_until, remind_at)
+            LIMIT 1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, user_id, title, remind_at, snoozed_until, due_at, COALESCE(recurrence, '')`
+
+	var snoozedUntil, dueAt sql.NullTime
+	err = p.db.QueryRowContext(ctx, query, now, time.Now().Add(reminderClaimLease)).
+		Scan(&reminder.NoteId, &reminder.UserId, &reminder.Title, &reminder.RemindAt, &snoozedUntil, &dueAt, &reminder.Recurrence)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.Reminder{}, false, nil
+	}
+	if err != nil {
+		p.logger.Error("unable to claim due reminder", zap.String("operation_name", "ProcessDueReminders"), zap.Error(err))
+		return types.Reminder{}, false, fmt.Errorf("unable to claim due reminder: %w", err)
+	}
+	reminder.SnoozedUntil = timePtr(snoozedUntil)
+	reminder.DueAt = timePtr(dueAt)
+	return reminder, true, nil
+}
+
+// retryReminder records a failed delivery and schedules the next attempt.
+func (p *Postgres) retryReminder(ctx context.Context, noteId string, now time.Time) error {
+	query := `
+        UPDATE notes
+        SET reminder_attempts = reminder_attempts + 1,
+            reminder_retry_at = $1::timestamptz + LEAST($2::float8 * POWER(2, LEAST(reminder_attempts, 16)), $3::float8) * INTERVAL '1 second'
+        WHERE id = $4`
+
+	if _, err := p.db.ExecContext(ctx, query, now, reminderRetryBase.Seconds(), reminderRetryMax.Seconds(), noteId); err != nil {
+		p.logger.Error("unable to record failed reminder", zap.String("noteId", noteId), zap.Error(err))
+		return fmt.Errorf("unable to record failed reminder: %w", err)
+	}
+	return nil
+}
+
+// SnoozeReminder postpones the reminder of a note until the given time. The schedule of a recurring reminder is
+// left alone, so the occurrences after the snoozed one keep their usual times.
+func (p *Postgres) SnoozeReminder(ctx context.Context, userId, noteId string, until time.Time) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		p.logger.Error("userId and noteId must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId))
+
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	query := `
+        UPDATE notes
+        SET snoozed_until = $1, reminder_attempts = 0, reminder_retry_at = NULL
+        WHERE notes.id = $2 AND ` + canEdit("notes", "$3") + ` AND remind_at IS NOT NULL
+        RETURNING ` + noteColumns
+
+	var note types.Note
+	if err := scanNote(p.db.QueryRowContext(ctx, query, until, noteId, userId), &note); err != nil {
+		return types.Note{}, p.reminderFailed(ctx, "SnoozeReminder", userId, noteId, err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	p.logger.Info("reminder snoozed",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.Time("until", until))
+
+	return note, nil
+}
+
+// DismissReminder acknowledges the reminder of a note. A one-off reminder is cleared, while a recurring one only
+// drops its snooze and carries on with its next occurrence.
+func (p *Postgres) DismissReminder(ctx context.Context, userId, noteId string) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		p.logger.Error("userId and noteId must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId))
+
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	query := `
+        UPDATE notes
+        SET snoozed_until = NULL,
+            remind_at = CASE WHEN recurrence IS NULL THEN NULL ELSE remind_at END,
+            reminder_fired_at = CASE WHEN recurrence IS NULL THEN NULL ELSE reminder_fired_at END,
+            reminder_attempts = 0, reminder_retry_at = NULL
+        WHERE notes.id = $1 AND ` + canEdit("notes", "$2") + ` AND remind_at IS NOT NULL
+        RETURNING ` + noteColumns
+
+	var note types.Note
+	if err := scanNote(p.db.QueryRowContext(ctx, query, noteId, userId), &note); err != nil {
+		return types.Note{}, p.reminderFailed(ctx, "DismissReminder", userId, noteId, err)
+	}
+	p.noteChanged(ctx, noteId)
+
+	p.logger.Info("reminder dismissed",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId))
+
+	return note, nil
+}
+
+// reminderFailed works out why a reminder update matched no note: either the note does not exist for the user or it
+// has no reminder.
+func (p *Postgres) reminderFailed(ctx context.Context, operation, userId, noteId string, err error) error {
+	if !errors.Is(err, sql.ErrNoRows) {
+		p.logger.Error("failed to update reminder",
+			zap.String("operation_name", operation),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return fmt.Errorf("failed to update reminder: %w", err)
+	}
+
+	if _, err := p.GetSingleNote(ctx, userId, noteId); err != nil {
+		return fmt.Errorf("failed to update reminder: %w", err)
+	}
+	return fmt.Errorf("failed to update reminder: %w", ErrNoReminder)
+}
@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var _ services.RevisionStore = &Postgres{}
+
+// AddNoteRevision records a revision of a note. The caller has just saved the note, so it is not checked again who may
+// edit it.
+func (p *Postgres) AddNoteRevision(ctx context.Context, revision types.NoteRevision) error {
+	query := `
+        INSERT INTO note_revisions (note_id, version, content, editors)
+        VALUES ($1, $2, $3, $4)`
+
+	if _, err := p.db.ExecContext(ctx, query, revision.NoteId, revision.Version, revision.Content, pq.Array(revision.Editors)); err != nil {
+		p.logger.Error("unable to add revision",
+			zap.String("operation_name", "AddNoteRevision"),
+			zap.String("noteId", revision.NoteId),
+			zap.Error(err))
+		return fmt.Errorf("unable to add revision: %w", err)
+	}
+	return nil
+}
+
+// GetNoteRevisions returns the latest revisions of a note the user can read, newest first.
+func (p *Postgres) GetNoteRevisions(ctx context.Context, userId, noteId string, limit int) ([]types.NoteRevision, error) {
+	query := `
+        SELECT r.id, r.note_id, r.version, r.content, r.editors, r.created_at
+        FROM note_revisions r
+        JOIN notes ON notes.id = r.note_id
+        WHERE r.note_id = $1 AND ` + canRead("notes", "$2") + `
+        ORDER BY r.id DESC
+        LIMIT $3`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, userId, limit)
+	if err != nil {
+		p.logger.Error("unable to query revisions", zap.String("operation_name", "GetNoteRevisions"), zap.String("noteId", noteId), zap.Error(err))
+		return nil, fmt.Errorf("unable to query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []types.NoteRevision{}
+	for rows.Next() {
+		var revision types.NoteRevision
+		if err := rows.Scan(&revision.ID, &revision.NoteId, &revision.Version, &revision.Content, pq.Array(&revision.Editors), &revision.CreatedAt); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "GetNoteRevisions"), zap.Error(err))
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.String("operation_name", "GetNoteRevisions"), zap.Error(err))
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return revisions, nil
+}
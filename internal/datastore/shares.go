@@ -0,0 +1,215 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+var ErrShareNotFound = errors.New("could not find share")
+var _ services.ShareStore = &Postgres{}
+
+// canRead returns a condition that holds when the user bound to param can see the note aliased as table: they own
+// it, it has been shared with them, or it belongs to a workspace they are a member of.
+func canRead(table, param string) string {
+	return fmt.Sprintf(`((%[1]s.workspace_id IS NULL AND %[1]s.user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM note_shares ns WHERE ns.note_id = %[1]s.id AND ns.user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = %[1]s.workspace_id AND wm.user_id = %[2]s))`, table, param)
+}
+
+// canEdit is like canRead, but only lets through editors, whether by share or by workspace role.
+func canEdit(table, param string) string {
+	return fmt.Sprintf(`((%[1]s.workspace_id IS NULL AND %[1]s.user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM note_shares ns WHERE ns.note_id = %[1]s.id AND ns.user_id = %[2]s AND ns.permission = 'editor')
+		OR EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = %[1]s.workspace_id AND wm.user_id = %[2]s
+			AND wm.role IN ('owner', 'editor')))`, table, param)
+}
+
+// canManage holds for the owner of a personal note and for the owners of the workspace a note belongs to. Only they
+// can delete the note or control who else has access to it.
+func canManage(table, param string) string {
+	return fmt.Sprintf(`((%[1]s.workspace_id IS NULL AND %[1]s.user_id = %[2]s)
+		OR EXISTS (SELECT 1 FROM workspace_members wm WHERE wm.workspace_id = %[1]s.workspace_id AND wm.user_id = %[2]s
+			AND wm.role = 'owner'))`, table, param)
+}
+
+// permissionColumn selects the permission the user bound to param has on the note aliased as table. A workspace role
+// takes precedence over a share.
+func permissionColumn(table, param string) string {
+	return fmt.Sprintf(`CASE WHEN %[1]s.workspace_id IS NULL AND %[1]s.user_id = %[2]s THEN 'owner' ELSE COALESCE(
+		(SELECT wm.role FROM workspace_members wm WHERE wm.workspace_id = %[1]s.workspace_id AND wm.user_id = %[2]s),
+		(SELECT ns.permission FROM note_shares ns WHERE ns.note_id = %[1]s.id AND ns.user_id = %[2]s), '') END`, table, param)
+}
+
+const shareColumns = "note_id, user_id, username, permission, created_at"
+
+func scanShare(row rowScanner, share *types.NoteShare) error {
+	return row.Scan(&share.NoteId, &share.UserId, &share.Username, &share.Permission, &share.CreatedAt)
+}
+
+// ShareNote gives another user access to a note managed by ownerId. Sharing a note again with the same user changes
+// their permission.
+func (p *Postgres) ShareNote(ctx context.Context, ownerId, noteId string, grantee types.NoteShare) (types.NoteShare, error) {
+	if ownerId == "" || noteId == "" || grantee.UserId == "" || grantee.Permission == "" {
+		p.logger.Error("ownerId, noteId, grantee and permission must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", ownerId),
+			zap.String("noteId", noteId))
+
+		return types.NoteShare{}, fmt.Errorf("ownerId, noteId, grantee and permission must be provided: %w", ErrParameterNotProvided)
+	}
+
+	query := `
+        INSERT INTO note_shares (note_id, user_id, username, permission)
+        SELECT notes.id, $3, $4, $5 FROM notes WHERE notes.id = $1 AND ` + canManage("notes", "$2") + `
+        ON CONFLICT (note_id, user_id) DO UPDATE SET permission = EXCLUDED.permission
+        RETURNING ` + shareColumns
+
+	var share types.NoteShare
+	err := scanShare(p.db.QueryRowContext(ctx, query, noteId, ownerId, grantee.UserId, grantee.Username, grantee.Permission), &share)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.NoteShare{}, fmt.Errorf("unable to share note: %w", ErrNoteNoteFound)
+		}
+		p.logger.Error("failed to share note",
+			zap.String("operation_name", "ShareNote"),
+			zap.Error(err),
+			zap.String("userId", ownerId),
+			zap.String("noteId", noteId),
+		)
+		return types.NoteShare{}, fmt.Errorf("failed to share note: %w", err)
+	}
+	p.notesChanged(ctx, []string{grantee.UserId}, noteId, "")
+
+	p.logger.Info("note shared",
+		zap.String("userId", ownerId),
+		zap.String("noteId", noteId),
+		zap.String("granteeId", grantee.UserId),
+		zap.String("permission", grantee.Permission))
+
+	return share, nil
+}
+
+// ListNoteShares returns who a note managed by ownerId has been shared with.
+func (p *Postgres) ListNoteShares(ctx context.Context, ownerId, noteId string) ([]types.NoteShare, error) {
+	query := `
+        SELECT ns.note_id, ns.user_id, ns.username, ns.permission, ns.created_at
+        FROM note_shares ns
+        JOIN notes n ON n.id = ns.note_id
+        WHERE n.id = $1 AND ` + canManage("n", "$2") + `
+        ORDER BY ns.created_at`
+
+	rows, err := p.db.QueryContext(ctx, query, noteId, ownerId)
+	if err != nil {
+		p.logger.Error("unable to query note shares", zap.String("noteId", noteId), zap.Error(err))
+		return nil, fmt.Errorf("unable to query note shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []types.NoteShare{}
+	for rows.Next() {
+		var share types.NoteShare
+		if err := scanShare(rows, &share); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "ListNoteShares"), zap.Error(err))
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.Error(err))
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return shares, nil
+}
+
+// RevokeNoteShare removes the access granteeId has to a note. It is allowed for whoever manages the note, and for the
+// grantee giving up their own access.
+func (p *Postgres) RevokeNoteShare(ctx context.Context, userId, noteId, granteeId string) error {
+	query := `
+        DELETE FROM note_shares ns
+        USING notes n
+        WHERE ns.note_id = n.id AND n.id = $1 AND ns.user_id = $2 AND (ns.user_id = $3 OR ` + canManage("n", "$3") + `)`
+
+	res, err := p.db.ExecContext(ctx, query, noteId, granteeId, userId)
+	if err != nil {
+		p.logger.Error("failed to revoke note share",
+			zap.String("operation_name", "RevokeNoteShare"),
+			zap.Error(err),
+			zap.String("userId", userId),
+			zap.String("noteId", noteId),
+		)
+		return fmt.Errorf("failed to revoke note share: %w", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected after revoking share: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unable to revoke note share: %w", ErrShareNotFound)
+	}
+	p.notesChanged(ctx, []string{granteeId}, noteId, "")
+
+	p.logger.Info("note share revoked",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId),
+		zap.String("granteeId", granteeId))
+
+	return nil
+}
+
+// GetSharedNotes lists the notes other users have shared with userId, along with the total number of them.
+func (p *Postgres) GetSharedNotes(ctx context.Context, userId string, limit, offset int) ([]types.Note, int, error) {
+	if userId == "" {
+		p.logger.Error("userId must be provided", zap.Error(ErrParameterNotProvided))
+		return nil, 0, fmt.Errorf("userId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	var totalCount int
+	if err := p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM note_shares WHERE user_id = $1`, userId).Scan(&totalCount); err != nil {
+		p.logger.Error("failed to get total count", zap.String("operation_name", "GetSharedNotes"), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to get total count: %w", err)
+	}
+
+	query := `
+        SELECT ` + noteColumns + `, ns.permission
+        FROM notes
+        JOIN note_shares ns ON ns.note_id = notes.id
+        WHERE ns.user_id = $1
+        ORDER BY notes.id
+        LIMIT $2 OFFSET $3`
+
+	rows, err := p.db.QueryContext(ctx, query, userId, limit, offset)
+	if err != nil {
+		p.logger.Error("unable to run sql query", zap.String("operation_name", "GetSharedNotes"), zap.Error(err))
+		return nil, 0, fmt.Errorf("unable to run sql query: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []types.Note
+	for rows.Next() {
+		var note types.Note
+		if err := scanNote(rows, &note, &note.Permission); err != nil {
+			p.logger.Error("unable to scan row",
+				zap.String("operation_name", "GetSharedNotes"),
+				zap.Error(err),
+				zap.String("userId", userId))
+			return nil, 0, fmt.Errorf("unable to scan row: %w", err)
+		}
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.Error(err))
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return notes, totalCount, nil
+}
@@ -0,0 +1,31 @@
+-- SQLite keeps the personal notes of each user and the users themselves, with the columns of the Postgres schema
+-- that they use. Times are stored as text, which the driver reads back into times for TIMESTAMP columns.
+CREATE TABLE users (
+    user_id TEXT PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'user',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL DEFAULT '',
+    archived BOOLEAN NOT NULL DEFAULT false,
+    pinned BOOLEAN NOT NULL DEFAULT false,
+    color TEXT NOT NULL DEFAULT 'default',
+    kind TEXT NOT NULL DEFAULT 'text',
+    format TEXT NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown')),
+    remind_at TIMESTAMP,
+    snoozed_until TIMESTAMP,
+    due_at TIMESTAMP,
+    recurrence TEXT,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE INDEX notes_user_pinned_idx ON notes (user_id, pinned DESC, id);
@@ -0,0 +1,515 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var _ services.DBClient = &SQLite{}
+
+// sqliteMigrations are applied in order of their version by OpenSQLite. The version of the last one applied is kept
+// in the user_version of the database.
+//
+//go:embed sqlite-migrations/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteNoteColumns is the column list scanned by scanSQLiteNote.
+const sqliteNoteColumns = `id, user_id, title, content, archived, pinned, color, kind, format, remind_at, snoozed_until,
+	due_at, COALESCE(recurrence, ''), version`
+
+// SQLite is a DBClient keeping notes in a single SQLite file, for running the service without a database server.
+// Like Memory it only holds the personal notes of each user: there are no shares or workspaces, so only its owner can
+// read a note, and workspaces are empty and cannot be written to.
+type SQLite struct {
+	logger *zap.Logger
+	db     *sql.DB
+	cfg    config.Config
+}
+
+func NewSQLite(logger *zap.Logger, sqldb *sql.DB, cfg config.Config) *SQLite {
+	return &SQLite{
+		logger: logger,
+		db:     sqldb,
+		cfg:    cfg,
+	}
+}
+
+// OpenSQLite opens the database file at cfg.SQLitePath, creating it and its directory when they do not exist, and
+// brings its schema up to date. Writers wait for each other instead of failing while another one holds the lock.
+func OpenSQLite(ctx context.Context, cfg config.Config) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+cfg.SQLitePath+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	if err := migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// migrateSQLite applies the migrations newer than the version of the database, each in a transaction of its own.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(sqliteMigrations, "sqlite-migrations/V*.sql")
+	if err != nil {
+		return fmt.Errorf("unable to list migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&current); err != nil {
+		return fmt.Errorf("unable to read schema version: %w", err)
+	}
+
+	type migration struct {
+		version int
+		name    string
+	}
+	var pending []migration
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "sqlite-migrations/V"), "__")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("invalid migration name %q: %w", name, err)
+		}
+		if version > current {
+			pending = append(pending, migration{version: version, name: name})
+		}
+	}
+	slices.SortFunc(pending, func(a, b migration) int { return a.version - b.version })
+
+	for _, m := range pending {
+		script, err := sqliteMigrations.ReadFile(m.name)
+		if err != nil {
+			return fmt.Errorf("unable to read migration %q: %w", m.name, err)
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("unable to start transaction: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to apply migration %q: %w", m.name, err)
+		}
+		// PRAGMA statements cannot take parameters.
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("unable to record migration %q: %w", m.name, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("unable to apply migration %q: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyTitlePolicy makes sure the unique index backing the configured title policy exists. SQLite keeps the statement
+// each index was created with, so the index is only rebuilt when that statement changes. Case-insensitive titles only
+// fold ASCII letters, as that is all LOWER does in SQLite.
+func (s *SQLite) ApplyTitlePolicy(ctx context.Context) error {
+	column, policy := titleIndexColumn(s.cfg.TitleUniqueness, s.cfg.TitleUniqueActiveOnly)
+
+	create := ""
+	if column != "" {
+		create = fmt.Sprintf("CREATE UNIQUE INDEX %s ON notes (user_id, %s)", titleUniqueIndex, column)
+		if s.cfg.TitleUniqueActiveOnly {
+			create += " WHERE archived = false"
+		}
+	}
+
+	var current sql.NullString
+	err := s.db.QueryRowContext(ctx, `SELECT sql FROM sqlite_master WHERE type = 'index' AND name = $1`, titleUniqueIndex).Scan(&current)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Error("unable to read title policy", zap.Error(err))
+		return fmt.Errorf("unable to read title policy: %w", err)
+	}
+	if current.String == create {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP INDEX IF EXISTS %s", titleUniqueIndex)); err != nil {
+		s.logger.Error("unable to drop title index", zap.Error(err))
+		return fmt.Errorf("unable to drop title index: %w", err)
+	}
+	if create != "" {
+		if _, err := tx.ExecContext(ctx, create); err != nil {
+			s.logger.Error("unable to create title index, existing notes may violate the policy",
+				zap.String("policy", policy),
+				zap.Error(err))
+			return fmt.Errorf("unable to create title index for policy %q: %w", policy, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to apply title policy: %w", err)
+	}
+
+	s.logger.Info("title policy applied", zap.String("policy", policy))
+	return nil
+}
+
+func (s *SQLite) GetSingleNote(ctx context.Context, userId string, noteId string) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	query := `SELECT ` + sqliteNoteColumns + ` FROM notes WHERE id = $1 AND user_id = $2`
+
+	var note types.Note
+	err := scanSQLiteNote(s.db.QueryRowContext(ctx, query, noteId, userId), &note)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Note{}, fmt.Errorf("note not found: %w", ErrNoteNoteFound)
+		}
+		s.logger.Error("failed to query single note",
+			zap.String("operation_name", "GetSingleNote"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return types.Note{}, fmt.Errorf("failed to get note: %w", err)
+	}
+	return note, nil
+}
+
+func (s *SQLite) GetNotes(ctx context.Context, userId string, filter types.NoteFilter, limit, offset int) ([]types.Note, int, error) {
+	if userId == "" {
+		return nil, 0, fmt.Errorf("userId must be provided: %w", ErrParameterNotProvided)
+	}
+	// The user is not a member of any workspace, so there is nothing to list.
+	if filter.WorkspaceId != "" {
+		return nil, 0, nil
+	}
+
+	where := []string{"user_id = $1"}
+	args := []any{userId}
+	if filter.Archived != nil {
+		args = append(args, *filter.Archived)
+		where = append(where, fmt.Sprintf("archived = $%d", len(args)))
+	}
+	if filter.Pinned != nil {
+		args = append(args, *filter.Pinned)
+		where = append(where, fmt.Sprintf("pinned = $%d", len(args)))
+	}
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM notes WHERE ` + strings.Join(where, " AND ")
+	if err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total); err != nil {
+		s.logger.Error("failed to get total count", zap.String("operation_name", "GetNotes"), zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to get total count: %w", err)
+	}
+
+	args = append(args, limit, offset)
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM notes
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d`, sqliteNoteColumns, strings.Join(where, " AND "), noteOrder(filter), len(args)-1, len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error("unable to run sql query", zap.String("operation_name", "GetNotes"), zap.Error(err))
+		return nil, 0, fmt.Errorf("unable to run sql query: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []types.Note
+	for rows.Next() {
+		var note types.Note
+		if err := scanSQLiteNote(rows, &note); err != nil {
+			s.logger.Error("unable to scan row",
+				zap.String("operation_name", "GetNotes"),
+				zap.Error(err),
+				zap.String("userId", userId))
+			return nil, 0, fmt.Errorf("unable to scan row: %w", err)
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Error("row iteration error", zap.String("operation_name", "GetNotes"), zap.Error(err))
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return notes, total, nil
+}
+
+func (s *SQLite) CreateNote(ctx context.Context, userId string, note *types.NoteDto) (types.Note, error) {
+	if note == nil {
+		return types.Note{}, fmt.Errorf("note must not be nil: %w", ErrNilNote)
+	}
+	if userId == "" || note.Title == nil || *note.Title == "" {
+		return types.Note{}, fmt.Errorf("userId and title must be provided: %w", ErrParameterNotProvided)
+	}
+	if note.WorkspaceId != nil {
+		return types.Note{}, fmt.Errorf("failed to create note: %w", ErrPermissionDenied)
+	}
+
+	newNote := types.Note{
+		Title:  *note.Title,
+		Color:  types.DefaultNoteColor,
+		Kind:   types.NoteKindText,
+		Format: types.NoteFormatPlain,
+	}
+	if note.Content != nil {
+		newNote.Content = *note.Content
+	}
+	if note.Archived != nil {
+		newNote.Archived = *note.Archived
+	}
+	if note.Pinned != nil {
+		newNote.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		newNote.Color = *note.Color
+	}
+	if note.Kind != nil {
+		newNote.Kind = *note.Kind
+	}
+	if note.Format != nil {
+		newNote.Format = *note.Format
+	}
+	newNote.RemindAt = note.RemindAt.Value
+	newNote.DueAt = note.DueAt.Value
+	if note.Recurrence.Value != nil {
+		newNote.Recurrence = *note.Recurrence.Value
+	}
+
+	query := `
+        INSERT INTO notes (user_id, title, content, archived, pinned, color, kind, format, remind_at, due_at, recurrence)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))
+        RETURNING ` + sqliteNoteColumns
+
+	err := scanSQLiteNote(s.db.QueryRowContext(ctx, query, userId, newNote.Title, newNote.Content, newNote.Archived, newNote.Pinned,
+		newNote.Color, newNote.Kind, newNote.Format, utcTime(newNote.RemindAt), utcTime(newNote.DueAt), newNote.Recurrence), &newNote)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			s.logger.Info("note title already in use",
+				zap.String("operation_name", "CreateNote"),
+				zap.String("userId", userId),
+			)
+			return types.Note{}, fmt.Errorf("failed to create note: %w", ErrDuplicateTitle)
+		}
+		s.logger.Error("failed to create note",
+			zap.String("operation_name", "CreateNote"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return types.Note{}, fmt.Errorf("failed to create note: %w", err)
+	}
+
+	s.logger.Info("note created",
+		zap.String("userId", userId),
+		zap.String("noteId", newNote.ID))
+
+	return newNote, nil
+}
+
+func (s *SQLite) UpdateNote(ctx context.Context, userId, noteId string, note *types.NoteDto) (types.Note, error) {
+	if userId == "" || noteId == "" {
+		return types.Note{}, fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+	if note == nil {
+		return types.Note{}, fmt.Errorf("note must not be nil: %w", ErrNilNote)
+	}
+
+	oldNote, err := s.GetSingleNote(ctx, userId, noteId)
+	if err != nil {
+		return types.Note{}, fmt.Errorf("unable to update note: %w", err)
+	}
+	if note.Version != nil && *note.Version != oldNote.Version {
+		return types.Note{}, fmt.Errorf("unable to update note: %w", ErrVersionConflict)
+	}
+
+	if note.Title != nil {
+		oldNote.Title = *note.Title
+	}
+	if note.Content != nil {
+		oldNote.Content = *note.Content
+	}
+	if note.Archived != nil {
+		oldNote.Archived = *note.Archived
+	}
+	if note.Pinned != nil {
+		oldNote.Pinned = *note.Pinned
+	}
+	if note.Color != nil {
+		oldNote.Color = *note.Color
+	}
+	if note.Format != nil {
+		oldNote.Format = *note.Format
+	}
+	if note.DueAt.Set {
+		oldNote.DueAt = note.DueAt.Value
+	}
+	if note.Recurrence.Set {
+		oldNote.Recurrence = ""
+		if note.Recurrence.Value != nil {
+			oldNote.Recurrence = *note.Recurrence.Value
+		}
+	}
+	// A new reminder time starts the reminder afresh, dropping any snooze.
+	if note.RemindAt.Set {
+		oldNote.RemindAt = note.RemindAt.Value
+		oldNote.SnoozedUntil = nil
+	}
+
+	// Like the trigger in Postgres, the version only goes up when something changed.
+	query := `
+        UPDATE notes
+        SET title = $1, content = $2, archived = $3, pinned = $4, color = $5, format = $6, remind_at = $7,
+            snoozed_until = $8, due_at = $9, recurrence = NULLIF($10, ''), updated_at = CURRENT_TIMESTAMP,
+            version = version + (
+                title IS NOT $1 OR content IS NOT $2 OR archived IS NOT $3 OR pinned IS NOT $4 OR color IS NOT $5 OR
+                format IS NOT $6 OR remind_at IS NOT $7 OR snoozed_until IS NOT $8 OR due_at IS NOT $9 OR
+                recurrence IS NOT NULLIF($10, ''))
+        WHERE id = $11 AND user_id = $12 AND ($13 IS NULL OR version = $13)
+        RETURNING ` + sqliteNoteColumns
+
+	var newNote types.Note
+	err = scanSQLiteNote(s.db.QueryRowContext(ctx, query, oldNote.Title, oldNote.Content, oldNote.Archived, oldNote.Pinned, oldNote.Color,
+		oldNote.Format, utcTime(oldNote.RemindAt), utcTime(oldNote.SnoozedUntil), utcTime(oldNote.DueAt), oldNote.Recurrence,
+		noteId, userId, note.Version), &newNote)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) && note.Version != nil {
+			// Someone else changed the note after it was read above.
+			s.logger.Info("note has changed since the given version",
+				zap.String("operation_name", "UpdateNote"),
+				zap.String("userId", userId),
+				zap.String("noteId", noteId),
+			)
+			return types.Note{}, fmt.Errorf("failed to update note: %w", ErrVersionConflict)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Note{}, fmt.Errorf("failed to update note: note not found: %w", ErrNoteNoteFound)
+		}
+		if isSQLiteUniqueViolation(err) {
+			s.logger.Info("note title already in use",
+				zap.String("operation_name", "UpdateNote"),
+				zap.String("userId", userId),
+				zap.String("noteId", noteId),
+			)
+			return types.Note{}, fmt.Errorf("failed to update note: %w", ErrDuplicateTitle)
+		}
+		s.logger.Error("failed to update note",
+			zap.String("operation_name", "UpdateNote"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return types.Note{}, fmt.Errorf("failed to update note: %w", err)
+	}
+
+	s.logger.Info("note update",
+		zap.String("userId", userId),
+		zap.String("noteId", newNote.ID))
+
+	return newNote, nil
+}
+
+// DeleteNote deletes a note of the user. A note that is missing or belongs to someone else is left alone without an
+// error.
+func (s *SQLite) DeleteNote(ctx context.Context, userId, noteId string) error {
+	if userId == "" || noteId == "" {
+		return fmt.Errorf("userId and noteId must be provided: %w", ErrParameterNotProvided)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM notes WHERE id = $1 AND user_id = $2`, noteId, userId); err != nil {
+		s.logger.Error("failed to delete note",
+			zap.String("operation_name", "DeleteNote"),
+			zap.Error(err),
+			zap.String("userId", userId),
+		)
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+
+	s.logger.Info("note deleted",
+		zap.String("userId", userId),
+		zap.String("noteId", noteId))
+
+	return nil
+}
+
+// scanSQLiteNote reads the sqliteNoteColumns of a row into note, as its owner sees it.
+func scanSQLiteNote(row rowScanner, note *types.Note) error {
+	var id int64
+	var remindAt, snoozedUntil, dueAt sql.NullTime
+	err := row.Scan(
+		&id,
+		&note.UserId,
+		&note.Title,
+		&note.Content,
+		&note.Archived,
+		&note.Pinned,
+		&note.Color,
+		&note.Kind,
+		&note.Format,
+		&remindAt,
+		&snoozedUntil,
+		&dueAt,
+		&note.Recurrence,
+		&note.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	note.ID = strconv.FormatInt(id, 10)
+	note.Permission = types.PermissionOwner
+	note.RemindAt = timePtr(remindAt)
+	note.SnoozedUntil = timePtr(snoozedUntil)
+	note.DueAt = timePtr(dueAt)
+	if note.Kind == types.NoteKindChecklist {
+		note.Checklist = &types.ChecklistSummary{}
+	}
+	return nil
+}
+
+// utcTime stores times in UTC, so that the same instant is always written the same way and compares equal.
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC()
+	return &utc
+}
+
+// isSQLiteUniqueViolation reports whether err is a violation of a unique index. The title index is the only one on
+// notes.
+func isSQLiteUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
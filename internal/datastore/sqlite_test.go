@@ -0,0 +1,47 @@
+package datastore_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore/conformance"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"go.uber.org/zap"
+)
+
+// openSQLite opens a database of its own for each subtest, in a file that goes with it.
+func openSQLite(t *testing.T) (*sql.DB, config.Config) {
+	t.Helper()
+	cfg := config.Config{
+		TitleUniqueness: config.TitleUniquenessExact,
+		SQLitePath:      filepath.Join(t.TempDir(), "notes.db"),
+	}
+	db, err := datastore.OpenSQLite(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, cfg
+}
+
+func TestSQLite(t *testing.T) {
+	conformance.TestDBClient(t, func(t *testing.T) services.DBClient {
+		db, cfg := openSQLite(t)
+		lite := datastore.NewSQLite(zap.NewNop(), db, cfg)
+		if err := lite.ApplyTitlePolicy(context.Background()); err != nil {
+			t.Fatalf("ApplyTitlePolicy: %v", err)
+		}
+		return lite
+	})
+}
+
+func TestSQLiteUserStore(t *testing.T) {
+	conformance.TestUserStore(t, func(t *testing.T) services.UserStore {
+		db, _ := openSQLite(t)
+		return services.NewSQLiteUserStore(db)
+	})
+}
@@ -0,0 +1,186 @@
+package datastore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var _ services.SyncStore = &Postgres{}
+
+// GetNoteChanges returns the next page of up to limit changes to the notes the user can read, after cursor. The first
+// page of a round fixes where it ends at the oldest transaction still running, so that the next round sends again
+// whatever those transactions write, however late they commit. A first sync, from the zero cursor, only gets the notes
+// there are: there is nothing on the client for tombstones to delete.
+func (p *Postgres) GetNoteChanges(ctx context.Context, userId string, cursor types.SyncCursor, limit int) (types.NoteChanges, error) {
+	if cursor.Until == 0 {
+		if err := p.db.QueryRowContext(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`).Scan(&cursor.Until); err != nil {
+			p.logger.Error("unable to start sync round", zap.String("operation_name", "GetNoteChanges"), zap.String("userId", userId), zap.Error(err))
+			return types.NoteChanges{}, fmt.Errorf("unable to start sync round: %w", err)
+		}
+	}
+
+	// One more than asked for is read from each side, to know whether there is another page.
+	query := `
+        SELECT ` + noteColumns + `, ` + permissionColumn("notes", "$1") + `
+        FROM notes
+        WHERE ` + canRead("notes", "$1") + ` AND notes.change_xid >= $2::xid8 AND notes.id > $3
+        ORDER BY notes.id
+        LIMIT $4`
+
+	rows, err := p.db.QueryContext(ctx, query, userId, cursor.Since, cursor.AfterId, limit+1)
+	if err != nil {
+		p.logger.Error("unable to query changed notes", zap.String("operation_name", "GetNoteChanges"), zap.String("userId", userId), zap.Error(err))
+		return types.NoteChanges{}, fmt.Errorf("unable to query changed notes: %w", err)
+	}
+	defer rows.Close()
+
+	var changed []types.NoteChange
+	for rows.Next() {
+		var note types.Note
+		if err := scanNote(rows, &note, &note.Permission); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+			return types.NoteChanges{}, fmt.Errorf("unable to scan row: %w", err)
+		}
+		changed = append(changed, types.NoteChange{ID: note.ID, Note: &note})
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+		return types.NoteChanges{}, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	if err := p.addChecklistItems(ctx, changed); err != nil {
+		return types.NoteChanges{}, err
+	}
+
+	var deleted []types.NoteChange
+	if cursor.Since > 0 {
+		deleted, err = p.getTombstones(ctx, userId, cursor, limit+1)
+		if err != nil {
+			return types.NoteChanges{}, err
+		}
+	}
+
+	changes := mergeNoteChanges(changed, deleted)
+	result := types.NoteChanges{Changes: changes, Next: types.SyncCursor{Since: cursor.Until}}
+	if len(changes) > limit {
+		result.Changes = changes[:limit]
+		result.More = true
+		last, _ := strconv.ParseInt(result.Changes[limit-1].ID, 10, 64)
+		result.Next = types.SyncCursor{Since: cursor.Since, Until: cursor.Until, AfterId: last}
+	}
+	if result.Changes == nil {
+		result.Changes = []types.NoteChange{}
+	}
+	return result, nil
+}
+
+// addChecklistItems fills in the items of the checklists among changed notes, so that clients get a checklist whole.
+func (p *Postgres) addChecklistItems(ctx context.Context, changed []types.NoteChange) error {
+	checklists := make(map[string]*types.Note)
+	var noteIds []string
+	for _, change := range changed {
+		if change.Note.Kind == types.NoteKindChecklist {
+			change.Note.Items = []types.ChecklistItem{}
+			checklists[change.ID] = change.Note
+			noteIds = append(noteIds, change.ID)
+		}
+	}
+	if len(noteIds) == 0 {
+		return nil
+	}
+
+	query := `
+        SELECT ci.note_id, ` + checklistItemColumns + `
+        FROM checklist_items ci
+        WHERE ci.note_id = ANY($1::int[])
+        ORDER BY ci.note_id, ci.position, ci.id`
+
+	rows, err := p.db.QueryContext(ctx, query, pq.Array(noteIds))
+	if err != nil {
+		p.logger.Error("unable to query checklist items", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+		return fmt.Errorf("unable to query checklist items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteId string
+		var item types.ChecklistItem
+		if err := rows.Scan(&noteId, &item.ID, &item.Text, &item.Checked, &item.Position); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+			return fmt.Errorf("unable to scan row: %w", err)
+		}
+		note := checklists[noteId]
+		note.Items = append(note.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+		return fmt.Errorf("row iteration error: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) getTombstones(ctx context.Context, userId string, cursor types.SyncCursor, limit int) ([]types.NoteChange, error) {
+	query := `
+        SELECT note_id, deleted_at
+        FROM note_tombstones
+        WHERE user_id = $1 AND change_xid >= $2::xid8 AND note_id > $3
+        ORDER BY note_id
+        LIMIT $4`
+
+	rows, err := p.db.QueryContext(ctx, query, userId, cursor.Since, cursor.AfterId, limit)
+	if err != nil {
+		p.logger.Error("unable to query tombstones", zap.String("operation_name", "GetNoteChanges"), zap.String("userId", userId), zap.Error(err))
+		return nil, fmt.Errorf("unable to query tombstones: %w", err)
+	}
+	defer rows.Close()
+
+	var deleted []types.NoteChange
+	for rows.Next() {
+		var change types.NoteChange
+		var deletedAt time.Time
+		if err := rows.Scan(&change.ID, &deletedAt); err != nil {
+			p.logger.Error("unable to scan row", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+			return nil, fmt.Errorf("unable to scan row: %w", err)
+		}
+		change.Deleted = true
+		change.DeletedAt = &deletedAt
+		deleted = append(deleted, change)
+	}
+	if err := rows.Err(); err != nil {
+		p.logger.Error("row iteration error", zap.String("operation_name", "GetNoteChanges"), zap.Error(err))
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	return deleted, nil
+}
+
+// mergeNoteChanges merges two lists of changes ordered by note id into one. A note is never in both, as gaining access
+// to a note again removes its tombstone.
+func mergeNoteChanges(a, b []types.NoteChange) []types.NoteChange {
+	merged := make([]types.NoteChange, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		idA, _ := strconv.ParseInt(a[0].ID, 10, 64)
+		idB, _ := strconv.ParseInt(b[0].ID, 10, 64)
+		if idA < idB {
+			merged = append(merged, a[0])
+			a = a[1:]
+		} else {
+			merged = append(merged, b[0])
+			b = b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// DeleteNoteVersion deletes a note managed by the user if it is still at the given version, failing with
+// ErrVersionConflict if it has changed since and ErrNoteNoteFound if it is gone or the user may not delete it.
+func (p *Postgres) DeleteNoteVersion(ctx context.Context, userId, noteId string, version int) error {
+	return p.deleteNote(ctx, userId, noteId, &version)
+}
@@ -0,0 +1,159 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/templates"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrTemplateNotFound = errors.New("could not find template")
+var ErrDuplicateTemplate = errors.New("a template with this name already exists")
+var _ services.TemplateStore = &Postgres{}
+
+const (
+	templateColumns     = "id, name, title, content, format, created_at, updated_at"
+	templateUniqueIndex = "note_templates_user_name_unique"
+)
+
+func scanTemplate(row rowScanner, template *types.NoteTemplate) error {
+	var updatedAt sql.NullTime
+	err := row.Scan(&template.ID, &template.Name, &template.Title, &template.Content, &template.Format, &template.CreatedAt, &updatedAt)
+	if err != nil {
+		return err
+	}
+	template.UpdatedAt = timePtr(updatedAt)
+	template.Variables = templates.Variables(template.Title, template.Content)
+	return nil
+}
+
+func isDuplicateTemplate(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation && pqErr.Constraint == templateUniqueIndex
+}
+
+func (p *Postgres) templateFailed(operation, userId, templateId, msg string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", msg, ErrTemplateNotFound)
+	}
+	if isDuplicateTemplate(err) {
+		return fmt.Errorf("%s: %w", msg, ErrDuplicateTemplate)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("templateId", templateId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+func (p *Postgres) CreateTemplate(ctx context.Context, userId string, template types.TemplateDto) (types.NoteTemplate, error) {
+	if userId == "" || template.Name == nil || template.Title == nil {
+		p.logger.Error("userId, name and title must be provided", zap.Error(ErrParameterNotProvided), zap.String("userId", userId))
+		return types.NoteTemplate{}, fmt.Errorf("userId, name and title must be provided: %w", ErrParameterNotProvided)
+	}
+
+	content, format := "", types.NoteFormatPlain
+	if template.Content != nil {
+		content = *template.Content
+	}
+	if template.Format != nil {
+		format = *template.Format
+	}
+
+	query := `
+        INSERT INTO note_templates (user_id, name, title, content, format)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING ` + templateColumns
+
+	var created types.NoteTemplate
+	err := scanTemplate(p.db.QueryRowContext(ctx, query, userId, *template.Name, *template.Title, content, format), &created)
+	if err != nil {
+		return types.NoteTemplate{}, p.templateFailed("CreateTemplate", userId, "", "unable to create template", err)
+	}
+
+	p.logger.Info("template created", zap.String("userId", userId), zap.String("templateId", created.ID))
+
+	return created, nil
+}
+
+// GetTemplates lists the templates of a user by name.
+func (p *Postgres) GetTemplates(ctx context.Context, userId string) ([]types.NoteTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM note_templates WHERE user_id = $1 ORDER BY LOWER(name), id`
+
+	rows, err := p.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, p.templateFailed("GetTemplates", userId, "", "unable to query templates", err)
+	}
+	defer rows.Close()
+
+	list := []types.NoteTemplate{}
+	for rows.Next() {
+		var template types.NoteTemplate
+		if err := scanTemplate(rows, &template); err != nil {
+			return nil, p.templateFailed("GetTemplates", userId, "", "unable to scan row", err)
+		}
+		list = append(list, template)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.templateFailed("GetTemplates", userId, "", "row iteration error", err)
+	}
+
+	return list, nil
+}
+
+func (p *Postgres) GetTemplate(ctx context.Context, userId, templateId string) (types.NoteTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM note_templates WHERE id = $1 AND user_id = $2`
+
+	var template types.NoteTemplate
+	if err := scanTemplate(p.db.QueryRowContext(ctx, query, templateId, userId), &template); err != nil {
+		return types.NoteTemplate{}, p.templateFailed("GetTemplate", userId, templateId, "unable to get template", err)
+	}
+
+	return template, nil
+}
+
+// UpdateTemplate changes the fields of a template that are set in template.
+func (p *Postgres) UpdateTemplate(ctx context.Context, userId, templateId string, template types.TemplateDto) (types.NoteTemplate, error) {
+	query := `
+        UPDATE note_templates
+        SET name = COALESCE($3, name), title = COALESCE($4, title), content = COALESCE($5, content),
+            format = COALESCE($6, format), updated_at = NOW()
+        WHERE id = $1 AND user_id = $2
+        RETURNING ` + templateColumns
+
+	var updated types.NoteTemplate
+	err := scanTemplate(p.db.QueryRowContext(ctx, query, templateId, userId, template.Name, template.Title, template.Content, template.Format), &updated)
+	if err != nil {
+		return types.NoteTemplate{}, p.templateFailed("UpdateTemplate", userId, templateId, "unable to update template", err)
+	}
+
+	return updated, nil
+}
+
+func (p *Postgres) DeleteTemplate(ctx context.Context, userId, templateId string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM note_templates WHERE id = $1 AND user_id = $2`, templateId, userId)
+	if err != nil {
+		return p.templateFailed("DeleteTemplate", userId, templateId, "unable to delete template", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return p.templateFailed("DeleteTemplate", userId, templateId, "unable to delete template", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("unable to delete template: %w", ErrTemplateNotFound)
+	}
+
+	p.logger.Info("template deleted", zap.String("userId", userId), zap.String("templateId", templateId))
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+var _ services.ThumbnailStore = &Postgres{}
+
+// GetThumbnailSource returns an image attachment that is waiting for its thumbnail.
+func (p *Postgres) GetThumbnailSource(ctx context.Context, attachmentId string) (types.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM note_attachments a WHERE a.id = $1`
+
+	var attachment types.Attachment
+	err := scanAttachment(p.db.QueryRowContext(ctx, query, attachmentId), &attachment)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = ErrAttachmentNotFound
+	}
+	if err != nil {
+		return types.Attachment{}, p.attachmentFailed("GetThumbnailSource", "", "", "unable to get attachment", err)
+	}
+	return attachment, nil
+}
+
+// RecordThumbnail records the thumbnail made for an image, along with the dimensions of the image.
+func (p *Postgres) RecordThumbnail(ctx context.Context, attachmentId string, thumbnail types.Thumbnail) error {
+	update := `
+        UPDATE note_attachments
+        SET width = $2, height = $3, thumbnail_status = 'ready', thumbnail_key = $4, thumbnail_content_type = $5
+        WHERE id = $1`
+
+	if _, err := p.db.ExecContext(ctx, update, attachmentId, thumbnail.Width, thumbnail.Height, thumbnail.Key, thumbnail.ContentType); err != nil {
+		return p.attachmentFailed("RecordThumbnail", "", "", "unable to record thumbnail", err)
+	}
+	return nil
+}
+
+// FailThumbnail gives up on the thumbnail of an image.
+func (p *Postgres) FailThumbnail(ctx context.Context, attachmentId string) error {
+	if _, err := p.db.ExecContext(ctx, `UPDATE note_attachments SET thumbnail_status = 'failed' WHERE id = $1`, attachmentId); err != nil {
+		return p.attachmentFailed("FailThumbnail", "", "", "unable to record failed thumbnail", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrDuplicateTitle = errors.New("a note with this title already exists")
+
+const (
+	titleUniqueIndex    = "notes_user_title_unique"
+	pqUniqueViolation   = "23505"
+	titlePolicyDisabled = "off"
+	// titleScope is who titles have to be unique for: the workspace of a note, or its user for personal notes.
+	titleScope = "COALESCE('workspace:' || workspace_id::text, user_id)"
+)
+
+// ApplyTitlePolicy makes sure the unique index backing the configured title policy exists. The policy an index enforces
+// is recorded as a comment on it, so the index is only rebuilt when the configured policy changes. Rebuilding fails,
+// and the service refuses to start, when existing notes already violate the new policy.
+func (p *Postgres) ApplyTitlePolicy(ctx context.Context) error {
+	column, policy := titleIndexColumn(p.cfg.TitleUniqueness, p.cfg.TitleUniqueActiveOnly)
+
+	var current sql.NullString
+	err := p.db.QueryRowContext(ctx, `SELECT obj_description(to_regclass($1), 'pg_class')`, titleUniqueIndex).Scan(&current)
+	if err != nil {
+		p.logger.Error("unable to read title policy", zap.Error(err))
+		return fmt.Errorf("unable to read title policy: %w", err)
+	}
+
+	enforced := titlePolicyDisabled
+	if current.Valid {
+		enforced = current.String
+	}
+	if enforced == policy {
+		return nil
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP INDEX IF EXISTS %s", titleUniqueIndex)); err != nil {
+		p.logger.Error("unable to drop title index", zap.Error(err))
+		return fmt.Errorf("unable to drop title index: %w", err)
+	}
+	if column != "" {
+		create := fmt.Sprintf("CREATE UNIQUE INDEX %s ON notes (%s, %s)", titleUniqueIndex, titleScope, column)
+		if p.cfg.TitleUniqueActiveOnly {
+			create += " WHERE NOT archived"
+		}
+		if _, err := tx.ExecContext(ctx, create); err != nil {
+			p.logger.Error("unable to create title index, existing notes may violate the policy",
+				zap.String("policy", policy),
+				zap.Error(err))
+			return fmt.Errorf("unable to create title index for policy %q: %w", policy, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("COMMENT ON INDEX %s IS %s", titleUniqueIndex, pq.QuoteLiteral(policy))); err != nil {
+			p.logger.Error("unable to record title policy", zap.Error(err))
+			return fmt.Errorf("unable to record title policy: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to apply title policy: %w", err)
+	}
+
+	p.logger.Info("title policy applied", zap.String("policy", policy), zap.String("previous_policy", enforced))
+	return nil
+}
+
+// titleIndexColumn returns the indexed expression for the policy along with a short description of it. An empty
+// expression means titles are not required to be unique.
+func titleIndexColumn(uniqueness config.TitleUniqueness, activeOnly bool) (string, string) {
+	var column string
+	switch uniqueness {
+	case config.TitleUniquenessExact:
+		column = "title"
+	case config.TitleUniquenessCaseInsensitive:
+		column = "LOWER(title)"
+	default:
+		return "", titlePolicyDisabled
+	}
+
+	policy := string(uniqueness) + ",per-workspace"
+	if activeOnly {
+		policy += ",active-only"
+	}
+	return column, policy
+}
+
+// isDuplicateTitle reports whether err is a violation of the title uniqueness index.
+func isDuplicateTitle(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation && pqErr.Constraint == titleUniqueIndex
+}
@@ -0,0 +1,389 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrWebhookNotFound = errors.New("could not find webhook")
+var ErrDeliveryNotFound = errors.New("could not find webhook delivery")
+var ErrWebhookLimit = errors.New("too many webhooks")
+var ErrWebhookDisabled = errors.New("webhook is disabled")
+var _ services.WebhookStore = &Postgres{}
+
+const (
+	// maxWebhooks bounds the webhooks of a single user, as every event of their notes is sent to each of them.
+	maxWebhooks = 10
+	// deliveryAttempts is how often an event is sent to a webhook before the delivery is given up on. With the backoff
+	// of the job queue, the last attempt comes about two hours after the first.
+	deliveryAttempts = 8
+)
+
+const webhookColumns = `id, url, events, description, active, consecutive_failures, disabled_at, created_at, updated_at`
+
+const deliveryColumns = `d.id, d.webhook_id, d.event, d.payload, d.redelivery_of, d.status, d.attempts, d.response_status,
+	COALESCE(d.response_body, ''), COALESCE(d.error, ''), d.duration_ms, d.created_at, d.attempted_at`
+
+func scanWebhook(row rowScanner, webhook *types.Webhook) error {
+	var disabledAt, updatedAt sql.NullTime
+	err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Description, &webhook.Active,
+		&webhook.ConsecutiveFailures, &disabledAt, &webhook.CreatedAt, &updatedAt)
+	if err != nil {
+		return err
+	}
+	webhook.DisabledAt = timePtr(disabledAt)
+	webhook.UpdatedAt = timePtr(updatedAt)
+	return nil
+}
+
+func scanDelivery(row rowScanner, delivery *types.WebhookDelivery, extra ...any) error {
+	var redeliveryOf sql.NullString
+	var responseStatus, durationMs sql.NullInt32
+	var attemptedAt sql.NullTime
+	dest := []any{&delivery.ID, &delivery.WebhookId, &delivery.Event, &delivery.Payload, &redeliveryOf, &delivery.Status,
+		&delivery.Attempts, &responseStatus, &delivery.ResponseBody, &delivery.Error, &durationMs, &delivery.CreatedAt,
+		&attemptedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	delivery.RedeliveryOf = stringPtr(redeliveryOf)
+	delivery.ResponseStatus = intPtr(responseStatus)
+	delivery.DurationMs = intPtr(durationMs)
+	delivery.AttemptedAt = timePtr(attemptedAt)
+	return nil
+}
+
+func intPtr(n sql.NullInt32) *int {
+	if !n.Valid {
+		return nil
+	}
+	v := int(n.Int32)
+	return &v
+}
+
+func (p *Postgres) webhookFailed(operation, userId, webhookId, msg string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", msg, ErrWebhookNotFound)
+	}
+	if errors.Is(err, ErrWebhookNotFound) || errors.Is(err, ErrDeliveryNotFound) || errors.Is(err, ErrWebhookLimit) ||
+		errors.Is(err, ErrWebhookDisabled) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("webhookId", webhookId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// queueNoteEvent records an event of note: it is logged for the event streams of every user who can read the note,
+// and queued for delivery to every active webhook subscribed to it whose user can read the note. It runs in the
+// transaction making the change, so that events go out for exactly the changes that are committed. A deleted note is
+// recorded before it goes.
+func queueNoteEvent(ctx context.Context, tx *sql.Tx, event string, note types.Note) error {
+	note.Permission = ""
+	payload, err := json.Marshal(note)
+	if err != nil {
+		return fmt.Errorf("unable to encode note: %w", err)
+	}
+
+	if err := logNoteEvent(ctx, tx, event, note.ID, payload); err != nil {
+		return err
+	}
+
+	query := `
+        WITH deliveries AS (
+            INSERT INTO webhook_deliveries (webhook_id, event, payload)
+            SELECT w.id, $2, $3
+            FROM webhooks w
+            JOIN notes ON notes.id = $1
+            WHERE w.active AND $2 = ANY(w.events) AND ` + canRead("notes", "w.user_id") + `
+            RETURNING id)
+        INSERT INTO jobs (kind, payload, max_attempts)
+        SELECT $4, jsonb_build_object('deliveryId', id::text), $5 FROM deliveries`
+
+	if _, err := tx.ExecContext(ctx, query, note.ID, event, string(payload), types.JobWebhookDelivery, deliveryAttempts); err != nil {
+		return fmt.Errorf("unable to queue %s event: %w", event, err)
+	}
+	return nil
+}
+
+// CreateWebhook registers a webhook for the user, up to maxWebhooks of them.
+func (p *Postgres) CreateWebhook(ctx context.Context, userId string, webhook types.Webhook) (types.Webhook, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Webhook{}, p.webhookFailed("CreateWebhook", userId, "", "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	// Webhooks of the same user are created one at a time, so that they cannot overrun the limit together.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('webhooks:' || $1))`, userId); err != nil {
+		return types.Webhook{}, p.webhookFailed("CreateWebhook", userId, "", "unable to lock webhooks", err)
+	}
+
+	query := `
+        INSERT INTO webhooks (user_id, url, secret, events, description)
+        SELECT $1, $2, $3, $4, $5
+        WHERE (SELECT COUNT(*) FROM webhooks WHERE user_id = $1) < $6
+        RETURNING ` + webhookColumns
+
+	var created types.Webhook
+	err = scanWebhook(tx.QueryRowContext(ctx, query, userId, webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.Description, maxWebhooks), &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.Webhook{}, fmt.Errorf("unable to create webhook: %w", ErrWebhookLimit)
+	}
+	if err != nil {
+		return types.Webhook{}, p.webhookFailed("CreateWebhook", userId, "", "unable to create webhook", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.Webhook{}, p.webhookFailed("CreateWebhook", userId, "", "unable to create webhook", err)
+	}
+
+	p.logger.Info("webhook created", zap.String("userId", userId), zap.String("webhookId", created.ID))
+	created.Secret = webhook.Secret
+	return created, nil
+}
+
+// GetWebhooks lists the webhooks of a user, oldest first.
+func (p *Postgres) GetWebhooks(ctx context.Context, userId string) ([]types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE user_id = $1 ORDER BY id`
+
+	rows, err := p.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, p.webhookFailed("GetWebhooks", userId, "", "unable to query webhooks", err)
+	}
+	defer rows.Close()
+
+	list := []types.Webhook{}
+	for rows.Next() {
+		var webhook types.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return nil, p.webhookFailed("GetWebhooks", userId, "", "unable to scan row", err)
+		}
+		list = append(list, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.webhookFailed("GetWebhooks", userId, "", "row iteration error", err)
+	}
+
+	return list, nil
+}
+
+func (p *Postgres) GetWebhook(ctx context.Context, userId, webhookId string) (types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	var webhook types.Webhook
+	if err := scanWebhook(p.db.QueryRowContext(ctx, query, webhookId, userId), &webhook); err != nil {
+		return types.Webhook{}, p.webhookFailed("GetWebhook", userId, webhookId, "unable to get webhook", err)
+	}
+
+	return webhook, nil
+}
+
+// UpdateWebhook changes the fields of a webhook that are set in webhook. Enabling a webhook starts its count of failed
+// deliveries afresh.
+func (p *Postgres) UpdateWebhook(ctx context.Context, userId, webhookId string, webhook types.WebhookDto) (types.Webhook, error) {
+	var events interface{}
+	if webhook.Events != nil {
+		events = pq.Array(webhook.Events)
+	}
+
+	query := `
+        UPDATE webhooks
+        SET url = COALESCE($3, url), events = COALESCE($4, events), description = COALESCE($5, description),
+            active = COALESCE($6, active),
+            consecutive_failures = CASE WHEN $6 THEN 0 ELSE consecutive_failures END,
+            disabled_at = CASE WHEN $6 THEN NULL WHEN NOT $6 THEN COALESCE(disabled_at, NOW()) ELSE disabled_at END,
+            updated_at = NOW()
+        WHERE id = $1 AND user_id = $2
+        RETURNING ` + webhookColumns
+
+	var updated types.Webhook
+	err := scanWebhook(p.db.QueryRowContext(ctx, query, webhookId, userId, webhook.URL, events, webhook.Description, webhook.Active), &updated)
+	if err != nil {
+		return types.Webhook{}, p.webhookFailed("UpdateWebhook", userId, webhookId, "unable to update webhook", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteWebhook deletes a webhook along with its delivery log. Deliveries still queued are dropped.
+func (p *Postgres) DeleteWebhook(ctx context.Context, userId, webhookId string) error {
+	result, err := p.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, webhookId, userId)
+	if err != nil {
+		return p.webhookFailed("DeleteWebhook", userId, webhookId, "unable to delete webhook", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return p.webhookFailed("DeleteWebhook", userId, webhookId, "unable to delete webhook", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("unable to delete webhook: %w", ErrWebhookNotFound)
+	}
+
+	p.logger.Info("webhook deleted", zap.String("userId", userId), zap.String("webhookId", webhookId))
+
+	return nil
+}
+
+// GetWebhookDeliveries lists the latest deliveries to a webhook of the user, newest first.
+func (p *Postgres) GetWebhookDeliveries(ctx context.Context, userId, webhookId string, limit int) ([]types.WebhookDelivery, error) {
+	if _, err := p.GetWebhook(ctx, userId, webhookId); err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT ` + deliveryColumns + `
+        FROM webhook_deliveries d
+        WHERE d.webhook_id = $1
+        ORDER BY d.id DESC
+        LIMIT $2`
+
+	rows, err := p.db.QueryContext(ctx, query, webhookId, limit)
+	if err != nil {
+		return nil, p.webhookFailed("GetWebhookDeliveries", userId, webhookId, "unable to query deliveries", err)
+	}
+	defer rows.Close()
+
+	list := []types.WebhookDelivery{}
+	for rows.Next() {
+		var delivery types.WebhookDelivery
+		if err := scanDelivery(rows, &delivery); err != nil {
+			return nil, p.webhookFailed("GetWebhookDeliveries", userId, webhookId, "unable to scan row", err)
+		}
+		list = append(list, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.webhookFailed("GetWebhookDeliveries", userId, webhookId, "row iteration error", err)
+	}
+
+	return list, nil
+}
+
+// RedeliverWebhook sends the payload of an earlier delivery to its webhook again, as a new delivery.
+func (p *Postgres) RedeliverWebhook(ctx context.Context, userId, webhookId, deliveryId string) (types.WebhookDelivery, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.WebhookDelivery{}, p.webhookFailed("RedeliverWebhook", userId, webhookId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO webhook_deliveries AS d (webhook_id, event, payload, redelivery_of)
+        SELECT original.webhook_id, original.event, original.payload, original.id
+        FROM webhook_deliveries original
+        JOIN webhooks w ON w.id = original.webhook_id
+        WHERE original.id = $1 AND original.webhook_id = $2 AND w.user_id = $3
+        RETURNING ` + deliveryColumns + `, (SELECT active FROM webhooks WHERE webhooks.id = d.webhook_id)`
+
+	var created types.WebhookDelivery
+	var active bool
+	err = scanDelivery(tx.QueryRowContext(ctx, query, deliveryId, webhookId, userId), &created, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.WebhookDelivery{}, fmt.Errorf("unable to redeliver: %w", ErrDeliveryNotFound)
+	}
+	if err != nil {
+		return types.WebhookDelivery{}, p.webhookFailed("RedeliverWebhook", userId, webhookId, "unable to redeliver", err)
+	}
+	if !active {
+		return types.WebhookDelivery{}, fmt.Errorf("unable to redeliver: %w", ErrWebhookDisabled)
+	}
+
+	job := types.JobDto{Kind: types.JobWebhookDelivery, Payload: map[string]string{"deliveryId": created.ID}, MaxAttempts: deliveryAttempts}
+	if _, err := enqueueJob(ctx, tx, job); err != nil {
+		return types.WebhookDelivery{}, p.webhookFailed("RedeliverWebhook", userId, webhookId, "unable to queue delivery", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.WebhookDelivery{}, p.webhookFailed("RedeliverWebhook", userId, webhookId, "unable to redeliver", err)
+	}
+
+	p.logger.Info("webhook redelivery queued",
+		zap.String("userId", userId),
+		zap.String("webhookId", webhookId),
+		zap.String("deliveryId", created.ID),
+		zap.String("redeliveryOf", deliveryId))
+	return created, nil
+}
+
+// GetWebhookTarget returns a delivery along with where and how to send it.
+func (p *Postgres) GetWebhookTarget(ctx context.Context, deliveryId string) (types.WebhookTarget, error) {
+	query := `
+        SELECT ` + deliveryColumns + `, w.url, w.secret, w.active
+        FROM webhook_deliveries d
+        JOIN webhooks w ON w.id = d.webhook_id
+        WHERE d.id = $1`
+
+	var target types.WebhookTarget
+	err := scanDelivery(p.db.QueryRowContext(ctx, query, deliveryId), &target.Delivery, &target.URL, &target.Secret, &target.Active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.WebhookTarget{}, fmt.Errorf("unable to get delivery: %w", ErrDeliveryNotFound)
+	}
+	if err != nil {
+		return types.WebhookTarget{}, p.webhookFailed("GetWebhookTarget", "", "", "unable to get delivery", err)
+	}
+	return target, nil
+}
+
+// RecordDeliveryAttempt records the outcome of an attempt at a delivery and keeps count of the failures of its
+// webhook, which is disabled once disableAfter attempts in a row have failed. It reports whether the webhook was
+// disabled by this attempt. Attempts made while the webhook is disabled do not count.
+func (p *Postgres) RecordDeliveryAttempt(ctx context.Context, deliveryId string, attempt types.DeliveryAttempt, disableAfter int) (bool, error) {
+	status := types.DeliveryPending
+	switch {
+	case attempt.Succeeded:
+		status = types.DeliverySucceeded
+	case attempt.Final:
+		status = types.DeliveryFailed
+	}
+
+	query := `
+        WITH delivery AS (
+            UPDATE webhook_deliveries
+            SET status = $2, attempts = attempts + 1, response_status = NULLIF($3, 0), response_body = NULLIF($4, ''),
+                error = NULLIF($5, ''), duration_ms = $6, attempted_at = NOW()
+            WHERE id = $1
+            RETURNING webhook_id)
+        UPDATE webhooks w
+        SET consecutive_failures = CASE WHEN $7 THEN 0 ELSE w.consecutive_failures + 1 END,
+            active = $7 OR w.consecutive_failures + 1 < $8,
+            disabled_at = CASE WHEN $7 OR w.consecutive_failures + 1 < $8 THEN NULL ELSE NOW() END
+        FROM delivery
+        WHERE w.id = delivery.webhook_id AND w.active
+        RETURNING w.id, w.active`
+
+	var webhookId string
+	var active bool
+	err := p.db.QueryRowContext(ctx, query, deliveryId, status, attempt.ResponseStatus, attempt.ResponseBody, attempt.Error,
+		attempt.Duration.Milliseconds(), attempt.Succeeded, disableAfter).Scan(&webhookId, &active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, p.webhookFailed("RecordDeliveryAttempt", "", "", "unable to record delivery attempt", err)
+	}
+
+	if active {
+		return false, nil
+	}
+
+	p.logger.Warn("webhook disabled after repeated failures", zap.String("webhookId", webhookId), zap.Int("failures", disableAfter))
+	// The delivery is not tried again, as the webhook is disabled.
+	if _, err := p.db.ExecContext(ctx, `UPDATE webhook_deliveries SET status = 'failed' WHERE id = $1 AND status = 'pending'`, deliveryId); err != nil {
+		return true, p.webhookFailed("RecordDeliveryAttempt", "", webhookId, "unable to record delivery attempt", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,484 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+var ErrWorkspaceNotFound = errors.New("could not find workspace")
+var ErrMemberNotFound = errors.New("could not find workspace member")
+var ErrInvitationNotFound = errors.New("could not find invitation")
+var ErrAlreadyMember = errors.New("user is already a member of the workspace")
+var ErrLastOwner = errors.New("a workspace must keep at least one owner")
+var _ services.WorkspaceStore = &Postgres{}
+
+const memberColumns = "workspace_id, user_id, username, role, created_at"
+
+func scanMember(row rowScanner, member *types.WorkspaceMember) error {
+	return row.Scan(&member.WorkspaceId, &member.UserId, &member.Username, &member.Role, &member.CreatedAt)
+}
+
+const invitationColumns = "i.id, i.workspace_id, w.name, i.user_id, i.username, i.role, i.invited_by, i.created_at"
+
+func scanInvitation(row rowScanner, invitation *types.WorkspaceInvitation) error {
+	return row.Scan(&invitation.ID, &invitation.WorkspaceId, &invitation.WorkspaceName, &invitation.UserId, &invitation.Username,
+		&invitation.Role, &invitation.InvitedBy, &invitation.CreatedAt)
+}
+
+// isWorkspaceOwner is a condition holding when the user bound to param owns the workspace whose id is bound to
+// workspace.
+func isWorkspaceOwner(workspace, param string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM workspace_members o WHERE o.workspace_id = %s AND o.user_id = %s AND o.role = 'owner')`,
+		workspace, param)
+}
+
+func (p *Postgres) workspaceFailed(operation, userId, workspaceId, msg string, err error) error {
+	p.logger.Error(msg,
+		zap.String("operation_name", operation),
+		zap.Error(err),
+		zap.String("userId", userId),
+		zap.String("workspaceId", workspaceId),
+	)
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// CreateWorkspace creates a workspace with userId as its first owner.
+func (p *Postgres) CreateWorkspace(ctx context.Context, userId, name string) (types.Workspace, error) {
+	if userId == "" || name == "" {
+		p.logger.Error("userId and name must be provided", zap.Error(ErrParameterNotProvided), zap.String("userId", userId))
+		return types.Workspace{}, fmt.Errorf("userId and name must be provided: %w", ErrParameterNotProvided)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Workspace{}, p.workspaceFailed("CreateWorkspace", userId, "", "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	workspace := types.Workspace{Name: name, Role: types.PermissionOwner}
+	err = tx.QueryRowContext(ctx, `INSERT INTO workspaces (name, created_by) VALUES ($1, $2) RETURNING id, created_at`, name, userId).
+		Scan(&workspace.ID, &workspace.CreatedAt)
+	if err != nil {
+		return types.Workspace{}, p.workspaceFailed("CreateWorkspace", userId, "", "unable to create workspace", err)
+	}
+
+	insert := `INSERT INTO workspace_members (workspace_id, user_id, role) VALUES ($1, $2, 'owner')`
+	if _, err := tx.ExecContext(ctx, insert, workspace.ID, userId); err != nil {
+		return types.Workspace{}, p.workspaceFailed("CreateWorkspace", userId, workspace.ID, "unable to add workspace owner", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.Workspace{}, p.workspaceFailed("CreateWorkspace", userId, workspace.ID, "unable to create workspace", err)
+	}
+
+	p.logger.Info("workspace created", zap.String("userId", userId), zap.String("workspaceId", workspace.ID))
+
+	return workspace, nil
+}
+
+// GetWorkspaces lists the workspaces userId is a member of, along with their role in each.
+func (p *Postgres) GetWorkspaces(ctx context.Context, userId string) ([]types.Workspace, error) {
+	query := `
+        SELECT w.id, w.name, wm.role, w.created_at
+        FROM workspaces w
+        JOIN workspace_members wm ON wm.workspace_id = w.id
+        WHERE wm.user_id = $1
+        ORDER BY w.name, w.id`
+
+	rows, err := p.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, p.workspaceFailed("GetWorkspaces", userId, "", "unable to query workspaces", err)
+	}
+	defer rows.Close()
+
+	workspaces := []types.Workspace{}
+	for rows.Next() {
+		var workspace types.Workspace
+		if err := rows.Scan(&workspace.ID, &workspace.Name, &workspace.Role, &workspace.CreatedAt); err != nil {
+			return nil, p.workspaceFailed("GetWorkspaces", userId, "", "unable to scan row", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.workspaceFailed("GetWorkspaces", userId, "", "row iteration error", err)
+	}
+
+	return workspaces, nil
+}
+
+// GetWorkspace returns a workspace along with the role userId has in it. Workspaces the user is not a member of are
+// reported as not found.
+func (p *Postgres) GetWorkspace(ctx context.Context, userId, workspaceId string) (types.Workspace, error) {
+	query := `
+        SELECT w.id, w.name, wm.role, w.created_at
+        FROM workspaces w
+        JOIN workspace_members wm ON wm.workspace_id = w.id
+        WHERE w.id = $1 AND wm.user_id = $2`
+
+	var workspace types.Workspace
+	err := p.db.QueryRowContext(ctx, query, workspaceId, userId).Scan(&workspace.ID, &workspace.Name, &workspace.Role, &workspace.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Workspace{}, fmt.Errorf("unable to get workspace: %w", ErrWorkspaceNotFound)
+		}
+		return types.Workspace{}, p.workspaceFailed("GetWorkspace", userId, workspaceId, "unable to get workspace", err)
+	}
+
+	return workspace, nil
+}
+
+// DeleteWorkspace deletes a workspace owned by userId, together with all of its notes.
+func (p *Postgres) DeleteWorkspace(ctx context.Context, userId, workspaceId string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	// The members are returned for the cache to forget the notes they could read.
+	query := `
+        SELECT ARRAY(SELECT user_id FROM workspace_members WHERE workspace_id = $1)
+        FROM workspaces
+        WHERE id = $1 AND ` + isWorkspaceOwner("workspaces.id", "$2") + `
+        FOR UPDATE`
+
+	var members []string
+	err = tx.QueryRowContext(ctx, query, workspaceId, userId).Scan(pq.Array(&members))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("unable to delete workspace: %w", ErrWorkspaceNotFound)
+	}
+	if err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "failed to lock workspace", err)
+	}
+
+	// The notes are deleted one by one rather than left to the cascade, so that webhooks are sent what was deleted.
+	rows, err := tx.QueryContext(ctx, `SELECT `+noteColumns+` FROM notes WHERE workspace_id = $1 ORDER BY id FOR UPDATE`, workspaceId)
+	if err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "unable to query workspace notes", err)
+	}
+	var deleted []types.Note
+	for rows.Next() {
+		var note types.Note
+		if err := scanNote(rows, &note); err != nil {
+			rows.Close()
+			return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "unable to scan row", err)
+		}
+		deleted = append(deleted, note)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "row iteration error", err)
+	}
+
+	for _, note := range deleted {
+		if err := queueNoteEvent(ctx, tx, types.EventNoteDeleted, note); err != nil {
+			return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "unable to queue note event", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM notes WHERE workspace_id = $1`, workspaceId); err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "failed to delete workspace notes", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM workspaces WHERE id = $1`, workspaceId); err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "failed to delete workspace", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return p.workspaceFailed("DeleteWorkspace", userId, workspaceId, "unable to commit transaction", err)
+	}
+	p.notesChanged(ctx, members, "", workspaceId)
+
+	p.logger.Info("workspace deleted", zap.String("userId", userId), zap.String("workspaceId", workspaceId),
+		zap.Int("notes", len(deleted)))
+
+	return nil
+}
+
+// GetWorkspaceMembers lists the members of a workspace userId belongs to.
+func (p *Postgres) GetWorkspaceMembers(ctx context.Context, userId, workspaceId string) ([]types.WorkspaceMember, error) {
+	query := `
+        SELECT ` + memberColumns + `
+        FROM workspace_members
+        WHERE workspace_id = $1
+            AND EXISTS (SELECT 1 FROM workspace_members me WHERE me.workspace_id = $1 AND me.user_id = $2)
+        ORDER BY created_at, user_id`
+
+	rows, err := p.db.QueryContext(ctx, query, workspaceId, userId)
+	if err != nil {
+		return nil, p.workspaceFailed("GetWorkspaceMembers", userId, workspaceId, "unable to query workspace members", err)
+	}
+	defer rows.Close()
+
+	members := []types.WorkspaceMember{}
+	for rows.Next() {
+		var member types.WorkspaceMember
+		if err := scanMember(rows, &member); err != nil {
+			return nil, p.workspaceFailed("GetWorkspaceMembers", userId, workspaceId, "unable to scan row", err)
+		}
+		members = append(members, member)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.workspaceFailed("GetWorkspaceMembers", userId, workspaceId, "row iteration error", err)
+	}
+
+	return members, nil
+}
+
+// InviteToWorkspace invites a user to a workspace owned by userId. Inviting a user again replaces the role they are
+// invited with.
+func (p *Postgres) InviteToWorkspace(ctx context.Context, userId, workspaceId string, invitation types.WorkspaceInvitation) (types.WorkspaceInvitation, error) {
+	if userId == "" || workspaceId == "" || invitation.UserId == "" || invitation.Role == "" {
+		p.logger.Error("userId, workspaceId, invitee and role must be provided", zap.Error(ErrParameterNotProvided),
+			zap.String("userId", userId),
+			zap.String("workspaceId", workspaceId))
+
+		return types.WorkspaceInvitation{}, fmt.Errorf("userId, workspaceId, invitee and role must be provided: %w", ErrParameterNotProvided)
+	}
+
+	var member bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = $1 AND user_id = $2)`,
+		workspaceId, invitation.UserId).Scan(&member)
+	if err != nil {
+		return types.WorkspaceInvitation{}, p.workspaceFailed("InviteToWorkspace", userId, workspaceId, "unable to check membership", err)
+	}
+	if member {
+		return types.WorkspaceInvitation{}, fmt.Errorf("unable to invite user: %w", ErrAlreadyMember)
+	}
+
+	query := `
+        WITH invited AS (
+            INSERT INTO workspace_invitations (workspace_id, user_id, username, role, invited_by)
+            SELECT w.id, $3, $4, $5, $2 FROM workspaces w WHERE w.id = $1 AND ` + isWorkspaceOwner("w.id", "$2") + `
+            ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role, invited_by = EXCLUDED.invited_by
+            RETURNING *
+        )
+        SELECT ` + invitationColumns + `
+        FROM invited i
+        JOIN workspaces w ON w.id = i.workspace_id`
+
+	var created types.WorkspaceInvitation
+	err = scanInvitation(p.db.QueryRowContext(ctx, query, workspaceId, userId, invitation.UserId, invitation.Username, invitation.Role), &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.WorkspaceInvitation{}, fmt.Errorf("unable to invite user: %w", ErrWorkspaceNotFound)
+		}
+		return types.WorkspaceInvitation{}, p.workspaceFailed("InviteToWorkspace", userId, workspaceId, "unable to invite user", err)
+	}
+
+	p.logger.Info("user invited to workspace",
+		zap.String("userId", userId),
+		zap.String("workspaceId", workspaceId),
+		zap.String("inviteeId", invitation.UserId),
+		zap.String("role", invitation.Role))
+
+	return created, nil
+}
+
+// GetInvitations lists the pending invitations addressed to userId.
+func (p *Postgres) GetInvitations(ctx context.Context, userId string) ([]types.WorkspaceInvitation, error) {
+	query := `
+        SELECT ` + invitationColumns + `
+        FROM workspace_invitations i
+        JOIN workspaces w ON w.id = i.workspace_id
+        WHERE i.user_id = $1
+        ORDER BY i.created_at, i.id`
+
+	rows, err := p.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, p.workspaceFailed("GetInvitations", userId, "", "unable to query invitations", err)
+	}
+	defer rows.Close()
+
+	invitations := []types.WorkspaceInvitation{}
+	for rows.Next() {
+		var invitation types.WorkspaceInvitation
+		if err := scanInvitation(rows, &invitation); err != nil {
+			return nil, p.workspaceFailed("GetInvitations", userId, "", "unable to scan row", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, p.workspaceFailed("GetInvitations", userId, "", "row iteration error", err)
+	}
+
+	return invitations, nil
+}
+
+// AcceptInvitation turns an invitation addressed to userId into a membership of the workspace.
+func (p *Postgres) AcceptInvitation(ctx context.Context, userId, invitationId string) (types.WorkspaceMember, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.WorkspaceMember{}, p.workspaceFailed("AcceptInvitation", userId, "", "unable to start transaction", err)
+	}
+	defer tx.Rollback()
+
+	var workspaceId, username, role string
+	err = tx.QueryRowContext(ctx, `DELETE FROM workspace_invitations WHERE id = $1 AND user_id = $2 RETURNING workspace_id, username, role`,
+		invitationId, userId).Scan(&workspaceId, &username, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.WorkspaceMember{}, fmt.Errorf("unable to accept invitation: %w", ErrInvitationNotFound)
+		}
+		return types.WorkspaceMember{}, p.workspaceFailed("AcceptInvitation", userId, "", "unable to accept invitation", err)
+	}
+
+	query := `
+        INSERT INTO workspace_members (workspace_id, user_id, username, role)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (workspace_id, user_id) DO UPDATE SET username = EXCLUDED.username
+        RETURNING ` + memberColumns
+
+	var member types.WorkspaceMember
+	if err := scanMember(tx.QueryRowContext(ctx, query, workspaceId, userId, username, role), &member); err != nil {
+		return types.WorkspaceMember{}, p.workspaceFailed("AcceptInvitation", userId, workspaceId, "unable to add workspace member", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.WorkspaceMember{}, p.workspaceFailed("AcceptInvitation", userId, workspaceId, "unable to accept invitation", err)
+	}
+	p.notesChanged(ctx, []string{userId}, "", workspaceId)
+
+	p.logger.Info("workspace invitation accepted", zap.String("userId", userId), zap.String("workspaceId", workspaceId))
+
+	return member, nil
+}
+
+// DeclineInvitation drops an invitation addressed to userId.
+func (p *Postgres) DeclineInvitation(ctx context.Context, userId, invitationId string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM workspace_invitations WHERE id = $1 AND user_id = $2`, invitationId, userId)
+	if err != nil {
+		return p.workspaceFailed("DeclineInvitation", userId, "", "unable to decline invitation", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected after declining invitation: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unable to decline invitation: %w", ErrInvitationNotFound)
+	}
+
+	return nil
+}
+
+// UpdateMemberRole changes the role of a member of a workspace owned by userId.
+func (p *Postgres) UpdateMemberRole(ctx context.Context, userId, workspaceId, memberId, role string) (types.WorkspaceMember, error) {
+	tx, err := p.lockWorkspace(ctx, userId, workspaceId, "UpdateMemberRole")
+	if err != nil {
+		return types.WorkspaceMember{}, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        UPDATE workspace_members SET role = $1
+        WHERE workspace_id = $2 AND user_id = $3 AND ` + isWorkspaceOwner("$2", "$4") + `
+        RETURNING ` + memberColumns
+
+	var member types.WorkspaceMember
+	if err := scanMember(tx.QueryRowContext(ctx, query, role, workspaceId, memberId, userId), &member); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.WorkspaceMember{}, fmt.Errorf("unable to update member: %w", ErrMemberNotFound)
+		}
+		return types.WorkspaceMember{}, p.workspaceFailed("UpdateMemberRole", userId, workspaceId, "unable to update member", err)
+	}
+
+	if err := p.checkOwnersLeft(ctx, tx, userId, workspaceId, "UpdateMemberRole"); err != nil {
+		return types.WorkspaceMember{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return types.WorkspaceMember{}, p.workspaceFailed("UpdateMemberRole", userId, workspaceId, "unable to update member", err)
+	}
+	p.notesChanged(ctx, []string{memberId}, "", workspaceId)
+
+	p.logger.Info("workspace member role changed",
+		zap.String("userId", userId),
+		zap.String("workspaceId", workspaceId),
+		zap.String("memberId", memberId),
+		zap.String("role", role))
+
+	return member, nil
+}
+
+// RemoveMember removes a member from a workspace. Owners can remove anyone, and every member can leave.
+func (p *Postgres) RemoveMember(ctx context.Context, userId, workspaceId, memberId string) error {
+	tx, err := p.lockWorkspace(ctx, userId, workspaceId, "RemoveMember")
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        DELETE FROM workspace_members
+        WHERE workspace_id = $1 AND user_id = $2 AND ($2 = $3 OR ` + isWorkspaceOwner("$1", "$3") + `)`
+
+	res, err := tx.ExecContext(ctx, query, workspaceId, memberId, userId)
+	if err != nil {
+		return p.workspaceFailed("RemoveMember", userId, workspaceId, "unable to remove member", err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not check rows affected after removing member: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("unable to remove member: %w", ErrMemberNotFound)
+	}
+
+	if err := p.checkOwnersLeft(ctx, tx, userId, workspaceId, "RemoveMember"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return p.workspaceFailed("RemoveMember", userId, workspaceId, "unable to remove member", err)
+	}
+	p.notesChanged(ctx, []string{memberId}, "", workspaceId)
+
+	p.logger.Info("workspace member removed",
+		zap.String("userId", userId),
+		zap.String("workspaceId", workspaceId),
+		zap.String("memberId", memberId))
+
+	return nil
+}
+
+// lockWorkspace starts a transaction holding a lock on the workspace, so that concurrent membership changes cannot
+// together remove its last owner.
+func (p *Postgres) lockWorkspace(ctx context.Context, userId, workspaceId, operation string) (*sql.Tx, error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, p.workspaceFailed(operation, userId, workspaceId, "unable to start transaction", err)
+	}
+
+	var id string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM workspaces WHERE id = $1 FOR UPDATE`, workspaceId).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("unable to lock workspace: %w", ErrWorkspaceNotFound)
+		}
+		return nil, p.workspaceFailed(operation, userId, workspaceId, "unable to lock workspace", err)
+	}
+
+	return tx, nil
+}
+
+func (p *Postgres) checkOwnersLeft(ctx context.Context, tx *sql.Tx, userId, workspaceId, operation string) error {
+	var owners int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM workspace_members WHERE workspace_id = $1 AND role = 'owner'`, workspaceId).Scan(&owners)
+	if err != nil {
+		return p.workspaceFailed(operation, userId, workspaceId, "unable to count workspace owners", err)
+	}
+	if owners == 0 {
+		return fmt.Errorf("unable to change workspace members: %w", ErrLastOwner)
+	}
+	return nil
+}
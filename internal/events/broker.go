@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"go.uber.org/zap"
+)
+
+const (
+	// retryDelay is how long the broker waits before listening again after failing to.
+	retryDelay = 5 * time.Second
+	// pruneInterval is how often the events older than the retention period are deleted from the log.
+	pruneInterval = time.Hour
+)
+
+// Broker wakes the event streams of users as their events are logged, on this replica or any other. It also keeps the
+// event log short, so that it only holds enough for clients to resume after a dropped connection.
+type Broker struct {
+	store     services.NoteEventStore
+	retention time.Duration
+	logger    *zap.Logger
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+var _ services.EventBroker = &Broker{}
+
+func NewBroker(store services.NoteEventStore, retention time.Duration, logger *zap.Logger) *Broker {
+	return &Broker{
+		store:       store,
+		retention:   retention,
+		logger:      logger,
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe returns a channel that is signalled whenever new events may have been logged for the user, and a function
+// to stop. Signals are merged while the subscriber is busy, so it must read every event logged since it last looked.
+func (b *Broker) Subscribe(userId string) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.subscribers[userId] == nil {
+		b.subscribers[userId] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[userId][wake] = struct{}{}
+	b.mu.Unlock()
+
+	return wake, func() {
+		b.mu.Lock()
+		delete(b.subscribers[userId], wake)
+		if len(b.subscribers[userId]) == 0 {
+			delete(b.subscribers, userId)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// notify wakes the subscribers of a user, or of every user when userId is empty.
+func (b *Broker) notify(userId string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for user, subscribers := range b.subscribers {
+		if userId != "" && user != userId {
+			continue
+		}
+		for wake := range subscribers {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// Run listens for events and prunes the log until ctx is cancelled.
+func (b *Broker) Run(ctx context.Context) {
+	go b.prune(ctx)
+
+	for {
+		if err := b.store.ListenNoteEvents(ctx, b.notify); err != nil {
+			b.logger.Error("unable to listen for note events", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryDelay):
+			// Events may have been logged while nobody was listening.
+			b.notify("")
+		}
+	}
+}
+
+func (b *Broker) prune(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := b.store.PruneNoteEvents(ctx, time.Now().Add(-b.retention))
+		if err != nil {
+			if ctx.Err() == nil {
+				b.logger.Warn("unable to prune note events", zap.Error(err))
+			}
+			continue
+		}
+		if pruned > 0 {
+			b.logger.Info("pruned note events", zap.Int64("count", pruned))
+		}
+	}
+}
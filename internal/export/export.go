@@ -0,0 +1,39 @@
+// Package export writes notes out in formats meant to be read outside the service. Every format is written one note at
+// a time, so that an export can be streamed to the client while the notes are still being read.
+package export
+
+import (
+	"errors"
+	"io"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes notes to an export. Close finishes the export but does not close the underlying writer.
+type Writer interface {
+	Write(note types.ExportedNote) error
+	Close() error
+}
+
+type format struct {
+	contentType string
+	extension   string
+	new         func(io.Writer) Writer
+}
+
+var formats = map[string]format{
+	types.ExportJSONLines: {"application/x-ndjson", "jsonl", newJSONLines},
+	types.ExportMarkdown:  {"application/zip", "zip", newMarkdown},
+	types.ExportHTML:      {"text/html; charset=utf-8", "html", newHTML},
+}
+
+// New returns a Writer for the named format, along with the content type and file extension of what it writes.
+func New(name string, w io.Writer) (writer Writer, contentType, extension string, err error) {
+	f, ok := formats[name]
+	if !ok {
+		return nil, "", "", ErrUnknownFormat
+	}
+	return f.new(w), f.contentType, f.extension, nil
+}
@@ -0,0 +1,111 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/render"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// htmlHeader opens the export document. The styles are inlined so that the file can be opened on its own, without
+// anything else to fetch.
+const htmlHeader = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Notes</title>
+<style>
+body { font-family: system-ui, sans-serif; line-height: 1.5; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+article { border: 1px solid #ddd; border-radius: 6px; padding: 0 1rem 1rem; margin-bottom: 1.5rem; }
+article h2 { margin-bottom: 0.25rem; }
+.meta { color: #666; font-size: 0.85rem; margin-top: 0; }
+.checklist { list-style: none; padding-left: 0; }
+pre { background: #f5f5f5; padding: 0.75rem; overflow-x: auto; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: 0.25rem 0.5rem; }
+</style>
+</head>
+<body>
+<h1>Notes</h1>
+`
+
+const htmlFooter = `</body>
+</html>
+`
+
+// htmlDocument writes a single HTML document holding every note as an article, with its content rendered the way
+// GetSingleNote renders it.
+type htmlDocument struct {
+	w       io.Writer
+	started bool
+}
+
+func newHTML(w io.Writer) Writer {
+	return &htmlDocument{w: w}
+}
+
+func (h *htmlDocument) start() error {
+	if h.started {
+		return nil
+	}
+	h.started = true
+	_, err := io.WriteString(h.w, htmlHeader)
+	return err
+}
+
+func (h *htmlDocument) Write(note types.ExportedNote) error {
+	if err := h.start(); err != nil {
+		return err
+	}
+
+	content, err := render.HTML(note.Content, note.Format)
+	if err != nil {
+		return fmt.Errorf("unable to render note %s: %w", note.ID, err)
+	}
+
+	meta := "Created " + note.CreatedAt.UTC().Format(time.RFC1123) + " · updated " + note.UpdatedAt.UTC().Format(time.RFC1123)
+	if note.Pinned {
+		meta += " · pinned"
+	}
+	if note.Archived {
+		meta += " · archived"
+	}
+
+	if _, err := fmt.Fprintf(h.w, "<article id=\"note-%s\">\n<h2>%s</h2>\n<p class=\"meta\">%s</p>\n%s",
+		html.EscapeString(note.ID), html.EscapeString(note.Title), html.EscapeString(meta), content); err != nil {
+		return err
+	}
+
+	if len(note.Items) > 0 {
+		if _, err := io.WriteString(h.w, "<ul class=\"checklist\">\n"); err != nil {
+			return err
+		}
+		for _, item := range note.Items {
+			checked := ""
+			if item.Checked {
+				checked = " checked"
+			}
+			if _, err := fmt.Fprintf(h.w, "<li><input type=\"checkbox\" disabled%s> %s</li>\n", checked, html.EscapeString(item.Text)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(h.w, "</ul>\n"); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(h.w, "</article>\n")
+	return err
+}
+
+func (h *htmlDocument) Close() error {
+	if err := h.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(h.w, htmlFooter)
+	return err
+}
@@ -0,0 +1,27 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// jsonLines writes every note as a JSON object on a line of its own.
+type jsonLines struct {
+	enc *json.Encoder
+}
+
+func newJSONLines(w io.Writer) Writer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonLines{enc: enc}
+}
+
+func (j *jsonLines) Write(note types.ExportedNote) error {
+	return j.enc.Encode(note)
+}
+
+func (j *jsonLines) Close() error {
+	return nil
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// maxFilenameLen bounds the part of a file name taken from the title of a note, in bytes.
+const maxFilenameLen = 100
+
+// markdown writes a ZIP archive holding a Markdown file per note. Each file starts with YAML front matter describing
+// the note, followed by its content and, for checklists, its items as a task list.
+type markdown struct {
+	zw *zip.Writer
+	// names holds the file names used so far, as notes with the same title must not overwrite each other.
+	names map[string]bool
+}
+
+func newMarkdown(w io.Writer) Writer {
+	return &markdown{zw: zip.NewWriter(w), names: map[string]bool{}}
+}
+
+func (m *markdown) Write(note types.ExportedNote) error {
+	f, err := m.zw.CreateHeader(&zip.FileHeader{
+		Name:     m.filename(note.Title),
+		Method:   zip.Deflate,
+		Modified: note.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, Markdown(note))
+	return err
+}
+
+func (m *markdown) Close() error {
+	return m.zw.Close()
+}
+
+// filename derives a file name from the title of a note that is safe on every common filesystem and not yet taken.
+func (m *markdown) filename(title string) string {
+	base := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	for len(base) > maxFilenameLen {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	base = strings.Trim(base, ". ")
+	if base == "" {
+		base = "Untitled"
+	}
+
+	name := base + ".md"
+	for i := 2; m.names[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d).md", base, i)
+	}
+	m.names[strings.ToLower(name)] = true
+	return name
+}
+
+// Markdown returns a note as a Markdown document with YAML front matter. Strings are written as JSON strings, which
+// YAML reads as double-quoted scalars. The colour label of a note is its only tag.
+func Markdown(note types.ExportedNote) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", quote(note.ID))
+	fmt.Fprintf(&b, "title: %s\n", quote(note.Title))
+	fmt.Fprintf(&b, "archived: %t\n", note.Archived)
+	fmt.Fprintf(&b, "pinned: %t\n", note.Pinned)
+	if note.Color != "" && note.Color != types.DefaultNoteColor {
+		fmt.Fprintf(&b, "tags: [%s]\n", quote(note.Color))
+	} else {
+		b.WriteString("tags: []\n")
+	}
+	fmt.Fprintf(&b, "kind: %s\n", note.Kind)
+	fmt.Fprintf(&b, "format: %s\n", note.Format)
+	fmt.Fprintf(&b, "created: %s\n", note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated: %s\n", note.UpdatedAt.UTC().Format(time.RFC3339))
+	b.WriteString("---\n\n")
+
+	if note.Content != "" {
+		b.WriteString(note.Content)
+		if !strings.HasSuffix(note.Content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	if len(note.Items) > 0 {
+		if note.Content != "" {
+			b.WriteString("\n")
+		}
+		for _, item := range note.Items {
+			check := " "
+			if item.Checked {
+				check = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] %s\n", check, strings.ReplaceAll(item.Text, "\n", " "))
+		}
+	}
+	return b.String()
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
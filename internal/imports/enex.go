@@ -0,0 +1,209 @@
+package imports
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// enexTime is how ENEX files write timestamps.
+const enexTime = "20060102T150405Z"
+
+// enexNote is a note in an Evernote ENEX export. Its content is ENML, a subset of XHTML.
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+// blockElements start on a line of their own when ENML is turned into text.
+var blockElements = map[string]bool{
+	"div": true, "p": true, "br": true, "li": true, "tr": true, "hr": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "table": true, "ul": true, "ol": true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// enexReader reads the notes of an ENEX file as it goes, so that large exports are never held in memory. The file is
+// read once upfront to count its notes.
+type enexReader struct {
+	total int
+	dec   *xml.Decoder
+	next  int
+}
+
+func newEnexReader(r io.ReaderAt, size int64) (Reader, error) {
+	total, err := countNotes(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return &enexReader{total: total, dec: xml.NewDecoder(io.NewSectionReader(r, 0, size))}, nil
+}
+
+func countNotes(r io.Reader) (int, error) {
+	dec := xml.NewDecoder(r)
+	count := 0
+	for {
+		token, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid ENEX file: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "note" {
+			count++
+		}
+	}
+}
+
+func (e *enexReader) Total() int {
+	return e.total
+}
+
+func (e *enexReader) Next() (Item, error) {
+	for {
+		token, err := e.dec.Token()
+		if err != nil {
+			return Item{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		e.next++
+		var en enexNote
+		if err := e.dec.DecodeElement(&en, &start); err != nil {
+			return Item{}, fmt.Errorf("invalid ENEX file: %w", err)
+		}
+		return enexItem(fmt.Sprintf("note %d", e.next), en), nil
+	}
+}
+
+func enexItem(name string, en enexNote) Item {
+	item := Item{Name: name}
+
+	content, err := enmlText(en.Content)
+	if err != nil {
+		item.Note.Title = en.Title
+		item.Err = fmt.Errorf("invalid note content: %w", err)
+		return item
+	}
+
+	note := types.ImportedNote{
+		Title:     en.Title,
+		Content:   content,
+		CreatedAt: parseEnexTime(en.Created),
+		UpdatedAt: parseEnexTime(en.Updated),
+	}
+	if err := normalize(&note, en.Tags, ""); err != nil {
+		item.Err = err
+	}
+	item.Note = note
+	return item
+}
+
+func parseEnexTime(value string) *time.Time {
+	t, err := time.Parse(enexTime, strings.TrimSpace(value))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// enmlText turns ENML into plain text. Block elements become lines, list items are bulleted, to-do checkboxes become
+// [ ] or [x], and attached files are marked where they were.
+func enmlText(enml string) (string, error) {
+	dec := xml.NewDecoder(strings.NewReader(enml))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+
+	var b strings.Builder
+	newline := func() {
+		if text := b.String(); text != "" && !strings.HasSuffix(text, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	space := func() {
+		if text := b.String(); text != "" && !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\n") {
+			b.WriteString(" ")
+		}
+	}
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			if blockElements[name] {
+				newline()
+			}
+			switch name {
+			case "li":
+				b.WriteString("- ")
+			case "en-todo":
+				if attr(t, "checked") == "true" {
+					b.WriteString("[x] ")
+				} else {
+					b.WriteString("[ ] ")
+				}
+			case "en-media":
+				b.WriteString("[attachment]")
+			}
+		case xml.EndElement:
+			if blockElements[strings.ToLower(t.Name.Local)] {
+				newline()
+			}
+		case xml.CharData:
+			// Runs of whitespace collapse into a single space, as they do when the note is displayed.
+			text := string(t)
+			if text == "" {
+				continue
+			}
+			if first, _ := utf8.DecodeRuneInString(text); unicode.IsSpace(first) {
+				space()
+			}
+			if words := strings.Fields(text); len(words) > 0 {
+				b.WriteString(strings.Join(words, " "))
+				if last, _ := utf8.DecodeLastRuneInString(text); unicode.IsSpace(last) {
+					space()
+				}
+			}
+		}
+	}
+
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"), nil
+}
+
+func attr(start xml.StartElement, name string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
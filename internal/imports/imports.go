@@ -0,0 +1,243 @@
+// Package imports reads notes out of the files other note-taking tools export: folders of Markdown files, Google Keep
+// Takeout archives and Evernote ENEX files.
+package imports
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// The limits on imported notes match the ones on notes created through the API.
+const (
+	maxTitleLen    = 255
+	maxContentLen  = types.MaxNoteContentLen
+	maxItemTextLen = 1000
+	maxItems       = 1000
+	// maxItemSize bounds how much of a single file in an archive is read.
+	maxItemSize = 1 << 20
+)
+
+var ErrUnknownSource = errors.New("unknown import source")
+
+// zipMagic starts every ZIP archive.
+var zipMagic = []byte("PK\x03\x04")
+
+var strict = bluemonday.StrictPolicy()
+
+// Item is an entry of an imported file. Name is where it was found in the file, for reporting. Items that are not
+// imported have Skip or Err set.
+type Item struct {
+	Name string
+	Note types.ImportedNote
+	// Skip is why the item is deliberately left out, such as a note that was in the trash.
+	Skip string
+	Err  error
+}
+
+// Reader reads the items of an imported file in a stable order, so that an import can be resumed by skipping the items
+// it has already dealt with.
+type Reader interface {
+	// Total is the number of items in the file.
+	Total() int
+	// Next returns the next item, or io.EOF once every item has been read. An error means the rest of the file
+	// cannot be read, whereas an item that cannot be made into a note is returned with Err set.
+	Next() (Item, error)
+}
+
+// NewReader reads the items of a file of the given source.
+func NewReader(source string, r io.ReaderAt, size int64) (Reader, error) {
+	switch source {
+	case types.ImportMarkdown:
+		return newMarkdownReader(r, size)
+	case types.ImportKeep:
+		return newKeepReader(r, size)
+	case types.ImportEvernote:
+		return newEnexReader(r, size)
+	}
+	return nil, ErrUnknownSource
+}
+
+// Detect works out the source of an uploaded file from its name and, for ZIP archives, what they hold: Keep Takeout
+// archives hold JSON files, whereas Markdown folders hold .md files.
+func Detect(filename string, r io.ReaderAt, size int64) (string, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".enex":
+		return types.ImportEvernote, nil
+	case ".json":
+		return types.ImportKeep, nil
+	case ".md", ".markdown":
+		return types.ImportMarkdown, nil
+	}
+
+	if !isZip(r) {
+		return "", ErrUnknownSource
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", fmt.Errorf("unable to read archive: %w", err)
+	}
+	markdown := false
+	for _, f := range zr.File {
+		switch {
+		case hidden(f.Name):
+		case strings.EqualFold(path.Ext(f.Name), ".json"):
+			return types.ImportKeep, nil
+		case isMarkdownFile(f.Name):
+			markdown = true
+		}
+	}
+	if markdown {
+		return types.ImportMarkdown, nil
+	}
+	return "", ErrUnknownSource
+}
+
+func isZip(r io.ReaderAt) bool {
+	head := make([]byte, len(zipMagic))
+	n, _ := r.ReadAt(head, 0)
+	return bytes.Equal(head[:n], zipMagic)
+}
+
+// hidden reports whether a file in an archive is metadata added by the system rather than content, such as the
+// __MACOSX folder or dot files.
+func hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// readZipFile reads a file from an archive, refusing files larger than maxItemSize.
+func readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxItemSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxItemSize)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxItemSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxItemSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxItemSize)
+	}
+	return data, nil
+}
+
+// applyLabels carries the labels of a note over. Notes have no labels of their own, so the first label naming a colour
+// becomes the colour label of the note and the others are added to the end of its content as #hashtags.
+func applyLabels(note *types.ImportedNote, labels []string) {
+	var tags []string
+	for _, label := range labels {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if color := strings.ToLower(label); note.Color == "" && types.IsValidNoteColor(color) {
+			note.Color = color
+			continue
+		}
+		tags = append(tags, "#"+strings.Join(strings.Fields(label), "-"))
+	}
+	if len(tags) == 0 {
+		return
+	}
+	if note.Content != "" {
+		note.Content = strings.TrimRight(note.Content, "\n") + "\n\n"
+	}
+	note.Content += strings.Join(tags, " ")
+}
+
+// normalize fills in the defaults of a note read from an import, carries its labels over and checks it stays within
+// the limits on notes. A missing title is taken from the first line of the content or the first checklist item,
+// failing that from fallback. Titles and checklist items are sanitised as they are for notes created through the API,
+// after undoing any escaping so that notes exported from this service come back unchanged.
+func normalize(note *types.ImportedNote, labels []string, fallback string) error {
+	note.Content = strings.TrimSpace(note.Content)
+
+	title := strings.Join(strings.Fields(note.Title), " ")
+	if title == "" {
+		line, _, _ := strings.Cut(note.Content, "\n")
+		title = strings.Join(strings.Fields(strings.TrimLeft(line, "#")), " ")
+	}
+	if title == "" && len(note.Items) > 0 {
+		title = strings.Join(strings.Fields(note.Items[0].Text), " ")
+	}
+	if title == "" {
+		title = strings.TrimSpace(fallback)
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	note.Title = sanitize(title, maxTitleLen)
+
+	applyLabels(note, labels)
+	if len(note.Content) > maxContentLen {
+		return fmt.Errorf("content length exceeds %d characters", maxContentLen)
+	}
+
+	if len(note.Items) > maxItems {
+		return fmt.Errorf("checklist has more than %d items", maxItems)
+	}
+	items := note.Items[:0]
+	for _, item := range note.Items {
+		item.Text = strings.TrimSpace(item.Text)
+		if item.Text == "" {
+			continue
+		}
+		item.Text = sanitize(item.Text, maxItemTextLen)
+		items = append(items, item)
+	}
+	note.Items = items
+
+	if note.Kind == "" {
+		note.Kind = types.NoteKindText
+		if len(note.Items) > 0 {
+			note.Kind = types.NoteKindChecklist
+		}
+	}
+	if note.Format == "" {
+		note.Format = types.NoteFormatPlain
+	}
+	if note.Color == "" {
+		note.Color = types.DefaultNoteColor
+	}
+	return nil
+}
+
+// sanitize sanitises text and shortens it until the result fits in n bytes, so that no escape sequence is cut short.
+func sanitize(text string, n int) string {
+	text = truncate(html.UnescapeString(text), n)
+	for {
+		clean := strict.Sanitize(text)
+		if len(clean) <= n {
+			return clean
+		}
+		text = truncate(text, len(text)-1)
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	for len(s) > n {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package imports
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// keepNote is a note as exported by Google Takeout, one JSON file per note.
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	IsArchived bool   `json:"isArchived"`
+	IsPinned   bool   `json:"isPinned"`
+	IsTrashed  bool   `json:"isTrashed"`
+	Color      string `json:"color"`
+	Labels     []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+// keepColors maps the Keep colours without an equivalent in the palette of notes onto the closest one.
+var keepColors = map[string]string{
+	"CERULEAN": "blue",
+	"GREY":     "gray",
+}
+
+// keepReader reads a note from every JSON file in a Takeout archive, or from a single JSON file. The images and other
+// files in the archive are left out.
+type keepReader struct {
+	files  []*zip.File
+	single io.Reader
+	next   int
+}
+
+func newKeepReader(r io.ReaderAt, size int64) (Reader, error) {
+	if !isZip(r) {
+		return &keepReader{single: io.NewSectionReader(r, 0, size)}, nil
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archive: %w", err)
+	}
+	k := &keepReader{}
+	for _, f := range zr.File {
+		if !hidden(f.Name) && !strings.HasSuffix(f.Name, "/") && strings.EqualFold(path.Ext(f.Name), ".json") {
+			k.files = append(k.files, f)
+		}
+	}
+	return k, nil
+}
+
+func (k *keepReader) Total() int {
+	if k.single != nil {
+		return 1
+	}
+	return len(k.files)
+}
+
+func (k *keepReader) Next() (Item, error) {
+	if k.next >= k.Total() {
+		return Item{}, io.EOF
+	}
+	k.next++
+
+	if k.single != nil {
+		data, err := io.ReadAll(io.LimitReader(k.single, maxItemSize+1))
+		if err != nil {
+			return Item{}, err
+		}
+		if len(data) > maxItemSize {
+			return Item{Name: "file", Err: fmt.Errorf("file is larger than %d bytes", maxItemSize)}, nil
+		}
+		return keepItem("file", data), nil
+	}
+
+	f := k.files[k.next-1]
+	data, err := readZipFile(f)
+	if err != nil {
+		return Item{Name: f.Name, Err: err}, nil
+	}
+	return keepItem(f.Name, data), nil
+}
+
+func keepItem(name string, data []byte) Item {
+	item := Item{Name: name}
+
+	var kn keepNote
+	if err := json.Unmarshal(data, &kn); err != nil {
+		item.Err = fmt.Errorf("invalid Keep note: %w", err)
+		return item
+	}
+	if kn.IsTrashed {
+		item.Note.Title = kn.Title
+		item.Skip = "the note is in the trash"
+		return item
+	}
+
+	note := types.ImportedNote{
+		Title:     kn.Title,
+		Content:   kn.TextContent,
+		Archived:  kn.IsArchived,
+		Pinned:    kn.IsPinned,
+		CreatedAt: fromUsec(kn.CreatedTimestampUsec),
+		UpdatedAt: fromUsec(kn.UserEditedTimestampUsec),
+	}
+	for _, entry := range kn.ListContent {
+		note.Items = append(note.Items, types.ChecklistItem{Text: entry.Text, Checked: entry.IsChecked})
+	}
+	if kn.ListContent != nil {
+		note.Kind = types.NoteKindChecklist
+	}
+
+	color := keepColors[kn.Color]
+	if color == "" {
+		color = strings.ToLower(kn.Color)
+	}
+	if types.IsValidNoteColor(color) && color != types.DefaultNoteColor {
+		note.Color = color
+	}
+
+	labels := make([]string, 0, len(kn.Labels))
+	for _, label := range kn.Labels {
+		labels = append(labels, label.Name)
+	}
+	stem := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	if err := normalize(&note, labels, stem); err != nil {
+		item.Err = err
+	}
+	item.Note = note
+	return item
+}
+
+func fromUsec(usec int64) *time.Time {
+	if usec <= 0 {
+		return nil
+	}
+	t := time.UnixMicro(usec).UTC()
+	return &t
+}
@@ -0,0 +1,183 @@
+package imports
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"gopkg.in/yaml.v3"
+)
+
+// taskPattern matches an item of a Markdown task list.
+var taskPattern = regexp.MustCompile(`^\s*[-*+] \[([ xX])\] (.*)$`)
+
+// frontMatter is the metadata a Markdown file may start with, as written by the Markdown export and by tools such as
+// Obsidian.
+type frontMatter struct {
+	Title    string     `yaml:"title"`
+	Archived bool       `yaml:"archived"`
+	Pinned   bool       `yaml:"pinned"`
+	Tags     tagList    `yaml:"tags"`
+	Kind     string     `yaml:"kind"`
+	Format   string     `yaml:"format"`
+	Created  *time.Time `yaml:"created"`
+	Updated  *time.Time `yaml:"updated"`
+}
+
+// tagList reads tags written either as a list or as a single comma separated string.
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = strings.FieldsFunc(node.Value, func(r rune) bool { return r == ',' })
+		return nil
+	}
+	var tags []string
+	if err := node.Decode(&tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
+}
+
+// markdownReader reads a note from every Markdown file in a ZIP archive, or from a single Markdown file.
+type markdownReader struct {
+	files []*zip.File
+	// single holds the file when a lone Markdown file was uploaded.
+	single io.Reader
+	next   int
+}
+
+func newMarkdownReader(r io.ReaderAt, size int64) (Reader, error) {
+	if !isZip(r) {
+		return &markdownReader{single: io.NewSectionReader(r, 0, size)}, nil
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archive: %w", err)
+	}
+	m := &markdownReader{}
+	for _, f := range zr.File {
+		if !hidden(f.Name) && isMarkdownFile(f.Name) {
+			m.files = append(m.files, f)
+		}
+	}
+	return m, nil
+}
+
+func isMarkdownFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return !strings.HasSuffix(name, "/") && (ext == ".md" || ext == ".markdown")
+}
+
+func (m *markdownReader) Total() int {
+	if m.single != nil {
+		return 1
+	}
+	return len(m.files)
+}
+
+func (m *markdownReader) Next() (Item, error) {
+	if m.next >= m.Total() {
+		return Item{}, io.EOF
+	}
+	m.next++
+
+	if m.single != nil {
+		data, err := io.ReadAll(io.LimitReader(m.single, maxItemSize+1))
+		if err != nil {
+			return Item{}, err
+		}
+		if len(data) > maxItemSize {
+			return Item{Name: "file", Err: fmt.Errorf("file is larger than %d bytes", maxItemSize)}, nil
+		}
+		return markdownItem("file", "", data), nil
+	}
+
+	f := m.files[m.next-1]
+	data, err := readZipFile(f)
+	if err != nil {
+		return Item{Name: f.Name, Err: err}, nil
+	}
+	stem := strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+	return markdownItem(f.Name, stem, data), nil
+}
+
+// markdownItem makes a note out of a Markdown file. The title comes from the front matter or else the file name. The
+// task list items of a checklist are taken out of its content and become its items.
+func markdownItem(name, stem string, data []byte) Item {
+	item := Item{Name: name}
+
+	meta, body, err := splitFrontMatter(data)
+	if err != nil {
+		item.Err = err
+		return item
+	}
+
+	note := types.ImportedNote{
+		Title:     meta.Title,
+		Content:   body,
+		Format:    types.NoteFormatMarkdown,
+		Archived:  meta.Archived,
+		Pinned:    meta.Pinned,
+		CreatedAt: meta.Created,
+		UpdatedAt: meta.Updated,
+	}
+	if meta.Format == types.NoteFormatPlain {
+		note.Format = meta.Format
+	}
+	if meta.Kind == types.NoteKindChecklist {
+		note.Kind = types.NoteKindChecklist
+		note.Content, note.Items = takeTasks(body)
+	}
+	if note.Title == "" {
+		note.Title = stem
+	}
+
+	if err := normalize(&note, meta.Tags, stem); err != nil {
+		item.Err = err
+	}
+	item.Note = note
+	return item
+}
+
+// splitFrontMatter separates the YAML front matter, if any, from the body of a Markdown file.
+func splitFrontMatter(data []byte) (frontMatter, string, error) {
+	var meta frontMatter
+	text := strings.TrimPrefix(strings.ReplaceAll(string(bytes.ToValidUTF8(data, nil)), "\r\n", "\n"), "\ufeff")
+	if !strings.HasPrefix(text, "---\n") {
+		return meta, text, nil
+	}
+
+	header, body, found := strings.Cut(text[len("---\n"):], "\n---")
+	if !found {
+		return meta, text, nil
+	}
+	if err := yaml.Unmarshal([]byte(header), &meta); err != nil {
+		return meta, "", fmt.Errorf("invalid front matter: %w", err)
+	}
+	// Drop the rest of the closing line.
+	_, body, _ = strings.Cut(body, "\n")
+	return meta, body, nil
+}
+
+// takeTasks splits the task list items out of the body of a checklist note.
+func takeTasks(body string) (string, []types.ChecklistItem) {
+	var items []types.ChecklistItem
+	var rest []string
+	for _, line := range strings.Split(body, "\n") {
+		if match := taskPattern.FindStringSubmatch(line); match != nil {
+			items = append(items, types.ChecklistItem{Text: match[2], Checked: match[1] != " "})
+			continue
+		}
+		rest = append(rest, line)
+	}
+	return strings.Join(rest, "\n"), items
+}
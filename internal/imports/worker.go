@@ -0,0 +1,114 @@
+package imports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/jobs"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// Worker imports the notes of uploaded files. It runs the jobs of kind types.JobImport. Each import carries on from
+// the last item it recorded, so that an import retried after a failure or a restart resumes rather than starting over.
+type Worker struct {
+	store  services.ImportStore
+	blobs  services.BlobStore
+	logger *zap.Logger
+}
+
+func NewWorker(store services.ImportStore, blobs services.BlobStore, logger *zap.Logger) *Worker {
+	return &Worker{
+		store:  store,
+		blobs:  blobs,
+		logger: logger,
+	}
+}
+
+// Run imports the items of an import that have not been dealt with yet. Failures of the store are retried, whereas a
+// file that cannot be read as a whole fails the import; items that cannot be imported are reported and do not stop it.
+func (w *Worker) Run(ctx context.Context, job types.Job, progress jobs.Progress) error {
+	var payload struct {
+		ImportId string `json:"importId"`
+	}
+	if err := jobs.DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	imp, err := w.store.GetImportByID(ctx, payload.ImportId)
+	if err != nil {
+		return err
+	}
+
+	file, err := w.spool(ctx, imp.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	reader, err := NewReader(imp.Source, file, imp.Size)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if reader.Total() != imp.Total {
+		if err := w.store.SetImportTotal(ctx, imp.ID, reader.Total()); err != nil {
+			return err
+		}
+	}
+	progress(imp.Processed, reader.Total())
+
+	for i := 0; ; i++ {
+		item, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			w.logger.Info("import finished", zap.String("importId", imp.ID), zap.String("jobId", job.ID))
+			return nil
+		}
+		if err != nil {
+			return jobs.Permanent(err)
+		}
+		if i < imp.Processed {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		switch {
+		case item.Err != nil:
+			err = w.store.SkipImportItem(ctx, imp.ID, types.ImportItem{Name: item.Name, Title: item.Note.Title, Outcome: types.ImportItemFailed, Reason: item.Err.Error()})
+		case item.Skip != "":
+			err = w.store.SkipImportItem(ctx, imp.ID, types.ImportItem{Name: item.Name, Title: item.Note.Title, Outcome: types.ImportItemSkipped, Reason: item.Skip})
+		default:
+			err = w.store.ImportNote(ctx, imp, item.Name, item.Note)
+		}
+		if err != nil {
+			return err
+		}
+		progress(i+1, reader.Total())
+	}
+}
+
+// spool copies the uploaded file to a temporary file, as reading archives needs random access.
+func (w *Worker) spool(ctx context.Context, key string) (*os.File, error) {
+	blob, err := w.blobs.Open(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open upload: %w", err)
+	}
+	defer blob.Close()
+
+	file, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, blob); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("unable to read upload: %w", err)
+	}
+	return file, nil
+}
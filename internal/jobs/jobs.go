@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// Handler does the work of one kind of job. Returning an error has the job retried later, unless the error is marked
+// with Permanent or the job has run out of attempts. Handlers should stop once ctx is done, which happens when the job
+// is cancelled, when its lease is lost or when the service shuts down.
+type Handler interface {
+	Run(ctx context.Context, job types.Job, progress Progress) error
+}
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(ctx context.Context, job types.Job, progress Progress) error
+
+func (f HandlerFunc) Run(ctx context.Context, job types.Job, progress Progress) error {
+	return f(ctx, job, progress)
+}
+
+// Progress records how far a job has got. It is cheap to call: the latest value is saved with the next heartbeat.
+type Progress func(done, total int)
+
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks an error that trying the job again will not fix, so that the job fails straight away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// DecodePayload decodes the payload of a job into v. A payload that cannot be decoded will not get any better, so the
+// error is permanent.
+func DecodePayload(job types.Job, v interface{}) error {
+	if err := json.Unmarshal(job.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("invalid payload for %s job: %w", job.Kind, err))
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// retryDelay is how long a job waits after its first failed attempt. The delay doubles with each attempt after
+	// that, up to maxRetryDelay.
+	retryDelay    = 30 * time.Second
+	maxRetryDelay = time.Hour
+	// pruneInterval is how often the jobs that finished longer ago than the retention period are deleted.
+	pruneInterval = time.Hour
+)
+
+var (
+	errCancelled = errors.New("job cancelled")
+	errLeaseLost = errors.New("job lease lost")
+)
+
+// Runner runs queued jobs on a pool of workers. Several replicas can each run a Runner: the store hands each job to one
+// of them at a time. A job is held for the length of a lease that the Runner keeps extending while the job runs, so
+// that the jobs of a replica that goes away are picked up again by the others.
+type Runner struct {
+	store     services.JobStore
+	handlers  map[string]Handler
+	workers   int
+	interval  time.Duration
+	lease     time.Duration
+	retention time.Duration
+	logger    *zap.Logger
+}
+
+func NewRunner(store services.JobStore, workers int, interval, lease, retention time.Duration, logger *zap.Logger) *Runner {
+	return &Runner{
+		store:     store,
+		handlers:  make(map[string]Handler),
+		workers:   workers,
+		interval:  interval,
+		lease:     lease,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+// Handle sets the handler for a kind of job. Only the kinds with a handler are claimed, so it must be called before
+// Run.
+func (r *Runner) Handle(kind string, handler Handler) {
+	r.handlers[kind] = handler
+}
+
+// Run claims and runs jobs until ctx is cancelled, then waits for the running jobs to stop. It looks for due jobs every
+// interval, and as soon as a worker is free.
+func (r *Runner) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Each running job sends on finished once it is over. The buffer leaves room for all of them, so that none blocks
+	// after Run has stopped receiving.
+	finished := make(chan struct{}, r.workers)
+	busy := 0
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		if busy < r.workers {
+			claimed, err := r.store.ClaimJobs(ctx, kinds, r.workers-busy, r.lease)
+			if err != nil && ctx.Err() == nil {
+				r.logger.Error("unable to claim jobs", zap.Error(err))
+			}
+			for _, job := range claimed {
+				busy++
+				wg.Add(1)
+				go func(job types.Job) {
+					defer wg.Done()
+					r.run(ctx, job)
+					finished <- struct{}{}
+				}(job)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-finished:
+			busy--
+		case <-ticker.C:
+			r.observeQueue(ctx)
+			if r.retention > 0 && time.Since(lastPrune) >= pruneInterval {
+				r.prune(ctx)
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+// run runs a claimed job and records how it went.
+func (r *Runner) run(ctx context.Context, job types.Job) {
+	logger := r.logger.With(zap.String("jobId", job.ID), zap.String("kind", job.Kind), zap.Int("attempt", job.Attempts))
+	metrics.JobWaitDurationSeconds.WithLabelValues(job.Kind).Observe(time.Since(job.RunAfter).Seconds())
+
+	// The store stays usable while shutting down, so that the outcome of jobs stopped by it is still recorded.
+	storeCtx := context.WithoutCancel(ctx)
+
+	if job.Attempts > job.MaxAttempts {
+		// Every attempt lost its lease, most likely because the job brings the service down.
+		if err := r.store.FailJob(storeCtx, job, types.JobFailed, fmt.Sprintf("gave up after %d attempts", job.MaxAttempts)); err != nil {
+			logger.Error("unable to fail job", zap.Error(err))
+		}
+		metrics.JobRunDurationSeconds.WithLabelValues(job.Kind, "failed").Observe(0)
+		return
+	}
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var latest atomic.Pointer[types.JobProgress]
+	progress := func(done, total int) {
+		latest.Store(&types.JobProgress{Done: done, Total: total})
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		r.heartbeat(jobCtx, job, &latest, cancel, stop, logger)
+	}()
+
+	started := time.Now()
+	err := r.call(jobCtx, job, progress)
+	close(stop)
+	<-stopped
+
+	// Save the final progress, as the last heartbeat may have come before it.
+	if p := latest.Load(); p != nil && context.Cause(jobCtx) == nil {
+		if _, err := r.store.HeartbeatJob(storeCtx, job, r.lease, p); err != nil {
+			logger.Warn("unable to record job progress", zap.Error(err))
+		}
+	}
+
+	outcome := r.record(ctx, storeCtx, job, err, context.Cause(jobCtx), logger)
+	metrics.JobRunDurationSeconds.WithLabelValues(job.Kind, outcome).Observe(time.Since(started).Seconds())
+}
+
+// call runs the handler of a job, turning a panic into an error so that one bad job does not bring the service down.
+func (r *Runner) call(ctx context.Context, job types.Job, progress Progress) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("job panicked: %v", v)
+		}
+	}()
+	return r.handlers[job.Kind].Run(ctx, job, progress)
+}
+
+// heartbeat extends the lease of a running job until stop is closed, saving its progress along the way. The job is
+// stopped through cancel once it has been cancelled or its lease has been lost.
+func (r *Runner) heartbeat(ctx context.Context, job types.Job, latest *atomic.Pointer[types.JobProgress], cancel context.CancelCauseFunc, stop <-chan struct{}, logger *zap.Logger) {
+	// Heartbeats come often enough to notice a cancellation quickly, and to survive a couple of failures before the
+	// lease runs out.
+	every := r.lease / 3
+	if r.interval < every {
+		every = r.interval
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cancelRequested, err := r.store.HeartbeatJob(ctx, job, r.lease, latest.Load())
+		switch {
+		case errors.Is(err, datastore.ErrJobNotFound):
+			logger.Warn("job lease lost, stopping it")
+			cancel(errLeaseLost)
+			return
+		case err != nil:
+			if ctx.Err() == nil {
+				logger.Warn("unable to extend job lease", zap.Error(err))
+			}
+		case cancelRequested:
+			logger.Info("job cancelled, stopping it")
+			cancel(errCancelled)
+			return
+		}
+	}
+}
+
+// record saves the outcome of a job and returns it, for metrics. cause is why the job was stopped, if it was.
+func (r *Runner) record(ctx, storeCtx context.Context, job types.Job, err, cause error, logger *zap.Logger) string {
+	var outcome string
+	var recordErr error
+	switch {
+	case errors.Is(cause, errLeaseLost):
+		// Another attempt has the job now, and records its outcome.
+		return "lost"
+	case err == nil:
+		outcome = types.JobSucceeded
+		recordErr = r.store.CompleteJob(storeCtx, job)
+	case errors.Is(cause, errCancelled):
+		outcome = types.JobCancelled
+		recordErr = r.store.FailJob(storeCtx, job, types.JobCancelled, "")
+	case ctx.Err() != nil:
+		// Shutting down: the job is run again straight away by whichever replica is still up.
+		outcome = "interrupted"
+		recordErr = r.store.RetryJob(storeCtx, job, "interrupted by shutdown", time.Now())
+	case IsPermanent(err) || job.Attempts >= job.MaxAttempts:
+		logger.Warn("job failed", zap.Error(err))
+		outcome = types.JobFailed
+		recordErr = r.store.FailJob(storeCtx, job, types.JobFailed, err.Error())
+	default:
+		delay := backoff(job.Attempts)
+		logger.Warn("job failed, it will be retried", zap.Duration("delay", delay), zap.Error(err))
+		outcome = "retried"
+		recordErr = r.store.RetryJob(storeCtx, job, err.Error(), time.Now().Add(delay))
+	}
+
+	if recordErr != nil {
+		// The job is picked up again once its lease runs out.
+		logger.Error("unable to record job outcome", zap.String("outcome", outcome), zap.Error(recordErr))
+	}
+	return outcome
+}
+
+// backoff is how long a job waits before it is tried again, after failing the given attempt.
+func backoff(attempt int) time.Duration {
+	delay := retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (r *Runner) observeQueue(ctx context.Context) {
+	counts, err := r.store.CountJobs(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Warn("unable to count jobs", zap.Error(err))
+		}
+		return
+	}
+
+	// Kinds without any jobs left are reported as empty rather than keeping their last count.
+	metrics.JobQueueDepth.Reset()
+	for kind := range r.handlers {
+		metrics.JobQueueDepth.WithLabelValues(kind, types.JobQueued).Set(0)
+		metrics.JobQueueDepth.WithLabelValues(kind, types.JobRunning).Set(0)
+	}
+	for _, count := range counts {
+		metrics.JobQueueDepth.WithLabelValues(count.Kind, count.Status).Set(float64(count.Count))
+	}
+}
+
+func (r *Runner) prune(ctx context.Context) {
+	pruned, err := r.store.PruneJobs(ctx, time.Now().Add(-r.retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Warn("unable to prune jobs", zap.Error(err))
+		}
+		return
+	}
+	if pruned > 0 {
+		r.logger.Info("pruned finished jobs", zap.Int64("count", pruned))
+	}
+}
@@ -1,10 +1,13 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"sort"
 	"strings"
 
+	"github.com/RogueAlmond70/code-review-challenge/internal/models"
+	"github.com/RogueAlmond70/code-review-challenge/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -42,4 +45,19 @@ func BasicAuth() gin.HandlerFunc {
 	}
 }
 
-// TODO: review
+// basicAuthUsers looks users up among those BasicAuth accepts, so that a note shared with a user is found under the id
+// set on their requests.
+type basicAuthUsers struct{}
+
+func BasicAuthUsers() services.UserDirectory {
+	return basicAuthUsers{}
+}
+
+func (basicAuthUsers) GetUserByUsername(_ context.Context, username string) (*models.User, error) {
+	for _, u := range users {
+		if u.name == username {
+			return &models.User{UserId: u.id, Username: u.name, Role: "user"}, nil
+		}
+	}
+	return nil, nil
+}
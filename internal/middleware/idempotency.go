@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyStoreOpTimeout = 5 * time.Second
+	// idempotencyLease is how long a key is held for a request at a time. It is renewed while the request runs, so a
+	// retry only takes over the key of a request whose process went away.
+	idempotencyLease = 30 * time.Second
+)
+
+// responseRecorder keeps a copy of everything written to the client so it can be stored against the idempotency key.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Idempotency honours the Idempotency-Key header on mutating endpoints. The first request with a key is executed and
+// its response stored for ttl; a retry with the same key and body receives the stored response, while reusing the key
+// with a different request is rejected with 422. Bodies are read whole to tell requests apart, so they are refused
+// with 413 beyond maxBody bytes. Requests without the header are passed through untouched.
+func Idempotency(store services.IdempotencyStore, ttl time.Duration, maxBody int64, zlog *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		userID := c.GetString("userId")
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBody))
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body is too large"})
+			return
+		}
+		if err != nil {
+			zlog.Warn("unable to read request body", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c.Request, body)
+		existing, reserved, err := store.ReserveIdempotencyKey(c.Request.Context(), types.IdempotencyRecord{
+			UserId:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().Add(ttl),
+			LockedUntil: time.Now().Add(idempotencyLease),
+		})
+		if err != nil {
+			zlog.Error("failed to reserve idempotency key", zap.String("userID", userID), zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			return
+		}
+
+		if !reserved {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				metrics.CountIdempotentRequestsTotal.WithLabelValues("mismatch").Inc()
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key has already been used for a different request"})
+			case existing.StatusCode == 0:
+				metrics.CountIdempotentRequestsTotal.WithLabelValues("in_progress").Inc()
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still being processed"})
+			default:
+				metrics.CountIdempotentRequestsTotal.WithLabelValues("replayed").Inc()
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		metrics.CountIdempotentRequestsTotal.WithLabelValues("executed").Inc()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// The response has already been sent, so the outcome is stored even if the client has gone away.
+		storeCtx := func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.WithoutCancel(c.Request.Context()), idempotencyStoreOpTimeout)
+		}
+		release := func() {
+			ctx, cancel := storeCtx()
+			defer cancel()
+			if err := store.ReleaseIdempotencyKey(ctx, userID, key); err != nil {
+				zlog.Error("failed to release idempotency key", zap.String("userID", userID), zap.Error(err))
+			}
+		}
+
+		stopRenewing := renewIdempotencyKey(store, userID, key, storeCtx, zlog)
+
+		// A handler that panics never finishes the request, so the key is released for it to be retried before the
+		// panic carries on to the recovery middleware.
+		defer func() {
+			if r := recover(); r != nil {
+				stopRenewing()
+				release()
+				panic(r)
+			}
+		}()
+
+		c.Next()
+		stopRenewing()
+
+		// Server errors are not remembered so that the client can safely retry them.
+		if recorder.Status() >= http.StatusInternalServerError {
+			release()
+			return
+		}
+
+		ctx, cancel := storeCtx()
+		defer cancel()
+
+		if err := store.CompleteIdempotencyKey(ctx, userID, key, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			zlog.Error("failed to store idempotent response", zap.String("userID", userID), zap.Error(err))
+		}
+	}
+}
+
+// renewIdempotencyKey keeps a reserved key held for the request running under it, renewing its lease every third of
+// idempotencyLease, until the returned function is called.
+func renewIdempotencyKey(store services.IdempotencyStore, userID, key string, storeCtx func() (context.Context, context.CancelFunc), zlog *zap.Logger) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(idempotencyLease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := storeCtx()
+				if err := store.RenewIdempotencyKey(ctx, userID, key, time.Now().Add(idempotencyLease)); err != nil {
+					zlog.Warn("failed to renew idempotency key", zap.String("userID", userID), zap.Error(err))
+				}
+				cancel()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// requestFingerprint identifies a request by its method, target and body so that key reuse can be detected.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,32 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// LogNotifier writes reminders to the service log, which is handy for local development.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) Notify(_ context.Context, reminder types.Reminder) error {
+	fields := []zap.Field{
+		zap.String("noteId", reminder.NoteId),
+		zap.String("userId", reminder.UserId),
+		zap.String("title", reminder.Title),
+		zap.Time("remindAt", reminder.RemindAt),
+	}
+	if reminder.DueAt != nil {
+		fields = append(fields, zap.Time("dueAt", *reminder.DueAt))
+	}
+
+	n.logger.Info("reminder", fields...)
+	return nil
+}
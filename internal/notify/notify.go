@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"go.uber.org/zap"
+)
+
+// New returns the notifier selected by cfg.ReminderNotifier.
+func New(cfg config.Config, logger *zap.Logger) (services.Notifier, error) {
+	switch cfg.ReminderNotifier {
+	case "log":
+		return NewLogNotifier(logger), nil
+	case "webhook":
+		if cfg.ReminderWebhookURL == "" {
+			return nil, fmt.Errorf("REMINDER_WEBHOOK_URL must be set to use the webhook notifier")
+		}
+		return NewWebhookNotifier(cfg.ReminderWebhookURL, &http.Client{Timeout: 10 * time.Second}), nil
+	case "smtp":
+		return NewSMTPNotifier(cfg.ReminderSMTPAddr, cfg.ReminderSMTPFrom, cfg.ReminderEmailDomain), nil
+	default:
+		return nil, fmt.Errorf("unsupported reminder notifier %q", cfg.ReminderNotifier)
+	}
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// smtpTimeout bounds a whole conversation with the mail server when the context does not end sooner.
+const smtpTimeout = 30 * time.Second
+
+// SMTPNotifier emails reminders through an unauthenticated SMTP server, such as a local MailHog or Mailpit instance.
+// Users have no email address on record, so mail is addressed to <userId>@domain.
+type SMTPNotifier struct {
+	addr   string
+	from   string
+	domain string
+}
+
+func NewSMTPNotifier(addr, from, domain string) *SMTPNotifier {
+	return &SMTPNotifier{addr: addr, from: from, domain: domain}
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, reminder types.Reminder) error {
+	to := fmt.Sprintf("%s@%s", reminder.UserId, n.domain)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", n.from)
+	fmt.Fprintf(&body, "To: %s\r\n", to)
+	fmt.Fprintf(&body, "Subject: Reminder: %s\r\n", headerSafe(reminder.Title))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=UTF-8\r\n")
+	fmt.Fprintf(&body, "\r\n")
+	fmt.Fprintf(&body, "This is your reminder for %q.\r\n", reminder.Title)
+	if reminder.DueAt != nil {
+		fmt.Fprintf(&body, "It is due at %s.\r\n", reminder.DueAt.Format(time.RFC1123))
+	}
+
+	if err := n.send(ctx, to, body.String()); err != nil {
+		return fmt.Errorf("unable to send reminder email: %w", err)
+	}
+	return nil
+}
+
+// send does what smtp.SendMail does without authentication, but gives up once ctx is done or smtpTimeout has passed
+// instead of waiting on an unresponsive server forever.
+func (n *SMTPNotifier) send(ctx context.Context, to, msg string) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	// Closing the connection unblocks any read or write in progress when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, _ := net.SplitHostPort(n.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// headerSafe stops a note title from injecting extra mail headers.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+// WebhookNotifier POSTs each reminder as JSON to a fixed URL. Any non-2xx response counts as a failed delivery.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+type reminderPayload struct {
+	NoteId     string     `json:"noteId"`
+	UserId     string     `json:"userId"`
+	Title      string     `json:"title"`
+	RemindAt   time.Time  `json:"remindAt"`
+	DueAt      *time.Time `json:"dueAt,omitempty"`
+	Recurrence string     `json:"recurrence,omitempty"`
+}
+
+func NewWebhookNotifier(url string, client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: client}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder types.Reminder) error {
+	body, err := json.Marshal(reminderPayload{
+		NoteId:     reminder.NoteId,
+		UserId:     reminder.UserId,
+		Title:      reminder.Title,
+		RemindAt:   reminder.RemindAt,
+		DueAt:      reminder.DueAt,
+		Recurrence: reminder.Recurrence,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode reminder: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call reminder webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("reminder webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package ratelimit counts attempts at something per key, such as a client address, to turn away clients that make
+// too many of them.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to limit attempts per key in each window. Every key starts a new window at the same time, so memory
+// is only held for the keys seen since the current window started. Counts are kept in the memory of this replica.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	started time.Time
+	counts  map[string]int
+}
+
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+		counts: make(map[string]int),
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the limit. When it is not, it also returns how long
+// until the next window starts.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.started) >= l.window {
+		l.started = now
+		clear(l.counts)
+	}
+
+	if l.counts[key] >= l.limit {
+		return false, l.started.Add(l.window).Sub(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
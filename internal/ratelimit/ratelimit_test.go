@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	l := New(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("attempt %d refused, want it allowed", i+1)
+		}
+	}
+	now = now.Add(20 * time.Second)
+	if ok, wait := l.Allow("a"); ok || wait != 40*time.Second {
+		t.Errorf("Allow = %v, %v, want refused for 40s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Error("another key was refused, want it counted on its own")
+	}
+
+	now = now.Add(40 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Error("attempt in the next window refused, want it allowed")
+	}
+	if len(l.counts) != 1 {
+		t.Errorf("%d keys are held, want only the one seen in this window", len(l.counts))
+	}
+}
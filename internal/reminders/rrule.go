@@ -0,0 +1,208 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+const (
+	maxInterval = 1000
+	// maxSteps bounds the search for the next occurrence so that a rule can never keep the scheduler busy.
+	maxSteps = 100000
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Rule is the subset of RFC 5545 recurrence rules supported for reminders: FREQ, INTERVAL, UNTIL, BYDAY for weekly
+// rules and BYMONTHDAY for monthly ones. For example "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH" or
+// "FREQ=MONTHLY;BYMONTHDAY=-1". COUNT is not supported, as reminders only keep their next occurrence and not how many
+// came before it.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	Until    *time.Time
+	ByDay    []time.Weekday
+	// ByMonthDay holds days of the month, counted back from the end of the month when negative.
+	ByMonthDay []int
+}
+
+// ParseRule parses a recurrence rule, with or without a leading "RRULE:".
+func ParseRule(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return Rule{}, fmt.Errorf("%w: empty rule", ErrInvalidRecurrence)
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("%w: malformed part %q", ErrInvalidRecurrence, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			freq := Frequency(strings.ToUpper(value))
+			switch freq {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = freq
+			default:
+				return Rule{}, fmt.Errorf("%w: unsupported frequency %q", ErrInvalidRecurrence, value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > maxInterval {
+				return Rule{}, fmt.Errorf("%w: interval must be between 1 and %d", ErrInvalidRecurrence, maxInterval)
+			}
+			rule.Interval = interval
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(value), ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return Rule{}, fmt.Errorf("%w: unsupported day %q", ErrInvalidRecurrence, day)
+				}
+				if !slices.Contains(rule.ByDay, weekday) {
+					rule.ByDay = append(rule.ByDay, weekday)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return Rule{}, fmt.Errorf("%w: unsupported day of the month %q", ErrInvalidRecurrence, day)
+				}
+				if !slices.Contains(rule.ByMonthDay, monthDay) {
+					rule.ByMonthDay = append(rule.ByMonthDay, monthDay)
+				}
+			}
+		default:
+			return Rule{}, fmt.Errorf("%w: unsupported part %q", ErrInvalidRecurrence, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return Rule{}, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != Weekly {
+		return Rule{}, fmt.Errorf("%w: BYDAY is only supported for weekly rules", ErrInvalidRecurrence)
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != Monthly {
+		return Rule{}, fmt.Errorf("%w: BYMONTHDAY is only supported for monthly rules", ErrInvalidRecurrence)
+	}
+
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole of that day.
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			return until, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must look like 20250131 or 20250131T090000Z", ErrInvalidRecurrence)
+}
+
+// Next returns the first occurrence of the series starting at start that falls strictly after the given time. The
+// start itself is the first occurrence unless BYDAY or BYMONTHDAY leaves its day out. It returns false once the series
+// has ended. Occurrences keep the wall clock time of start in its location, across daylight saving time changes.
+func (r Rule) Next(start, after time.Time) (time.Time, bool) {
+	for step := 0; step < maxSteps; step++ {
+		candidate, ok := r.occurrence(start, step)
+		if !ok {
+			continue
+		}
+		if r.Until != nil && candidate.After(*r.Until) {
+			return time.Time{}, false
+		}
+		if candidate.After(after) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// occurrence returns the candidate for the given step of the series, and false if that step does not produce an
+// occurrence (a day not listed in BYDAY or BYMONTHDAY, or a month without the day of the month the series started on).
+func (r Rule) occurrence(start time.Time, step int) (time.Time, bool) {
+	switch r.Freq {
+	case Daily:
+		return start.AddDate(0, 0, step*r.Interval), true
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return start.AddDate(0, 0, 7*step*r.Interval), true
+		}
+		// With BYDAY every day is a step; only the listed days of every Interval-th week (starting on Monday) count.
+		day := start.AddDate(0, 0, step)
+		weeks := int(weekStart(day).Sub(weekStart(start)).Hours()/24+0.5) / 7
+		return day, weeks%r.Interval == 0 && slices.Contains(r.ByDay, day.Weekday())
+	case Monthly:
+		if len(r.ByMonthDay) > 0 {
+			// As with BYDAY, every day is a step; only the listed days of every Interval-th month count.
+			day := start.AddDate(0, 0, step)
+			months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+			return day, months%r.Interval == 0 && r.matchesMonthDay(day)
+		}
+		candidate := time.Date(start.Year(), start.Month()+time.Month(step*r.Interval), start.Day(),
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		return candidate, candidate.Day() == start.Day()
+	case Yearly:
+		candidate := time.Date(start.Year()+step*r.Interval, start.Month(), start.Day(),
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		return candidate, candidate.Month() == start.Month()
+	}
+	return time.Time{}, false
+}
+
+// matchesMonthDay reports whether t falls on one of the days in ByMonthDay. Days a month does not have, such as the
+// 31st of April, are skipped rather than moved.
+func (r Rule) matchesMonthDay(t time.Time) bool {
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	for _, monthDay := range r.ByMonthDay {
+		if monthDay < 0 {
+			monthDay += daysInMonth + 1
+		}
+		if monthDay == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
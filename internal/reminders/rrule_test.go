@@ -0,0 +1,133 @@
+package reminders
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("RRULE:freq=weekly;interval=2;byday=mo,TH,MO")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	want := Rule{Freq: Weekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Thursday}}
+	if !reflect.DeepEqual(rule, want) {
+		t.Errorf("ParseRule = %+v, want %+v", rule, want)
+	}
+
+	rule, err = ParseRule("FREQ=MONTHLY;BYMONTHDAY=-1,15;UNTIL=20250131")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	until := time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC)
+	if !reflect.DeepEqual(rule.ByMonthDay, []int{-1, 15}) || rule.Until == nil || !rule.Until.Equal(until) {
+		t.Errorf("ParseRule = %+v, want BYMONTHDAY -1,15 until the end of 31 January", rule)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"RRULE:",
+		"FREQ",
+		"FREQ=",
+		"FREQ=DAILY;",
+		"FREQ=HOURLY",
+		"INTERVAL=2",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=1001",
+		"FREQ=DAILY;INTERVAL=two",
+		"FREQ=DAILY;COUNT=5",
+		"FREQ=DAILY;UNTIL=2025-01-31",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=MO,XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=MONTHLY;BYMONTHDAY=-32",
+		"FREQ=MONTHLY;BYMONTHDAY=last",
+	} {
+		if _, err := ParseRule(invalid); !errors.Is(err, ErrInvalidRecurrence) {
+			t.Errorf("ParseRule(%q): %v, want ErrInvalidRecurrence", invalid, err)
+		}
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		loc   *time.Location
+		start string
+		after string
+		// want is empty when the series has ended.
+		want string
+	}{
+		{"start is the first occurrence", "FREQ=DAILY", time.UTC, "2025-01-01T09:00:00", "2024-12-01T00:00:00", "2025-01-01T09:00:00"},
+		{"daily", "FREQ=DAILY", time.UTC, "2025-01-01T09:00:00", "2025-01-01T09:00:00", "2025-01-02T09:00:00"},
+		{"daily long after the start", "FREQ=DAILY;INTERVAL=3", time.UTC, "2025-01-01T09:00:00", "2025-01-05T12:00:00", "2025-01-07T09:00:00"},
+		{"weekly", "FREQ=WEEKLY", time.UTC, "2025-03-03T09:00:00", "2025-03-03T09:00:00", "2025-03-10T09:00:00"},
+		{"weekly by day", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", time.UTC, "2025-03-03T09:00:00", "2025-03-03T09:00:00", "2025-03-06T09:00:00"},
+		{"weekly by day skips the odd week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", time.UTC, "2025-03-03T09:00:00", "2025-03-06T09:00:00", "2025-03-17T09:00:00"},
+		{"start not in BYDAY", "FREQ=WEEKLY;BYDAY=MO", time.UTC, "2025-03-05T09:00:00", "2025-03-01T00:00:00", "2025-03-10T09:00:00"},
+		{"monthly skips months without the day", "FREQ=MONTHLY", time.UTC, "2025-01-31T09:00:00", "2025-01-31T09:00:00", "2025-03-31T09:00:00"},
+		{"BYMONTHDAY=31", "FREQ=MONTHLY;BYMONTHDAY=31", time.UTC, "2025-01-31T09:00:00", "2025-03-31T09:00:00", "2025-05-31T09:00:00"},
+		{"BYMONTHDAY=31 every other month", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31", time.UTC, "2025-02-28T09:00:00", "2025-02-28T09:00:00", "2025-08-31T09:00:00"},
+		{"last day of February", "FREQ=MONTHLY;BYMONTHDAY=-1", time.UTC, "2025-01-31T09:00:00", "2025-01-31T09:00:00", "2025-02-28T09:00:00"},
+		{"last day in a leap year", "FREQ=MONTHLY;BYMONTHDAY=-1", time.UTC, "2024-01-31T09:00:00", "2024-01-31T09:00:00", "2024-02-29T09:00:00"},
+		{"last day after February", "FREQ=MONTHLY;BYMONTHDAY=-1", time.UTC, "2025-01-31T09:00:00", "2025-02-28T09:00:00", "2025-03-31T09:00:00"},
+		{"several days of the month", "FREQ=MONTHLY;BYMONTHDAY=1,15", time.UTC, "2025-01-15T09:00:00", "2025-01-15T09:00:00", "2025-02-01T09:00:00"},
+		{"yearly on 29 February", "FREQ=YEARLY", time.UTC, "2024-02-29T09:00:00", "2024-02-29T09:00:00", "2028-02-29T09:00:00"},
+		{"daily into summer time", "FREQ=DAILY", berlin, "2025-03-29T09:00:00", "2025-03-29T09:00:00", "2025-03-30T09:00:00"},
+		{"daily into winter time", "FREQ=DAILY", berlin, "2025-10-25T09:00:00", "2025-10-25T09:00:00", "2025-10-26T09:00:00"},
+		{"weekly by day into winter time", "FREQ=WEEKLY;BYDAY=SA,SU", berlin, "2025-10-25T09:00:00", "2025-10-25T09:00:00", "2025-10-26T09:00:00"},
+		{"weekly by day across the week of the change", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", berlin, "2025-03-24T09:00:00", "2025-03-24T09:00:00", "2025-04-07T09:00:00"},
+		{"monthly by day into summer time", "FREQ=MONTHLY;BYMONTHDAY=-1", berlin, "2025-02-28T09:00:00", "2025-02-28T09:00:00", "2025-03-31T09:00:00"},
+		{"last occurrence before a date-only UNTIL", "FREQ=DAILY;UNTIL=20250103", time.UTC, "2025-01-01T09:00:00", "2025-01-02T09:00:00", "2025-01-03T09:00:00"},
+		{"ended by a date-only UNTIL", "FREQ=DAILY;UNTIL=20250103", time.UTC, "2025-01-01T09:00:00", "2025-01-03T09:00:00", ""},
+		{"occurrence at UNTIL", "FREQ=DAILY;UNTIL=20250103T090000Z", time.UTC, "2025-01-01T09:00:00", "2025-01-02T09:00:00", "2025-01-03T09:00:00"},
+		{"ended just before UNTIL", "FREQ=DAILY;UNTIL=20250103T085959Z", time.UTC, "2025-01-01T09:00:00", "2025-01-02T09:00:00", ""},
+		{"UNTIL before the start", "FREQ=WEEKLY;UNTIL=20241231", time.UTC, "2025-01-01T09:00:00", "2024-01-01T00:00:00", ""},
+		{"no 31st before UNTIL", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=31;UNTIL=20250731", time.UTC, "2025-04-01T09:00:00", "2025-04-01T09:00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRule(%q): %v", tt.rule, err)
+			}
+			start := parseLocal(t, tt.start, tt.loc)
+			next, ok := rule.Next(start, parseLocal(t, tt.after, tt.loc))
+
+			if tt.want == "" {
+				if ok {
+					t.Errorf("Next = %v, want the series to have ended", next)
+				}
+				return
+			}
+			want := parseLocal(t, tt.want, tt.loc)
+			if !ok || !next.Equal(want) {
+				t.Errorf("Next = %v, %v, want %v", next, ok, want)
+			}
+			if next.Location() != tt.loc {
+				t.Errorf("Next is in %v, want %v", next.Location(), tt.loc)
+			}
+		})
+	}
+}
+
+func parseLocal(t *testing.T, s string, loc *time.Location) time.Time {
+	t.Helper()
+	parsed, err := time.ParseInLocation("2006-01-02T15:04:05", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
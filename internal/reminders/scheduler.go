@@ -0,0 +1,90 @@
+package reminders
+
+import (
+	"context"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+const batchSize = 100
+
+// Scheduler periodically fires due reminders through a Notifier. Several replicas can each run a Scheduler: the store
+// makes sure each reminder is only handed to one of them.
+type Scheduler struct {
+	store    services.ReminderStore
+	notifier services.Notifier
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+func NewScheduler(store services.ReminderStore, notifier services.Notifier, interval time.Duration, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		notifier: notifier,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run fires reminders every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	// Keep going while full batches come back, so that a backlog is worked through without waiting for the next tick.
+	for {
+		fired, err := s.store.ProcessDueReminders(ctx, time.Now(), batchSize, s.fire)
+		if err != nil {
+			if ctx.Err() == nil {
+				metrics.CountReminderErrorsTotal.WithLabelValues("process").Inc()
+				s.logger.Error("unable to process due reminders", zap.Error(err))
+			}
+			return
+		}
+		if fired < batchSize {
+			return
+		}
+	}
+}
+
+// fire delivers a reminder and works out when a recurring reminder should fire next.
+func (s *Scheduler) fire(ctx context.Context, reminder types.Reminder) (*time.Time, error) {
+	if err := s.notifier.Notify(ctx, reminder); err != nil {
+		metrics.CountReminderErrorsTotal.WithLabelValues("notify").Inc()
+		return nil, err
+	}
+	metrics.CountRemindersFiredTotal.Inc()
+
+	if reminder.Recurrence == "" {
+		return nil, nil
+	}
+
+	rule, err := ParseRule(reminder.Recurrence)
+	if err != nil {
+		// Rules are validated when they are saved, so this only happens if the stored rule was edited by hand.
+		s.logger.Warn("ignoring invalid recurrence rule", zap.String("noteId", reminder.NoteId), zap.Error(err))
+		return nil, nil
+	}
+
+	next, ok := rule.Next(reminder.RemindAt, time.Now())
+	if !ok {
+		return nil, nil
+	}
+	return &next, nil
+}
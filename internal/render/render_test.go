@@ -0,0 +1,103 @@
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/RogueAlmond70/code-review-challenge/types"
+)
+
+func TestHTMLMarkdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "script",
+			content: "before\n\n<script>alert(1)</script>\n\nafter",
+			want:    []string{"<p>before</p>", "<p>after</p>"},
+			notWant: []string{"<script", "alert(1)"},
+		},
+		{
+			name:    "javascript link",
+			content: "[click](javascript:alert(1)) and <a href=\"javascript:alert(2)\">raw</a>",
+			want:    []string{"click", "raw"},
+			notWant: []string{"javascript:", "href"},
+		},
+		{
+			name:    "event handler",
+			content: `<img src="https://example.com/a.png" onerror="alert(1)">`,
+			want:    []string{`<img src="https://example.com/a.png"`},
+			notWant: []string{"onerror", "alert(1)"},
+		},
+		{
+			name:    "raw HTML",
+			content: "<details><summary>More</summary><b>bold</b> and <u>underlined</u></details>",
+			want:    []string{"<details>", "<summary>More</summary>", "<b>bold</b>", "<u>underlined</u>"},
+		},
+		{
+			name:    "style and iframe",
+			content: "<style>p{color:red}</style>\n\n<iframe src=\"https://example.com\"></iframe>\n\n<p style=\"color:red\">text</p>",
+			want:    []string{"<p>text</p>"},
+			notWant: []string{"<style", "color:red", "<iframe"},
+		},
+		{
+			name:    "task list",
+			content: "- [x] done\n- [ ] todo",
+			want:    []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`, "done", "todo"},
+		},
+		{
+			name:    "other inputs",
+			content: `<input type="text" value="x"> <input type="checkbox" onclick="alert(1)">`,
+			want:    []string{`<input type="checkbox"`},
+			notWant: []string{`type="text"`, "onclick"},
+		},
+		{
+			name:    "language class",
+			content: "```go\nfmt.Println(\"<hi>\")\n```",
+			want:    []string{`<code class="language-go">`, "&lt;hi&gt;"},
+		},
+		{
+			name:    "other classes",
+			content: `<code class="evil">x</code> <span class="language-go">y</span> <code class="language-go x">z</code>`,
+			want:    []string{"<code>x</code>", "<span>y</span>", "<code>z</code>"},
+			notWant: []string{"class="},
+		},
+		{
+			name:    "GFM",
+			content: "| a | b |\n|---|---|\n| 1 | 2 |\n\n~~gone~~ https://example.com",
+			want:    []string{"<table>", "<td>1</td>", "<del>gone</del>", `<a href="https://example.com" rel="nofollow">`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HTML(tt.content, types.NoteFormatMarkdown)
+			if err != nil {
+				t.Fatalf("HTML: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("HTML = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("HTML = %q, want it not to contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLPlain(t *testing.T) {
+	got, err := HTML("first <b>line</b>\r\nsecond & last\n\n\n\n  # not a heading  \n\n", types.NoteFormatPlain)
+	if err != nil {
+		t.Fatalf("HTML: %v", err)
+	}
+	want := "<p>first &lt;b&gt;line&lt;/b&gt;<br>\nsecond &amp; last</p>\n<p># not a heading</p>\n"
+	if got != want {
+		t.Errorf("HTML = %q, want %q", got, want)
+	}
+}
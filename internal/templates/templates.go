@@ -0,0 +1,62 @@
+package templates
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Built-in variables are filled in without being supplied, although a supplied value takes precedence.
+const (
+	VarDate = "date"
+	VarTime = "time"
+	VarUser = "user"
+)
+
+// placeholderPattern matches {{name}}, allowing spaces inside the braces.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][\w.-]*)\s*\}\}`)
+
+// Variables returns the distinct placeholders used in texts, in the order they first appear.
+func Variables(texts ...string) []string {
+	variables := []string{}
+	for _, text := range texts {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !slices.Contains(variables, match[1]) {
+				variables = append(variables, match[1])
+			}
+		}
+	}
+	return variables
+}
+
+// Builtins returns the values of the built-in variables for a note created by username at now.
+func Builtins(username string, now time.Time) map[string]string {
+	return map[string]string{
+		VarDate: now.Format(time.DateOnly),
+		VarTime: now.Format("15:04"),
+		VarUser: username,
+	}
+}
+
+// Missing returns the placeholders used in texts that have no value.
+func Missing(values map[string]string, texts ...string) []string {
+	var missing []string
+	for _, variable := range Variables(texts...) {
+		if _, ok := values[variable]; !ok {
+			missing = append(missing, variable)
+		}
+	}
+	return missing
+}
+
+// Expand replaces the placeholders in text with their values. Placeholders without a value are left as they are.
+func Expand(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := strings.TrimSpace(placeholder[2 : len(placeholder)-2])
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
@@ -0,0 +1,135 @@
+package thumbnails
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	gpsInfoTag = 0x8825
+	// maxJPEGMetadata is how much of the start of a JPEG file is searched for its EXIF data, which comes before the
+	// image data in a segment of at most 64KB.
+	maxJPEGMetadata = 1 << 20
+)
+
+// exifTypeSizes is the size in bytes of a single value of each TIFF field type.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// StripJPEGLocation blanks out the GPS information in the EXIF data of a JPEG image, in place, so that the file keeps
+// its size and the rest of its metadata, orientation included. It reports whether anything was removed.
+func StripJPEGLocation(data []byte) bool {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return false
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return false
+		}
+		marker := data[i+1]
+		// Start of scan: the metadata segments all come before the image data.
+		if marker == 0xDA || marker == 0xD9 {
+			return false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return false
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:end], []byte("Exif\x00\x00")) {
+			return stripGPS(data[i+10 : end])
+		}
+		i = end
+	}
+	return false
+}
+
+// StripJPEGFileLocation does what StripJPEGLocation does for a JPEG file, rewriting only the start of it.
+func StripJPEGFileLocation(file interface {
+	io.ReaderAt
+	io.WriterAt
+}) (bool, error) {
+	head := make([]byte, maxJPEGMetadata)
+	n, err := file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	head = head[:n]
+	if !StripJPEGLocation(head) {
+		return false, nil
+	}
+	if _, err := file.WriteAt(head, 0); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// stripGPS zeroes the values of every entry in the GPS directory of a TIFF structure.
+func stripGPS(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	gps, ok := findTag(tiff, order, order.Uint32(tiff[4:]), gpsInfoTag)
+	if !ok {
+		return false
+	}
+
+	count, entries, ok := directory(tiff, order, gps)
+	if !ok {
+		return false
+	}
+	for n := 0; n < count; n++ {
+		entry := entries[n*12 : n*12+12]
+		size := uint64(exifTypeSizes[order.Uint16(entry[2:])]) * uint64(order.Uint32(entry[4:]))
+		if size <= 4 {
+			clear(entry[8:12])
+			continue
+		}
+		offset := uint64(order.Uint32(entry[8:]))
+		if offset+size <= uint64(len(tiff)) {
+			clear(tiff[offset : offset+size])
+		}
+		clear(entry[8:12])
+	}
+	return count > 0
+}
+
+// findTag returns the value of a LONG tag in the directory at offset.
+func findTag(tiff []byte, order binary.ByteOrder, offset uint32, tag uint16) (uint32, bool) {
+	count, entries, ok := directory(tiff, order, offset)
+	if !ok {
+		return 0, false
+	}
+	for n := 0; n < count; n++ {
+		entry := entries[n*12 : n*12+12]
+		if order.Uint16(entry) == tag {
+			return order.Uint32(entry[8:]), true
+		}
+	}
+	return 0, false
+}
+
+// directory returns the number of entries of the directory at offset and the bytes holding them.
+func directory(tiff []byte, order binary.ByteOrder, offset uint32) (int, []byte, bool) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0, nil, false
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	start := uint64(offset) + 2
+	if start+uint64(count)*12 > uint64(len(tiff)) {
+		return 0, nil, false
+	}
+	return count, tiff[start : start+uint64(count)*12], true
+}
@@ -0,0 +1,211 @@
+package thumbnails
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Offsets within the TIFF structure built by exifTIFF.
+const (
+	gpsOffset      = 26
+	latitudeOffset = 56
+)
+
+// exifTIFF builds a TIFF structure whose first directory points at a GPS directory with the latitude reference,
+// stored in its entry, and the latitude, stored after the directory.
+func exifTIFF(order binary.ByteOrder) []byte {
+	tiff := make([]byte, latitudeOffset+24)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+
+	entry := func(at int, tag, kind uint16, count, value uint32) {
+		order.PutUint16(tiff[at:], tag)
+		order.PutUint16(tiff[at+2:], kind)
+		order.PutUint32(tiff[at+4:], count)
+		order.PutUint32(tiff[at+8:], value)
+	}
+
+	order.PutUint16(tiff[8:], 1)
+	entry(10, gpsInfoTag, 4, 1, gpsOffset)
+
+	order.PutUint16(tiff[gpsOffset:], 2)
+	entry(gpsOffset+2, 1, 2, 2, 0)
+	copy(tiff[gpsOffset+10:], "N\x00")
+	entry(gpsOffset+14, 2, 5, 3, latitudeOffset)
+	for i := range 24 {
+		tiff[latitudeOffset+i] = byte(i + 1)
+	}
+	return tiff
+}
+
+// jpegWithEXIF wraps tiff in an APP1 segment of a JPEG file, after a JFIF segment and before the image data.
+func jpegWithEXIF(tiff []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write([]byte{0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0x00})
+
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	b.Write([]byte{0xFF, 0xE1})
+	binary.Write(&b, binary.BigEndian, uint16(len(app1)+2))
+	b.Write(app1)
+
+	b.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9})
+	return b.Bytes()
+}
+
+// tiffStart is where exifTIFF starts in the file made by jpegWithEXIF.
+const tiffStart = 2 + 9 + 4 + 6
+
+func TestStripJPEGLocation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			data := jpegWithEXIF(exifTIFF(order))
+			size := len(data)
+
+			if !StripJPEGLocation(data) {
+				t.Fatal("StripJPEGLocation = false, want the location removed")
+			}
+			if len(data) != size {
+				t.Errorf("size is %d, want %d", len(data), size)
+			}
+
+			tiff := data[tiffStart:]
+			if got := order.Uint32(tiff[18:]); got != gpsOffset {
+				t.Errorf("GPS directory pointer is %d, want it kept", got)
+			}
+			if got := tiff[gpsOffset+10 : gpsOffset+14]; !bytes.Equal(got, make([]byte, 4)) {
+				t.Errorf("latitude reference is %q, want it cleared", got)
+			}
+			if got := order.Uint32(tiff[gpsOffset+22:]); got != 0 {
+				t.Errorf("latitude offset is %d, want it cleared", got)
+			}
+			if got := tiff[latitudeOffset : latitudeOffset+24]; !bytes.Equal(got, make([]byte, 24)) {
+				t.Errorf("latitude is %v, want it cleared", got)
+			}
+			if !bytes.HasSuffix(data, []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}) {
+				t.Error("image data was changed")
+			}
+		})
+	}
+}
+
+func TestStripJPEGLocationLeavesOtherFilesAlone(t *testing.T) {
+	noGPS := exifTIFF(binary.BigEndian)
+	binary.BigEndian.PutUint16(noGPS[10:], 0x0112)
+
+	badIFD := exifTIFF(binary.LittleEndian)
+	binary.LittleEndian.PutUint32(badIFD[4:], 1<<31)
+
+	badGPS := exifTIFF(binary.LittleEndian)
+	binary.LittleEndian.PutUint32(badGPS[18:], uint32(len(badGPS)-4))
+
+	manyEntries := exifTIFF(binary.BigEndian)
+	binary.BigEndian.PutUint16(manyEntries[gpsOffset:], 0xFFFF)
+
+	badOrder := exifTIFF(binary.BigEndian)
+	copy(badOrder, "XX")
+
+	afterScan := jpegWithEXIF(exifTIFF(binary.BigEndian))
+	afterScan = append(append([]byte{0xFF, 0xD8}, afterScan[len(afterScan)-8:]...), afterScan[2:len(afterScan)-8]...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n....")},
+		{"no EXIF", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x07, 'J', 'F', 'I', 'F', 0x00, 0xFF, 0xD9}},
+		{"no GPS directory", jpegWithEXIF(noGPS)},
+		{"first directory out of range", jpegWithEXIF(badIFD)},
+		{"GPS directory out of range", jpegWithEXIF(badGPS)},
+		{"GPS entries out of range", jpegWithEXIF(manyEntries)},
+		{"unknown byte order", jpegWithEXIF(badOrder)},
+		{"EXIF after the image data", afterScan},
+		{"short TIFF header", jpegWithEXIF([]byte("MM\x00"))},
+		{"segment shorter than its header", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01, 0xFF, 0xD9}},
+		{"missing marker", append([]byte{0xFF, 0xD8, 0x00}, jpegWithEXIF(exifTIFF(binary.BigEndian))[2:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Clone(tt.data)
+			if StripJPEGLocation(data) {
+				t.Error("StripJPEGLocation = true, want nothing removed")
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Error("data was changed")
+			}
+		})
+	}
+}
+
+func TestStripJPEGLocationTruncated(t *testing.T) {
+	full := jpegWithEXIF(exifTIFF(binary.LittleEndian))
+	segmentEnd := len(full) - 8
+
+	// Cut anywhere before the end of the EXIF segment, nothing is removed. Cut after it, the image data is missing
+	// but the location is still found.
+	for n := range len(full) {
+		data := bytes.Clone(full[:n])
+		stripped := StripJPEGLocation(data)
+		if want := n >= segmentEnd; stripped != want {
+			t.Errorf("StripJPEGLocation of the first %d bytes = %v, want %v", n, stripped, want)
+		}
+		if !stripped && !bytes.Equal(data, full[:n]) {
+			t.Errorf("first %d bytes were changed", n)
+		}
+	}
+}
+
+func TestStripJPEGLocationValueOutOfRange(t *testing.T) {
+	tiff := exifTIFF(binary.BigEndian)
+	// A latitude said to be stored past the end, and an entry whose size overflows 32 bits.
+	binary.BigEndian.PutUint32(tiff[gpsOffset+22:], uint32(len(tiff)-8))
+	binary.BigEndian.PutUint32(tiff[gpsOffset+6:], 1<<31)
+	binary.BigEndian.PutUint16(tiff[gpsOffset+4:], 12)
+	data := jpegWithEXIF(tiff)
+
+	if !StripJPEGLocation(data) {
+		t.Fatal("StripJPEGLocation = false, want the entries cleared")
+	}
+	if got := data[tiffStart+latitudeOffset : tiffStart+latitudeOffset+24]; bytes.Equal(got, make([]byte, 24)) {
+		t.Error("bytes the entries do not point at were cleared")
+	}
+	if got := binary.BigEndian.Uint32(data[tiffStart+gpsOffset+22:]); got != 0 {
+		t.Errorf("latitude offset is %d, want it cleared", got)
+	}
+}
+
+func TestStripJPEGFileLocation(t *testing.T) {
+	data := jpegWithEXIF(exifTIFF(binary.LittleEndian))
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stripped, err := StripJPEGFileLocation(file)
+	if err != nil || !stripped {
+		t.Fatalf("StripJPEGFileLocation = %v, %v, want the location removed", stripped, err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	StripJPEGLocation(data)
+	if !bytes.Equal(got, data) {
+		t.Error("file differs from the image with its location removed in memory")
+	}
+}
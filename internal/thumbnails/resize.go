@@ -0,0 +1,105 @@
+package thumbnails
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// maxPixels bounds the images that are decoded, so that a small file claiming huge dimensions cannot exhaust memory.
+const maxPixels = 50_000_000
+
+var ErrTooLarge = errors.New("image is too large to process")
+
+// Make decodes an image and scales it down to fit within size by size pixels. JPEG images stay JPEG; PNG and GIF
+// images, whose first frame is used, become PNG to keep their transparency. It returns the encoded thumbnail, its
+// content type and the dimensions of the original image.
+func Make(data []byte, contentType string, size int) ([]byte, string, int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("unable to read image header: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, "", 0, 0, ErrTooLarge
+	}
+
+	var src image.Image
+	switch contentType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	default:
+		return nil, "", 0, 0, fmt.Errorf("unsupported image type %q", contentType)
+	}
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("unable to decode image: %w", err)
+	}
+
+	thumb := scaleDown(src, size)
+
+	var buf bytes.Buffer
+	outType := "image/png"
+	if contentType == "image/jpeg" {
+		outType = "image/jpeg"
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, "", 0, 0, fmt.Errorf("unable to encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), outType, config.Width, config.Height, nil
+}
+
+// scaleDown shrinks src to fit within size by size pixels, keeping its aspect ratio, by averaging the source pixels
+// each thumbnail pixel covers. Images that already fit are copied as they are.
+func scaleDown(src image.Image, size int) *image.NRGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+(y+1)*h/th
+		y1 = max(y1, y0+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+(x+1)*w/tw
+			x1 = max(x1, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
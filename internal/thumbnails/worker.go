@@ -0,0 +1,107 @@
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/jobs"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// Worker makes the thumbnails of images uploaded as attachments. It runs the jobs of kind types.JobThumbnail. Unless
+// told to keep it, the location a photo was taken at is removed from the original JPEG file first. Uploads are
+// stripped before they are stored, so this only finds a location in photos uploaded by earlier versions.
+type Worker struct {
+	store         services.ThumbnailStore
+	blobs         services.BlobStore
+	size          int
+	stripLocation bool
+	logger        *zap.Logger
+}
+
+func NewWorker(store services.ThumbnailStore, blobs services.BlobStore, size int, stripLocation bool, logger *zap.Logger) *Worker {
+	return &Worker{
+		store:         store,
+		blobs:         blobs,
+		size:          size,
+		stripLocation: stripLocation,
+		logger:        logger,
+	}
+}
+
+// Run makes the thumbnail of the image a job was queued for. The image is marked as failed once the job has run out of
+// attempts, so that clients stop waiting for its thumbnail.
+func (w *Worker) Run(ctx context.Context, job types.Job, _ jobs.Progress) error {
+	var payload struct {
+		AttachmentId string `json:"attachmentId"`
+	}
+	if err := jobs.DecodePayload(job, &payload); err != nil {
+		return err
+	}
+
+	attachment, err := w.store.GetThumbnailSource(ctx, payload.AttachmentId)
+	if errors.Is(err, datastore.ErrAttachmentNotFound) {
+		// Deleted before its turn came.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	thumbnail, err := w.process(ctx, attachment)
+	if err == nil {
+		err = w.store.RecordThumbnail(ctx, attachment.ID, thumbnail)
+	}
+	if err != nil && ctx.Err() == nil && job.Attempts >= job.MaxAttempts {
+		if err := w.store.FailThumbnail(ctx, attachment.ID); err != nil {
+			w.logger.Error("unable to record failed thumbnail", zap.String("attachmentId", attachment.ID), zap.Error(err))
+		}
+	}
+	return err
+}
+
+func (w *Worker) process(ctx context.Context, attachment types.Attachment) (types.Thumbnail, error) {
+	data, err := w.read(ctx, attachment.StorageKey)
+	if err != nil {
+		return types.Thumbnail{}, err
+	}
+
+	if w.stripLocation && attachment.ContentType == "image/jpeg" && StripJPEGLocation(data) {
+		if err := w.blobs.Put(ctx, attachment.StorageKey, bytes.NewReader(data), int64(len(data)), attachment.ContentType); err != nil {
+			return types.Thumbnail{}, fmt.Errorf("unable to store image without location: %w", err)
+		}
+		w.logger.Info("removed location from image", zap.String("attachmentId", attachment.ID))
+	}
+
+	thumb, contentType, width, height, err := Make(data, attachment.ContentType, w.size)
+	if err != nil {
+		return types.Thumbnail{}, err
+	}
+
+	key := attachment.StorageKey + ".thumb"
+	if err := w.blobs.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), contentType); err != nil {
+		return types.Thumbnail{}, fmt.Errorf("unable to store thumbnail: %w", err)
+	}
+
+	return types.Thumbnail{Key: key, ContentType: contentType, Width: width, Height: height}, nil
+}
+
+func (w *Worker) read(ctx context.Context, key string) ([]byte, error) {
+	blob, err := w.blobs.Open(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open image: %w", err)
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read image: %w", err)
+	}
+	return data, nil
+}
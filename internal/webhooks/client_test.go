@@ -0,0 +1,262 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+const testSecret = "whsec_test"
+
+// fakeWebhookStore hands out a single delivery and records the attempts made at it.
+type fakeWebhookStore struct {
+	services.WebhookStore
+	target types.WebhookTarget
+
+	mu       sync.Mutex
+	attempts []types.DeliveryAttempt
+}
+
+func (s *fakeWebhookStore) GetWebhookTarget(_ context.Context, deliveryId string) (types.WebhookTarget, error) {
+	if deliveryId != s.target.Delivery.ID {
+		return types.WebhookTarget{}, errors.New("unknown delivery")
+	}
+	return s.target, nil
+}
+
+func (s *fakeWebhookStore) RecordDeliveryAttempt(_ context.Context, _ string, attempt types.DeliveryAttempt, _ int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, attempt)
+	return false, nil
+}
+
+// receiver is a webhook endpoint that verifies the signature of every delivery and answers with the next of its
+// statuses, repeating the last one.
+type receiver struct {
+	t        *testing.T
+	statuses []int
+
+	mu         sync.Mutex
+	deliveries []payload
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	if err := Verify(testSecret, req.Header.Get(SignatureHeader), body, time.Now(), time.Minute); err != nil {
+		r.t.Errorf("delivery %d: %v", len(r.deliveries)+1, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if got := req.Header.Get("X-Notes-Event"); got != "note.updated" {
+		r.t.Errorf("X-Notes-Event = %q, want note.updated", got)
+	}
+
+	var p payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		r.t.Errorf("invalid payload: %v", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, p)
+	status := r.statuses[min(len(r.deliveries), len(r.statuses))-1]
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
+}
+
+func newTarget(url string) types.WebhookTarget {
+	return types.WebhookTarget{
+		Delivery: types.WebhookDelivery{
+			ID:        "7",
+			WebhookId: "3",
+			Event:     "note.updated",
+			Payload:   json.RawMessage(`{"id":"42","title":"Groceries"}`),
+			CreatedAt: time.Now(),
+		},
+		URL:    url,
+		Secret: testSecret,
+		Active: true,
+	}
+}
+
+func deliveryJob(attempt, maxAttempts int) types.Job {
+	return types.Job{
+		Kind:        types.JobWebhookDelivery,
+		Payload:     json.RawMessage(`{"deliveryId":"7"}`),
+		Attempts:    attempt,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+func TestDelivererSignsAndRetries(t *testing.T) {
+	recv := &receiver{t: t, statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusNoContent}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	store := &fakeWebhookStore{target: newTarget(server.URL)}
+	deliverer := NewDeliverer(store, NewClient(5*time.Second, true), 10, zap.NewNop())
+
+	// The job queue runs the job again for as long as it returns an error.
+	for attempt := 1; attempt <= 3; attempt++ {
+		err := deliverer.Run(context.Background(), deliveryJob(attempt, 5), nil)
+		if attempt < 3 && err == nil {
+			t.Fatalf("attempt %d: Run succeeded against a failing receiver", attempt)
+		}
+		if attempt == 3 && err != nil {
+			t.Fatalf("attempt %d: Run: %v", attempt, err)
+		}
+	}
+
+	if len(recv.deliveries) != 3 {
+		t.Fatalf("receiver got %d deliveries, want 3", len(recv.deliveries))
+	}
+	for _, p := range recv.deliveries {
+		if p.ID != "7" || p.Event != "note.updated" || string(p.Note) != `{"id":"42","title":"Groceries"}` {
+			t.Errorf("payload = %+v", p)
+		}
+	}
+
+	want := []types.DeliveryAttempt{
+		{ResponseStatus: http.StatusInternalServerError, Error: "webhook responded with status 500"},
+		{ResponseStatus: http.StatusBadGateway, Error: "webhook responded with status 502"},
+		{ResponseStatus: http.StatusNoContent, Succeeded: true},
+	}
+	if len(store.attempts) != len(want) {
+		t.Fatalf("recorded %d attempts, want %d", len(store.attempts), len(want))
+	}
+	for i, got := range store.attempts {
+		if got.Succeeded != want[i].Succeeded || got.Final || got.ResponseStatus != want[i].ResponseStatus || got.Error != want[i].Error {
+			t.Errorf("attempt %d = %+v, want %+v", i+1, got, want[i])
+		}
+	}
+}
+
+func TestDelivererLastAttemptIsFinal(t *testing.T) {
+	recv := &receiver{t: t, statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	store := &fakeWebhookStore{target: newTarget(server.URL)}
+	deliverer := NewDeliverer(store, NewClient(5*time.Second, true), 10, zap.NewNop())
+
+	if err := deliverer.Run(context.Background(), deliveryJob(3, 3), nil); err == nil {
+		t.Fatal("Run succeeded against a failing receiver")
+	}
+	if len(store.attempts) != 1 || !store.attempts[0].Final {
+		t.Errorf("attempts = %+v, want one final attempt", store.attempts)
+	}
+}
+
+func TestDelivererSkipsDisabledWebhook(t *testing.T) {
+	recv := &receiver{t: t, statuses: []int{http.StatusOK}}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	target := newTarget(server.URL)
+	target.Active = false
+	store := &fakeWebhookStore{target: target}
+	deliverer := NewDeliverer(store, NewClient(5*time.Second, true), 10, zap.NewNop())
+
+	if err := deliverer.Run(context.Background(), deliveryJob(1, 5), nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(recv.deliveries) != 0 {
+		t.Errorf("disabled webhook received %d deliveries", len(recv.deliveries))
+	}
+	if len(store.attempts) != 1 || !store.attempts[0].Final {
+		t.Errorf("attempts = %+v, want one final attempt", store.attempts)
+	}
+}
+
+func TestClientBlocksPrivateAddresses(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	for _, url := range []string{server.URL, "http://localhost:" + port} {
+		resp, err := NewClient(5*time.Second, false).Post(url, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("POST %s: %v, want ErrPrivateAddress", url, err)
+		}
+	}
+	if hits != 0 {
+		t.Errorf("%d requests reached a loopback receiver", hits)
+	}
+
+	resp, err := NewClient(5*time.Second, true).Get("http://" + server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("with private addresses allowed: %v", err)
+	}
+	resp.Body.Close()
+	if hits != 1 {
+		t.Errorf("receiver got %d requests with private addresses allowed, want 1", hits)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hook" {
+			t.Errorf("redirect to %s was followed", r.URL.Path)
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := NewClient(5*time.Second, true).Post(server.URL+"/hook", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want the 302 itself", resp.StatusCode)
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.10", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(net.ParseIP(tt.ip)); got != tt.public {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.ip, got, tt.public)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/config/metrics"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/jobs"
+	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
+	"go.uber.org/zap"
+)
+
+// maxResponseBody is how much of the response of a webhook is kept in the delivery log.
+const maxResponseBody = 1024
+
+// Deliverer sends events to webhooks. It runs the jobs of kind types.JobWebhookDelivery, so failed deliveries are
+// retried with the backoff of the job queue. A webhook is disabled once disableAfter attempts in a row have failed.
+type Deliverer struct {
+	store        services.WebhookStore
+	client       *http.Client
+	disableAfter int
+	logger       *zap.Logger
+}
+
+func NewDeliverer(store services.WebhookStore, client *http.Client, disableAfter int, logger *zap.Logger) *Deliverer {
+	return &Deliverer{
+		store:        store,
+		client:       client,
+		disableAfter: disableAfter,
+		logger:       logger,
+	}
+}
+
+// payload is the body POSTed to webhooks.
+type payload struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Note      json.RawMessage `json:"note"`
+}
+
+func (d *Deliverer) Run(ctx context.Context, job types.Job, _ jobs.Progress) error {
+	var p struct {
+		DeliveryId string `json:"deliveryId"`
+	}
+	if err := jobs.DecodePayload(job, &p); err != nil {
+		return err
+	}
+
+	target, err := d.store.GetWebhookTarget(ctx, p.DeliveryId)
+	if errors.Is(err, datastore.ErrDeliveryNotFound) {
+		// The webhook was deleted along with its deliveries.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !target.Active {
+		_, err := d.store.RecordDeliveryAttempt(ctx, p.DeliveryId, types.DeliveryAttempt{Final: true, Error: "webhook is disabled"}, d.disableAfter)
+		return err
+	}
+
+	attempt := d.send(ctx, target)
+	if ctx.Err() != nil {
+		// Cancelled or shutting down rather than failed: the attempt is made again.
+		return ctx.Err()
+	}
+	attempt.Final = !attempt.Succeeded && job.Attempts >= job.MaxAttempts
+
+	if attempt.Succeeded {
+		metrics.CountWebhookDeliveriesTotal.WithLabelValues("succeeded").Inc()
+	} else {
+		metrics.CountWebhookDeliveriesTotal.WithLabelValues("failed").Inc()
+	}
+
+	disabled, err := d.store.RecordDeliveryAttempt(ctx, p.DeliveryId, attempt, d.disableAfter)
+	if err != nil {
+		return err
+	}
+	if attempt.Succeeded || disabled {
+		return nil
+	}
+	return fmt.Errorf("webhook delivery failed: %s", attempt.Error)
+}
+
+// send makes one attempt at a delivery. Any response other than 2xx is a failure.
+func (d *Deliverer) send(ctx context.Context, target types.WebhookTarget) types.DeliveryAttempt {
+	body, err := json.Marshal(payload{
+		ID:        target.Delivery.ID,
+		Event:     target.Delivery.Event,
+		CreatedAt: target.Delivery.CreatedAt.UTC(),
+		Note:      target.Delivery.Payload,
+	})
+	if err != nil {
+		return types.DeliveryAttempt{Error: fmt.Sprintf("unable to encode payload: %v", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return types.DeliveryAttempt{Error: fmt.Sprintf("unable to build request: %v", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notes-service-webhooks")
+	req.Header.Set("X-Notes-Event", target.Delivery.Event)
+	req.Header.Set("X-Notes-Delivery", target.Delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(target.Secret, time.Now(), body))
+
+	started := time.Now()
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return types.DeliveryAttempt{Error: err.Error(), Duration: time.Since(started)}
+	}
+	defer resp.Body.Close()
+
+	response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	attempt := types.DeliveryAttempt{
+		Succeeded:      resp.StatusCode >= 200 && resp.StatusCode <= 299,
+		ResponseStatus: resp.StatusCode,
+		ResponseBody:   string(bytes.ToValidUTF8(response, nil)),
+		Duration:       time.Since(started),
+	}
+	if !attempt.Succeeded {
+		attempt.Error = fmt.Sprintf("webhook responded with status %d", resp.StatusCode)
+	}
+	return attempt
+}
@@ -1,34 +1,268 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/RogueAlmond70/code-review-challenge/endpoints"
+	"github.com/RogueAlmond70/code-review-challenge/internal/blob"
+	"github.com/RogueAlmond70/code-review-challenge/internal/cache"
+	"github.com/RogueAlmond70/code-review-challenge/internal/collab"
+	"github.com/RogueAlmond70/code-review-challenge/internal/config"
+	"github.com/RogueAlmond70/code-review-challenge/internal/datastore"
+	"github.com/RogueAlmond70/code-review-challenge/internal/events"
+	"github.com/RogueAlmond70/code-review-challenge/internal/imports"
+	"github.com/RogueAlmond70/code-review-challenge/internal/jobs"
 	"github.com/RogueAlmond70/code-review-challenge/internal/middleware"
+	"github.com/RogueAlmond70/code-review-challenge/internal/notify"
+	"github.com/RogueAlmond70/code-review-challenge/internal/reminders"
+	"github.com/RogueAlmond70/code-review-challenge/internal/thumbnails"
+	"github.com/RogueAlmond70/code-review-challenge/internal/webhooks"
 	"github.com/RogueAlmond70/code-review-challenge/services"
+	"github.com/RogueAlmond70/code-review-challenge/types"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 func main() {
-	router := gin.Default()
-
-	router.Use(middleware.BasicAuth())
-
-	db, err := services.OpenDB()
+	logger, err := zap.NewProduction()
 	if err != nil {
-		fmt.Println("Unable to open database")
+		fmt.Println("Unable to create logger")
 		fmt.Println(err)
 		return
 	}
+	defer logger.Sync()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Error("unable to load config", zap.Error(err))
+		return
+	}
+
+	// db is only set with the postgres driver, which is the only one keeping everything beyond notes themselves.
+	var db *datastore.Postgres
+	var store services.DBClient
+	var userStore services.UserStore
+	switch cfg.StorageDriver {
+	case "postgres":
+		sqlDB, err := datastore.ConnectDBWithRetry(*cfg, *logger)
+		if err != nil {
+			logger.Error("unable to open database", zap.Error(err))
+			return
+		}
+		defer sqlDB.Close()
+
+		db = datastore.NewPostgres(logger, sqlDB, *cfg)
+		if err := db.ApplyTitlePolicy(context.Background()); err != nil {
+			logger.Error("unable to apply title policy", zap.Error(err))
+			return
+		}
+		store, userStore = db, services.NewUserStore(sqlDB)
+	case "sqlite":
+		sqlDB, err := datastore.OpenSQLite(context.Background(), *cfg)
+		if err != nil {
+			logger.Error("unable to open database", zap.Error(err))
+			return
+		}
+		defer sqlDB.Close()
+
+		lite := datastore.NewSQLite(logger, sqlDB, *cfg)
+		if err := lite.ApplyTitlePolicy(context.Background()); err != nil {
+			logger.Error("unable to apply title policy", zap.Error(err))
+			return
+		}
+		store, userStore = lite, services.NewSQLiteUserStore(sqlDB)
+	case "memory":
+		store, userStore = datastore.NewMemory(*cfg), services.NewMemoryUserStore()
+	default:
+		logger.Error("unsupported storage driver", zap.String("driver", cfg.StorageDriver))
+		return
+	}
+
+	// Notes are read through the cache unless it is turned off. Other stores go to the database directly.
+	notes := store
+	if cfg.NoteCache {
+		values, err := cache.New(*cfg)
+		if err != nil {
+			logger.Error("unable to create cache", zap.Error(err))
+			return
+		}
+		noteCache := cache.NewNoteCache(store, values, cfg.NoteCacheTTL, logger)
+		notes = noteCache
+
+		// Postgres is also changed by background workers and through other stores, so it tells the cache itself.
+		if db != nil {
+			db.SetNoteInvalidator(noteCache)
+		}
+	}
+
+	server := endpoints.NewServer(notes, cfg, logger)
+	server.Users = middleware.BasicAuthUsers()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if db != nil {
+		server.Checklists = db
+		server.Reminders = db
+		server.Shares = db
+		server.Links = db
+		server.Workspaces = db
+		server.Comments = db
+		server.References = db
+		server.Templates = db
+		server.Exports = db
+		server.Imports = db
+		server.Attachments = db
+		server.Jobs = db
+		server.Webhooks = db
+		server.NoteEvents = db
+		server.Sync = db
+		server.Revisions = db
+
+		blobs, err := blob.New(*cfg)
+		if err != nil {
+			logger.Error("unable to create blob store", zap.Error(err))
+			return
+		}
+		server.Blobs = blobs
+
+		notifier, err := notify.New(*cfg, logger)
+		if err != nil {
+			logger.Error("unable to create reminder notifier", zap.Error(err))
+			return
+		}
+
+		go reminders.NewScheduler(db, notifier, cfg.ReminderPollInterval, logger).Run(ctx)
+
+		runner := jobs.NewRunner(db, cfg.JobWorkers, cfg.JobPollInterval, cfg.JobLease, cfg.JobRetention, logger)
+		runner.Handle(types.JobBlobDeletion, blob.NewDeletionHandler(blobs))
+		runner.Handle(types.JobThumbnail, thumbnails.NewWorker(db, blobs, cfg.ThumbnailSize, cfg.StripImageLocation, logger))
+		runner.Handle(types.JobImport, imports.NewWorker(db, blobs, logger))
+		runner.Handle(types.JobWebhookDelivery, webhooks.NewDeliverer(db, webhooks.NewClient(cfg.WebhookTimeout, cfg.WebhookAllowPrivate), cfg.WebhookDisableAfter, logger))
+		go runner.Run(ctx)
+
+		broker := events.NewBroker(db, cfg.EventLogRetention, logger)
+		server.Events = broker
+		go broker.Run(ctx)
+
+		hub := collab.NewHub(notes, db, cfg.CollabSaveInterval, logger)
+		server.Collab = hub
+		go hub.Run(ctx)
+	}
+
+	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Error("invalid TRUSTED_PROXIES", zap.Error(err))
+		return
+	}
+
+	// Public share links are the only routes that work without signing in.
+	if db != nil {
+		router.GET("/s/:token", server.ViewSharedNote())
+		router.POST("/s/:token", server.ViewSharedNote())
+	}
+
+	router.Use(middleware.BasicAuth())
 
-	userStore := services.NewUserStore(db)
 	router.POST("/register", endpoints.Register(userStore))
 	router.POST("/login", endpoints.Login(userStore))
 
-	router.GET("/notes", endpoints.GetNotes(db))
-	router.POST("/note", endpoints.CreateNote(db))
-	router.PATCH("/note/:id", endpoints.UpdateNote(db)) // This is incorrectly labelled as a PUT method in the README
-	router.DELETE("/note/:id", endpoints.DeleteNote(db))
+	// Mutating endpoints honour the Idempotency-Key header so that clients can safely retry them. The keys are kept in
+	// postgres, so other storage drivers run every request.
+	idempotent := gin.HandlerFunc(func(c *gin.Context) { c.Next() })
+	idempotentPush := idempotent
+	if db != nil {
+		idempotent = middleware.Idempotency(db, cfg.IdempotencyTTL, endpoints.MaxRequestBody, logger)
+		idempotentPush = middleware.Idempotency(db, cfg.IdempotencyTTL, endpoints.MaxSyncPushBody, logger)
+	}
+
+	router.GET("/notes", server.GetNotes())
+	router.GET("/note/:noteId", server.GetSingleNote())
+	router.POST("/note", idempotent, server.CreateNote())
+	router.PATCH("/note/:noteId", idempotent, server.UpdateNote()) // This is incorrectly labelled as a PUT method in the README
+	router.DELETE("/note/:noteId", idempotent, server.DeleteNote())
+
+	// Everything beyond notes themselves is only kept in postgres.
+	if db != nil {
+		router.GET("/events", server.StreamEvents())
+		router.GET("/sync", server.GetSyncChanges())
+		router.POST("/sync", idempotentPush, server.PushSyncChanges())
+		router.GET("/notes/export", server.ExportNotes())
+		router.POST("/notes/import", server.ImportNotes())
+		router.GET("/imports/:importId", server.GetImport())
+		router.GET("/jobs/:jobId", server.GetJob())
+		router.POST("/jobs/:jobId/cancel", idempotent, server.CancelJob())
+		router.GET("/note/:noteId/edit", server.EditNote())
+		router.GET("/note/:noteId/revisions", server.GetNoteRevisions())
+
+		router.POST("/note/:noteId/convert", idempotent, server.ConvertNote())
+		router.POST("/note/:noteId/items", idempotent, server.AddChecklistItem())
+		router.PUT("/note/:noteId/items", idempotent, server.ReorderChecklistItems())
+		router.PATCH("/note/:noteId/items/:itemId", idempotent, server.UpdateChecklistItem())
+		router.POST("/note/:noteId/items/:itemId/toggle", idempotent, server.ToggleChecklistItem())
+		router.DELETE("/note/:noteId/items/:itemId", idempotent, server.RemoveChecklistItem())
+
+		router.POST("/note/:noteId/reminder/snooze", idempotent, server.SnoozeReminder())
+		router.POST("/note/:noteId/reminder/dismiss", idempotent, server.DismissReminder())
+
+		router.GET("/shared-with-me", server.SharedWithMe())
+		router.GET("/note/:noteId/shares", server.ListShares())
+		router.POST("/note/:noteId/shares", idempotent, server.ShareNote())
+		router.DELETE("/note/:noteId/shares/:userId", idempotent, server.RevokeShare())
+
+		router.GET("/note/:noteId/links", server.ListShareLinks())
+		router.POST("/note/:noteId/links", idempotent, server.CreateShareLink())
+		router.DELETE("/note/:noteId/links/:linkId", idempotent, server.RevokeShareLink())
+
+		router.GET("/note/:noteId/comments", server.GetComments())
+		router.POST("/note/:noteId/comments", idempotent, server.AddComment())
+		router.PATCH("/note/:noteId/comments/:commentId", idempotent, server.UpdateComment())
+		router.DELETE("/note/:noteId/comments/:commentId", idempotent, server.DeleteComment())
+		router.POST("/note/:noteId/comments/:commentId/resolve", idempotent, server.ResolveComment())
+		router.GET("/mentions", server.GetMentions())
+		router.POST("/mentions/:commentId/read", idempotent, server.MarkMentionRead())
+
+		router.GET("/note/:noteId/backlinks", server.GetBacklinks())
+		router.GET("/note/:noteId/outlinks", server.GetOutlinks())
+		router.GET("/broken-links", server.GetBrokenLinks())
+
+		router.GET("/note/:noteId/attachments", server.GetAttachments())
+		router.POST("/note/:noteId/attachments", server.UploadAttachment())
+		router.GET("/note/:noteId/attachments/:attachmentId", server.DownloadAttachment())
+		router.GET("/note/:noteId/attachments/:attachmentId/thumbnail", server.GetThumbnail())
+		router.DELETE("/note/:noteId/attachments/:attachmentId", idempotent, server.DeleteAttachment())
+		router.GET("/storage", server.GetStorageUsage())
+
+		router.GET("/templates", server.GetTemplates())
+		router.POST("/templates", idempotent, server.CreateTemplate())
+		router.GET("/templates/:templateId", server.GetTemplate())
+		router.PATCH("/templates/:templateId", idempotent, server.UpdateTemplate())
+		router.DELETE("/templates/:templateId", idempotent, server.DeleteTemplate())
+
+		router.GET("/webhooks", server.GetWebhooks())
+		router.POST("/webhooks", idempotent, server.CreateWebhook())
+		router.GET("/webhooks/:webhookId", server.GetWebhook())
+		router.PATCH("/webhooks/:webhookId", idempotent, server.UpdateWebhook())
+		router.DELETE("/webhooks/:webhookId", idempotent, server.DeleteWebhook())
+		router.GET("/webhooks/:webhookId/deliveries", server.GetWebhookDeliveries())
+		router.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", idempotent, server.RedeliverWebhook())
+
+		router.GET("/workspaces", server.GetWorkspaces())
+		router.POST("/workspaces", idempotent, server.CreateWorkspace())
+		router.GET("/workspaces/:workspaceId", server.GetWorkspace())
+		router.DELETE("/workspaces/:workspaceId", idempotent, server.DeleteWorkspace())
+		router.GET("/workspaces/:workspaceId/members", server.GetWorkspaceMembers())
+		router.PATCH("/workspaces/:workspaceId/members/:userId", idempotent, server.UpdateMemberRole())
+		router.DELETE("/workspaces/:workspaceId/members/:userId", idempotent, server.RemoveMember())
+		router.POST("/workspaces/:workspaceId/invitations", idempotent, server.InviteToWorkspace())
+		router.GET("/invitations", server.GetInvitations())
+		router.POST("/invitations/:invitationId/accept", idempotent, server.AcceptInvitation())
+		router.POST("/invitations/:invitationId/decline", idempotent, server.DeclineInvitation())
+	}
 
 	router.Run("localhost:8080")
 }
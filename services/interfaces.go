@@ -2,18 +2,20 @@ package services
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/RogueAlmond70/code-review-challenge/internal/models"
 	"github.com/RogueAlmond70/code-review-challenge/types"
+	"github.com/gorilla/websocket"
 )
 
 // Though postgres has been chosen for this implementation, we want the flexibility of using whatever database client
 // best fits our needs. The DBClient interface has been designed with this in mind.
 type DBClient interface {
 	GetSingleNote(ctx context.Context, userId string, noteId string) (types.Note, error)
-	GetNotes(ctx context.Context, userId string, archiveFilter *bool, limit, offset int) ([]types.Note, int, error)
-	CreateNote(ctx context.Context, userId, title, body string) (types.Note, error)
+	GetNotes(ctx context.Context, userId string, filter types.NoteFilter, limit, offset int) ([]types.Note, int, error)
+	CreateNote(ctx context.Context, userId string, note *types.NoteDto) (types.Note, error)
 	UpdateNote(ctx context.Context, userId, noteId string, note *types.NoteDto) (types.Note, error)
 	DeleteNote(ctx context.Context, userId, noteId string) error
 }
@@ -25,7 +27,227 @@ type Cache interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// NoteInvalidator drops what is cached about the notes of users, and about a note and a workspace when their IDs are
+// set, after they were changed without going through the DBClient.
+type NoteInvalidator interface {
+	InvalidateNotes(ctx context.Context, userIds []string, noteId, workspaceId string)
+}
+
+// ChecklistStore manages the structured items of checklist notes.
+type ChecklistStore interface {
+	GetChecklistItems(ctx context.Context, userId, noteId string) ([]types.ChecklistItem, error)
+	AddChecklistItem(ctx context.Context, userId, noteId string, item types.ChecklistItemDto) (types.ChecklistItem, error)
+	UpdateChecklistItem(ctx context.Context, userId, noteId, itemId string, item types.ChecklistItemDto) (types.ChecklistItem, error)
+	ToggleChecklistItem(ctx context.Context, userId, noteId, itemId string) (types.ChecklistItem, error)
+	ReorderChecklistItems(ctx context.Context, userId, noteId string, itemIds []string) ([]types.ChecklistItem, error)
+	RemoveChecklistItem(ctx context.Context, userId, noteId, itemId string) error
+	ConvertNote(ctx context.Context, userId, noteId, kind string) (types.Note, error)
+}
+
+// ReminderStore tracks note reminders. ProcessDueReminders hands every due reminder to fire, which returns the next
+// occurrence for recurring reminders (nil otherwise); reminders for which fire fails stay due and are retried later,
+// waiting longer after each failure.
+type ReminderStore interface {
+	ProcessDueReminders(ctx context.Context, now time.Time, limit int, fire func(context.Context, types.Reminder) (*time.Time, error)) (int, error)
+	SnoozeReminder(ctx context.Context, userId, noteId string, until time.Time) (types.Note, error)
+	DismissReminder(ctx context.Context, userId, noteId string) (types.Note, error)
+}
+
+// Notifier delivers a reminder to the owner of the note, whether by logging it, calling a webhook or sending an email.
+type Notifier interface {
+	Notify(ctx context.Context, reminder types.Reminder) error
+}
+
+// IdempotencyStore keeps the outcome of requests made with an Idempotency-Key so that retried requests can be
+// answered with the original response instead of being executed a second time. A reserved key is held until its lease
+// runs out, which RenewIdempotencyKey pushes back while the request runs.
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(ctx context.Context, record types.IdempotencyRecord) (types.IdempotencyRecord, bool, error)
+	RenewIdempotencyKey(ctx context.Context, userId, key string, lockedUntil time.Time) error
+	CompleteIdempotencyKey(ctx context.Context, userId, key string, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, userId, key string) error
+}
+
+// ShareStore manages who, besides its owner, can see or edit a note. Only the owner can share a note or list its
+// shares; a share can be revoked by the owner or by the user it was granted to.
+type ShareStore interface {
+	ShareNote(ctx context.Context, ownerId, noteId string, grantee types.NoteShare) (types.NoteShare, error)
+	ListNoteShares(ctx context.Context, ownerId, noteId string) ([]types.NoteShare, error)
+	RevokeNoteShare(ctx context.Context, userId, noteId, granteeId string) error
+	GetSharedNotes(ctx context.Context, userId string, limit, offset int) ([]types.Note, int, error)
+}
+
+// LinkStore keeps the public links to notes. Links are looked up by the SHA-256 hash of their token, and
+// ViewShareLink counts a view, failing once the link has expired or run out of views.
+type LinkStore interface {
+	CreateShareLink(ctx context.Context, ownerId, noteId, tokenHash string, link types.ShareLink) (types.ShareLink, error)
+	ListShareLinks(ctx context.Context, ownerId, noteId string) ([]types.ShareLink, error)
+	RevokeShareLink(ctx context.Context, ownerId, noteId, linkId string) error
+	GetShareLink(ctx context.Context, tokenHash string) (types.ShareLink, error)
+	ViewShareLink(ctx context.Context, linkId string, now time.Time) (types.Note, error)
+}
+
+// WorkspaceStore manages workspaces, their members and invitations to join them. Only owners can invite users or
+// change roles, and a workspace always keeps at least one owner.
+type WorkspaceStore interface {
+	CreateWorkspace(ctx context.Context, userId, name string) (types.Workspace, error)
+	GetWorkspaces(ctx context.Context, userId string) ([]types.Workspace, error)
+	GetWorkspace(ctx context.Context, userId, workspaceId string) (types.Workspace, error)
+	DeleteWorkspace(ctx context.Context, userId, workspaceId string) error
+	GetWorkspaceMembers(ctx context.Context, userId, workspaceId string) ([]types.WorkspaceMember, error)
+	InviteToWorkspace(ctx context.Context, userId, workspaceId string, invitation types.WorkspaceInvitation) (types.WorkspaceInvitation, error)
+	GetInvitations(ctx context.Context, userId string) ([]types.WorkspaceInvitation, error)
+	AcceptInvitation(ctx context.Context, userId, invitationId string) (types.WorkspaceMember, error)
+	DeclineInvitation(ctx context.Context, userId, invitationId string) error
+	UpdateMemberRole(ctx context.Context, userId, workspaceId, memberId, role string) (types.WorkspaceMember, error)
+	RemoveMember(ctx context.Context, userId, workspaceId, memberId string) error
+}
+
+// CommentStore keeps the comment threads on notes and the mentions of users in them. Anyone who can see a note can
+// comment on it; mentions are only recorded for users who can see the note too.
+type CommentStore interface {
+	GetComments(ctx context.Context, userId, noteId string) ([]types.Comment, error)
+	AddComment(ctx context.Context, userId, noteId string, comment types.CommentDto, mentions []types.MentionedUser) (types.Comment, error)
+	UpdateComment(ctx context.Context, userId, noteId, commentId, body string, mentions []types.MentionedUser) (types.Comment, error)
+	DeleteComment(ctx context.Context, userId, noteId, commentId string) error
+	ResolveComment(ctx context.Context, userId, noteId, commentId string, resolved bool) (types.Comment, error)
+	GetMentions(ctx context.Context, userId string, unreadOnly bool, limit, offset int) ([]types.Mention, int, error)
+	MarkMentionRead(ctx context.Context, userId, commentId string) error
+}
+
+// ReferenceStore reads the graph of wiki links between notes. The graph itself is kept up to date as notes are
+// written.
+type ReferenceStore interface {
+	GetBacklinks(ctx context.Context, userId, noteId string) ([]types.NoteReference, error)
+	GetOutlinks(ctx context.Context, userId, noteId string) ([]types.NoteReference, error)
+	GetBrokenLinks(ctx context.Context, userId, workspaceId string) ([]types.NoteReference, error)
+}
+
+// ExportStore reads out the notes of a user for an export. ExportNotes hands the notes matched by filter to fn one at
+// a time, in listing order, and stops at the first error fn returns.
+type ExportStore interface {
+	ExportNotes(ctx context.Context, userId string, filter types.NoteFilter, fn func(types.ExportedNote) error) error
+}
+
+// ImportStore keeps track of the imports of notes, each run by a job queued along with it. ImportNote and
+// SkipImportItem record the outcome of each item along with the progress of the import, so that an import retried
+// after a failure carries on where it stopped.
+type ImportStore interface {
+	CreateImport(ctx context.Context, userId string, imp types.Import) (types.Import, error)
+	GetImport(ctx context.Context, userId, importId string) (types.Import, error)
+	GetImportByID(ctx context.Context, importId string) (types.Import, error)
+	SetImportTotal(ctx context.Context, importId string, total int) error
+	ImportNote(ctx context.Context, imp types.Import, name string, note types.ImportedNote) error
+	SkipImportItem(ctx context.Context, importId string, item types.ImportItem) error
+}
+
+// JobStore is the queue of background jobs. ClaimJobs hands out due jobs of the given kinds for the length of lease,
+// which HeartbeatJob extends while a job runs; CompleteJob, RetryJob and FailJob record how it went. These only take
+// effect for the attempt of the job they are given, so that a job claimed again elsewhere after its lease ran out is
+// left to the new attempt.
+type JobStore interface {
+	EnqueueJob(ctx context.Context, job types.JobDto) (types.Job, error)
+	GetJob(ctx context.Context, userId, jobId string) (types.Job, error)
+	CancelJob(ctx context.Context, userId, jobId string) (types.Job, error)
+	ClaimJobs(ctx context.Context, kinds []string, limit int, lease time.Duration) ([]types.Job, error)
+	HeartbeatJob(ctx context.Context, job types.Job, lease time.Duration, progress *types.JobProgress) (bool, error)
+	CompleteJob(ctx context.Context, job types.Job) error
+	RetryJob(ctx context.Context, job types.Job, cause string, runAfter time.Time) error
+	FailJob(ctx context.Context, job types.Job, status, cause string) error
+	CountJobs(ctx context.Context) ([]types.JobCount, error)
+	PruneJobs(ctx context.Context, finishedBefore time.Time) (int64, error)
+}
+
+// WebhookStore keeps the webhooks of each user and the log of deliveries made to them. Deliveries are queued as jobs in
+// the same transaction as the change to the note, and RecordDeliveryAttempt records how each attempt went.
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, userId string, webhook types.Webhook) (types.Webhook, error)
+	GetWebhooks(ctx context.Context, userId string) ([]types.Webhook, error)
+	GetWebhook(ctx context.Context, userId, webhookId string) (types.Webhook, error)
+	UpdateWebhook(ctx context.Context, userId, webhookId string, webhook types.WebhookDto) (types.Webhook, error)
+	DeleteWebhook(ctx context.Context, userId, webhookId string) error
+	GetWebhookDeliveries(ctx context.Context, userId, webhookId string, limit int) ([]types.WebhookDelivery, error)
+	RedeliverWebhook(ctx context.Context, userId, webhookId, deliveryId string) (types.WebhookDelivery, error)
+	GetWebhookTarget(ctx context.Context, deliveryId string) (types.WebhookTarget, error)
+	RecordDeliveryAttempt(ctx context.Context, deliveryId string, attempt types.DeliveryAttempt, disableAfter int) (bool, error)
+}
+
+// NoteEventStore keeps a short log of the changes to notes, for each user who can read them. Events are logged in the
+// same transaction as the change. ListenNoteEvents announces the users with new events as they are committed on any
+// replica; the events themselves are read from the log with GetNoteEvents.
+type NoteEventStore interface {
+	GetNoteEvents(ctx context.Context, userId string, afterId int64, limit int) ([]types.NoteEvent, bool, error)
+	GetLatestNoteEventID(ctx context.Context) (int64, error)
+	PruneNoteEvents(ctx context.Context, createdBefore time.Time) (int64, error)
+	ListenNoteEvents(ctx context.Context, notify func(userId string)) error
+}
+
+// EventBroker wakes the live event streams of a user when new events have been logged for them. The channel is
+// signalled rather than sent the events, which are read from the NoteEventStore.
+type EventBroker interface {
+	Subscribe(userId string) (<-chan struct{}, func())
+}
+
+// SyncStore serves offline clients the changes to their notes since they last synced, page by page, including the
+// notes they can no longer read. Clients push their own changes through the DBClient, with DeleteNoteVersion for
+// deletes so that a note changed since the client saw it is not deleted.
+type SyncStore interface {
+	GetNoteChanges(ctx context.Context, userId string, cursor types.SyncCursor, limit int) (types.NoteChanges, error)
+	DeleteNoteVersion(ctx context.Context, userId, noteId string, version int) error
+}
+
+// RevisionStore keeps the revisions of notes saved by collaborative editing sessions.
+type RevisionStore interface {
+	AddNoteRevision(ctx context.Context, revision types.NoteRevision) error
+	GetNoteRevisions(ctx context.Context, userId, noteId string, limit int) ([]types.NoteRevision, error)
+}
+
+// Collaboration runs the collaborative editing sessions of notes. Serve joins a connection to the session of a note
+// and returns once it has closed.
+type Collaboration interface {
+	Serve(conn *websocket.Conn, noteId, userId string, canEdit bool)
+}
+
+// TemplateStore keeps the note templates of each user.
+type TemplateStore interface {
+	CreateTemplate(ctx context.Context, userId string, template types.TemplateDto) (types.NoteTemplate, error)
+	GetTemplates(ctx context.Context, userId string) ([]types.NoteTemplate, error)
+	GetTemplate(ctx context.Context, userId, templateId string) (types.NoteTemplate, error)
+	UpdateTemplate(ctx context.Context, userId, templateId string, template types.TemplateDto) (types.NoteTemplate, error)
+	DeleteTemplate(ctx context.Context, userId, templateId string) error
+}
+
+// AttachmentStore keeps the records of the files attached to notes, while their contents live in a BlobStore. Once an
+// attachment is deleted, a job is queued to remove its contents.
+type AttachmentStore interface {
+	AddAttachment(ctx context.Context, userId, noteId string, attachment types.Attachment, quota int64) (types.Attachment, error)
+	GetAttachments(ctx context.Context, userId, noteId string) ([]types.Attachment, error)
+	GetAttachment(ctx context.Context, userId, noteId, attachmentId string) (types.Attachment, error)
+	DeleteAttachment(ctx context.Context, userId, noteId, attachmentId string) error
+	GetStorageUsage(ctx context.Context, userId string) (int64, error)
+}
+
+// ThumbnailStore records the thumbnails made for image attachments by the jobs queued as they are uploaded.
+type ThumbnailStore interface {
+	GetThumbnailSource(ctx context.Context, attachmentId string) (types.Attachment, error)
+	RecordThumbnail(ctx context.Context, attachmentId string, thumbnail types.Thumbnail) error
+	FailThumbnail(ctx context.Context, attachmentId string) error
+}
+
+// BlobStore keeps the contents of attachments by key, on the local filesystem or in an S3-compatible bucket.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
 type UserStore interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 }
+
+// UserDirectory finds the users that notes are shared with, workspaces invite and comments mention. The ids it returns
+// are the ones requests of those users are authenticated as. GetUserByUsername returns nil when there is no such user.
+type UserDirectory interface {
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrUsernameTaken = errors.New("username already taken")
+
+// memoryUserStore keeps users in memory, for tests and local development.
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+func NewMemoryUserStore() UserStore {
+	return &memoryUserStore{users: make(map[string]models.User)}
+}
+
+// CreateUser fails with ErrUsernameTaken when the username is in use, as the unique constraint of the users table
+// does.
+func (s *memoryUserStore) CreateUser(_ context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Username]; ok {
+		return ErrUsernameTaken
+	}
+
+	user.UserId = uuid.New().String()
+	s.users[user.Username] = *user
+	return nil
+}
+
+// GetUserByUsername returns nil without an error when there is no such user.
+func (s *memoryUserStore) GetUserByUsername(_ context.Context, username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[username]
+	if !ok {
+		return nil, nil
+	}
+	return &user, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/RogueAlmond70/code-review-challenge/internal/models"
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteUserStore keeps users in the SQLite database the notes are kept in.
+type sqliteUserStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteUserStore(db *sql.DB) UserStore {
+	return &sqliteUserStore{db: db}
+}
+
+// CreateUser fails with ErrUsernameTaken when the username is in use.
+func (s *sqliteUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	query := `
+		INSERT INTO users (user_id, username, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	id := uuid.New().String()
+	_, err := s.db.ExecContext(ctx, query, id, user.Username, user.PasswordHash, user.CreatedAt)
+	if err != nil {
+		var sqliteErr *sqlite.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+			return ErrUsernameTaken
+		}
+		return err
+	}
+
+	user.UserId = id
+	return nil
+}
+
+// GetUserByUsername returns nil without an error when there is no such user.
+func (s *sqliteUserStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := `SELECT user_id, username, password_hash, created_at FROM users WHERE username = $1`
+
+	row := s.db.QueryRowContext(ctx, query, username)
+
+	var user models.User
+	if err := row.Scan(&user.UserId, &user.Username, &user.PasswordHash, &user.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
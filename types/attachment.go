@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+// Attachment is a file uploaded to a note. Its contents live in the blob store under StorageKey.
+type Attachment struct {
+	ID          string    `json:"id"`
+	NoteId      string    `json:"noteId"`
+	UserId      string    `json:"userId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	StorageKey  string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Width and Height are recorded for images once they have been processed, along with the state of their
+	// thumbnail: pending, ready or failed.
+	Width                *int    `json:"width,omitempty"`
+	Height               *int    `json:"height,omitempty"`
+	ThumbnailStatus      *string `json:"thumbnailStatus,omitempty"`
+	ThumbnailKey         *string `json:"-"`
+	ThumbnailContentType *string `json:"-"`
+}
+
+// ThumbnailTypes are the content types of the attachments thumbnails are made for.
+var ThumbnailTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+const (
+	ThumbnailPending = "pending"
+	ThumbnailReady   = "ready"
+	ThumbnailFailed  = "failed"
+)
+
+// Thumbnail is the outcome of processing an image attachment.
+type Thumbnail struct {
+	Key         string
+	ContentType string
+	// Width and Height are the dimensions of the original image.
+	Width  int
+	Height int
+}
+
+// StorageUsage is how many bytes of attachments a user has uploaded, out of their quota.
+type StorageUsage struct {
+	Used  int64 `json:"used"`
+	Quota int64 `json:"quota"`
+}
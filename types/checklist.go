@@ -0,0 +1,28 @@
+package types
+
+type ChecklistItem struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Checked  bool   `json:"checked"`
+	Position int    `json:"position"`
+}
+
+type ChecklistItemDto struct {
+	Text     *string `json:"text"`
+	Checked  *bool   `json:"checked"`
+	Position *int    `json:"position"`
+}
+
+// ChecklistSummary gives the completion state of a checklist note without returning every item.
+type ChecklistSummary struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+type ChecklistOrderDto struct {
+	ItemIds []string `json:"itemIds" binding:"required"`
+}
+
+type ConvertNoteDto struct {
+	Kind string `json:"kind" binding:"required"`
+}
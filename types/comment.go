@@ -0,0 +1,55 @@
+package types
+
+import "time"
+
+// Comment is part of a discussion on a note. Top-level comments start a thread and can be resolved; replies are
+// listed under the comment they answer.
+type Comment struct {
+	ID         string     `json:"id"`
+	NoteId     string     `json:"noteId"`
+	ParentId   *string    `json:"parentId,omitempty"`
+	UserId     string     `json:"userId"`
+	Body       string     `json:"body"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy *string    `json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+	// Mentions are the usernames of the users mentioned in the comment.
+	Mentions []string  `json:"mentions"`
+	Replies  []Comment `json:"replies,omitempty"`
+}
+
+type CommentDto struct {
+	Body     string  `json:"body" binding:"required"`
+	ParentId *string `json:"parentId"`
+}
+
+type ResolveCommentDto struct {
+	Resolved *bool `json:"resolved" binding:"required"`
+}
+
+// Mention tells a user they were mentioned in a comment.
+type Mention struct {
+	CommentId string     `json:"commentId"`
+	NoteId    string     `json:"noteId"`
+	NoteTitle string     `json:"noteTitle"`
+	AuthorId  string     `json:"authorId"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt"`
+}
+
+// MentionedUser is a user resolved from an @username in a comment.
+type MentionedUser struct {
+	UserId   string
+	Username string
+}
+
+type MentionsResponse struct {
+	Mentions      []Mention `json:"mentions"`
+	Offset        int       `json:"offset"`
+	Limit         int       `json:"limit"`
+	TotalMentions int       `json:"totalMentions"`
+	HasMore       bool      `json:"hasMore"`
+}
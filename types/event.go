@@ -0,0 +1,16 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// NoteEvent is a change to a note, as streamed live to the users who can read it. Note is the note as it was after the
+// change, or before it for note.deleted.
+type NoteEvent struct {
+	ID        string          `json:"-"`
+	Event     string          `json:"-"`
+	NoteId    string          `json:"noteId"`
+	Note      json.RawMessage `json:"note"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+// The formats notes can be exported in.
+const (
+	ExportJSONLines = "jsonl"
+	ExportMarkdown  = "markdown"
+	ExportHTML      = "html"
+)
+
+// ExportedNote is a note as written to an export, with its checklist items and when it was created and last changed.
+type ExportedNote struct {
+	Note
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
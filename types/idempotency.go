@@ -0,0 +1,18 @@
+package types
+
+import "time"
+
+// IdempotencyRecord is the stored outcome of a request made with an Idempotency-Key header.
+// A record with a StatusCode of 0 has been reserved but the original request has not finished yet, and is held for it
+// until LockedUntil.
+type IdempotencyRecord struct {
+	UserId      string
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	Body        []byte
+	ContentType string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	LockedUntil time.Time
+}
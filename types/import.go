@@ -0,0 +1,74 @@
+package types
+
+import "time"
+
+// The kinds of file notes can be imported from.
+const (
+	ImportMarkdown = "markdown"
+	ImportKeep     = "keep"
+	ImportEvernote = "enex"
+)
+
+// The status of an import follows the job running it.
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportDone      = "done"
+	ImportFailed    = "failed"
+	ImportCancelled = "cancelled"
+)
+
+// The outcomes reported for the items of an import that did not become notes.
+const (
+	ImportItemSkipped = "skipped"
+	ImportItemFailed  = "failed"
+)
+
+// Import is an uploaded file whose notes are imported in the background, by the job JobId. Its contents live in the
+// blob store under StorageKey until the import finishes.
+type Import struct {
+	ID          string  `json:"id"`
+	JobId       string  `json:"jobId"`
+	UserId      string  `json:"-"`
+	WorkspaceId *string `json:"workspaceId,omitempty"`
+	Source      string  `json:"source"`
+	Filename    string  `json:"filename"`
+	Size        int64   `json:"size"`
+	StorageKey  string  `json:"-"`
+	Status      string  `json:"status"`
+	// Total is the number of items in the file, known once the import has started. Processed counts those dealt with
+	// so far, each of which was either imported, skipped or failed.
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Imported  int `json:"imported"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	// Report lists the items that were skipped or failed, and why.
+	Report     []ImportItem `json:"report"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	FinishedAt *time.Time   `json:"finishedAt,omitempty"`
+}
+
+// ImportItem reports on an item of an import that did not become a note. Name is where the item was found in the
+// uploaded file.
+type ImportItem struct {
+	Name    string `json:"name"`
+	Title   string `json:"title,omitempty"`
+	Outcome string `json:"outcome"`
+	Reason  string `json:"reason"`
+}
+
+// ImportedNote is a note read from an import. Timestamps are kept from the original when it has them.
+type ImportedNote struct {
+	Title     string
+	Content   string
+	Format    string
+	Kind      string
+	Color     string
+	Archived  bool
+	Pinned    bool
+	Items     []ChecklistItem
+	CreatedAt *time.Time
+	UpdatedAt *time.Time
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// The kinds of work done by jobs. The payload of each kind is described next to it.
+const (
+	// JobThumbnail makes the thumbnail of an image attachment: {"attachmentId"}.
+	JobThumbnail = "thumbnail"
+	// JobBlobDeletion removes a blob that is no longer used: {"key"}.
+	JobBlobDeletion = "blob_deletion"
+	// JobImport imports notes from an uploaded file: {"importId"}.
+	JobImport = "import"
+	// JobWebhookDelivery sends an event to a webhook: {"deliveryId"}.
+	JobWebhookDelivery = "webhook_delivery"
+)
+
+// Job is a unit of background work. Attempts counts the times it was started, including the current one while it is
+// running.
+type Job struct {
+	ID              string          `json:"id"`
+	Kind            string          `json:"kind"`
+	UserId          *string         `json:"-"`
+	Payload         json.RawMessage `json:"-"`
+	Status          string          `json:"status"`
+	Progress        *JobProgress    `json:"progress,omitempty"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"maxAttempts"`
+	RunAfter        time.Time       `json:"runAfter"`
+	CancelRequested bool            `json:"cancelRequested"`
+	Error           string          `json:"error,omitempty"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	StartedAt       *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// JobProgress is how far a running job has got, in whatever items the job deals in.
+type JobProgress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// JobDto queues a job. Payload is encoded as JSON. A zero MaxAttempts uses the default of the queue.
+type JobDto struct {
+	Kind        string
+	UserId      string
+	Payload     interface{}
+	MaxAttempts int
+}
+
+// JobCount is the number of jobs of a kind in a status, for monitoring the queue.
+type JobCount struct {
+	Kind   string
+	Status string
+	Count  int
+}
+
+// IsFinished reports whether a job has stopped for good.
+func (j Job) IsFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
@@ -0,0 +1,46 @@
+package types
+
+import "time"
+
+// ShareLink is a public, read-only link to a note that works without an account. The token of the link is only ever
+// shown once, as part of URL, when the link is created.
+type ShareLink struct {
+	ID           string     `json:"id"`
+	NoteId       string     `json:"noteId"`
+	UserId       string     `json:"-"`
+	URL          string     `json:"url,omitempty"`
+	HasPassword  bool       `json:"hasPassword"`
+	PasswordHash string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxViews     *int       `json:"maxViews"`
+	ViewCount    int        `json:"viewCount"`
+	LastViewedAt *time.Time `json:"lastViewedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// ShareLinkDto describes a link to create. It expires either after a duration such as "72h" (ExpiresIn) or at a
+// given time (ExpiresAt), or never if neither is set.
+type ShareLinkDto struct {
+	ExpiresIn string     `json:"expiresIn"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Password  string     `json:"password"`
+	MaxViews  *int       `json:"maxViews"`
+}
+
+// Usable reports whether the link can still be viewed at now.
+func (l ShareLink) Usable(now time.Time) bool {
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return false
+	}
+	return l.MaxViews == nil || l.ViewCount < *l.MaxViews
+}
+
+// SharedNote is what a public link shows of a note: its text, but not how its owner organises or schedules it.
+type SharedNote struct {
+	ID      string          `json:"id"`
+	Title   string          `json:"title"`
+	Content string          `json:"content"`
+	Format  string          `json:"format"`
+	Kind    string          `json:"kind"`
+	Items   []ChecklistItem `json:"items,omitempty"`
+}
@@ -1,17 +1,90 @@
 package types
 
+import (
+	"slices"
+	"time"
+)
+
+// NoteColors is the palette of colour labels a note can be given. An unlabelled note uses DefaultNoteColor.
+var NoteColors = []string{
+	DefaultNoteColor, "red", "orange", "yellow", "green", "teal", "blue", "purple", "pink", "brown", "gray",
+}
+
+const DefaultNoteColor = "default"
+
+// MaxNoteContentLen is the longest content a note can have, in bytes, whether it is written through the API, imported
+// or edited together.
+const MaxNoteContentLen = 10000
+
+// A note is either free text or a checklist whose items are stored separately from the content.
+const (
+	NoteKindText      = "text"
+	NoteKindChecklist = "checklist"
+)
+
+// The content of a note is stored as written, in one of these formats. It is only turned into HTML when rendered.
+const (
+	NoteFormatPlain    = "plain"
+	NoteFormatMarkdown = "markdown"
+)
+
 type Note struct {
 	ID       string `json:"id"`
 	UserId   string `json:"-"`
 	Title    string `json:"title"`
 	Content  string `json:"content"`
 	Archived bool   `json:"archived"`
+	Pinned   bool   `json:"pinned"`
+	Color    string `json:"color"`
+	Kind     string `json:"kind"`
+	Format   string `json:"format"`
+	// Version goes up with every change to the note, for clients to tell whether theirs is still the latest.
+	Version int `json:"version"`
+	// HTML is the rendered content, only set when a single note is requested with render=html.
+	HTML string `json:"html,omitempty"`
+	// RemindAt is the next time a reminder fires for the note. SnoozedUntil postpones it without moving the schedule
+	// a Recurrence rule is based on.
+	RemindAt     *time.Time `json:"remindAt,omitempty"`
+	SnoozedUntil *time.Time `json:"snoozedUntil,omitempty"`
+	DueAt        *time.Time `json:"dueAt,omitempty"`
+	Recurrence   string     `json:"recurrence,omitempty"`
+	// WorkspaceId is set for notes that belong to a workspace instead of a single user.
+	WorkspaceId *string `json:"workspaceId,omitempty"`
+	// Permission is what the requesting user may do with the note: owner, editor or viewer.
+	Permission string `json:"permission,omitempty"`
+	// CommentCount is the number of comments on the note, replies included.
+	CommentCount int `json:"commentCount"`
+	// Checklist summarises the items of a checklist note and Items holds them when a single note is requested.
+	Checklist *ChecklistSummary `json:"checklist,omitempty"`
+	Items     []ChecklistItem   `json:"items,omitempty"`
 }
 
 type NoteDto struct {
 	Title    *string `json:"title"`
 	Content  *string `json:"content"`
 	Archived *bool   `json:"archived"`
+	Pinned   *bool   `json:"pinned"`
+	Color    *string `json:"color"`
+	Kind     *string `json:"kind"`
+	Format   *string `json:"format"`
+	// Reminder fields can be cleared by sending null.
+	RemindAt   Nullable[time.Time] `json:"remindAt"`
+	DueAt      Nullable[time.Time] `json:"dueAt"`
+	Recurrence Nullable[string]    `json:"recurrence"`
+	// WorkspaceId creates the note in a workspace. It comes from the workspace selector rather than the body.
+	WorkspaceId *string `json:"-"`
+	// Version, when set, makes an update fail with a conflict unless the note is still at that version.
+	Version *int `json:"version"`
+}
+
+// NoteFilter narrows down the notes returned when listing. A nil field means the attribute is not filtered on.
+type NoteFilter struct {
+	Archived *bool
+	Pinned   *bool
+	// PinnedFirst lists pinned notes ahead of the others.
+	PinnedFirst bool
+	// WorkspaceId lists the notes of a workspace instead of the personal notes of the user.
+	WorkspaceId string
 }
 
 type NotesResponse struct {
@@ -21,3 +94,8 @@ type NotesResponse struct {
 	Limit      int    `json:"limit"`
 	HasMore    bool   `json:"hasMore"`
 }
+
+// IsValidNoteColor reports whether color is part of the NoteColors palette.
+func IsValidNoteColor(color string) bool {
+	return slices.Contains(NoteColors, color)
+}
@@ -0,0 +1,25 @@
+package types
+
+import "encoding/json"
+
+// Nullable tells apart a JSON field that was left out (Set is false) from one explicitly set to null (Set is true and
+// Value is nil), so that partial updates can clear a value.
+type Nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
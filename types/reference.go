@@ -0,0 +1,12 @@
+package types
+
+// NoteReference is a wiki link, written [[Title]] or [[id]], from one note to another. A link is broken when no note
+// it could point to exists.
+type NoteReference struct {
+	SourceId    string  `json:"sourceId"`
+	SourceTitle string  `json:"sourceTitle"`
+	Target      string  `json:"target"`
+	TargetId    *string `json:"targetId,omitempty"`
+	TargetTitle *string `json:"targetTitle,omitempty"`
+	Broken      bool    `json:"broken"`
+}
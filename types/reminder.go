@@ -0,0 +1,20 @@
+package types
+
+import "time"
+
+// Reminder is a note whose reminder is due to fire.
+type Reminder struct {
+	NoteId       string
+	UserId       string
+	Title        string
+	RemindAt     time.Time
+	SnoozedUntil *time.Time
+	DueAt        *time.Time
+	Recurrence   string
+}
+
+// SnoozeDto postpones a reminder, either for a Duration such as "10m" or until a given time.
+type SnoozeDto struct {
+	Duration string     `json:"duration"`
+	Until    *time.Time `json:"until"`
+}
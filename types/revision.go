@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// NoteRevision is the content of a note as saved by a collaborative editing session, at Version of the note. Editors
+// are the users whose changes it holds.
+type NoteRevision struct {
+	ID        string    `json:"id"`
+	NoteId    string    `json:"noteId"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	Editors   []string  `json:"editors"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package types
+
+import "time"
+
+// The permission a user has on a note. Owners can do anything, editors can change the note and viewers can only
+// read it.
+const (
+	PermissionOwner  = "owner"
+	PermissionEditor = "editor"
+	PermissionViewer = "viewer"
+)
+
+var permissionLevels = map[string]int{
+	PermissionViewer: 1,
+	PermissionEditor: 2,
+	PermissionOwner:  3,
+}
+
+// NoteShare grants a user other than the owner access to a note.
+type NoteShare struct {
+	NoteId     string    `json:"noteId"`
+	UserId     string    `json:"userId"`
+	Username   string    `json:"username"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ShareDto struct {
+	Username   string `json:"username" binding:"required"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+// PermissionAllows reports whether holding permission have is enough for an action requiring need.
+func PermissionAllows(have, need string) bool {
+	return permissionLevels[have] > 0 && permissionLevels[have] >= permissionLevels[need]
+}
@@ -0,0 +1,69 @@
+package types
+
+import "time"
+
+// SyncCursor is where a client is in the changes to its notes. A sync runs in rounds: a round sends, a page at a time
+// in order of note id, every note changed since the end of the previous round, Since. Until is where the round ends and
+// the next one starts, fixed when its first page is read, and AfterId is the last note sent so far.
+type SyncCursor struct {
+	Since   int64
+	Until   int64
+	AfterId int64
+}
+
+// NoteChange is a note that was created or changed, or one that was deleted or that the user can no longer read. The
+// Note of a checklist comes with its Items.
+type NoteChange struct {
+	ID        string     `json:"id"`
+	Deleted   bool       `json:"deleted"`
+	Note      *Note      `json:"note,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// NoteChanges is a page of changes. Token, made from Next, is what the client asks for the next page with, and keeps
+// for its next sync once More is false.
+type NoteChanges struct {
+	Changes []NoteChange `json:"changes"`
+	Token   string       `json:"token"`
+	More    bool         `json:"more"`
+	Next    SyncCursor   `json:"-"`
+}
+
+// What became of a change pushed by a client. A failed change was not applied because of an error on our side, and can
+// be pushed again.
+const (
+	SyncApplied  = "applied"
+	SyncConflict = "conflict"
+	SyncRejected = "rejected"
+	SyncFailed   = "failed"
+)
+
+// NoteChangeDto is a change a client made while offline. A change without an ID creates a note, under a ClientId the
+// client picks to match up the result. Updates and deletes give the Version of the note the client changed.
+type NoteChangeDto struct {
+	ClientId    string   `json:"clientId"`
+	ID          string   `json:"id"`
+	Version     *int     `json:"version"`
+	Deleted     bool     `json:"deleted"`
+	WorkspaceId *string  `json:"workspaceId"`
+	Note        *NoteDto `json:"note"`
+}
+
+type SyncPushDto struct {
+	Changes []NoteChangeDto `json:"changes"`
+}
+
+// NoteChangeResult reports on a pushed change. Note is the note as it is now: the client's change when it was applied,
+// or the one it conflicts with. Deleted is set when the note is gone.
+type NoteChangeResult struct {
+	ClientId string `json:"clientId,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Status   string `json:"status"`
+	Deleted  bool   `json:"deleted,omitempty"`
+	Note     *Note  `json:"note,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type SyncPushResult struct {
+	Results []NoteChangeResult `json:"results"`
+}
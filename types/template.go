@@ -0,0 +1,31 @@
+package types
+
+import "time"
+
+// NoteTemplate is a reusable starting point for notes. Its title and content may contain {{placeholders}} that are
+// filled in when a note is created from it.
+type NoteTemplate struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Format  string `json:"format"`
+	// Variables are the placeholders used in the title and content, built-in ones included.
+	Variables []string   `json:"variables"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+type TemplateDto struct {
+	Name    *string `json:"name"`
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+	Format  *string `json:"format"`
+}
+
+// TemplateNoteDto creates a note from a template. Fields of the note that are set override the ones the template
+// would give it, and Variables supplies the values of its placeholders.
+type TemplateNoteDto struct {
+	NoteDto
+	Variables map[string]string `json:"variables"`
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// The events of notes that webhooks can subscribe to. A note that is archived while other fields change only sends
+// note.archived.
+const (
+	EventNoteCreated  = "note.created"
+	EventNoteUpdated  = "note.updated"
+	EventNoteArchived = "note.archived"
+	EventNoteDeleted  = "note.deleted"
+)
+
+var WebhookEvents = []string{EventNoteCreated, EventNoteUpdated, EventNoteArchived, EventNoteDeleted}
+
+func IsWebhookEvent(event string) bool {
+	return slices.Contains(WebhookEvents, event)
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint called with the events of the notes its user can read. Secret signs the payloads and is only
+// returned when the webhook is created.
+type Webhook struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret,omitempty"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	// Active is cleared once too many deliveries in a row have failed, at DisabledAt.
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           *time.Time `json:"updatedAt,omitempty"`
+}
+
+type WebhookDto struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	// Setting Active enables a disabled webhook again, starting its count of failures afresh.
+	Active *bool `json:"active"`
+}
+
+// WebhookDelivery is an event sent, or being sent, to a webhook, along with the outcome of its latest attempt.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookId      string          `json:"webhookId"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	RedeliveryOf   *string         `json:"redeliveryOf,omitempty"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"responseStatus,omitempty"`
+	ResponseBody   string          `json:"responseBody,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	DurationMs     *int            `json:"durationMs,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	AttemptedAt    *time.Time      `json:"attemptedAt,omitempty"`
+}
+
+// WebhookTarget is a delivery along with the webhook it goes to, as needed to send it.
+type WebhookTarget struct {
+	Delivery WebhookDelivery
+	URL      string
+	Secret   string
+	Active   bool
+}
+
+// DeliveryAttempt is the outcome of an attempt at sending a delivery. Final is set when no more attempts will follow.
+type DeliveryAttempt struct {
+	Succeeded      bool
+	Final          bool
+	ResponseStatus int
+	ResponseBody   string
+	Error          string
+	Duration       time.Duration
+}
@@ -0,0 +1,50 @@
+package types
+
+import "time"
+
+// Workspace is a space shared by a team. Notes in a workspace belong to the workspace rather than to whoever created
+// them, and members reach them with the permission of their role: owner, editor or viewer.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type WorkspaceDto struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceId string    `json:"workspaceId"`
+	UserId      string    `json:"userId"`
+	Username    string    `json:"username,omitempty"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// WorkspaceInvitation asks a user to join a workspace with the given role.
+type WorkspaceInvitation struct {
+	ID            string    `json:"id"`
+	WorkspaceId   string    `json:"workspaceId"`
+	WorkspaceName string    `json:"workspaceName,omitempty"`
+	UserId        string    `json:"userId"`
+	Username      string    `json:"username"`
+	Role          string    `json:"role"`
+	InvitedBy     string    `json:"invitedBy"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+type InvitationDto struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type MemberRoleDto struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// IsValidRole reports whether role is one of the roles a workspace member can have.
+func IsValidRole(role string) bool {
+	return role == PermissionOwner || role == PermissionEditor || role == PermissionViewer
+}